@@ -0,0 +1,112 @@
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+
+	infra "git.eldondev.com/gotrc/pkg/lock"
+)
+
+// benchClient connects to the table named by GOTRC_BENCH_TABLE (default
+// "locks"), at GOTRC_BENCH_ENDPOINT when set, e.g. http://localhost:8000 for
+// DynamoDB Local.
+func benchClient(b *testing.B) (*dynamodb.Client, string) {
+	awsConf, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+	client := dynamodb.NewFromConfig(awsConf, func(o *dynamodb.Options) {
+		if endpoint := os.Getenv("GOTRC_BENCH_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	table := os.Getenv("GOTRC_BENCH_TABLE")
+	if table == "" {
+		table = "locks"
+	}
+	return client, table
+}
+
+// benchContention runs parallel lockers, each attempting and immediately
+// releasing locks chosen by pattern, and reports the share of attempts that
+// acquired.
+func benchContention(b *testing.B, pattern Pattern) {
+	client, table := benchClient(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var attempts, acquired atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		locker := infra.NewLocker(client, ctx, table)
+		defer locker.Close(context.Background())
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for pb.Next() {
+			name := pattern.Next(r)
+			ok, err := locker.AcquireLock(name, 10*time.Second)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			attempts.Add(1)
+			if ok {
+				acquired.Add(1)
+				if err := locker.ReleaseLock(name); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}
+	})
+	b.ReportMetric(float64(acquired.Load())/float64(attempts.Load()), "acquired/op")
+}
+
+func BenchmarkHotLock(b *testing.B) {
+	benchContention(b, HotLock{Prefix: uuid.New().String()})
+}
+
+func BenchmarkZipfianLocks(b *testing.B) {
+	benchContention(b, Zipfian{Prefix: uuid.New().String(), Locks: 1000, S: 1.1})
+}
+
+// BenchmarkLargeHeldSetRefresh measures acquiring while a Locker already holds
+// many locks, which the acquire path and heartbeater have to track.
+func BenchmarkLargeHeldSetRefresh(b *testing.B) {
+	for _, size := range []int{10, 100, 1000, 10000} {
+		b.Run(fmt.Sprintf("held-%d", size), func(b *testing.B) {
+			client, table := benchClient(b)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			locker := infra.NewLocker(client, ctx, table)
+			defer locker.Close(context.Background())
+			prefix := uuid.New().String()
+			for _, name := range HeldSetNames(prefix, size) {
+				if ok, err := locker.AcquireLock(name, time.Minute); !ok || err != nil {
+					b.Fatalf("acquiring held set: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				name := uuid.New().String()
+				if ok, err := locker.AcquireLock(name, time.Minute); !ok || err != nil {
+					b.Fatalf("acquiring: %v", err)
+				}
+				if err := locker.ReleaseLock(name); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	}
+}
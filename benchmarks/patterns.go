@@ -0,0 +1,55 @@
+// Package benchmarks measures Locker acquire and refresh performance under
+// configurable contention patterns, against DynamoDB Local or a real table.
+package benchmarks
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Pattern picks the lock each acquisition attempt targets.
+type Pattern interface {
+	// Next returns the name of the next lock to try.
+	Next(r *rand.Rand) string
+	String() string
+}
+
+// HotLock sends every attempt at a single lock.
+type HotLock struct {
+	Prefix string
+}
+
+func (p HotLock) Next(r *rand.Rand) string {
+	return p.Prefix + "-hot"
+}
+
+func (p HotLock) String() string {
+	return "hot"
+}
+
+// Zipfian spreads attempts over Locks locks with a Zipf distribution, so a few
+// locks are very hot and most are cold. S (> 1) controls the skew.
+type Zipfian struct {
+	Prefix string
+	Locks  uint64
+	S      float64
+}
+
+func (p Zipfian) Next(r *rand.Rand) string {
+	// rand.Zipf is not safe to share between goroutines, but each worker has its own r
+	z := rand.NewZipf(r, p.S, 1, p.Locks-1)
+	return fmt.Sprintf("%s-%d", p.Prefix, z.Uint64())
+}
+
+func (p Zipfian) String() string {
+	return fmt.Sprintf("zipf-%d-s%.1f", p.Locks, p.S)
+}
+
+// HeldSetNames returns the names of a large set of locks to hold at once.
+func HeldSetNames(prefix string, n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-held-%d", prefix, i)
+	}
+	return names
+}
@@ -0,0 +1,25 @@
+package benchmarks
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipfianSkew(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	p := Zipfian{Prefix: "z", Locks: 100, S: 1.5}
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[p.Next(r)]++
+	}
+	assert.LessOrEqual(t, len(counts), 100, "names should stay within the lock count")
+	assert.Greater(t, counts["z-0"], counts["z-50"], "low ranks should be hotter")
+}
+
+func TestHotLock(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	p := HotLock{Prefix: "h"}
+	assert.Equal(t, p.Next(r), p.Next(r), "every attempt should target the same lock")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+
+	infra "git.eldondev.com/gotrc/pkg/lock"
+)
+
+type benchWorker struct {
+	attempts   int
+	acquired   int
+	throttled  int
+	errors     int
+	latencies  []time.Duration
+	successful []time.Duration
+}
+
+// latencySummary reports latency percentiles in milliseconds.
+type latencySummary struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+type benchReport struct {
+	Lockers               int            `json:"lockers"`
+	Locks                 int            `json:"locks"`
+	DurationSeconds       float64        `json:"duration_seconds"`
+	Attempts              int            `json:"attempts"`
+	Acquisitions          int            `json:"acquisitions"`
+	Throttled             int            `json:"throttled"`
+	Errors                int            `json:"errors"`
+	AttemptLatency        latencySummary `json:"attempt_latency"`
+	AcquisitionLatency    latencySummary `json:"acquisition_latency"`
+	Fairness              float64        `json:"fairness"`
+	AcquisitionsPerLocker []int          `json:"acquisitions_per_locker"`
+}
+
+func benchCommand(fs *flag.FlagSet) func(ctx context.Context) int {
+	var tf tableFlags
+	var of outputFlags
+	tf.register(fs)
+	of.register(fs)
+	lockers := fs.Int("lockers", 10, "number of simulated lockers")
+	locks := fs.Int("locks", 1, "number of locks they contend for")
+	duration := fs.Duration("duration", 30*time.Second, "how long to run")
+	lease := fs.Duration("lease", 10*time.Second, "lease duration of each acquisition")
+	hold := fs.Duration("hold", 100*time.Millisecond, "how long a locker holds a lock once acquired")
+	return func(ctx context.Context) int {
+		if !of.valid() {
+			return 2
+		}
+		if *lockers < 1 || *locks < 1 {
+			fmt.Fprintln(os.Stderr, "lockers and locks must be positive")
+			return 2
+		}
+		client, err := tf.client(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		workers := runBench(ctx, client, tf.table, tf.attrs, *lockers, *locks, *duration, *lease, *hold)
+		report := newBenchReport(workers, *locks, *duration)
+		if of.json() {
+			printJSON(report)
+		} else {
+			printBenchReport(report)
+		}
+		return 0
+	}
+}
+
+func runBench(ctx context.Context, client *dynamodb.Client, table string, attrs infra.AttributeNames, lockers, locks int, duration, lease, hold time.Duration) []*benchWorker {
+
+	runId := uuid.New().String()
+	names := make([]string, locks)
+	for i := range names {
+		names[i] = fmt.Sprintf("gotrc-bench-%s-%d", runId, i)
+	}
+	benchCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	workers := make([]*benchWorker, lockers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		w := &benchWorker{}
+		workers[i] = w
+		locker := infra.NewLocker(client, ctx, table, infra.WithAttributeNames(attrs))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer locker.Close(context.Background())
+			w.run(benchCtx, locker, names, lease, hold)
+		}()
+	}
+	wg.Wait()
+	return workers
+}
+
+func (w *benchWorker) run(ctx context.Context, locker *infra.Locker, names []string, lease, hold time.Duration) {
+	for ctx.Err() == nil {
+		name := names[rand.Intn(len(names))]
+		start := time.Now()
+		ok, err := locker.AcquireLock(name, lease)
+		latency := time.Since(start)
+		w.attempts++
+		w.latencies = append(w.latencies, latency)
+		switch {
+		case err != nil && isThrottle(err):
+			w.throttled++
+		case err != nil:
+			w.errors++
+		case ok:
+			w.acquired++
+			w.successful = append(w.successful, latency)
+			select {
+			case <-time.After(hold):
+			case <-ctx.Done():
+			}
+			if err := locker.ReleaseLock(name); err != nil {
+				w.errors++
+			}
+		}
+	}
+}
+
+func isThrottle(err error) bool {
+	var exceeded *dynamodbtypes.ProvisionedThroughputExceededException
+	if errors.As(err, &exceeded) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ThrottlingException", "RequestLimitExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+func newBenchReport(workers []*benchWorker, locks int, duration time.Duration) benchReport {
+	report := benchReport{Lockers: len(workers), Locks: locks, DurationSeconds: duration.Seconds()}
+	var latencies, successful []time.Duration
+	var perLocker []float64
+	for _, w := range workers {
+		report.Attempts += w.attempts
+		report.Acquisitions += w.acquired
+		report.Throttled += w.throttled
+		report.Errors += w.errors
+		report.AcquisitionsPerLocker = append(report.AcquisitionsPerLocker, w.acquired)
+		latencies = append(latencies, w.latencies...)
+		successful = append(successful, w.successful...)
+		perLocker = append(perLocker, float64(w.acquired))
+	}
+	report.AttemptLatency = summarize(latencies)
+	report.AcquisitionLatency = summarize(successful)
+	report.Fairness = jainIndex(perLocker)
+	return report
+}
+
+func summarize(durations []time.Duration) latencySummary {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return latencySummary{
+		P50: ms(percentile(durations, 50)),
+		P90: ms(percentile(durations, 90)),
+		P99: ms(percentile(durations, 99)),
+	}
+}
+
+func printBenchReport(report benchReport) {
+	fmt.Printf("attempts:      %d (%.1f/s)\n", report.Attempts, float64(report.Attempts)/report.DurationSeconds)
+	fmt.Printf("acquisitions:  %d (%.1f/s)\n", report.Acquisitions, float64(report.Acquisitions)/report.DurationSeconds)
+	fmt.Printf("throttled:     %d\n", report.Throttled)
+	fmt.Printf("errors:        %d\n", report.Errors)
+	fmt.Printf("attempt latency     p50 %.1fms  p90 %.1fms  p99 %.1fms\n",
+		report.AttemptLatency.P50, report.AttemptLatency.P90, report.AttemptLatency.P99)
+	fmt.Printf("acquisition latency p50 %.1fms  p90 %.1fms  p99 %.1fms\n",
+		report.AcquisitionLatency.P50, report.AcquisitionLatency.P90, report.AcquisitionLatency.P99)
+	fmt.Printf("fairness (Jain's index, 1 is perfectly fair): %.3f\n", report.Fairness)
+}
+
+// percentile returns the p-th percentile of durations using the nearest-rank method.
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(time.Microsecond)
+}
+
+// jainIndex measures how evenly acquisitions were spread across lockers.
+func jainIndex(values []float64) float64 {
+	var sum, squares float64
+	for _, v := range values {
+		sum += v
+		squares += v * v
+	}
+	if squares == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(values)) * squares)
+}
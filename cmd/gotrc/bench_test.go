@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(durations, 50), "p50 should be the median")
+	assert.Equal(t, 99*time.Millisecond, percentile(durations, 99), "p99 should be nearest rank")
+	assert.Equal(t, time.Duration(0), percentile(nil, 50), "empty input should be zero")
+}
+
+func TestJainIndex(t *testing.T) {
+	assert.InDelta(t, 1.0, jainIndex([]float64{5, 5, 5, 5}), 0.0001, "even spread should be perfectly fair")
+	assert.InDelta(t, 0.25, jainIndex([]float64{20, 0, 0, 0}), 0.0001, "one winner should be maximally unfair")
+}
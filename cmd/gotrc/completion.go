@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a top-level gotrc command, listed for usage and completion.
+type command struct {
+	name    string
+	summary string
+}
+
+var commands = []command{
+	{"lock", "operate on a lock table"},
+	{"completion", "print a shell completion script (bash, zsh or fish)"},
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// flagChoices lists the accepted values of flags that take a fixed set of values.
+var flagChoices = map[string][]string{
+	"output": {outputText, outputJSON},
+}
+
+func completionMain(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: gotrc completion <%s>\n", strings.Join(completionShells, "|"))
+		return 2
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print("autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported shell %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// subcommandFlags returns the flags a subcommand accepts.
+func subcommandFlags(sub subcommand) []*flag.Flag {
+	fs := flag.NewFlagSet(sub.name, flag.ContinueOnError)
+	sub.setup(fs)
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	return flags
+}
+
+func bashCompletion() string {
+	var commandNames, subcommandNames []string
+	for _, c := range commands {
+		commandNames = append(commandNames, c.name)
+	}
+	var b strings.Builder
+	b.WriteString("_gotrc() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    case \"$prev\" in\n")
+	for name, choices := range flagChoices {
+		fmt.Fprintf(&b, "    -%s|--%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return;;\n", name, name, strings.Join(choices, " "))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("    if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\")); return\n", strings.Join(commandNames, " "))
+	b.WriteString("    fi\n")
+	b.WriteString("    case \"${COMP_WORDS[1]}\" in\n")
+	fmt.Fprintf(&b, "    completion) COMPREPLY=($(compgen -W %q -- \"$cur\"));;\n", strings.Join(completionShells, " "))
+	b.WriteString("    lock)\n")
+	b.WriteString("        if [ \"$COMP_CWORD\" -eq 2 ]; then\n")
+	for _, sub := range lockSubcommands {
+		subcommandNames = append(subcommandNames, sub.name)
+	}
+	fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W %q -- \"$cur\")); return\n", strings.Join(subcommandNames, " "))
+	b.WriteString("        fi\n")
+	b.WriteString("        case \"${COMP_WORDS[2]}\" in\n")
+	for _, sub := range lockSubcommands {
+		var names []string
+		for _, f := range subcommandFlags(sub) {
+			names = append(names, "--"+f.Name)
+		}
+		fmt.Fprintf(&b, "        %s) COMPREPLY=($(compgen -W %q -- \"$cur\"));;\n", sub.name, strings.Join(names, " "))
+	}
+	b.WriteString("        esac;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -F _gotrc gotrc\n")
+	return b.String()
+}
+
+func fishCompletion() string {
+	var subcommandNames []string
+	for _, sub := range lockSubcommands {
+		subcommandNames = append(subcommandNames, sub.name)
+	}
+	var b strings.Builder
+	b.WriteString("complete -c gotrc -f\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "complete -c gotrc -n __fish_use_subcommand -a %s -d %q\n", c.name, c.summary)
+	}
+	fmt.Fprintf(&b, "complete -c gotrc -n '__fish_seen_subcommand_from completion' -a %q\n", strings.Join(completionShells, " "))
+	for _, sub := range lockSubcommands {
+		fmt.Fprintf(&b, "complete -c gotrc -n '__fish_seen_subcommand_from lock; and not __fish_seen_subcommand_from %s' -a %s -d %q\n",
+			strings.Join(subcommandNames, " "), sub.name, sub.summary)
+		for _, f := range subcommandFlags(sub) {
+			fmt.Fprintf(&b, "complete -c gotrc -n '__fish_seen_subcommand_from %s' -l %s -d %q", sub.name, f.Name, f.Usage)
+			if choices, ok := flagChoices[f.Name]; ok {
+				fmt.Fprintf(&b, " -xa %q", strings.Join(choices, " "))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
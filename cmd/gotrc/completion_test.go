@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletionCoversSubcommandFlags(t *testing.T) {
+	bash := bashCompletion()
+	fish := fishCompletion()
+	for _, sub := range lockSubcommands {
+		assert.Contains(t, bash, sub.name+")", "bash completion should list %s", sub.name)
+		for _, f := range subcommandFlags(sub) {
+			assert.Contains(t, bash, "--"+f.Name, "bash completion should list --%s", f.Name)
+			assert.Contains(t, fish, "__fish_seen_subcommand_from "+sub.name+"' -l "+f.Name, "fish completion should list --%s", f.Name)
+		}
+	}
+	assert.Contains(t, bash, `"text json"`, "bash completion should offer output formats")
+}
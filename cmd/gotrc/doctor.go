@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+
+	infra "git.eldondev.com/gotrc/pkg/lock"
+)
+
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "fail"
+)
+
+// doctorProbeKey is the lock name used for permission probes. The probes are
+// conditioned so that they can never succeed, and so never modify the table.
+const doctorProbeKey = "gotrc-doctor-probe"
+
+// maxClockSkew is how far the local clock may drift from DynamoDB's before
+// lease expiry comparisons become unreliable.
+const maxClockSkew = 2 * time.Second
+
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+type doctorReport struct {
+	Table  string  `json:"table"`
+	OK     bool    `json:"ok"`
+	Checks []check `json:"checks"`
+}
+
+func doctorCommand(fs *flag.FlagSet) func(ctx context.Context) int {
+	var tf tableFlags
+	var of outputFlags
+	tf.register(fs)
+	of.register(fs)
+	return func(ctx context.Context) int {
+		if !of.valid() {
+			return 2
+		}
+		client, err := tf.client(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		report := doctorReport{Table: tf.table, OK: true, Checks: runDoctor(ctx, client, tf.table, tf.attrs)}
+		for _, c := range report.Checks {
+			report.OK = report.OK && c.Status != statusFail
+		}
+		if of.json() {
+			printJSON(report)
+		} else {
+			for _, c := range report.Checks {
+				fmt.Printf("[%s] %s: %s\n", c.Status, c.Name, c.Detail)
+				if c.Fix != "" {
+					fmt.Printf("       fix: %s\n", c.Fix)
+				}
+			}
+		}
+		if !report.OK {
+			return 1
+		}
+		return 0
+	}
+}
+
+func runDoctor(ctx context.Context, client *dynamodb.Client, table string, attrs infra.AttributeNames) []check {
+	var checks []check
+
+	start := time.Now()
+	described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	latency := time.Since(start)
+	var notFound *dynamodbtypes.ResourceNotFoundException
+	switch {
+	case err == nil, errors.As(err, &notFound):
+		checks = append(checks, check{Name: "connectivity", Status: statusOK, Detail: fmt.Sprintf("DynamoDB answered in %s", latency.Round(time.Millisecond))})
+	case isAccessDenied(err):
+		checks = append(checks, check{Name: "connectivity", Status: statusOK, Detail: "DynamoDB is reachable"})
+	default:
+		return append(checks, check{Name: "connectivity", Status: statusFail, Detail: err.Error(),
+			Fix: "check network access, the configured region and AWS credentials"})
+	}
+
+	holderIndex := false
+	switch {
+	case err == nil:
+		checks = append(checks, checkTable(described.Table, attrs.Key))
+		checks = append(checks, checkIndexes(described.Table, attrs.Owner)...)
+		holderIndex = findIndex(described.Table, infra.HolderIndex) != nil
+		checks = append(checks, checkReplication(described.Table))
+		checks = append(checks, checkClock(described.ResultMetadata))
+	case errors.As(err, &notFound):
+		return append(checks, check{Name: "table", Status: statusFail, Detail: fmt.Sprintf("table %s does not exist", table),
+			Fix: fmt.Sprintf("aws dynamodb create-table --table-name %s --attribute-definitions AttributeName=%s,AttributeType=S "+
+				"--key-schema AttributeName=%s,KeyType=HASH --billing-mode PAY_PER_REQUEST", table, attrs.Key, attrs.Key)})
+	default:
+		checks = append(checks, check{Name: "table", Status: statusFail, Detail: err.Error(),
+			Fix: "grant dynamodb:DescribeTable on the lock table"})
+	}
+
+	checks = append(checks, checkTTL(ctx, client, table, attrs.Expiry))
+	return append(checks, checkPermissions(ctx, client, table, attrs, holderIndex)...)
+}
+
+func checkTable(table *dynamodbtypes.TableDescription, key string) check {
+	c := check{Name: "table"}
+	types := map[string]dynamodbtypes.ScalarAttributeType{}
+	for _, def := range table.AttributeDefinitions {
+		types[aws.ToString(def.AttributeName)] = def.AttributeType
+	}
+	if len(table.KeySchema) != 1 || aws.ToString(table.KeySchema[0].AttributeName) != key ||
+		table.KeySchema[0].KeyType != dynamodbtypes.KeyTypeHash || types[key] != dynamodbtypes.ScalarAttributeTypeS {
+		c.Status = statusFail
+		c.Detail = fmt.Sprintf("key schema must be a single string partition key called %s", key)
+		c.Fix = fmt.Sprintf("recreate the table with --key-schema AttributeName=%s,KeyType=HASH, or pass -key-attribute", key)
+		return c
+	}
+	if table.TableStatus != dynamodbtypes.TableStatusActive {
+		c.Status = statusWarn
+		c.Detail = fmt.Sprintf("table status is %s", table.TableStatus)
+		c.Fix = "wait for the table to become ACTIVE"
+		return c
+	}
+	c.Status = statusOK
+	c.Detail = fmt.Sprintf("%s is ACTIVE with the expected key schema", aws.ToString(table.TableName))
+	return c
+}
+
+// checkIndexes checks for the secondary indexes that Locker.LocksHeldBy, the
+// holders command and Locker.ExpiredLocks query. A Locker works without them,
+// so a missing index is only a warning.
+func checkIndexes(table *dynamodbtypes.TableDescription, owner string) []check {
+	holder := check{Name: "index " + infra.HolderIndex, Status: statusOK, Detail: fmt.Sprintf("%s is keyed on %s", infra.HolderIndex, owner)}
+	if index := findIndex(table, infra.HolderIndex); index == nil {
+		holder.Status = statusWarn
+		holder.Detail = fmt.Sprintf("%s is missing, so Locker.LocksHeldBy and holders -locker can't find a locker's locks", infra.HolderIndex)
+		holder.Fix = "add it with infra.EnsureLockTable"
+	} else if len(index.KeySchema) == 0 || aws.ToString(index.KeySchema[0].AttributeName) != owner {
+		holder.Status = statusFail
+		holder.Detail = fmt.Sprintf("%s is not keyed on %s", infra.HolderIndex, owner)
+		holder.Fix = "recreate the index on the owner attribute, or pass -owner-attribute"
+	}
+	expiry := check{Name: "index " + infra.ExpiryIndex, Status: statusOK, Detail: fmt.Sprintf("%s is present", infra.ExpiryIndex)}
+	if findIndex(table, infra.ExpiryIndex) == nil {
+		expiry.Status = statusWarn
+		expiry.Detail = fmt.Sprintf("%s is missing, so Locker.ExpiredLocks has nothing to query", infra.ExpiryIndex)
+		expiry.Fix = "add it with infra.EnsureLockTable"
+	}
+	return []check{holder, expiry}
+}
+
+func findIndex(table *dynamodbtypes.TableDescription, name string) *dynamodbtypes.GlobalSecondaryIndexDescription {
+	for i, index := range table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == name {
+			return &table.GlobalSecondaryIndexes[i]
+		}
+	}
+	return nil
+}
+
+func checkReplication(table *dynamodbtypes.TableDescription) check {
+	c := check{Name: "replication", Status: statusOK, Detail: "table is not a Global Table"}
+	var regions []string
+	for _, replica := range table.Replicas {
+		regions = append(regions, aws.ToString(replica.RegionName))
+	}
+	if len(regions) > 0 {
+		c.Status = statusWarn
+		c.Detail = fmt.Sprintf("table is a Global Table replicated to %s; writes to the same lock in different regions "+
+			"are resolved last-writer-wins", strings.Join(regions, ", "))
+		c.Fix = "pin every Locker to one home region with infra.WithHomeRegion or infra.NewGlobalTableLocker"
+	}
+	return c
+}
+
+func checkClock(metadata middleware.Metadata) check {
+	c := check{Name: "clock"}
+	serverTime, ok := awsmiddleware.GetServerTime(metadata)
+	if !ok {
+		c.Status = statusWarn
+		c.Detail = "DynamoDB did not report its time"
+		return c
+	}
+	skew := time.Since(serverTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		c.Status = statusFail
+		c.Detail = fmt.Sprintf("local clock differs from DynamoDB by %s", skew.Round(time.Millisecond))
+		c.Fix = "synchronise the host clock (e.g. chrony or systemd-timesyncd); lease expiry relies on it"
+		return c
+	}
+	c.Status = statusOK
+	c.Detail = fmt.Sprintf("local clock is within %s of DynamoDB", maxClockSkew)
+	return c
+}
+
+func checkTTL(ctx context.Context, client *dynamodb.Client, table, attribute string) check {
+	c := check{Name: "ttl"}
+	out, err := client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(table)})
+	if err != nil {
+		c.Status = statusWarn
+		c.Detail = err.Error()
+		c.Fix = "grant dynamodb:DescribeTimeToLive to let doctor inspect TTL"
+		return c
+	}
+	ttl := out.TimeToLiveDescription
+	if ttl == nil || ttl.TimeToLiveStatus != dynamodbtypes.TimeToLiveStatusEnabled {
+		c.Status = statusWarn
+		c.Detail = "TTL is not enabled, so abandoned lock items are never removed"
+		c.Fix = fmt.Sprintf("aws dynamodb update-time-to-live --table-name %s --time-to-live-specification Enabled=true,AttributeName=%s", table, attribute)
+		return c
+	}
+	if aws.ToString(ttl.AttributeName) != attribute {
+		c.Status = statusWarn
+		c.Detail = fmt.Sprintf("TTL uses attribute %s rather than %s", aws.ToString(ttl.AttributeName), attribute)
+		c.Fix = fmt.Sprintf("point TTL at the %s attribute, or pass -expiry-attribute", attribute)
+		return c
+	}
+	c.Status = statusOK
+	c.Detail = fmt.Sprintf("TTL is enabled on %s", attribute)
+	return c
+}
+
+// checkPermissions probes each operation the Locker needs with a request that
+// is conditioned to fail. A conditional check failure proves the caller is
+// allowed to perform the operation without changing anything. Query is probed
+// on HolderIndex when the table has it, as that is where it is used.
+func checkPermissions(ctx context.Context, client *dynamodb.Client, table string, attrs infra.AttributeNames, holderIndex bool) []check {
+	key := map[string]dynamodbtypes.AttributeValue{
+		attrs.Key: &dynamodbtypes.AttributeValueMemberS{Value: doctorProbeKey},
+	}
+	impossible := aws.String("attribute_exists(#owner) and attribute_not_exists(#owner)")
+	names := map[string]string{"#owner": attrs.Owner}
+	values := map[string]dynamodbtypes.AttributeValue{
+		":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: doctorProbeKey},
+	}
+
+	_, getErr := client.GetItem(ctx, &dynamodb.GetItemInput{Key: key, TableName: aws.String(table)})
+	_, updateErr := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       key,
+		UpdateExpression:          aws.String("SET #owner = :lockerId"),
+		ConditionExpression:       impossible,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		TableName:                 aws.String(table),
+	})
+	_, deleteErr := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		Key:                      key,
+		ConditionExpression:      impossible,
+		ExpressionAttributeNames: names,
+		TableName:                aws.String(table),
+	})
+	// Batched renewal updates locks in transactions
+	_, transactErr := client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []dynamodbtypes.TransactWriteItem{{Update: &dynamodbtypes.Update{
+			Key:                       key,
+			UpdateExpression:          aws.String("SET #owner = :lockerId"),
+			ConditionExpression:       impossible,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			TableName:                 aws.String(table),
+		}}},
+	})
+	query := &dynamodb.QueryInput{
+		KeyConditionExpression:    aws.String("#key = :lockerId"),
+		ExpressionAttributeNames:  map[string]string{"#key": attrs.Key},
+		ExpressionAttributeValues: values,
+		Limit:                     aws.Int32(1),
+		TableName:                 aws.String(table),
+	}
+	if holderIndex {
+		query.IndexName = aws.String(infra.HolderIndex)
+		query.KeyConditionExpression = aws.String("#owner = :lockerId")
+		query.ExpressionAttributeNames = names
+	}
+	_, queryErr := client.Query(ctx, query)
+
+	return []check{
+		permissionCheck("GetItem", getErr),
+		permissionCheck("UpdateItem", updateErr),
+		permissionCheck("DeleteItem", deleteErr),
+		permissionCheck("TransactWriteItems", transactErr),
+		permissionCheck("Query", queryErr),
+	}
+}
+
+func permissionCheck(operation string, err error) check {
+	c := check{Name: "permission " + operation}
+	var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+	var cancelled *dynamodbtypes.TransactionCanceledException
+	switch {
+	case err == nil, errors.As(err, &conditionFailed), errors.As(err, &cancelled):
+		c.Status = statusOK
+		c.Detail = fmt.Sprintf("dynamodb:%s is allowed", operation)
+	case isAccessDenied(err):
+		c.Status = statusFail
+		c.Detail = fmt.Sprintf("dynamodb:%s is denied", operation)
+		c.Fix = fmt.Sprintf("grant dynamodb:%s on the lock table to this principal", operation)
+	default:
+		c.Status = statusFail
+		c.Detail = err.Error()
+	}
+	return c
+}
+
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDeniedException"
+}
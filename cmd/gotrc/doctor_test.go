@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/stretchr/testify/assert"
+
+	infra "git.eldondev.com/gotrc/pkg/lock"
+)
+
+func TestCheckTableSchema(t *testing.T) {
+	table := &dynamodbtypes.TableDescription{
+		TableName:   aws.String("locks"),
+		TableStatus: dynamodbtypes.TableStatusActive,
+		KeySchema: []dynamodbtypes.KeySchemaElement{
+			{AttributeName: aws.String("name"), KeyType: dynamodbtypes.KeyTypeHash},
+		},
+		AttributeDefinitions: []dynamodbtypes.AttributeDefinition{
+			{AttributeName: aws.String("name"), AttributeType: dynamodbtypes.ScalarAttributeTypeS},
+		},
+	}
+	assert.Equal(t, statusOK, checkTable(table, "name").Status, "expected schema should pass")
+
+	assert.Equal(t, statusOK, checkReplication(table).Status, "a regional table should pass")
+	table.Replicas = []dynamodbtypes.ReplicaDescription{{RegionName: aws.String("us-east-1")}, {RegionName: aws.String("eu-west-1")}}
+	assert.Equal(t, statusWarn, checkReplication(table).Status, "a Global Table should warn")
+
+	table.KeySchema[0].AttributeName = aws.String("LockID")
+	assert.Equal(t, statusFail, checkTable(table, "name").Status, "unexpected key should fail")
+	table.AttributeDefinitions[0].AttributeName = aws.String("LockID")
+	assert.Equal(t, statusOK, checkTable(table, "LockID").Status, "a configured key should pass")
+}
+
+func TestCheckIndexes(t *testing.T) {
+	table := &dynamodbtypes.TableDescription{}
+	for _, c := range checkIndexes(table, "lockerId") {
+		assert.Equal(t, statusWarn, c.Status, "a missing index should warn")
+	}
+
+	table.GlobalSecondaryIndexes = []dynamodbtypes.GlobalSecondaryIndexDescription{
+		{IndexName: aws.String(infra.HolderIndex), KeySchema: []dynamodbtypes.KeySchemaElement{{AttributeName: aws.String("owner")}}},
+		{IndexName: aws.String(infra.ExpiryIndex)},
+	}
+	checks := checkIndexes(table, "owner")
+	assert.Equal(t, statusOK, checks[0].Status, "an index on the configured owner should pass")
+	assert.Equal(t, statusOK, checks[1].Status, "a present expiry index should pass")
+	assert.Equal(t, statusFail, checkIndexes(table, "lockerId")[0].Status, "an index on another attribute should fail")
+}
+
+func TestPermissionCheck(t *testing.T) {
+	assert.Equal(t, statusOK, permissionCheck("UpdateItem", &dynamodbtypes.ConditionalCheckFailedException{}).Status,
+		"a failed condition proves the call is allowed")
+	denied := &smithy.GenericAPIError{Code: "AccessDeniedException"}
+	c := permissionCheck("DeleteItem", denied)
+	assert.Equal(t, statusFail, c.Status, "access denied should fail")
+	assert.Contains(t, c.Fix, "dynamodb:DeleteItem", "fix should name the missing permission")
+	assert.Equal(t, statusOK, permissionCheck("TransactWriteItems", &dynamodbtypes.TransactionCanceledException{}).Status,
+		"a cancelled transaction proves the call is allowed")
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	infra "git.eldondev.com/gotrc/pkg/lock"
+)
+
+// holder summarises the locks held by one Locker. A holder is stale when
+// every one of its leases has lapsed, which means its heartbeater stopped
+// refreshing them and the process is most likely gone.
+type holder struct {
+	LockerId     string    `json:"locker_id"`
+	Host         string    `json:"host,omitempty"`
+	PID          int64     `json:"pid,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	Locks        int       `json:"locks"`
+	Names        []string  `json:"names"`
+	LatestExpiry time.Time `json:"latest_expiry"`
+	Stale        bool      `json:"stale"`
+}
+
+type holdersReport struct {
+	Table   string   `json:"table"`
+	Holders []holder `json:"holders"`
+}
+
+func holdersCommand(fs *flag.FlagSet) func(ctx context.Context) int {
+	var tf tableFlags
+	var of outputFlags
+	tf.register(fs)
+	of.register(fs)
+	staleOnly := fs.Bool("stale", false, "only list holders whose leases have all lapsed")
+	lockerId := fs.String("locker", "", "only list the locks held by this locker, using the holder index")
+	return func(ctx context.Context) int {
+		if !of.valid() {
+			return 2
+		}
+		client, err := tf.client(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		items, err := holderItems(ctx, client, tf.table, tf.attrs, *lockerId)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		report := holdersReport{Table: tf.table, Holders: []holder{}}
+		for _, h := range groupHolders(items, tf.attrs, time.Now()) {
+			if h.Stale || !*staleOnly {
+				report.Holders = append(report.Holders, h)
+			}
+		}
+		if of.json() {
+			printJSON(report)
+			return 0
+		}
+		for _, h := range report.Holders {
+			state := "live"
+			if h.Stale {
+				state = "STALE"
+			}
+			host := h.Host
+			if host == "" {
+				host = "-"
+			} else if h.PID != 0 {
+				host += fmt.Sprintf(" pid %d", h.PID)
+			}
+			fmt.Printf("%-36s %-28s %5d locks  %-5s latest expiry %s  %s\n", h.LockerId, host, h.Locks, state, h.LatestExpiry.Format(time.RFC3339), h.Description)
+		}
+		return 0
+	}
+}
+
+// holderItems reads the lock items of the table, or only those held by
+// lockerId if it is set. Those are found with the holder index rather than
+// a scan, so that one instance's locks can be listed quickly on large tables.
+func holderItems(ctx context.Context, client *dynamodb.Client, table string, attrs infra.AttributeNames, lockerId string) ([]map[string]dynamodbtypes.AttributeValue, error) {
+	var items []map[string]dynamodbtypes.AttributeValue
+	if lockerId != "" {
+		paginator := dynamodb.NewQueryPaginator(client, &dynamodb.QueryInput{
+			TableName:                aws.String(table),
+			IndexName:                aws.String(infra.HolderIndex),
+			KeyConditionExpression:   aws.String("#owner = :lockerId"),
+			ExpressionAttributeNames: map[string]string{"#owner": attrs.Owner},
+			ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+				":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: lockerId},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("querying %s for locks held by %s : %w", table, lockerId, err)
+			}
+			items = append(items, page.Items...)
+		}
+		return items, nil
+	}
+	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{TableName: aws.String(table)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s : %w", table, err)
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+// groupHolders groups lock items by holder, most locks first. Items without
+// a holder, such as released locks cooling down, are skipped.
+func groupHolders(items []map[string]dynamodbtypes.AttributeValue, attrs infra.AttributeNames, now time.Time) []holder {
+	byId := map[string]*holder{}
+	for _, item := range items {
+		lockerId := stringAttribute(item, attrs.Owner)
+		if lockerId == "" {
+			continue
+		}
+		h, ok := byId[lockerId]
+		if !ok {
+			h = &holder{LockerId: lockerId, Stale: true}
+			byId[lockerId] = h
+		}
+		if host := stringAttribute(item, "host"); host != "" {
+			h.Host = host
+		}
+		if v, ok := item["pid"].(*dynamodbtypes.AttributeValueMemberN); ok {
+			h.PID, _ = strconv.ParseInt(v.Value, 10, 64)
+		}
+		if description := stringAttribute(item, "ownerDescription"); description != "" {
+			h.Description = description
+		}
+		h.Locks++
+		h.Names = append(h.Names, stringAttribute(item, attrs.Key))
+		expiry := itemExpiry(item)
+		if expiry.After(h.LatestExpiry) {
+			h.LatestExpiry = expiry
+		}
+		if !now.After(expiry) {
+			h.Stale = false
+		}
+	}
+	holders := make([]holder, 0, len(byId))
+	for _, h := range byId {
+		sort.Strings(h.Names)
+		holders = append(holders, *h)
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if holders[i].Locks != holders[j].Locks {
+			return holders[i].Locks > holders[j].Locks
+		}
+		return strings.Compare(holders[i].LockerId, holders[j].LockerId) < 0
+	})
+	return holders
+}
+
+func stringAttribute(item map[string]dynamodbtypes.AttributeValue, name string) string {
+	if v, ok := item[name].(*dynamodbtypes.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// itemExpiry reads the lease expiry of a lock item, preferring the
+// millisecond ExpireAtMs written by current clients.
+func itemExpiry(item map[string]dynamodbtypes.AttributeValue) time.Time {
+	if v, ok := item["ExpireAtMs"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if ms, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			return time.UnixMilli(ms)
+		}
+	}
+	if v, ok := item["ExpireAt"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if s, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			return time.Unix(s, 0)
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/stretchr/testify/assert"
+
+	infra "git.eldondev.com/gotrc/pkg/lock"
+)
+
+func lockItem(name, lockerId string, expiry time.Time) map[string]dynamodbtypes.AttributeValue {
+	return map[string]dynamodbtypes.AttributeValue{
+		"name":       &dynamodbtypes.AttributeValueMemberS{Value: name},
+		"lockerId":   &dynamodbtypes.AttributeValueMemberS{Value: lockerId},
+		"ExpireAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expiry.UnixMilli(), 10)},
+	}
+}
+
+func TestGroupHolders(t *testing.T) {
+	now := time.Now()
+	items := []map[string]dynamodbtypes.AttributeValue{
+		lockItem("a", "dead", now.Add(-time.Minute)),
+		lockItem("b", "dead", now.Add(-time.Second)),
+		lockItem("c", "live", now.Add(time.Minute)),
+		{"name": &dynamodbtypes.AttributeValueMemberS{Value: "cooling"}},
+	}
+	items[2]["host"] = &dynamodbtypes.AttributeValueMemberS{Value: "orders-worker-3"}
+	items[2]["pid"] = &dynamodbtypes.AttributeValueMemberN{Value: "4112"}
+	items[2]["ownerDescription"] = &dynamodbtypes.AttributeValueMemberS{Value: "nightly export"}
+	holders := groupHolders(items, infra.AttributeNames{Key: "name", Owner: "lockerId"}, now)
+	assert.Len(t, holders, 2, "items without a holder should be skipped")
+	assert.Equal(t, "dead", holders[0].LockerId, "holders with the most locks should come first")
+	assert.Equal(t, []string{"a", "b"}, holders[0].Names, "locks should be grouped by holder")
+	assert.True(t, holders[0].Stale, "a holder whose leases all lapsed should be stale")
+	assert.False(t, holders[1].Stale, "a holder with a live lease should not be stale")
+	assert.Equal(t, "orders-worker-3", holders[1].Host, "the holder's host should be read")
+	assert.Equal(t, int64(4112), holders[1].PID, "the holder's process ID should be read")
+	assert.Equal(t, "nightly export", holders[1].Description, "the holder's description should be read")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	infra "git.eldondev.com/gotrc/pkg/lock"
+)
+
+// subcommand is a lock subcommand. setup registers its flags and returns the
+// function that runs it once they have been parsed, which lets completion
+// scripts be generated from the same definitions.
+type subcommand struct {
+	name    string
+	summary string
+	setup   func(fs *flag.FlagSet) func(ctx context.Context) int
+}
+
+var lockSubcommands = []subcommand{
+	{"doctor", "check that a lock table is set up correctly", doctorCommand},
+	{"bench", "measure acquisition latency and fairness under contention", benchCommand},
+	{"holders", "list lock holders and flag those whose leases have lapsed", holdersCommand},
+}
+
+func lockUsage() {
+	fmt.Fprintf(os.Stderr, "usage: gotrc lock <subcommand> [flags]\n\nsubcommands:\n")
+	for _, sub := range lockSubcommands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", sub.name, sub.summary)
+	}
+}
+
+func lockMain(ctx context.Context, args []string) int {
+	if len(args) < 1 {
+		lockUsage()
+		return 2
+	}
+	for _, sub := range lockSubcommands {
+		if sub.name == args[0] {
+			fs := flag.NewFlagSet(sub.name, flag.ContinueOnError)
+			run := sub.setup(fs)
+			if err := fs.Parse(args[1:]); err != nil {
+				return 2
+			}
+			return run(ctx)
+		}
+	}
+	lockUsage()
+	return 2
+}
+
+// tableFlags are the flags shared by every subcommand that talks to a lock table.
+type tableFlags struct {
+	table  string
+	region string
+	attrs  infra.AttributeNames
+}
+
+func (f *tableFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.table, "table", "locks", "name of the lock table")
+	fs.StringVar(&f.region, "region", "", "AWS region (defaults to the SDK configuration)")
+	fs.StringVar(&f.attrs.Key, "key-attribute", "name", "partition key of the lock table, as set with infra.WithAttributeNames")
+	fs.StringVar(&f.attrs.Owner, "owner-attribute", "lockerId", "attribute naming a lock's holder")
+	fs.StringVar(&f.attrs.Expiry, "expiry-attribute", "ExpireAt", "attribute holding a lock's TTL expiry")
+}
+
+func (f *tableFlags) client(ctx context.Context) (*dynamodb.Client, error) {
+	var opts []func(*config.LoadOptions) error
+	if f.region != "" {
+		opts = append(opts, config.WithRegion(f.region))
+	}
+	awsConf, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration : %w", err)
+	}
+	return dynamodb.NewFromConfig(awsConf), nil
+}
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFlags select how a subcommand prints its results.
+type outputFlags struct {
+	format string
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "output", outputText, "output format: text or json")
+}
+
+func (f *outputFlags) valid() bool {
+	if f.format == outputText || f.format == outputJSON {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "unknown output format %q\n", f.format)
+	return false
+}
+
+func (f *outputFlags) json() bool {
+	return f.format == outputJSON
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
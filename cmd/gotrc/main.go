@@ -0,0 +1,35 @@
+// Command gotrc inspects and operates goTRC lock tables.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gotrc <command> [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch os.Args[1] {
+	case "lock":
+		os.Exit(lockMain(ctx, os.Args[2:]))
+	case "completion":
+		os.Exit(completionMain(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,42 @@
+package infra
+
+import (
+	"time"
+)
+
+// WithAdaptiveLease lengthens the lease of locks that stay held. Each time a
+// lock has been refreshed after times in a row at its current lease, the lease
+// is doubled, up to max, and the heartbeater only refreshes the lock as its
+// lease runs low instead of on every tick. New locks keep the short lease
+// they were acquired with, so a crashed holder of a new lock is still noticed
+// quickly, while stable long-lived holders make far fewer writes.
+func WithAdaptiveLease(after int, max time.Duration) Option {
+	return func(l *Locker) {
+		l.adaptiveAfter = after
+		l.adaptiveMax = max
+	}
+}
+
+// dueForRefresh reports whether a held lock should be refreshed on this tick.
+// Without adaptive leases every lock is refreshed on every tick; with them a
+// lock is refreshed once its remaining lease could drop below half before the
+// next tick.
+func (l *Locker) dueForRefresh(lk *lock, now time.Time) bool {
+	if l.adaptiveAfter <= 0 {
+		return true
+	}
+	return lk.expiresAt.Sub(now)-l.skewMargin <= lk.timeout/2+l.HeartbeatInterval
+}
+
+// adaptLease lengthens a lock's lease once it has been refreshed enough times.
+func (l *Locker) adaptLease(lk *lock) {
+	if l.adaptiveAfter <= 0 || lk.refreshes < l.adaptiveAfter || lk.timeout >= l.adaptiveMax {
+		return
+	}
+	lk.timeout *= 2
+	if lk.timeout > l.adaptiveMax {
+		lk.timeout = l.adaptiveMax
+	}
+	lk.refreshes = 0
+	l.heartbeatLogger.Debug("Lengthening lease", "lockname", lk.name, "timeout", lk.timeout)
+}
@@ -0,0 +1,40 @@
+package infra
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptLeaseDoublesUpToMax(t *testing.T) {
+	l := &Locker{heartbeatLogger: slog.Default()}
+	WithAdaptiveLease(3, 25*time.Second)(l)
+
+	lk := lock{name: "x", timeout: 10 * time.Second, refreshes: 2}
+	l.adaptLease(&lk)
+	assert.Equal(t, 10*time.Second, lk.timeout, "lease should not grow before enough refreshes")
+
+	lk.refreshes = 3
+	l.adaptLease(&lk)
+	assert.Equal(t, 20*time.Second, lk.timeout, "lease should double")
+	assert.Equal(t, 0, lk.refreshes, "refreshes should be counted again at the new lease")
+
+	lk.refreshes = 3
+	l.adaptLease(&lk)
+	assert.Equal(t, 25*time.Second, lk.timeout, "lease should be capped")
+}
+
+func TestDueForRefresh(t *testing.T) {
+	now := time.Now()
+	l := &Locker{HeartbeatInterval: 5 * time.Second}
+	lk := lock{name: "x", timeout: 60 * time.Second, expiresAt: now.Add(50 * time.Second)}
+	assert.True(t, l.dueForRefresh(&lk, now), "every lock should be refreshed without adaptive leases")
+
+	WithAdaptiveLease(3, time.Minute)(l)
+	assert.False(t, l.dueForRefresh(&lk, now), "a lock with plenty of lease left should be skipped")
+	lk.expiresAt = now.Add(35 * time.Second)
+	assert.True(t, l.dueForRefresh(&lk, now), "a lock that could drop below half its lease should be refreshed")
+}
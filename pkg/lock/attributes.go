@@ -0,0 +1,81 @@
+package infra
+
+import (
+	"strings"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AttributeNames names the attributes of a lock item that a table's schema
+// or other clients sharing it may dictate: the partition key holding the lock
+// name, the owner and the lease expiry in epoch seconds.
+type AttributeNames struct {
+	Key    string
+	Owner  string
+	Expiry string
+}
+
+// defaultAttributeNames are the names used by tables EnsureLockTable creates.
+var defaultAttributeNames = AttributeNames{Key: "name", Owner: "lockerId", Expiry: "ExpireAt"}
+
+// Placeholders for the configurable attributes in expressions. Lock item
+// expressions always refer to them through these, since a table's names may
+// be DynamoDB reserved words.
+const (
+	keyPlaceholder    = "#key"
+	ownerPlaceholder  = "#owner"
+	expiryPlaceholder = "#expiry"
+)
+
+// WithAttributeNames makes the Locker use existing lock tables with a
+// different schema, such as one keyed by "LockID". Empty fields keep their
+// defaults of "name", "lockerId" and "ExpireAt". Every client sharing a table
+// must use the same names. The Locker's other attributes, and the items of
+// RWLocker, keep their own names; Semaphore takes its key name from
+// WithSemaphoreAttributeNames.
+func WithAttributeNames(names AttributeNames) Option {
+	return func(l *Locker) {
+		l.attrs = names.withDefaults()
+	}
+}
+
+func (a AttributeNames) withDefaults() AttributeNames {
+	if a.Key == "" {
+		a.Key = defaultAttributeNames.Key
+	}
+	if a.Owner == "" {
+		a.Owner = defaultAttributeNames.Owner
+	}
+	if a.Expiry == "" {
+		a.Expiry = defaultAttributeNames.Expiry
+	}
+	return a
+}
+
+// key returns the primary key of the lock item for name.
+func (a AttributeNames) key(name string) map[string]dynamodbtypes.AttributeValue {
+	return map[string]dynamodbtypes.AttributeValue{
+		a.Key: &dynamodbtypes.AttributeValueMemberS{Value: name},
+	}
+}
+
+// expressionNames returns the ExpressionAttributeNames for expressions,
+// adding the placeholders they use to names. DynamoDB rejects placeholders
+// that are not used, and an empty map, so it returns nil if there are none.
+func (a AttributeNames) expressionNames(names map[string]string, expressions ...string) map[string]string {
+	all := strings.Join(expressions, " ")
+	for placeholder, attribute := range map[string]string{
+		keyPlaceholder:    a.Key,
+		ownerPlaceholder:  a.Owner,
+		expiryPlaceholder: a.Expiry,
+	} {
+		if !strings.Contains(all, placeholder) {
+			continue
+		}
+		if names == nil {
+			names = map[string]string{}
+		}
+		names[placeholder] = attribute
+	}
+	return names
+}
@@ -0,0 +1,78 @@
+package infra
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributeNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	client.DefineTable("locks", "LockID")
+	names := AttributeNames{Key: "LockID", Owner: "owner"}
+
+	n := NewLocker(client, ctx, "locks", WithAttributeNames(names))
+	b := NewLocker(client, ctx, "locks", WithAttributeNames(names))
+	ok, err := n.AcquireLock("custom", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	ok, err = b.AcquireLock("custom", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a held lock should not be acquired")
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("locks"),
+		Key:       map[string]dynamodbtypes.AttributeValue{"LockID": &dynamodbtypes.AttributeValueMemberS{Value: "custom"}},
+	})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberS{Value: n.ID()}, out.Item["owner"], "the owner should be written to the configured attribute")
+	assert.Contains(t, out.Item, "ExpireAt", "an unset name should keep its default")
+	assert.NotContains(t, out.Item, "lockerId", "the default owner attribute should not be written")
+
+	info, found, err := b.GetLockInfo(ctx, "custom")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock item should be found")
+	assert.Equal(t, "custom", info.Name, "the name should be read from the configured key")
+	assert.Equal(t, n.ID(), info.LockerId, "the owner should be read from the configured attribute")
+	locked, err := b.IsLocked(ctx, "custom")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, locked, "the lock should be reported as held")
+
+	assert.Nil(t, n.ReleaseLock("custom"), "the lock should be released")
+	ok, err = b.WouldAcquire(ctx, "custom")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a released lock could be acquired")
+}
+
+func TestAttributeNamesTakeover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	client.DefineTable("locks", "LockID")
+	expired := time.Now().Add(-time.Second)
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"LockID":  &dynamodbtypes.AttributeValueMemberS{Value: "custom"},
+			"owner":   &dynamodbtypes.AttributeValueMemberS{Value: "dead"},
+			"expires": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.Unix()-1, 10)},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+
+	var previous string
+	n := NewLocker(client, ctx, "locks", WithAttributeNames(AttributeNames{Key: "LockID", Owner: "owner", Expiry: "expires"}),
+		WithTakeoverHandler(func(t Takeover) { previous = t.PreviousLockerId }))
+	ok, err := n.AcquireLock("custom", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a lock whose lease lapsed should be taken over")
+	assert.Equal(t, "dead", previous, "the previous owner should be read from the configured attribute")
+}
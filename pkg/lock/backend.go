@@ -0,0 +1,156 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported is returned by Locker methods that rely on DynamoDB features
+// a Backend doesn't offer, such as transactions and secondary indexes.
+var ErrUnsupported = errors.New("not supported by this backend")
+
+// Backend stores lock items for a Locker created with NewBackendLocker, so
+// the Locker's heartbeats, lease tracking, handles and helpers built on them
+// can run on a store other than DynamoDB. Owners are the IDs of Lockers.
+// Implementations must make each method atomic with respect to the others.
+type Backend interface {
+	// AcquireItem takes the lock named by req.Name for req.LockerId with the
+	// given lease, if it has no owner, its lease has lapsed or req.LockerId
+	// already owns it, storing req's TraceId and Data. It reports false if
+	// another owner holds the lock, and otherwise returns the item as
+	// stored. The item's FencingToken must be greater than any the lock had
+	// before.
+	AcquireItem(ctx context.Context, req LockInfo, lease time.Duration) (LockInfo, bool, error)
+	// RenewItem starts a new lease for owner, reporting false if owner no
+	// longer holds the lock.
+	RenewItem(ctx context.Context, name, owner string, lease time.Duration) (bool, error)
+	// ReleaseItem gives up owner's lock, returning an error wrapping
+	// ErrNotHeld if owner doesn't hold it.
+	ReleaseItem(ctx context.Context, name, owner string) error
+	// GetItem returns the named lock item, reporting false if there is none.
+	GetItem(ctx context.Context, name string) (LockInfo, bool, error)
+	// ListItems returns every lock item, including ones whose lease lapsed.
+	ListItems(ctx context.Context) ([]LockInfo, error)
+}
+
+// NewBackendLocker creates a Locker storing its locks in backend rather than a
+// DynamoDB table. Methods that need DynamoDB itself (AcquireLocks,
+// ReleaseMany, SetData, UpdateData, BroadcastCancel, ClearCancel,
+// WouldAcquire, ExpiredLocks, History and Once) return ErrUnsupported, and
+// the options configuring release cooldowns, lock history and process-wide
+// waiter limits have no effect.
+func NewBackendLocker(backend Backend, ctx context.Context, opts ...Option) *Locker {
+	return NewLocker(nil, ctx, "", append([]Option{func(l *Locker) { l.backend = backend }}, opts...)...)
+}
+
+// dynamoOnly returns ErrUnsupported for operations that need DynamoDB.
+func (l *Locker) dynamoOnly(op string) error {
+	if l.backend != nil {
+		return fmt.Errorf("%s : %w", op, ErrUnsupported)
+	}
+	return nil
+}
+
+// acquireFromBackend is acquire for Lockers with a Backend.
+func (l *Locker) acquireFromBackend(ctx context.Context, name string, timeout time.Duration, held bool, acquireOpts acquireOptions) (bool, error) {
+	if held {
+		return l.backend.RenewItem(ctx, name, l.lockerId, timeout)
+	}
+	now := time.Now()
+	info, ok, err := l.backend.AcquireItem(ctx, LockInfo{Name: name, LockerId: l.lockerId, TraceId: acquireOpts.traceId, Data: acquireOpts.data}, timeout)
+	if err != nil || !ok {
+		return false, err
+	}
+	if l.verifyAcquire {
+		if err := l.verifyOwnership(ctx, name); err != nil {
+			return false, l.abandon(name, err)
+		}
+	}
+	acquired := lock{name: name, timeout: timeout, traceId: acquireOpts.traceId, expiresAt: now.Add(timeout), acquiredAt: now,
+		fencingToken: info.FencingToken}
+	if err := l.track(acquired, info.Data, nil); err != nil {
+		return false, l.abandon(name, err)
+	}
+	return true, nil
+}
+
+// MemoryBackend is a Backend keeping lock items in process memory. It is
+// the reference implementation of Backend, and useful in tests.
+type MemoryBackend struct {
+	mu    sync.Mutex
+	items map[string]LockInfo
+}
+
+var _ Backend = (*MemoryBackend)(nil)
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{items: map[string]LockInfo{}}
+}
+
+func (b *MemoryBackend) AcquireItem(ctx context.Context, req LockInfo, lease time.Duration) (LockInfo, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	old, exists := b.items[req.Name]
+	if exists && old.LockerId != "" && old.LockerId != req.LockerId && !old.Expired(now) {
+		return old, false, nil
+	}
+	item := req
+	item.ExpiresAt = now.Add(lease)
+	item.FencingToken = nextFencingToken(nil, now)
+	if exists {
+		item.FencingToken = old.FencingToken + 1
+		if item.Data == nil {
+			item.Data = old.Data
+		}
+	}
+	b.items[req.Name] = item
+	return item, true, nil
+}
+
+func (b *MemoryBackend) RenewItem(ctx context.Context, name, owner string, lease time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item, ok := b.items[name]
+	if !ok || item.LockerId != owner {
+		return false, nil
+	}
+	item.ExpiresAt = time.Now().Add(lease)
+	b.items[name] = item
+	return true, nil
+}
+
+func (b *MemoryBackend) ReleaseItem(ctx context.Context, name, owner string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if item, ok := b.items[name]; !ok || item.LockerId != owner {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	delete(b.items, name)
+	return nil
+}
+
+func (b *MemoryBackend) GetItem(ctx context.Context, name string) (LockInfo, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item, ok := b.items[name]
+	if !ok {
+		return LockInfo{Name: name}, false, nil
+	}
+	return item, true, nil
+}
+
+func (b *MemoryBackend) ListItems(ctx context.Context) ([]LockInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	items := make([]LockInfo, 0, len(b.items))
+	for _, item := range b.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
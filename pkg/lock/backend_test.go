@@ -0,0 +1,54 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendLocker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := NewMemoryBackend()
+	s := NewManualScheduler()
+	n := NewBackendLocker(backend, ctx, WithScheduler(func(time.Duration) Scheduler { return s }))
+	b := NewBackendLocker(backend, ctx)
+
+	h, err := n.Acquire(ctx, "x", time.Millisecond*200, WithTraceID("trace-1"))
+	assert.Nil(t, err, "error should be nil")
+	if !assert.NotNil(t, h, "lock should be acquired") {
+		return
+	}
+	token := h.FencingToken()
+	assert.NotZero(t, token, "the backend's fencing token should be used")
+	ok, err := b.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "held lock should not be acquired")
+
+	time.Sleep(time.Millisecond * 150)
+	s.Tick(time.Now())
+	time.Sleep(time.Millisecond * 100)
+	info, found, err := b.GetLockInfo(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock item should be found")
+	assert.Equal(t, n.ID(), info.LockerId, "the holder should be reported")
+	assert.Equal(t, "trace-1", info.TraceId, "the trace should be stored")
+	assert.False(t, info.Expired(time.Now()), "the heartbeater should renew the lease")
+	held, err := b.LocksHeldBy(ctx, n.ID())
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, held, 1, "locks should be listed by holder")
+
+	assert.ErrorIs(t, n.ReleaseMany(ctx, []string{"x"}), ErrUnsupported, "transactions should need DynamoDB")
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	assert.ErrorIs(t, n.ReleaseLock("x"), ErrNotHeld, "lock should not be released twice")
+	locked, err := b.IsLocked(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, locked, "released lock should be free")
+	ok, err = b.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "released lock should be acquired")
+	next, _, _ := b.GetLockInfo(ctx, "x")
+	assert.Greater(t, next.FencingToken, token, "fencing tokens should grow across holders")
+}
@@ -0,0 +1,230 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxTransactItems is the most items DynamoDB accepts in one transaction.
+const maxTransactItems = 100
+
+// ErrNotHeld is returned when an operation requires a lock this Locker
+// doesn't hold.
+var ErrNotHeld = errors.New("lock is not held by this locker")
+
+type batchRelease struct {
+	ctx    context.Context
+	names  []string
+	result chan error
+}
+
+// ReleaseMany releases all the named locks in a single DynamoDB transaction:
+// either every lock is released, or, if any of them is no longer held by this
+// Locker, none are and the error wraps ErrNotHeld. At most 100 locks can be
+// released at once. Each lock is given up outright, however many holds a
+// reentrant lock has.
+func (l *Locker) ReleaseMany(ctx context.Context, names []string) error {
+	if err := l.dynamoOnly("releasing locks atomically"); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if len(names) > maxTransactItems {
+		return fmt.Errorf("releasing %d locks : at most %d can be released atomically", len(names), maxTransactItems)
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("releasing %v : %s is listed more than once", names, name)
+		}
+		seen[name] = true
+	}
+	if err := l.enter(); err != nil {
+		return err
+	}
+	req := batchRelease{ctx, names, make(chan error, 1)}
+	if err := send(l, l.batchReleaser, req); err != nil {
+		return err
+	}
+	return <-req.result
+}
+
+// AcquireLocks acquires all the named locks with the given lease in a single
+// DynamoDB transaction: either every lock is acquired, or, if any of them is
+// held by another Locker, none are and it returns false. Locks this Locker
+// already holds are renewed as part of the transaction. As the whole set is
+// taken at once, it can't deadlock with another Locker taking an overlapping
+// set, whatever order the names are in, so declared lock orders aren't
+// checked. At most 100 locks can be acquired at once.
+func (l *Locker) AcquireLocks(ctx context.Context, names []string, lease time.Duration, opts ...AcquireOption) (bool, error) {
+	if err := l.dynamoOnly("acquiring locks atomically"); err != nil {
+		return false, err
+	}
+	if len(names) == 0 {
+		return true, nil
+	}
+	if len(names) > maxTransactItems {
+		return false, fmt.Errorf("acquiring %d locks : at most %d can be acquired atomically", len(names), maxTransactItems)
+	}
+	if l.closed() {
+		return false, ErrClosed
+	}
+	var acquireOpts acquireOptions
+	for _, opt := range opts {
+		opt(&acquireOpts)
+	}
+	if acquireOpts.err != nil {
+		return false, acquireOpts.err
+	}
+	if err := checkDataSize(acquireOpts.data); err != nil {
+		return false, fmt.Errorf("acquiring %v : %w", names, err)
+	}
+	held := map[string]bool{}
+	for _, name := range l.heldNames() {
+		held[name] = true
+	}
+	seen := map[string]bool{}
+	items := make([]dynamodbtypes.TransactWriteItem, 0, len(names))
+	now := time.Now()
+	expiry := now.Add(lease)
+	for _, name := range names {
+		if seen[name] {
+			return false, fmt.Errorf("acquiring %v : %s is listed more than once", names, name)
+		}
+		seen[name] = true
+		if !held[name] {
+			unreserve, err := l.reserve(name)
+			if err != nil {
+				return false, err
+			}
+			defer unreserve()
+		}
+		update, values, attributeNames := l.acquireUpdate(name, now, expiry, held[name], acquireOpts)
+		condition := l.acquireExpression(name, now, values)
+		items = append(items, dynamodbtypes.TransactWriteItem{
+			Update: &dynamodbtypes.Update{
+				Key:                       l.attrs.key(name),
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String(condition),
+				ExpressionAttributeNames:  l.attrs.expressionNames(attributeNames, update, condition),
+				ExpressionAttributeValues: values,
+				TableName:                 aws.String(l.lockTable),
+			},
+		})
+		if l.versioned() {
+			// The holder's record version is needed to take the lock over later
+			items[len(items)-1].Update.ReturnValuesOnConditionCheckFailure = dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld
+		}
+	}
+	ctx, cancel := l.bound(ctx)
+	defer cancel()
+	_, err := l.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items}, l.requestOptions)
+	if err != nil {
+		var cancelled *dynamodbtypes.TransactionCanceledException
+		if errors.As(err, &cancelled) {
+			for i, reason := range cancelled.CancellationReasons {
+				if aws.ToString(reason.Code) == "ConditionalCheckFailed" && i < len(names) {
+					l.acquireLogger.Debug("Lock set contended", "lockname", names[i])
+					l.observeVersion(names[i], reason.Item)
+					if !held[names[i]] {
+						l.recordContention(ctx, names[i])
+					}
+					return false, nil
+				}
+			}
+		}
+		return false, fmt.Errorf("acquiring %v : %w", names, err)
+	}
+
+	for _, name := range names {
+		if held[name] {
+			continue
+		}
+		// A transaction doesn't return the items it changed, so read back the
+		// fencing token it wrote and any data left by the previous holder
+		out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+			Key:            l.attrs.key(name),
+			ConsistentRead: aws.Bool(true),
+			TableName:      aws.String(l.lockTable),
+		}, l.requestOptions)
+		var item map[string]dynamodbtypes.AttributeValue
+		if err != nil {
+			l.acquireLogger.Warn("Acquired lock could not be read back", "lockname", name, "error", err)
+		} else {
+			item = out.Item
+		}
+		token, _ := numberAttr(item, fencingAttribute)
+		acquired := lock{name: name, timeout: lease, traceId: acquireOpts.traceId, expiresAt: expiry, acquiredAt: now, fencingToken: token}
+		data := acquireOpts.data
+		if data == nil {
+			data = itemData(item)
+		}
+		if err := l.track(acquired, data, nil); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// releaseMany runs on the heartbeater.
+func (l *Locker) releaseMany(ctx context.Context, names []string) error {
+	items := make([]dynamodbtypes.TransactWriteItem, 0, len(names))
+	now := time.Now()
+	for _, name := range names {
+		key := l.attrs.key(name)
+		if l.cooldown > 0 || l.hasData(name) {
+			update, values := l.releaseUpdate(now)
+			items = append(items, dynamodbtypes.TransactWriteItem{
+				Update: &dynamodbtypes.Update{
+					Key:                       key,
+					UpdateExpression:          aws.String(update),
+					ConditionExpression:       aws.String(ownerCondition),
+					ExpressionAttributeNames:  l.attrs.expressionNames(nil, update, ownerCondition),
+					ExpressionAttributeValues: values,
+					TableName:                 aws.String(l.lockTable),
+				},
+			})
+			continue
+		}
+		items = append(items, dynamodbtypes.TransactWriteItem{
+			Delete: &dynamodbtypes.Delete{
+				Key:                      key,
+				ConditionExpression:      aws.String(ownerCondition),
+				ExpressionAttributeNames: l.attrs.expressionNames(nil, ownerCondition),
+				ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+					":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+				},
+				TableName: aws.String(l.lockTable),
+			},
+		})
+	}
+	_, err := l.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items}, l.requestOptions)
+	if err != nil {
+		var cancelled *dynamodbtypes.TransactionCanceledException
+		if errors.As(err, &cancelled) {
+			var notHeld []string
+			for i, reason := range cancelled.CancellationReasons {
+				if aws.ToString(reason.Code) == "ConditionalCheckFailed" && i < len(names) {
+					notHeld = append(notHeld, names[i])
+				}
+			}
+			if len(notHeld) > 0 {
+				return fmt.Errorf("releasing %v, not held: %v : %w", names, notHeld, ErrNotHeld)
+			}
+		}
+		return fmt.Errorf("releasing %v : %w", names, err)
+	}
+
+	for _, name := range names {
+		l.emit(Event{Type: EventReleased, Lock: name})
+		l.untrack(name, true)
+	}
+	return nil
+}
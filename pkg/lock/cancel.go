@@ -0,0 +1,97 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// BroadcastCancel marks the operation guarded by the named lock as cancelled.
+// Every Locker holding the lock sees the mark on its next refresh, and every
+// Locker trying to acquire it sees it on its next attempt; both raise
+// EventCancelled with the given reason. The mark stays on the lock item, so
+// processes that acquire the lock later are told too, until ClearCancel is
+// called. A lock without an item has never been held, so there is nobody to
+// tell and nothing is marked.
+func (l *Locker) BroadcastCancel(ctx context.Context, name string, reason string) error {
+	if err := l.dynamoOnly("broadcasting cancellation"); err != nil {
+		return err
+	}
+	if l.closed() {
+		return ErrClosed
+	}
+	// An item created here would have no expiry to clean it up
+	condition := "attribute_exists(#key)"
+	_, err := l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                      l.attrs.key(name),
+		UpdateExpression:         aws.String("SET cancelledAt = :now, cancelReason = :reason, cancelledBy = :lockerId"),
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: l.attrs.expressionNames(nil, condition),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":now":      &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().UnixMilli())},
+			":reason":   &dynamodbtypes.AttributeValueMemberS{Value: reason},
+			":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+		},
+		TableName: aws.String(l.lockTable),
+	}, l.requestOptions)
+	if isConditionalCheckFailed(err) {
+		l.adminLogger.Info("No lock item to cancel", "lockname", name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("broadcasting cancel for lock %s : %w", name, err)
+	}
+	l.adminLogger.Info("Cancel broadcast", "lockname", name, "reason", reason)
+	return nil
+}
+
+// ClearCancel removes a cancel mark set by BroadcastCancel.
+func (l *Locker) ClearCancel(ctx context.Context, name string) error {
+	if err := l.dynamoOnly("clearing cancellation"); err != nil {
+		return err
+	}
+	if l.closed() {
+		return ErrClosed
+	}
+	_, err := l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                 l.attrs.key(name),
+		UpdateExpression:    aws.String("REMOVE cancelledAt, cancelReason, cancelledBy"),
+		ConditionExpression: aws.String("attribute_exists(cancelledAt)"),
+		TableName:           aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil && !isConditionalCheckFailed(err) {
+		return fmt.Errorf("clearing cancel for lock %s : %w", name, err)
+	}
+	return nil
+}
+
+// observeCancel raises EventCancelled the first time this Locker sees a given
+// cancel mark on a lock item.
+func (l *Locker) observeCancel(name string, item map[string]dynamodbtypes.AttributeValue) {
+	at, ok := item["cancelledAt"].(*dynamodbtypes.AttributeValueMemberN)
+	if !ok {
+		return
+	}
+	cancelledAt, err := strconv.ParseInt(at.Value, 10, 64)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	seen := l.cancelsSeen[name] >= cancelledAt
+	l.cancelsSeen[name] = cancelledAt
+	l.mu.Unlock()
+	if seen {
+		return
+	}
+	var reason string
+	if r, ok := item["cancelReason"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		reason = r.Value
+	}
+	l.acquireLogger.Info("Lock operation cancelled", "lockname", name, "reason", reason)
+	l.emit(Event{Type: EventCancelled, Lock: name, Reason: reason, Time: time.UnixMilli(cancelledAt)})
+}
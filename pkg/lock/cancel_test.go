@@ -0,0 +1,83 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveCancelOncePerMark(t *testing.T) {
+	var events []Event
+	n := NewLocker(nil, context.Background(), "locks", WithEventHandler(func(e Event) { events = append(events, e) }))
+	item := map[string]dynamodbtypes.AttributeValue{
+		"cancelledAt":  &dynamodbtypes.AttributeValueMemberN{Value: "1000"},
+		"cancelReason": &dynamodbtypes.AttributeValueMemberS{Value: "bad deploy"},
+	}
+	n.observeCancel("job", item)
+	n.observeCancel("job", item)
+	n.observeCancel("job", map[string]dynamodbtypes.AttributeValue{})
+	assert.Len(t, events, 1, "a cancel mark should be reported once")
+	assert.Equal(t, EventCancelled, events[0].Type, "event should be a cancel")
+	assert.Equal(t, "bad deploy", events[0].Reason, "reason should be reported")
+
+	item["cancelledAt"] = &dynamodbtypes.AttributeValueMemberN{Value: "2000"}
+	n.observeCancel("job", item)
+	assert.Len(t, events, 2, "a newer cancel mark should be reported")
+}
+
+func TestBroadcastCancelReachesHolderAndWaiter(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	cancelled := make(chan string, 10)
+	handler := WithEventHandler(func(e Event) {
+		if e.Type == EventCancelled {
+			cancelled <- e.LockerId
+		}
+	})
+	holder := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks", handler)
+	waiter := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks", handler)
+	operator := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err := holder.AcquireLock(testLock, time.Second*2)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	assert.Nil(t, operator.BroadcastCancel(ctx, testLock, "abort"), "error should be nil")
+	ok, err = waiter.AcquireLock(testLock, time.Second*2)
+	assert.False(t, ok, "lock should not be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		select {
+		case id := <-cancelled:
+			seen[id] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("cancel was not observed by holder and waiter")
+		}
+	}
+	assert.Nil(t, operator.ClearCancel(ctx, testLock), "error should be nil")
+}
+
+func TestBroadcastCancelMissingLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	operator := NewLocker(client, ctx, "locks")
+
+	assert.Nil(t, operator.BroadcastCancel(ctx, "never-held", "abort"), "error should be nil")
+	out, err := client.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("locks")})
+	assert.Nil(t, err, "error should be nil")
+	assert.Empty(t, out.Items, "cancelling a lock without an item should not create one")
+}
@@ -0,0 +1,185 @@
+package infra
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// CapacityUsage is the DynamoDB capacity consumed by a set of calls.
+type CapacityUsage struct {
+	Requests   int64
+	ReadUnits  float64
+	WriteUnits float64
+}
+
+// CapacityReport is the capacity a Locker has consumed since capacity
+// reporting was enabled, in total, by DynamoDB operation, and by lock name.
+// Calls that don't address a single lock, such as queries, scans and
+// transactions, only count towards Total and ByOperation.
+type CapacityReport struct {
+	Total       CapacityUsage
+	ByOperation map[string]CapacityUsage
+	ByLock      map[string]CapacityUsage
+}
+
+// capacityMeter totals the capacity DynamoDB reports for a Locker's calls.
+type capacityMeter struct {
+	mu          sync.Mutex
+	total       CapacityUsage
+	byOperation map[string]CapacityUsage
+	byLock      map[string]CapacityUsage
+}
+
+// WithCapacityReporting asks DynamoDB to return the capacity consumed by
+// every call the Locker makes, and totals it for ConsumedCapacity, to size
+// the table and find the locks driving its cost. Capacity is only reported
+// by *dynamodb.Client; other clients leave the report empty. Every lock name
+// seen is kept, so Lockers working through many distinct names should read
+// and reset the report regularly.
+func WithCapacityReporting() Option {
+	return func(l *Locker) {
+		l.capacity = &capacityMeter{byOperation: map[string]CapacityUsage{}, byLock: map[string]CapacityUsage{}}
+	}
+}
+
+// ConsumedCapacity returns the capacity consumed since capacity reporting
+// was enabled or last reset. The report is empty without
+// WithCapacityReporting.
+func (l *Locker) ConsumedCapacity() CapacityReport {
+	report := CapacityReport{ByOperation: map[string]CapacityUsage{}, ByLock: map[string]CapacityUsage{}}
+	m := l.capacity
+	if m == nil {
+		return report
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report.Total = m.total
+	for op, usage := range m.byOperation {
+		report.ByOperation[op] = usage
+	}
+	for name, usage := range m.byLock {
+		report.ByLock[name] = usage
+	}
+	return report
+}
+
+// ResetConsumedCapacity clears the capacity counted so far.
+func (l *Locker) ResetConsumedCapacity() {
+	m := l.capacity
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = CapacityUsage{}
+	m.byOperation = map[string]CapacityUsage{}
+	m.byLock = map[string]CapacityUsage{}
+}
+
+// middleware requests the consumed capacity of a call and records it, once
+// for the call however many attempts it took.
+func (m *capacityMeter) middleware(keyAttribute string) middleware.InitializeMiddleware {
+	return middleware.InitializeMiddlewareFunc("ConsumedCapacity", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		op, write, key := requestCapacity(in.Parameters)
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if err == nil && op != "" {
+			name, _ := stringAttr(key, keyAttribute)
+			m.record(op, name, write, consumedCapacity(out.Result))
+		}
+		return out, metadata, err
+	})
+}
+
+// requestCapacity asks for the total consumed capacity of a call, returning
+// its operation, whether it writes, and the key of the item it addresses, if
+// any.
+func requestCapacity(params interface{}) (string, bool, map[string]dynamodbtypes.AttributeValue) {
+	total := dynamodbtypes.ReturnConsumedCapacityTotal
+	switch p := params.(type) {
+	case *dynamodb.GetItemInput:
+		p.ReturnConsumedCapacity = total
+		return "GetItem", false, p.Key
+	case *dynamodb.PutItemInput:
+		p.ReturnConsumedCapacity = total
+		return "PutItem", true, p.Item
+	case *dynamodb.UpdateItemInput:
+		p.ReturnConsumedCapacity = total
+		return "UpdateItem", true, p.Key
+	case *dynamodb.DeleteItemInput:
+		p.ReturnConsumedCapacity = total
+		return "DeleteItem", true, p.Key
+	case *dynamodb.QueryInput:
+		p.ReturnConsumedCapacity = total
+		return "Query", false, nil
+	case *dynamodb.ScanInput:
+		p.ReturnConsumedCapacity = total
+		return "Scan", false, nil
+	case *dynamodb.TransactWriteItemsInput:
+		p.ReturnConsumedCapacity = total
+		return "TransactWriteItems", true, nil
+	}
+	return "", false, nil
+}
+
+// consumedCapacity returns the capacity units a call's output reports.
+func consumedCapacity(result interface{}) []dynamodbtypes.ConsumedCapacity {
+	var consumed *dynamodbtypes.ConsumedCapacity
+	switch out := result.(type) {
+	case *dynamodb.GetItemOutput:
+		consumed = out.ConsumedCapacity
+	case *dynamodb.PutItemOutput:
+		consumed = out.ConsumedCapacity
+	case *dynamodb.UpdateItemOutput:
+		consumed = out.ConsumedCapacity
+	case *dynamodb.DeleteItemOutput:
+		consumed = out.ConsumedCapacity
+	case *dynamodb.QueryOutput:
+		consumed = out.ConsumedCapacity
+	case *dynamodb.ScanOutput:
+		consumed = out.ConsumedCapacity
+	case *dynamodb.TransactWriteItemsOutput:
+		return out.ConsumedCapacity
+	}
+	if consumed == nil {
+		return nil
+	}
+	return []dynamodbtypes.ConsumedCapacity{*consumed}
+}
+
+func (m *capacityMeter) record(op, name string, write bool, consumed []dynamodbtypes.ConsumedCapacity) {
+	usage := CapacityUsage{Requests: 1}
+	for _, c := range consumed {
+		// With TOTAL, DynamoDB may only report CapacityUnits, which are
+		// reads or writes depending on the operation
+		read, written := aws.ToFloat64(c.ReadCapacityUnits), aws.ToFloat64(c.WriteCapacityUnits)
+		if read == 0 && written == 0 {
+			if write {
+				written = aws.ToFloat64(c.CapacityUnits)
+			} else {
+				read = aws.ToFloat64(c.CapacityUnits)
+			}
+		}
+		usage.ReadUnits += read
+		usage.WriteUnits += written
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = m.total.add(usage)
+	m.byOperation[op] = m.byOperation[op].add(usage)
+	if name != "" {
+		m.byLock[name] = m.byLock[name].add(usage)
+	}
+}
+
+func (u CapacityUsage) add(other CapacityUsage) CapacityUsage {
+	return CapacityUsage{
+		Requests:   u.Requests + other.Requests,
+		ReadUnits:  u.ReadUnits + other.ReadUnits,
+		WriteUnits: u.WriteUnits + other.WriteUnits,
+	}
+}
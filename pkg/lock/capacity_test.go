@@ -0,0 +1,64 @@
+package infra
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapacityReporting(t *testing.T) {
+	var requested atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"ReturnConsumedCapacity":"TOTAL"`) {
+			requested.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "GetItem":
+			w.Write([]byte(`{"ConsumedCapacity":{"TableName":"locks","CapacityUnits":0.5}}`))
+		case "DeleteItem":
+			w.Write([]byte(`{"ConsumedCapacity":{"TableName":"locks","CapacityUnits":1,"WriteCapacityUnits":1}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewLocalClient(server.URL, "")
+	l := NewLocker(client, context.Background(), "locks", WithCapacityReporting())
+	defer l.Close(context.Background())
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, _, err := l.GetLockInfo(ctx, "hot")
+		assert.Nil(t, err, "error should be nil")
+	}
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String("locks"),
+		Key:       defaultAttributeNames.key("cold"),
+	}, l.requestOptions)
+	assert.Nil(t, err, "error should be nil")
+
+	assert.Equal(t, int32(3), requested.Load(), "every call should ask for its consumed capacity")
+	report := l.ConsumedCapacity()
+	assert.Equal(t, CapacityUsage{Requests: 3, ReadUnits: 1, WriteUnits: 1}, report.Total, "the total should add up every call")
+	assert.Equal(t, CapacityUsage{Requests: 2, ReadUnits: 1}, report.ByOperation["GetItem"], "reads should be counted by operation")
+	assert.Equal(t, CapacityUsage{Requests: 1, WriteUnits: 1}, report.ByOperation["DeleteItem"], "writes should be counted by operation")
+	assert.Equal(t, CapacityUsage{Requests: 2, ReadUnits: 1}, report.ByLock["hot"], "calls should be counted by lock")
+
+	l.ResetConsumedCapacity()
+	assert.Equal(t, CapacityUsage{}, l.ConsumedCapacity().Total, "the report should be reset")
+	plain := NewLocker(NewMemoryClient(), ctx, "locks")
+	defer plain.Close(ctx)
+	assert.Equal(t, CapacityReport{ByOperation: map[string]CapacityUsage{}, ByLock: map[string]CapacityUsage{}},
+		plain.ConsumedCapacity(), "the report should be empty without capacity reporting")
+}
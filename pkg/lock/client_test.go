@@ -0,0 +1,87 @@
+package infra
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient is a Client for offline tests. Operations without a function
+// set panic.
+type fakeClient struct {
+	Client
+	mu         sync.Mutex
+	getItem    func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	updateItem func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+	deleteItem func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+}
+
+func (c *fakeClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getItem(params)
+}
+
+func (c *fakeClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updateItem(params)
+}
+
+func (c *fakeClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deleteItem(params)
+}
+
+func conditionFailed(operation string) error {
+	return &smithy.OperationError{ServiceID: "DynamoDB", OperationName: operation, Err: &dynamodbtypes.ConditionalCheckFailedException{}}
+}
+
+func TestLockerWithFakeClient(t *testing.T) {
+	var owner string
+	deleted := make(chan string, 1)
+	client := &fakeClient{
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			lockerId := input.ExpressionAttributeValues[":lockerId"].(*dynamodbtypes.AttributeValueMemberS).Value
+			if owner != "" && owner != lockerId {
+				return nil, conditionFailed("UpdateItem")
+			}
+			owner = lockerId
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		deleteItem: func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+			owner = ""
+			deleted <- aws.ToString(input.TableName)
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock("x", time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	b := NewLocker(client, ctx, "locks")
+	ok, err = b.AcquireLock("x", time.Second*10)
+	assert.False(t, ok, "lock should not be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	assert.Nil(t, n.ReleaseLock("x"), "error should be nil")
+	select {
+	case table := <-deleted:
+		assert.Equal(t, "locks", table, "release should delete from the lock table")
+	case <-time.After(time.Second):
+		t.Fatal("lock was not released")
+	}
+}
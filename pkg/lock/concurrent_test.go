@@ -0,0 +1,54 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentAcquireAndRelease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewLocker(NewMemoryClient(), ctx, "locks")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("lock-%d", i)
+			for j := 0; j < 5; j++ {
+				ok, err := l.AcquireLock(name, time.Minute)
+				assert.Nil(t, err, "error should be nil")
+				assert.True(t, ok, "lock should be acquired")
+				assert.NotNil(t, l.Handle(name), "acquired lock should be held")
+				assert.Nil(t, l.ReleaseLock(name), "error should be nil")
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Empty(t, l.heldNames(), "every lock should have been released")
+}
+
+func TestConcurrentAcquireOfSameLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewLocker(NewMemoryClient(), ctx, "locks")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := l.AcquireLock("shared", time.Minute)
+			assert.Nil(t, err, "error should be nil")
+			assert.True(t, ok, "lock should be acquired")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"shared"}, l.heldNames(), "the lock should be tracked once")
+	assert.Nil(t, l.ReleaseLock("shared"), "error should be nil")
+	assert.False(t, l.holding("shared"), "a single release should give the lock up")
+}
@@ -0,0 +1,52 @@
+package infra
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// contentionAttribute counts the failed acquisitions of a lock item.
+const contentionAttribute = "contention"
+
+// countContention bumps the contention counter of a lock item.
+const countContention = "SET " + contentionAttribute + " = if_not_exists(" + contentionAttribute + ", :zero) + :one"
+
+// WithContentionCounters makes every acquisition that fails because the lock
+// is held bump a counter on the lock item, reported as LockInfo.Contention by
+// GetLockInfo and ListLocks, to find consistently hot locks. It costs an extra
+// write per failed attempt, including every retry by WaitForLock. The counter
+// lives as long as the item does: deleting a lock on release resets it, so it
+// only builds up across holders with WithReleaseCooldown or payloads.
+func WithContentionCounters() Option {
+	return func(l *Locker) {
+		l.trackContention = true
+	}
+}
+
+// recordContention counts a failed acquisition on the lock item. Counting is
+// best effort: failures are logged and otherwise ignored.
+func (l *Locker) recordContention(ctx context.Context, name string) {
+	if !l.trackContention || l.backend != nil {
+		return
+	}
+	// Only count on items that still exist, so a lock released in the meantime
+	// isn't recreated
+	condition := "attribute_exists(#key)"
+	_, err := l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                      l.attrs.key(name),
+		UpdateExpression:         aws.String(countContention),
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: l.attrs.expressionNames(nil, condition),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":zero": &dynamodbtypes.AttributeValueMemberN{Value: "0"},
+			":one":  &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+		},
+		TableName: aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil && !isConditionalCheckFailed(err) {
+		l.acquireLogger.Debug("Counting contention failed", "lockname", name, "error", err)
+	}
+}
@@ -0,0 +1,43 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentionCounters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks", WithContentionCounters())
+	b := NewLocker(client, ctx, "locks", WithContentionCounters())
+	ok, err := n.AcquireLock("hot", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	for i := 0; i < 3; i++ {
+		ok, err = b.AcquireLock("hot", time.Minute)
+		assert.Nil(t, err, "error should be nil")
+		assert.False(t, ok, "a held lock should not be acquired")
+	}
+	ok, err = b.AcquireLocks(ctx, []string{"hot", "cold"}, time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a set with a held lock should not be acquired")
+
+	info, found, err := b.GetLockInfo(ctx, "hot")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock item should be found")
+	assert.Equal(t, int64(4), info.Contention, "every failed acquisition should be counted")
+	assert.Equal(t, n.ID(), info.LockerId, "counting should leave the holder alone")
+
+	ok, err = n.AcquireLock("hot", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a held lock should be renewed")
+	info, _, _ = b.GetLockInfo(ctx, "hot")
+	assert.Equal(t, int64(4), info.Contention, "renewals should not count as contention")
+	_, found, err = b.GetLockInfo(ctx, "cold")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, found, "counting should not create lock items")
+}
@@ -0,0 +1,53 @@
+package infra
+
+import (
+	"fmt"
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CooldownMode selects who a post-release cooldown applies to.
+type CooldownMode int
+
+const (
+	// CooldownEveryone keeps every locker, including the releaser, from
+	// re-acquiring the lock until the cooldown ends.
+	CooldownEveryone CooldownMode = iota
+	// CooldownOthers lets the releaser re-acquire the lock straight away while
+	// everyone else waits out the cooldown.
+	CooldownOthers
+)
+
+// cooldownCondition holds back acquisition while a released lock is cooling
+// down. It is part of every acquisition, so a cooldown written by one Locker is
+// honoured by all of them whether or not they set a cooldown themselves.
+const cooldownCondition = "attribute_not_exists(cooldownUntilMs) or :nowMs > cooldownUntilMs or cooldownExempt = :lockerId"
+
+// WithReleaseCooldown makes released locks unavailable for d before they can be
+// acquired again, for resources that need time to settle between users. Rather
+// than deleting the item on release, the Locker clears its ownership and
+// records when the cooldown ends.
+func WithReleaseCooldown(d time.Duration, mode CooldownMode) Option {
+	return func(l *Locker) {
+		l.cooldown = d
+		l.cooldownMode = mode
+	}
+}
+
+// cooldownRelease returns the update expression and values that release a lock
+// into cooldown. ExpireAt is kept, rounded up to the end of the cooldown, so
+// TTL doesn't remove the item while it is still cooling down.
+func (l *Locker) cooldownRelease(now time.Time) (string, map[string]dynamodbtypes.AttributeValue) {
+	until := now.Add(l.cooldown)
+	values := map[string]dynamodbtypes.AttributeValue{
+		":lockerId":        &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+		":cooldownUntilMs": &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", until.UnixMilli())},
+		":cooldownUntil":   &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", until.Add(time.Second-1).Unix())},
+	}
+	update := "SET cooldownUntilMs = :cooldownUntilMs, #expiry = :cooldownUntil"
+	if l.cooldownMode == CooldownOthers {
+		update += ", cooldownExempt = :lockerId"
+	}
+	return update + " REMOVE #owner, ExpireAtMs, expiryShard, traceId", values
+}
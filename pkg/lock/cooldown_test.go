@@ -0,0 +1,58 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCooldownRelease(t *testing.T) {
+	now := time.UnixMilli(1700000000250)
+	l := &Locker{lockerId: "host-1", cooldown: 30 * time.Second}
+
+	update, values := l.cooldownRelease(now)
+	assert.Equal(t, "SET cooldownUntilMs = :cooldownUntilMs, #expiry = :cooldownUntil REMOVE #owner, ExpireAtMs, expiryShard, traceId", update,
+		"release should clear ownership and record the cooldown")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberN{Value: "1700000030250"}, values[":cooldownUntilMs"], "cooldown should end 30s after release")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberN{Value: "1700000031"}, values[":cooldownUntil"], "ExpireAt should be rounded up")
+
+	l.cooldownMode = CooldownOthers
+	update, _ = l.cooldownRelease(now)
+	assert.Contains(t, update, "cooldownExempt = :lockerId", "releaser should be exempt")
+}
+
+func TestReleaseCooldown(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks", WithReleaseCooldown(time.Second*2, CooldownOthers))
+	ok, err := n.AcquireLock(testLock, time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, n.ReleaseMany(ctx, []string{testLock}), "error should be nil")
+
+	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err = b.AcquireLock(testLock, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "lock should be cooling down")
+
+	ok, err = n.AcquireLock(testLock, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "releaser should be exempt from the cooldown")
+	assert.Nil(t, n.ReleaseMany(ctx, []string{testLock}), "error should be nil")
+
+	time.Sleep(time.Second * 3)
+	ok, err = b.AcquireLock(testLock, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired after the cooldown")
+}
@@ -0,0 +1,199 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dataAttribute is the lock item attribute holding the guarded payload. DATA
+// is a DynamoDB reserved word, so expressions refer to it as #data.
+const dataAttribute = "data"
+
+// bumpDataVersion increments dataVersion, which counts payload writes so that
+// UpdateData can detect a payload changed since it was read.
+const bumpDataVersion = "dataVersion = if_not_exists(dataVersion, :zero) + :one"
+
+// WithData stores data with the lock when it is acquired, replacing any
+// payload left by a previous holder. Payloads larger than MaxDataSize fail
+// the acquisition with an error wrapping ErrDataTooLarge.
+func WithData(data []byte) AcquireOption {
+	return func(o *acquireOptions) {
+		o.data = data
+	}
+}
+
+// Data returns the payload stored with a held lock: the one set with WithData,
+// SetData or UpdateData, or else the one left by the previous holder when the
+// lock was acquired. It returns nil if the lock carries no payload, and an error
+// wrapping ErrNotHeld if the lock isn't held.
+func (l *Locker) Data(name string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, held := l.locksHeld[name]; !held {
+		return nil, fmt.Errorf("reading data of lock %s : %w", name, ErrNotHeld)
+	}
+	return l.data[name], nil
+}
+
+// SetData replaces the payload stored with a lock this Locker holds, such as a
+// cursor to resume the guarded job from. The write is conditioned on
+// ownership, so it fails with an error wrapping ErrNotHeld once the lock has
+// been lost. A payload can be at most MaxDataSize bytes.
+func (l *Locker) SetData(ctx context.Context, name string, data []byte) error {
+	if err := l.dynamoOnly("setting lock data"); err != nil {
+		return err
+	}
+	if l.closed() {
+		return ErrClosed
+	}
+	if err := checkDataSize(data); err != nil {
+		return fmt.Errorf("setting data of lock %s : %w", name, err)
+	}
+	_, err := l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                      l.attrs.key(name),
+		UpdateExpression:         aws.String("SET #data = :data, " + bumpDataVersion),
+		ConditionExpression:      aws.String(ownerCondition),
+		ExpressionAttributeNames: l.attrs.expressionNames(map[string]string{"#data": dataAttribute}, ownerCondition),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+			":data":     &dynamodbtypes.AttributeValueMemberB{Value: data},
+			":zero":     &dynamodbtypes.AttributeValueMemberN{Value: "0"},
+			":one":      &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+		},
+		TableName: aws.String(l.lockTable),
+	}, l.requestOptions)
+	if isConditionalCheckFailed(err) {
+		return fmt.Errorf("setting data of lock %s : %w", name, ErrNotHeld)
+	}
+	if err != nil {
+		return fmt.Errorf("setting data of lock %s : %w", name, err)
+	}
+	l.storeData(name, data)
+	return nil
+}
+
+// UpdateData replaces the payload of a held lock with the result of applying
+// fn to the current one. The payload is read with a consistent read and
+// written back only if this Locker still holds the lock and nobody has written
+// the payload since, so a delayed write from a previous holder can never
+// overwrite newer state. If the payload changed under it while the lock is
+// still held, fn is applied again to the new payload. Losing the lock fails
+// with an error wrapping ErrNotHeld, and an error from fn is returned as is.
+func (l *Locker) UpdateData(ctx context.Context, name string, fn func(data []byte) ([]byte, error)) error {
+	if err := l.dynamoOnly("updating lock data"); err != nil {
+		return err
+	}
+	if l.closed() {
+		return ErrClosed
+	}
+	key := l.attrs.key(name)
+	for {
+		out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+			TableName:      aws.String(l.lockTable),
+		}, l.requestOptions)
+		if err != nil {
+			return fmt.Errorf("reading data of lock %s : %w", name, err)
+		}
+		if owner, _ := out.Item[l.attrs.Owner].(*dynamodbtypes.AttributeValueMemberS); owner == nil || owner.Value != l.lockerId {
+			return fmt.Errorf("updating data of lock %s : %w", name, ErrNotHeld)
+		}
+		data, err := fn(itemData(out.Item))
+		if err != nil {
+			return err
+		}
+		if err := checkDataSize(data); err != nil {
+			return fmt.Errorf("updating data of lock %s : %w", name, err)
+		}
+
+		values := map[string]dynamodbtypes.AttributeValue{
+			":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+			":data":     &dynamodbtypes.AttributeValueMemberB{Value: data},
+			":zero":     &dynamodbtypes.AttributeValueMemberN{Value: "0"},
+			":one":      &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+		}
+		condition := ownerCondition + " and attribute_not_exists(dataVersion)"
+		if version, ok := out.Item["dataVersion"].(*dynamodbtypes.AttributeValueMemberN); ok {
+			condition = ownerCondition + " and dataVersion = :version"
+			values[":version"] = version
+		}
+		_, err = l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			Key:                                 key,
+			UpdateExpression:                    aws.String("SET #data = :data, " + bumpDataVersion),
+			ConditionExpression:                 aws.String(condition),
+			ExpressionAttributeNames:            l.attrs.expressionNames(map[string]string{"#data": dataAttribute}, condition),
+			ExpressionAttributeValues:           values,
+			ReturnValuesOnConditionCheckFailure: dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+			TableName:                           aws.String(l.lockTable),
+		}, l.requestOptions)
+		var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+		switch {
+		case errors.As(err, &conditionFailed):
+			if owner, _ := conditionFailed.Item[l.attrs.Owner].(*dynamodbtypes.AttributeValueMemberS); owner == nil || owner.Value != l.lockerId {
+				return fmt.Errorf("updating data of lock %s : %w", name, ErrNotHeld)
+			}
+			l.adminLogger.Debug("Lock data changed during update, retrying", "lockname", name)
+		case err != nil:
+			return fmt.Errorf("updating data of lock %s : %w", name, err)
+		default:
+			l.storeData(name, data)
+			return nil
+		}
+	}
+}
+
+// storeData records the payload of a held lock, or forgets it if data is nil.
+func (l *Locker) storeData(name string, data []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if data == nil {
+		delete(l.data, name)
+		return
+	}
+	if l.data == nil {
+		l.data = map[string][]byte{}
+	}
+	l.data[name] = data
+}
+
+// hasData reports whether a held lock carries a payload, in which case its
+// item is kept on release so that the next holder receives the payload.
+func (l *Locker) hasData(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.data[name]
+	return ok
+}
+
+// itemData returns the payload of a lock item, or nil if it has none.
+func itemData(item map[string]dynamodbtypes.AttributeValue) []byte {
+	if v, ok := item[dataAttribute].(*dynamodbtypes.AttributeValueMemberB); ok {
+		return v.Value
+	}
+	return nil
+}
+
+// releaseUpdate returns the update expression and values that release a lock
+// while keeping its item, for locks cooling down or carrying a payload.
+func (l *Locker) releaseUpdate(now time.Time) (string, map[string]dynamodbtypes.AttributeValue) {
+	update, values := "REMOVE #owner, #expiry, ExpireAtMs, expiryShard, traceId", map[string]dynamodbtypes.AttributeValue{
+		":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+	}
+	if l.cooldown > 0 {
+		update, values = l.cooldownRelease(now)
+	}
+	if l.terraform {
+		update += ", Info"
+	}
+	if l.javaCompat {
+		update = javaRelease(update, values)
+	}
+	return update, values
+}
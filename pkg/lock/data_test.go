@@ -0,0 +1,133 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataReturnedOnAcquisition(t *testing.T) {
+	released := make(chan string, 1)
+	client := &fakeClient{updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		if input.ConditionExpression != nil && *input.ConditionExpression == ownerCondition {
+			released <- *input.UpdateExpression
+			return &dynamodb.UpdateItemOutput{}, nil
+		}
+		return &dynamodb.UpdateItemOutput{Attributes: map[string]dynamodbtypes.AttributeValue{
+			"data": &dynamodbtypes.AttributeValueMemberB{Value: []byte("cursor=42")},
+		}}, nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := NewLocker(client, ctx, "locks")
+
+	_, err := n.Data("x")
+	assert.True(t, errors.Is(err, ErrNotHeld), "data of a lock that isn't held can't be read")
+
+	ok, err := n.AcquireLock("x", time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+	data, err := n.Data("x")
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, []byte("cursor=42"), data, "the previous holder's payload should be returned")
+
+	assert.Nil(t, n.ReleaseLock("x"), "error should be nil")
+	select {
+	case update := <-released:
+		assert.NotContains(t, update, "data", "release should keep the payload")
+	case <-time.After(time.Second):
+		t.Fatal("lock was not released")
+	}
+}
+
+func TestSetDataRequiresOwnership(t *testing.T) {
+	client := &fakeClient{updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		return nil, &dynamodbtypes.ConditionalCheckFailedException{}
+	}}
+	n := NewLocker(client, context.Background(), "locks")
+	defer n.Close(context.Background())
+	err := n.SetData(context.Background(), "x", []byte("cursor=43"))
+	assert.True(t, errors.Is(err, ErrNotHeld), "a lost lock's payload can't be set")
+}
+
+func TestLockData(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err := n.AcquireLock(testLock, time.Second*10, WithData([]byte("cursor=1")))
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, n.SetData(ctx, testLock, []byte("cursor=2")), "error should be nil")
+	assert.Nil(t, n.ReleaseMany(ctx, []string{testLock}), "error should be nil")
+
+	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err = b.AcquireLock(testLock, time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+	data, err := b.Data(testLock)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, []byte("cursor=2"), data, "the next holder should receive the payload")
+}
+
+func TestUpdateDataRetriesOnVersionConflict(t *testing.T) {
+	item := map[string]dynamodbtypes.AttributeValue{
+		"data":        &dynamodbtypes.AttributeValueMemberB{Value: []byte("1")},
+		"dataVersion": &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+	}
+	var n *Locker
+	writes := 0
+	client := &fakeClient{
+		getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			item["lockerId"] = &dynamodbtypes.AttributeValueMemberS{Value: n.lockerId}
+			return &dynamodb.GetItemOutput{Item: item}, nil
+		},
+		updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			writes++
+			if input.ExpressionAttributeValues[":version"].(*dynamodbtypes.AttributeValueMemberN).Value != "2" {
+				// A concurrent update got there first
+				item["data"] = &dynamodbtypes.AttributeValueMemberB{Value: []byte("2")}
+				item["dataVersion"] = &dynamodbtypes.AttributeValueMemberN{Value: "2"}
+				return nil, &dynamodbtypes.ConditionalCheckFailedException{Item: item}
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	n = NewLocker(client, context.Background(), "locks")
+	defer n.Close(context.Background())
+
+	var seen []string
+	err := n.UpdateData(context.Background(), "x", func(data []byte) ([]byte, error) {
+		seen = append(seen, string(data))
+		return append(data, '+'), nil
+	})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, []string{"1", "2"}, seen, "fn should be applied again to the newer payload")
+	assert.Equal(t, 2, writes, "the conflicting write should be retried once")
+}
+
+func TestUpdateDataRequiresOwnership(t *testing.T) {
+	client := &fakeClient{getItem: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		return &dynamodb.GetItemOutput{Item: map[string]dynamodbtypes.AttributeValue{
+			"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "someone-else"},
+		}}, nil
+	}}
+	n := NewLocker(client, context.Background(), "locks")
+	defer n.Close(context.Background())
+	err := n.UpdateData(context.Background(), "x", func(data []byte) ([]byte, error) {
+		t.Fatal("fn should not run for a lock that isn't held")
+		return nil, nil
+	})
+	assert.True(t, errors.Is(err, ErrNotHeld), "a lock that isn't held can't be updated")
+}
@@ -0,0 +1,64 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Driver opens a Locker from a URL. Drivers register themselves for a URL
+// scheme with Register, so applications can choose a backend through
+// configuration alone by calling Open.
+type Driver interface {
+	Open(ctx context.Context, u *url.URL, opts ...Option) (*Locker, error)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// Register makes a driver available for the given URL scheme. It panics if the
+// driver is nil or a driver is already registered for the scheme.
+func Register(scheme string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("lock: Register driver is nil")
+	}
+	if _, dup := drivers[scheme]; dup {
+		panic("lock: Register called twice for scheme " + scheme)
+	}
+	drivers[scheme] = driver
+}
+
+// Drivers returns the sorted list of registered URL schemes.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	var schemes []string
+	for scheme := range drivers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open opens a Locker using the driver registered for the URL's scheme, for
+// example "dynamodb://locks?region=us-east-1". The context plays the same role
+// as the one passed to NewLocker.
+func Open(ctx context.Context, rawURL string, opts ...Option) (*Locker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing locker url %q : %w", rawURL, err)
+	}
+	driversMu.RLock()
+	driver, ok := drivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no locker driver registered for scheme %q", u.Scheme)
+	}
+	return driver.Open(ctx, u, opts...)
+}
@@ -0,0 +1,62 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func init() {
+	Register("dynamodb", dynamodbDriver{})
+}
+
+// dynamodbDriver opens Lockers from URLs of the form
+//
+//	dynamodb://<table>?region=<region>&endpoint=<endpoint>&fallback=mem
+//
+// The region and endpoint are optional and default to the SDK configuration.
+// With fallback=mem, a URL without an endpoint opens an in-process lock table
+// like the mem driver does when no AWS credentials can be found, so services
+// can run locally without DynamoDB.
+type dynamodbDriver struct{}
+
+func (dynamodbDriver) Open(ctx context.Context, u *url.URL, opts ...Option) (*Locker, error) {
+	table := u.Host
+	if table == "" {
+		return nil, fmt.Errorf("dynamodb locker url %q has no table name", u.String())
+	}
+	query := u.Query()
+	var loadOpts []func(*config.LoadOptions) error
+	if region := query.Get("region"); region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(region))
+	}
+	endpoint := query.Get("endpoint")
+	fallback := query.Get("fallback")
+	if fallback != "" && fallback != "mem" {
+		return nil, fmt.Errorf("dynamodb locker url %q has unknown fallback %q", u.String(), fallback)
+	}
+	awsConf, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if fallback != "" && endpoint == "" {
+		if err == nil {
+			_, err = awsConf.Credentials.Retrieve(ctx)
+		}
+		if err != nil {
+			l := openMemory(ctx, table, opts...)
+			l.adminLogger.Warn("No AWS credentials found, using an in-process lock table", "table", table, "error", err)
+			return l, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration : %w", err)
+	}
+	client := dynamodb.NewFromConfig(awsConf, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return NewLocker(client, ctx, table, opts...), nil
+}
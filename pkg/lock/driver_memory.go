@@ -0,0 +1,39 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+func init() {
+	Register("mem", memoryDriver{})
+}
+
+// sharedMemory backs every Locker opened from a mem URL, so that Lockers in
+// the same process contend with each other as they would on a shared table.
+var sharedMemory = NewMemoryClient()
+
+// memoryDriver opens Lockers from URLs of the form
+//
+//	mem://<table>
+//
+// backed by a MemoryClient shared by the whole process. It is meant for local
+// development and tests: locks are not shared with other processes.
+type memoryDriver struct{}
+
+func (memoryDriver) Open(ctx context.Context, u *url.URL, opts ...Option) (*Locker, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("mem locker url %q has no table name", u.String())
+	}
+	return openMemory(ctx, u.Host, opts...), nil
+}
+
+func openMemory(ctx context.Context, table string, opts ...Option) *Locker {
+	l := NewLocker(sharedMemory, ctx, table, opts...)
+	sharedMemory.defineTableIfMissing(table, l.attrs.Key)
+	if l.historyTable != "" {
+		sharedMemory.defineTableIfMissing(l.historyTable, "name", "acquiredAtMs")
+	}
+	return l
+}
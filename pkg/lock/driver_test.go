@@ -0,0 +1,34 @@
+package infra
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingDriver struct {
+	opened *url.URL
+}
+
+func (d *recordingDriver) Open(ctx context.Context, u *url.URL, opts ...Option) (*Locker, error) {
+	d.opened = u
+	return NewLocker(nil, ctx, u.Host, opts...), nil
+}
+
+func TestOpenUsesRegisteredDriver(t *testing.T) {
+	d := &recordingDriver{}
+	Register("recording", d)
+	assert.Contains(t, Drivers(), "dynamodb", "dynamodb driver should be registered")
+	assert.Contains(t, Drivers(), "recording", "test driver should be registered")
+
+	l, err := Open(context.Background(), "recording://my-table?x=1")
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, "my-table", l.lockTable, "table should come from the url")
+	assert.Equal(t, "1", d.opened.Query().Get("x"), "driver should see the query")
+
+	_, err = Open(context.Background(), "nope://table")
+	assert.NotNil(t, err, "unknown scheme should fail")
+	assert.Panics(t, func() { Register("recording", d) }, "duplicate registration should panic")
+}
@@ -0,0 +1,69 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// WouldAcquire reports whether AcquireLock would currently succeed for name,
+// without writing to the table. It reads the lock item with a consistent read
+// and evaluates the same conditions acquisition does, so schedulers can plan
+// which locks they could take. The answer can be out of date as soon as it is
+// returned.
+func (l *Locker) WouldAcquire(ctx context.Context, name string) (bool, error) {
+	if err := l.dynamoOnly("evaluating acquisition"); err != nil {
+		return false, err
+	}
+	if l.closed() {
+		return false, ErrClosed
+	}
+	out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            l.attrs.key(name),
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil {
+		return false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	return l.attrs.acquirable(out.Item, l.lockerId, l.takeoverTime(time.Now())) && !l.terraformHeld(out.Item), nil
+}
+
+// acquirable evaluates acquireCondition and cooldownCondition against a lock
+// item. As in DynamoDB condition expressions, comparisons involving a missing
+// attribute are false.
+func (a AttributeNames) acquirable(item map[string]dynamodbtypes.AttributeValue, lockerId string, now time.Time) bool {
+	owner, hasOwner := stringAttr(item, a.Owner)
+	expireAt, hasExpireAt := numberAttr(item, a.Expiry)
+	expireAtMs, hasExpireAtMs := numberAttr(item, "ExpireAtMs")
+	free := !hasOwner || owner == lockerId ||
+		(!hasExpireAtMs && hasExpireAt && now.Unix() > expireAt) ||
+		(hasExpireAtMs && hasExpireAt && now.UnixMilli() > expireAtMs && now.Unix() >= expireAt)
+
+	cooldownUntilMs, cooling := numberAttr(item, "cooldownUntilMs")
+	exempt, hasExempt := stringAttr(item, "cooldownExempt")
+	settled := !cooling || now.UnixMilli() > cooldownUntilMs || (hasExempt && exempt == lockerId)
+	return free && settled
+}
+
+func stringAttr(item map[string]dynamodbtypes.AttributeValue, name string) (string, bool) {
+	v, ok := item[name].(*dynamodbtypes.AttributeValueMemberS)
+	if !ok {
+		return "", false
+	}
+	return v.Value, true
+}
+
+func numberAttr(item map[string]dynamodbtypes.AttributeValue, name string) (int64, bool) {
+	v, ok := item[name].(*dynamodbtypes.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v.Value, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,65 @@
+package infra
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquirable(t *testing.T) {
+	now := time.UnixMilli(1700000000500)
+	n := func(v int64) dynamodbtypes.AttributeValue {
+		return &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}
+	}
+	s := func(v string) dynamodbtypes.AttributeValue {
+		return &dynamodbtypes.AttributeValueMemberS{Value: v}
+	}
+	cases := []struct {
+		name string
+		item map[string]dynamodbtypes.AttributeValue
+		want bool
+	}{
+		{"free", map[string]dynamodbtypes.AttributeValue{}, true},
+		{"ours", map[string]dynamodbtypes.AttributeValue{"lockerId": s("me"), "ExpireAt": n(1700000010), "ExpireAtMs": n(1700000010000)}, true},
+		{"held", map[string]dynamodbtypes.AttributeValue{"lockerId": s("other"), "ExpireAt": n(1700000010), "ExpireAtMs": n(1700000010000)}, false},
+		{"expired", map[string]dynamodbtypes.AttributeValue{"lockerId": s("other"), "ExpireAt": n(1700000000), "ExpireAtMs": n(1700000000250)}, true},
+		{"legacy held", map[string]dynamodbtypes.AttributeValue{"lockerId": s("other"), "ExpireAt": n(1700000000)}, false},
+		{"legacy expired", map[string]dynamodbtypes.AttributeValue{"lockerId": s("other"), "ExpireAt": n(1699999999)}, true},
+		{"stale ms expiry", map[string]dynamodbtypes.AttributeValue{"lockerId": s("other"), "ExpireAt": n(1700000010), "ExpireAtMs": n(1699999000000)}, false},
+		{"cooling down", map[string]dynamodbtypes.AttributeValue{"cooldownUntilMs": n(1700000001000)}, false},
+		{"cooled down", map[string]dynamodbtypes.AttributeValue{"cooldownUntilMs": n(1700000000000)}, true},
+		{"exempt from cooldown", map[string]dynamodbtypes.AttributeValue{"cooldownUntilMs": n(1700000001000), "cooldownExempt": s("me")}, true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, defaultAttributeNames.acquirable(c.item, "me", now), c.name)
+	}
+}
+
+func TestWouldAcquire(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err := b.WouldAcquire(ctx, testLock)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a free lock could be acquired")
+
+	ok, err = n.AcquireLock(testLock, time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+	ok, err = b.WouldAcquire(ctx, testLock)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a held lock could not be acquired")
+}
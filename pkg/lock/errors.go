@@ -0,0 +1,48 @@
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrClosed is returned by Locker methods once the Locker has been closed or
+// the context it was created with has been cancelled.
+var ErrClosed = errors.New("locker is closed")
+
+// ErrContended is wrapped by the *ContendedError TryAcquire returns when the
+// lock is held by another Locker.
+var ErrContended = errors.New("lock is held by another locker")
+
+// ContendedError reports that an acquisition failed because another Locker
+// holds the lock, rather than because DynamoDB or the Locker failed. Holder is
+// the lock item as the failed write found it; with a Backend, or a client not
+// returning the item, only its Name is set.
+type ContendedError struct {
+	Holder LockInfo
+}
+
+func (e *ContendedError) Error() string {
+	if e.Holder.LockerId == "" {
+		return fmt.Sprintf("lock %s is held by another locker", e.Holder.Name)
+	}
+	holder := e.Holder.LockerId
+	if owner := e.Holder.Owner; owner.Host != "" {
+		holder += fmt.Sprintf(" on %s (pid %d)", owner.Host, owner.PID)
+	}
+	if e.Holder.ExpiresAt.IsZero() {
+		return fmt.Sprintf("lock %s is held by %s", e.Holder.Name, holder)
+	}
+	return fmt.Sprintf("lock %s is held by %s until %s", e.Holder.Name, holder, e.Holder.ExpiresAt.Format(time.RFC3339))
+}
+
+func (e *ContendedError) Unwrap() error {
+	return ErrContended
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+	return errors.As(err, &conditionFailed)
+}
@@ -0,0 +1,257 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EtcdKV is a key-value pair read from etcd.
+type EtcdKV struct {
+	Key            string
+	Value          string
+	Lease          int64
+	CreateRevision int64
+	ModRevision    int64
+}
+
+// EtcdClient is the subset of etcd's API that EtcdBackend needs, so it works
+// without tying this package to a client version. Each method maps onto one
+// clientv3 call: CreateIfAbsent is a Txn comparing the key's CreateRevision to
+// 0 that puts the key with the lease or else gets it, and ReplaceIf is a Txn
+// comparing its ModRevision. etcd grants leases in whole seconds, so Grant
+// should round ttl up.
+type EtcdClient interface {
+	// Grant creates a lease expiring after ttl unless kept alive.
+	Grant(ctx context.Context, ttl time.Duration) (int64, error)
+	// KeepAliveOnce restarts a lease's TTL, reporting false if it expired.
+	KeepAliveOnce(ctx context.Context, lease int64) (bool, error)
+	// TimeToLive returns how long a lease has left, or 0 if it expired.
+	TimeToLive(ctx context.Context, lease int64) (time.Duration, error)
+	// Revoke ends a lease and deletes its keys, reporting false if it had
+	// already expired.
+	Revoke(ctx context.Context, lease int64) (bool, error)
+	Get(ctx context.Context, key string) (EtcdKV, bool, error)
+	GetPrefix(ctx context.Context, prefix string) ([]EtcdKV, error)
+	Put(ctx context.Context, key, value string) error
+	// CreateIfAbsent puts key attached to lease if it doesn't exist,
+	// reporting whether it did and returning the key as stored.
+	CreateIfAbsent(ctx context.Context, key, value string, lease int64) (EtcdKV, bool, error)
+	// ReplaceIf puts key attached to lease if it was last written at
+	// modRevision.
+	ReplaceIf(ctx context.Context, key, value string, lease, modRevision int64) (bool, error)
+}
+
+// etcdLock is the value of a lock key.
+type etcdLock struct {
+	Owner   string `json:"owner"`
+	TraceId string `json:"traceId,omitempty"`
+	LeaseMs int64  `json:"leaseMs"`
+}
+
+// EtcdBackend is a Backend storing locks in etcd. A lock is a key attached
+// to an etcd lease with the lock's TTL, created only if absent, so etcd
+// deletes it once its holder stops renewing. Fencing tokens are the revision
+// that created the key, which grows across holders. Data is kept under a
+// separate key that outlives the lock.
+type EtcdBackend struct {
+	client EtcdClient
+	prefix string
+}
+
+var _ Backend = (*EtcdBackend)(nil)
+
+// NewEtcdBackend returns a backend storing locks under keys starting with
+// prefix, "gotrc/" if empty.
+func NewEtcdBackend(client EtcdClient, prefix string) *EtcdBackend {
+	if prefix == "" {
+		prefix = "gotrc/"
+	}
+	return &EtcdBackend{client: client, prefix: prefix}
+}
+
+func (b *EtcdBackend) lockKey(name string) string {
+	return b.prefix + "locks/" + name
+}
+
+func (b *EtcdBackend) dataKey(name string) string {
+	return b.prefix + "data/" + name
+}
+
+func (b *EtcdBackend) AcquireItem(ctx context.Context, req LockInfo, lease time.Duration) (LockInfo, bool, error) {
+	value, err := json.Marshal(etcdLock{Owner: req.LockerId, TraceId: req.TraceId, LeaseMs: lease.Milliseconds()})
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("encoding lock %s : %w", req.Name, err)
+	}
+	now := time.Now()
+	id, err := b.client.Grant(ctx, lease)
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("granting lease for lock %s : %w", req.Name, err)
+	}
+	kv, created, err := b.client.CreateIfAbsent(ctx, b.lockKey(req.Name), string(value), id)
+	if err == nil && !created {
+		// Only the owner may take over its own key, moving it to the new lease
+		var current etcdLock
+		if json.Unmarshal([]byte(kv.Value), &current) == nil && current.Owner == req.LockerId {
+			created, err = b.client.ReplaceIf(ctx, kv.Key, string(value), id, kv.ModRevision)
+			if created && err == nil {
+				b.client.Revoke(ctx, kv.Lease)
+			}
+		}
+	}
+	if err != nil || !created {
+		b.client.Revoke(ctx, id)
+		if err != nil {
+			return LockInfo{}, false, fmt.Errorf("acquiring lock %s : %w", req.Name, err)
+		}
+		return LockInfo{}, false, nil
+	}
+	// Revoking the lease deletes the key, so a lock that can't be returned
+	// isn't left held
+	if req.Data != nil {
+		if err := b.client.Put(ctx, b.dataKey(req.Name), string(req.Data)); err != nil {
+			b.client.Revoke(context.Background(), id)
+			return LockInfo{}, false, fmt.Errorf("storing data of lock %s : %w", req.Name, err)
+		}
+	}
+	data, hasData, err := b.client.Get(ctx, b.dataKey(req.Name))
+	if err != nil {
+		b.client.Revoke(context.Background(), id)
+		return LockInfo{}, false, fmt.Errorf("reading data of lock %s : %w", req.Name, err)
+	}
+	item := req
+	item.ExpiresAt = now.Add(lease)
+	item.FencingToken = kv.CreateRevision
+	item.Data = nil
+	if hasData {
+		item.Data = []byte(data.Value)
+	}
+	return item, true, nil
+}
+
+// RenewItem keeps the lock's etcd lease alive. A new lease length can't be
+// set on an existing etcd lease, so the key is then moved to a new lease.
+func (b *EtcdBackend) RenewItem(ctx context.Context, name, owner string, lease time.Duration) (bool, error) {
+	kv, current, found, err := b.get(ctx, name)
+	if err != nil || !found || current.Owner != owner {
+		return false, err
+	}
+	if current.LeaseMs == lease.Milliseconds() {
+		ok, err := b.client.KeepAliveOnce(ctx, kv.Lease)
+		if err != nil {
+			return false, fmt.Errorf("renewing lock %s : %w", name, err)
+		}
+		return ok, nil
+	}
+	current.LeaseMs = lease.Milliseconds()
+	value, err := json.Marshal(current)
+	if err != nil {
+		return false, fmt.Errorf("encoding lock %s : %w", name, err)
+	}
+	id, err := b.client.Grant(ctx, lease)
+	if err != nil {
+		return false, fmt.Errorf("granting lease for lock %s : %w", name, err)
+	}
+	ok, err := b.client.ReplaceIf(ctx, kv.Key, string(value), id, kv.ModRevision)
+	if err != nil || !ok {
+		b.client.Revoke(ctx, id)
+		if err != nil {
+			return false, fmt.Errorf("renewing lock %s : %w", name, err)
+		}
+		return false, nil
+	}
+	b.client.Revoke(ctx, kv.Lease)
+	return true, nil
+}
+
+// ReleaseItem revokes the lock's etcd lease, which deletes the key.
+func (b *EtcdBackend) ReleaseItem(ctx context.Context, name, owner string) error {
+	kv, current, found, err := b.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !found || current.Owner != owner {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	// The lease belongs to owner's key alone, so revoking it can't release a
+	// later holder's lock
+	ok, err := b.client.Revoke(ctx, kv.Lease)
+	if err != nil {
+		return fmt.Errorf("releasing lock %s : %w", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	return nil
+}
+
+func (b *EtcdBackend) GetItem(ctx context.Context, name string) (LockInfo, bool, error) {
+	kv, current, found, err := b.get(ctx, name)
+	if err != nil || !found {
+		return LockInfo{Name: name}, false, err
+	}
+	return b.info(ctx, name, kv, current)
+}
+
+func (b *EtcdBackend) ListItems(ctx context.Context) ([]LockInfo, error) {
+	prefix := b.lockKey("")
+	kvs, err := b.client.GetPrefix(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("listing locks : %w", err)
+	}
+	infos := make([]LockInfo, 0, len(kvs))
+	for _, kv := range kvs {
+		name := kv.Key[len(prefix):]
+		var current etcdLock
+		if err := json.Unmarshal([]byte(kv.Value), &current); err != nil {
+			return nil, fmt.Errorf("decoding lock %s : %w", name, err)
+		}
+		info, found, err := b.info(ctx, name, kv, current)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// get reads and decodes the named lock key.
+func (b *EtcdBackend) get(ctx context.Context, name string) (EtcdKV, etcdLock, bool, error) {
+	var current etcdLock
+	kv, found, err := b.client.Get(ctx, b.lockKey(name))
+	if err != nil {
+		return kv, current, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	if !found {
+		return kv, current, false, nil
+	}
+	if err := json.Unmarshal([]byte(kv.Value), &current); err != nil {
+		return kv, current, false, fmt.Errorf("decoding lock %s : %w", name, err)
+	}
+	return kv, current, true, nil
+}
+
+// info builds the LockInfo of a lock key, reporting false if its lease
+// expired after the key was read.
+func (b *EtcdBackend) info(ctx context.Context, name string, kv EtcdKV, current etcdLock) (LockInfo, bool, error) {
+	now := time.Now()
+	ttl, err := b.client.TimeToLive(ctx, kv.Lease)
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("reading lease of lock %s : %w", name, err)
+	}
+	if ttl <= 0 {
+		return LockInfo{Name: name}, false, nil
+	}
+	info := LockInfo{Name: name, LockerId: current.Owner, TraceId: current.TraceId, ExpiresAt: now.Add(ttl), FencingToken: kv.CreateRevision}
+	data, hasData, err := b.client.Get(ctx, b.dataKey(name))
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("reading data of lock %s : %w", name, err)
+	}
+	if hasData {
+		info.Data = []byte(data.Value)
+	}
+	return info, true, nil
+}
@@ -0,0 +1,233 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEtcd keeps keys and leases in memory, deleting a lease's keys once it
+// expires or is revoked.
+type fakeEtcd struct {
+	mu       sync.Mutex
+	revision int64
+	nextId   int64
+	kvs      map[string]EtcdKV
+	leases   map[int64]time.Time
+	ttls     map[int64]time.Duration
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: map[string]EtcdKV{}, leases: map[int64]time.Time{}, ttls: map[int64]time.Duration{}}
+}
+
+func (e *fakeEtcd) expire() {
+	for id, exp := range e.leases {
+		if time.Now().After(exp) {
+			e.revoke(id)
+		}
+	}
+}
+
+func (e *fakeEtcd) revoke(id int64) bool {
+	if _, ok := e.leases[id]; !ok {
+		return false
+	}
+	delete(e.leases, id)
+	for key, kv := range e.kvs {
+		if kv.Lease == id {
+			delete(e.kvs, key)
+		}
+	}
+	return true
+}
+
+func (e *fakeEtcd) put(key, value string, lease int64) EtcdKV {
+	e.revision++
+	kv, ok := e.kvs[key]
+	if !ok {
+		kv = EtcdKV{Key: key, CreateRevision: e.revision}
+	}
+	kv.Value, kv.Lease, kv.ModRevision = value, lease, e.revision
+	e.kvs[key] = kv
+	return kv
+}
+
+func (e *fakeEtcd) Grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextId++
+	e.leases[e.nextId], e.ttls[e.nextId] = time.Now().Add(ttl), ttl
+	return e.nextId, nil
+}
+
+func (e *fakeEtcd) KeepAliveOnce(ctx context.Context, lease int64) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expire()
+	if _, ok := e.leases[lease]; !ok {
+		return false, nil
+	}
+	e.leases[lease] = time.Now().Add(e.ttls[lease])
+	return true, nil
+}
+
+func (e *fakeEtcd) TimeToLive(ctx context.Context, lease int64) (time.Duration, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expire()
+	if exp, ok := e.leases[lease]; ok {
+		return time.Until(exp), nil
+	}
+	return 0, nil
+}
+
+func (e *fakeEtcd) Revoke(ctx context.Context, lease int64) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expire()
+	return e.revoke(lease), nil
+}
+
+func (e *fakeEtcd) Get(ctx context.Context, key string) (EtcdKV, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expire()
+	kv, ok := e.kvs[key]
+	return kv, ok, nil
+}
+
+func (e *fakeEtcd) GetPrefix(ctx context.Context, prefix string) ([]EtcdKV, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expire()
+	var kvs []EtcdKV
+	for key, kv := range e.kvs {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, kv)
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, nil
+}
+
+func (e *fakeEtcd) Put(ctx context.Context, key, value string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.put(key, value, 0)
+	return nil
+}
+
+func (e *fakeEtcd) CreateIfAbsent(ctx context.Context, key, value string, lease int64) (EtcdKV, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expire()
+	if kv, ok := e.kvs[key]; ok {
+		return kv, false, nil
+	}
+	return e.put(key, value, lease), true, nil
+}
+
+func (e *fakeEtcd) ReplaceIf(ctx context.Context, key, value string, lease, modRevision int64) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expire()
+	if kv, ok := e.kvs[key]; !ok || kv.ModRevision != modRevision {
+		return false, nil
+	}
+	e.put(key, value, lease)
+	return true, nil
+}
+
+func TestEtcdBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := NewEtcdBackend(newFakeEtcd(), "")
+	n := NewBackendLocker(backend, ctx)
+	b := NewBackendLocker(backend, ctx)
+
+	h, err := n.Acquire(ctx, "x", time.Second*10, WithTraceID("trace-1"), WithData([]byte("payload")))
+	assert.Nil(t, err, "error should be nil")
+	if !assert.NotNil(t, h, "lock should be acquired") {
+		return
+	}
+	token := h.FencingToken()
+	assert.NotZero(t, token, "the create revision should be the fencing token")
+	ok, err := b.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "held lock should not be acquired")
+
+	info, found, err := b.GetLockInfo(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock item should be found")
+	assert.Equal(t, n.ID(), info.LockerId, "the holder should be reported")
+	assert.Equal(t, "trace-1", info.TraceId, "the trace should be stored")
+	assert.Equal(t, []byte("payload"), info.Data, "the data should be stored")
+	assert.Equal(t, token, info.FencingToken, "the fencing token should be reported")
+	held, err := b.LocksHeldBy(ctx, n.ID())
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, held, 1, "locks should be listed by holder")
+
+	assert.Nil(t, h.Extend(ctx, time.Second*20), "error should be nil")
+	info, _, _ = b.GetLockInfo(ctx, "x")
+	assert.Greater(t, time.Until(info.ExpiresAt), time.Second*15, "extending should move the lock to a longer lease")
+	assert.Equal(t, token, info.FencingToken, "extending should keep the fencing token")
+	ok, err = backend.RenewItem(ctx, "x", b.ID(), time.Second)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "only the owner should renew")
+	assert.ErrorIs(t, backend.ReleaseItem(ctx, "x", b.ID()), ErrNotHeld, "only the owner should release")
+
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	locked, err := b.IsLocked(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, locked, "released lock should be free")
+	bh, err := b.Acquire(ctx, "x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	if assert.NotNil(t, bh, "released lock should be acquired") {
+		assert.Greater(t, bh.FencingToken(), token, "fencing tokens should grow across holders")
+		data, err := b.Data("x")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, []byte("payload"), data, "data should outlive the holder")
+	}
+}
+
+func TestEtcdBackendLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	backend := NewEtcdBackend(newFakeEtcd(), "")
+	_, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "a"}, time.Millisecond*20)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "free lock should be acquired")
+	_, ok, _ = backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "b"}, time.Second)
+	assert.False(t, ok, "held lock should not be acquired")
+	time.Sleep(time.Millisecond * 30)
+	_, ok, _ = backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "b"}, time.Second)
+	assert.True(t, ok, "lock should be acquired once its lease expires")
+	ok, _ = backend.RenewItem(ctx, "x", "a", time.Second)
+	assert.False(t, ok, "the previous holder should not renew")
+}
+
+// failingPut is a fakeEtcd whose plain puts, used for lock data, fail.
+type failingPut struct {
+	*fakeEtcd
+}
+
+func (e failingPut) Put(ctx context.Context, key, value string) error {
+	return errors.New("etcdserver: request timed out")
+}
+
+func TestEtcdBackendDataFailure(t *testing.T) {
+	ctx := context.Background()
+	backend := NewEtcdBackend(failingPut{newFakeEtcd()}, "")
+	_, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "a", Data: []byte("payload")}, time.Second*10)
+	assert.NotNil(t, err, "a failed data write should be an error")
+	assert.False(t, ok, "lock should not be acquired")
+	_, found, err := backend.GetItem(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, found, "the lock key should be deleted")
+}
@@ -0,0 +1,79 @@
+package infra
+
+import (
+	"time"
+)
+
+// EventType identifies what happened in an Event.
+type EventType string
+
+const (
+	// EventAcquired is emitted when the Locker takes ownership of a lock.
+	EventAcquired EventType = "acquired"
+	// EventReleased is emitted when a held lock is deleted on release.
+	EventReleased EventType = "released"
+	// EventLost is emitted when a held lock could not be refreshed.
+	EventLost EventType = "lost"
+	// EventLeaseExpiring is emitted when a held lock's lease is close to
+	// running out without having been refreshed.
+	EventLeaseExpiring EventType = "lease_expiring"
+	// EventTakeover is emitted when the Locker acquires a lock whose previous
+	// holder's lease had expired.
+	EventTakeover EventType = "takeover"
+	// EventCancelled is emitted when a lock this Locker holds or tried to
+	// acquire has been marked cancelled with BroadcastCancel.
+	EventCancelled EventType = "cancelled"
+	// EventHeartbeatStalled is emitted by the watchdog when the heartbeater
+	// hasn't completed a tick within the configured number of intervals.
+	EventHeartbeatStalled EventType = "heartbeat_stalled"
+	// EventHeartbeatRecovered is emitted when a stalled heartbeater ticks again.
+	EventHeartbeatRecovered EventType = "heartbeat_recovered"
+	// EventHoldExceeded is emitted when a lock has been held for longer than
+	// the limit set with WithHoldTimeAlert.
+	EventHoldExceeded EventType = "hold_exceeded"
+	// EventStarving is emitted when an acquirer has been waiting for a lock
+	// or semaphore for longer than its starvation threshold, and again each
+	// time its wait doubles.
+	EventStarving EventType = "starving"
+)
+
+// Event describes something notable that happened inside a Locker.
+type Event struct {
+	Type     EventType
+	LockerId string
+	// Lock is the name of the lock the event concerns, if any.
+	Lock string
+	Time time.Time
+	// Elapsed is the time since the last heartbeat for heartbeat events, how
+	// long the lock has been held for EventHoldExceeded, and how long the
+	// acquirer has been waiting for EventStarving.
+	Elapsed time.Duration
+	// Escalation counts the EventStarving reports for the same wait,
+	// starting at 1.
+	Escalation int
+	// Remaining is the lease left on the lock for EventLeaseExpiring.
+	Remaining time.Duration
+	// Reason is the reason given to BroadcastCancel for EventCancelled.
+	Reason string
+	// PreviousLockerId is the expired holder replaced in EventTakeover.
+	PreviousLockerId string
+	Err              error
+}
+
+// WithEventHandler registers a function called for every Event. Handlers run
+// synchronously on the goroutine that raised the event and must not block.
+func WithEventHandler(handler func(Event)) Option {
+	return func(l *Locker) {
+		l.eventHandlers = append(l.eventHandlers, handler)
+	}
+}
+
+func (l *Locker) emit(e Event) {
+	e.LockerId = l.lockerId
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, handler := range l.eventHandlers {
+		handler(e)
+	}
+}
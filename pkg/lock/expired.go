@@ -0,0 +1,55 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// expiryShards is how many ExpiryIndex partitions lock items are spread over,
+// so that expiry writes don't all land on one index partition.
+const expiryShards = 8
+
+func expiryShard(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return strconv.Itoa(int(h.Sum32() % expiryShards))
+}
+
+// ExpiredLocks lists lock items whose lease expired before the given time by
+// querying ExpiryIndex, which EnsureLockTable provisions. Items last written by
+// versions that didn't record expiryShard aren't in the index. Index reads are
+// eventually consistent, so a lock refreshed moments ago may still be listed.
+func (l *Locker) ExpiredLocks(ctx context.Context, before time.Time) ([]LockInfo, error) {
+	if err := l.dynamoOnly("listing expired locks"); err != nil {
+		return nil, err
+	}
+	var infos []LockInfo
+	for shard := 0; shard < expiryShards; shard++ {
+		paginator := dynamodb.NewQueryPaginator(l.client, &dynamodb.QueryInput{
+			TableName:              aws.String(l.lockTable),
+			IndexName:              aws.String(ExpiryIndex),
+			KeyConditionExpression: aws.String("expiryShard = :shard and ExpireAtMs < :before"),
+			ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+				":shard":  &dynamodbtypes.AttributeValueMemberS{Value: strconv.Itoa(shard)},
+				":before": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(before.UnixMilli(), 10)},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx, l.requestOptions)
+			if err != nil {
+				return nil, fmt.Errorf("querying locks expired before %s : %w", before, err)
+			}
+			for _, item := range page.Items {
+				infos = append(infos, l.attrs.lockInfo(item))
+			}
+		}
+	}
+	return infos, nil
+}
@@ -0,0 +1,37 @@
+package infra
+
+import (
+	"time"
+)
+
+// WithExpiryWarning raises EventLeaseExpiring when a held lock has less than
+// threshold of its lease left without having been refreshed, giving the
+// application a chance to checkpoint before ownership is actually lost. The
+// warning runs on its own timer, so it fires even if the heartbeater is stuck.
+func WithExpiryWarning(threshold time.Duration) Option {
+	return func(l *Locker) {
+		l.expiryWarning = threshold
+	}
+}
+
+// armWarning schedules the expiry warning for a lock's current lease,
+// replacing any warning scheduled for a previous lease.
+func (l *Locker) armWarning(lk *lock) {
+	if l.expiryWarning <= 0 {
+		return
+	}
+	l.disarmWarning(lk)
+	name, expiresAt := lk.name, lk.expiresAt
+	lk.warning = time.AfterFunc(time.Until(expiresAt)-l.expiryWarning, func() {
+		remaining := time.Until(expiresAt)
+		l.heartbeatLogger.Warn("Lock lease about to expire", "lockname", name, "remaining", remaining)
+		l.emit(Event{Type: EventLeaseExpiring, Lock: name, Remaining: remaining})
+	})
+}
+
+func (l *Locker) disarmWarning(lk *lock) {
+	if lk.warning != nil {
+		lk.warning.Stop()
+		lk.warning = nil
+	}
+}
@@ -0,0 +1,44 @@
+package infra
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiryWarningFiresBeforeLeaseEnds(t *testing.T) {
+	events := make(chan Event, 10)
+	l := &Locker{heartbeatLogger: slog.Default(), expiryWarning: 50 * time.Millisecond}
+	WithEventHandler(func(e Event) { events <- e })(l)
+
+	lk := lock{name: "x", expiresAt: time.Now().Add(100 * time.Millisecond)}
+	l.armWarning(&lk)
+	select {
+	case e := <-events:
+		assert.Equal(t, EventLeaseExpiring, e.Type, "expiry warning should be raised")
+		assert.Equal(t, "x", e.Lock, "warning should name the lock")
+		assert.True(t, e.Remaining > 0 && e.Remaining <= 50*time.Millisecond, "remaining lease should be within the threshold")
+	case <-time.After(time.Second):
+		t.Fatal("no expiry warning")
+	}
+}
+
+func TestExpiryWarningRearmedOnRefresh(t *testing.T) {
+	events := make(chan Event, 10)
+	l := &Locker{heartbeatLogger: slog.Default(), expiryWarning: 50 * time.Millisecond}
+	WithEventHandler(func(e Event) { events <- e })(l)
+
+	lk := lock{name: "x", expiresAt: time.Now().Add(60 * time.Millisecond)}
+	l.armWarning(&lk)
+	lk.expiresAt = time.Now().Add(time.Hour)
+	l.armWarning(&lk)
+	defer l.disarmWarning(&lk)
+	select {
+	case <-events:
+		t.Fatal("refreshed lease should not warn")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
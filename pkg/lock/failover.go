@@ -0,0 +1,158 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// FailoverPolicy decides what a FailoverLocker does when the primary table
+// cannot be reached.
+type FailoverPolicy int
+
+const (
+	// FailClosed reports the primary's error and acquires nothing. Mutual
+	// exclusion is preserved at the cost of availability.
+	FailClosed FailoverPolicy = iota
+	// FailOpen acquires the lock on the secondary table instead. Processes that
+	// can still reach the primary may be granted the same lock there, so only
+	// use this for locks where availability matters more than exclusivity.
+	FailOpen
+)
+
+// FailoverLocker acquires locks on a primary Locker and, for lock classes
+// configured to fail open, falls back to a secondary Locker (typically backed
+// by a table in another region) when the primary is unavailable. Contention on
+// the primary never triggers failover.
+type FailoverLocker struct {
+	primary       *Locker
+	secondary     *Locker
+	defaultPolicy FailoverPolicy
+	policies      map[string]FailoverPolicy
+	mu            sync.Mutex
+	heldOn        map[string]*Locker
+}
+
+// FailoverOption configures a FailoverLocker.
+type FailoverOption func(*FailoverLocker)
+
+// WithDefaultFailoverPolicy sets the policy for locks not matched by a
+// WithFailoverPolicy prefix. The default is FailClosed.
+func WithDefaultFailoverPolicy(policy FailoverPolicy) FailoverOption {
+	return func(f *FailoverLocker) {
+		f.defaultPolicy = policy
+	}
+}
+
+// WithFailoverPolicy sets the policy for locks whose name starts with prefix.
+// The longest matching prefix wins.
+func WithFailoverPolicy(prefix string, policy FailoverPolicy) FailoverOption {
+	return func(f *FailoverLocker) {
+		f.policies[prefix] = policy
+	}
+}
+
+// NewFailoverLocker returns a FailoverLocker that acquires locks on primary,
+// falling back to secondary for lock classes whose policy is FailOpen. Both
+// Lockers should be configured alike, apart from the table they use.
+func NewFailoverLocker(primary, secondary *Locker, opts ...FailoverOption) *FailoverLocker {
+	f := &FailoverLocker{
+		primary:   primary,
+		secondary: secondary,
+		policies:  map[string]FailoverPolicy{},
+		heldOn:    map[string]*Locker{},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (f *FailoverLocker) policy(name string) FailoverPolicy {
+	policy, matched := f.defaultPolicy, -1
+	for prefix, p := range f.policies {
+		if strings.HasPrefix(name, prefix) && len(prefix) > matched {
+			policy, matched = p, len(prefix)
+		}
+	}
+	return policy
+}
+
+// unavailable reports whether err means the table couldn't be reached or
+// couldn't serve the request, as opposed to the Locker refusing it or the
+// caller giving up.
+func unavailable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var sendErr *smithyhttp.RequestSendError
+	var netErr net.Error
+	return isTransient(err) || errors.As(err, &sendErr) || errors.As(err, &netErr)
+}
+
+// AcquireLock acquires the lock on the primary table. If the primary is
+// unavailable and the lock's policy is FailOpen, it acquires the lock on the
+// secondary table instead. Any other error from the primary is returned as is.
+func (f *FailoverLocker) AcquireLock(name string, timeout time.Duration, opts ...AcquireOption) (bool, error) {
+	ok, err := f.primary.AcquireLock(name, timeout, opts...)
+	if err == nil || !unavailable(err) || f.policy(name) == FailClosed {
+		if ok {
+			f.record(name, f.primary)
+		}
+		return ok, err
+	}
+	f.primary.acquireLogger.Warn("Primary lock table unavailable, failing over", "lockname", name, "error", err)
+	ok, secondaryErr := f.secondary.AcquireLock(name, timeout, opts...)
+	if secondaryErr != nil {
+		return false, fmt.Errorf("lock %s unavailable on primary (%v) and secondary : %w", name, err, secondaryErr)
+	}
+	if ok {
+		f.record(name, f.secondary)
+	}
+	return ok, nil
+}
+
+// record notes that name is held on l. A copy still held on the other table,
+// from before a failover or a recovery, is released so it isn't leaked.
+func (f *FailoverLocker) record(name string, l *Locker) {
+	f.mu.Lock()
+	previous, held := f.heldOn[name]
+	f.heldOn[name] = l
+	f.mu.Unlock()
+	if !held || previous == l {
+		return
+	}
+	// Reentrant holds are released one at a time
+	for previous.Holds(name) > 0 {
+		if err := previous.ReleaseLock(name); err != nil {
+			if !errors.Is(err, ErrNotHeld) {
+				previous.acquireLogger.Warn("Failed to release lock held on the other table", "lockname", name, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// ReleaseLock releases the lock on whichever table it was acquired from.
+func (f *FailoverLocker) ReleaseLock(name string) error {
+	f.mu.Lock()
+	l, ok := f.heldOn[name]
+	delete(f.heldOn, name)
+	f.mu.Unlock()
+	if !ok {
+		l = f.primary
+	}
+	return l.ReleaseLock(name)
+}
+
+// Close closes both Lockers, releasing the locks held on either table, and
+// returns their errors joined.
+func (f *FailoverLocker) Close(ctx context.Context) error {
+	return errors.Join(f.primary.Close(ctx), f.secondary.Close(ctx))
+}
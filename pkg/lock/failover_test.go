@@ -0,0 +1,98 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// outageClient is a MemoryClient whose writes fail to reach the table while
+// down is set.
+type outageClient struct {
+	*MemoryClient
+	down atomic.Bool
+}
+
+func (c *outageClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if c.down.Load() {
+		return nil, &smithyhttp.RequestSendError{Err: errors.New("connection refused")}
+	}
+	return c.MemoryClient.UpdateItem(ctx, params, optFns...)
+}
+
+func TestFailoverPolicyLongestPrefix(t *testing.T) {
+	f := NewFailoverLocker(nil, nil,
+		WithFailoverPolicy("batch/", FailOpen),
+		WithFailoverPolicy("batch/billing/", FailClosed))
+
+	assert.Equal(t, FailClosed, f.policy("migrations"), "default policy should fail closed")
+	assert.Equal(t, FailOpen, f.policy("batch/reports"), "prefix policy should apply")
+	assert.Equal(t, FailClosed, f.policy("batch/billing/run"), "longest prefix should win")
+
+	open := NewFailoverLocker(nil, nil, WithDefaultFailoverPolicy(FailOpen))
+	assert.Equal(t, FailOpen, open.policy("anything"), "default policy should be configurable")
+}
+
+func TestFailoverLocker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &outageClient{MemoryClient: NewMemoryClient()}
+	primary := NewLocker(client, ctx, "locks")
+	secondary := NewLocker(NewMemoryClient(), ctx, "locks")
+	f := NewFailoverLocker(primary, secondary, WithFailoverPolicy("batch/", FailOpen))
+
+	client.down.Store(true)
+	ok, err := f.AcquireLock("migrations", time.Second*10)
+	assert.NotNil(t, err, "an unavailable primary should be an error when failing closed")
+	assert.False(t, ok, "lock should not be acquired when failing closed")
+	assert.False(t, secondary.holding("migrations"), "failing closed should not touch the secondary")
+
+	ok, err = f.AcquireLock("batch/reports", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired on the secondary")
+	assert.True(t, secondary.holding("batch/reports"), "secondary should hold the lock")
+
+	assert.Nil(t, f.ReleaseLock("batch/reports"), "release should be routed to the secondary")
+	assert.False(t, secondary.holding("batch/reports"), "secondary copy should be released")
+
+	// A lock taken on the secondary and re-acquired once the primary is back
+	// isn't left held on the secondary
+	ok, err = f.AcquireLock("batch/nightly", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired on the secondary")
+	client.down.Store(false)
+	ok, err = f.AcquireLock("batch/nightly", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired on the primary")
+	assert.True(t, primary.holding("batch/nightly"), "primary should hold the lock")
+	assert.False(t, secondary.holding("batch/nightly"), "secondary copy should be released")
+	assert.Nil(t, f.ReleaseLock("batch/nightly"), "release should be routed to the primary")
+	assert.False(t, primary.holding("batch/nightly"), "primary copy should be released")
+}
+
+func TestFailoverLockerReturnsOtherErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary := NewLocker(NewMemoryClient(), ctx, "locks", WithMaxHeldLocks(1))
+	secondary := NewLocker(NewMemoryClient(), ctx, "locks")
+	f := NewFailoverLocker(primary, secondary, WithDefaultFailoverPolicy(FailOpen))
+
+	ok, err := f.AcquireLock("a", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	ok, err = f.AcquireLock("b", time.Second*10)
+	assert.ErrorIs(t, err, ErrTooManyLocks, "the primary's error should be returned unchanged")
+	assert.False(t, ok, "lock should not be acquired")
+	assert.False(t, secondary.holding("b"), "a refused acquisition should not fail over")
+
+	assert.False(t, unavailable(context.Canceled), "a cancelled context is not an outage")
+	assert.False(t, unavailable(ErrLockOrderViolation), "an order violation is not an outage")
+	assert.True(t, unavailable(&attemptTimeoutError{time.Second}), "a timed out attempt is an outage")
+}
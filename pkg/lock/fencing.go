@@ -0,0 +1,54 @@
+package infra
+
+import (
+	"strconv"
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fencingAttribute holds a lock's fencing token, which grows by one on every
+// change of ownership.
+const fencingAttribute = "fencingToken"
+
+// bumpFencingToken is the SET action taking ownership adds. A lock item that
+// doesn't exist yet starts from :fencingBase, the acquisition time in
+// microseconds, so tokens keep increasing even after the item has been
+// deleted on release or by TTL: no lock changes hands a million times a
+// second.
+const bumpFencingToken = fencingAttribute + " = if_not_exists(" + fencingAttribute + ", :fencingBase) + :one"
+
+// fencingValues adds the values bumpFencingToken refers to.
+func fencingValues(values map[string]dynamodbtypes.AttributeValue, now time.Time) {
+	values[":fencingBase"] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMicro(), 10)}
+	values[":one"] = &dynamodbtypes.AttributeValueMemberN{Value: "1"}
+}
+
+// nextFencingToken returns the token bumpFencingToken wrote, given the item
+// as it was before.
+func nextFencingToken(old map[string]dynamodbtypes.AttributeValue, now time.Time) int64 {
+	if token, ok := numberAttr(old, fencingAttribute); ok {
+		return token + 1
+	}
+	return now.UnixMicro() + 1
+}
+
+// FencingToken returns the fencing token of this acquisition of the lock.
+// Tokens only grow from one holder to the next, so storage guarded by the
+// lock can reject writes carrying a lower token than one it has already
+// seen, which is how a holder that lost its lease without noticing is kept
+// from overwriting its successor's work. The token stays the same while the
+// lock is refreshed or extended.
+//
+// Tokens of items created after a deletion are based on the acquiring
+// Locker's clock, so clocks must not lag behind by more than the lock item
+// existed for.
+func (h *Lock) FencingToken() int64 {
+	l := h.locker
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if held, ok := l.locksHeld[h.name]; ok {
+		return held.fencingToken
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFencingTokens(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks", WithReleaseCooldown(time.Millisecond, CooldownEveryone))
+	b := NewLocker(client, ctx, "locks")
+
+	first, err := n.Acquire(ctx, "fenced", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	token := first.FencingToken()
+	assert.Greater(t, token, time.Now().Add(-time.Minute).UnixMicro(), "a new item's token should start from the clock")
+	assert.Nil(t, first.Extend(ctx, time.Second*20), "error should be nil")
+	assert.Equal(t, token, first.FencingToken(), "extending should keep the token")
+
+	// With a cooldown the item outlives the release, and so does its token
+	assert.Nil(t, first.Release(ctx), "error should be nil")
+	time.Sleep(time.Millisecond * 5)
+	second, err := b.Acquire(ctx, "fenced", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, token+1, second.FencingToken(), "each new owner should get the next token")
+
+	// Without one the item is deleted, and the next token comes from the clock
+	assert.Nil(t, second.Release(ctx), "error should be nil")
+	third, err := b.Acquire(ctx, "fenced", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.Greater(t, third.FencingToken(), token+1, "tokens should keep increasing after deletion")
+}
@@ -0,0 +1,200 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileLock is the metadata file of a lock.
+type fileLock struct {
+	Owner        string `json:"owner,omitempty"`
+	TraceId      string `json:"traceId,omitempty"`
+	ExpiresAtMs  int64  `json:"expiresAtMs"`
+	FencingToken int64  `json:"fencingToken"`
+	Data         []byte `json:"data,omitempty"`
+}
+
+// FileBackend is a Backend storing locks in a directory, for coordinating
+// processes on one machine in development. Each lock has a metadata file
+// recording its owner and lease expiry, and every change to it is made
+// holding an advisory flock on a companion lock file, so processes sharing
+// the directory see each change whole. Metadata files outlive the locks,
+// keeping the fencing token and data for the next holder. Advisory locks
+// aren't reliable on network filesystems, so the directory should be local.
+// It is only available on Unix systems; elsewhere its methods return
+// ErrUnsupported.
+type FileBackend struct {
+	dir string
+}
+
+var _ Backend = (*FileBackend)(nil)
+
+// NewFileBackend returns a backend storing locks in dir, creating it if
+// needed.
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating lock directory %s : %w", dir, err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// Lock names are escaped so names containing slashes don't nest directories.
+func (b *FileBackend) path(name, ext string) string {
+	return filepath.Join(b.dir, url.QueryEscape(name)+ext)
+}
+
+// update applies change to the named lock's metadata while holding its file
+// lock, writing the metadata back if change reports it changed.
+func (b *FileBackend) update(name string, change func(lk *fileLock) bool) error {
+	unlock, err := flock(b.path(name, ".lock"))
+	if err != nil {
+		return fmt.Errorf("locking %s : %w", name, err)
+	}
+	defer unlock()
+	lk, _, err := b.read(name)
+	if err != nil {
+		return err
+	}
+	if !change(&lk) {
+		return nil
+	}
+	buf, err := json.Marshal(lk)
+	if err != nil {
+		return fmt.Errorf("encoding lock %s : %w", name, err)
+	}
+	// Readers don't take the file lock, so replace the file whole
+	tmp := b.path(name, ".tmp")
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return fmt.Errorf("writing lock %s : %w", name, err)
+	}
+	if err := os.Rename(tmp, b.path(name, ".json")); err != nil {
+		return fmt.Errorf("writing lock %s : %w", name, err)
+	}
+	return nil
+}
+
+// read decodes the named lock's metadata, reporting false if it has none.
+func (b *FileBackend) read(name string) (fileLock, bool, error) {
+	var lk fileLock
+	buf, err := os.ReadFile(b.path(name, ".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return lk, false, nil
+	}
+	if err != nil {
+		return lk, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	if err := json.Unmarshal(buf, &lk); err != nil {
+		return lk, false, fmt.Errorf("decoding lock %s : %w", name, err)
+	}
+	return lk, true, nil
+}
+
+func (b *FileBackend) AcquireItem(ctx context.Context, req LockInfo, lease time.Duration) (LockInfo, bool, error) {
+	now := time.Now()
+	var item LockInfo
+	acquired := false
+	err := b.update(req.Name, func(lk *fileLock) bool {
+		if lk.Owner != "" && lk.Owner != req.LockerId && lk.ExpiresAtMs >= now.UnixMilli() {
+			return false
+		}
+		lk.Owner, lk.TraceId, lk.ExpiresAtMs = req.LockerId, req.TraceId, now.Add(lease).UnixMilli()
+		lk.FencingToken++
+		if req.Data != nil {
+			lk.Data = req.Data
+		}
+		item, acquired = lk.info(req.Name), true
+		return true
+	})
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("acquiring lock %s : %w", req.Name, err)
+	}
+	return item, acquired, nil
+}
+
+func (b *FileBackend) RenewItem(ctx context.Context, name, owner string, lease time.Duration) (bool, error) {
+	renewed := false
+	err := b.update(name, func(lk *fileLock) bool {
+		if lk.Owner != owner {
+			return false
+		}
+		lk.ExpiresAtMs, renewed = time.Now().Add(lease).UnixMilli(), true
+		return true
+	})
+	if err != nil {
+		return false, fmt.Errorf("renewing lock %s : %w", name, err)
+	}
+	return renewed, nil
+}
+
+func (b *FileBackend) ReleaseItem(ctx context.Context, name, owner string) error {
+	released := false
+	err := b.update(name, func(lk *fileLock) bool {
+		if lk.Owner != owner {
+			return false
+		}
+		lk.Owner, lk.TraceId, lk.ExpiresAtMs, released = "", "", 0, true
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("releasing lock %s : %w", name, err)
+	}
+	if !released {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	return nil
+}
+
+func (b *FileBackend) GetItem(ctx context.Context, name string) (LockInfo, bool, error) {
+	if err := flockSupported(); err != nil {
+		return LockInfo{}, false, err
+	}
+	lk, found, err := b.read(name)
+	if err != nil || !found || lk.Owner == "" {
+		return LockInfo{Name: name}, false, err
+	}
+	return lk.info(name), true, nil
+}
+
+func (b *FileBackend) ListItems(ctx context.Context) ([]LockInfo, error) {
+	if err := flockSupported(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing locks : %w", err)
+	}
+	var infos []LockInfo
+	for _, entry := range entries {
+		escaped, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		name, err := url.QueryUnescape(escaped)
+		if err != nil {
+			continue
+		}
+		info, found, err := b.GetItem(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+func (lk fileLock) info(name string) LockInfo {
+	return LockInfo{Name: name, LockerId: lk.Owner, TraceId: lk.TraceId, ExpiresAt: time.UnixMilli(lk.ExpiresAtMs),
+		FencingToken: lk.FencingToken, Data: lk.Data}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package infra
+
+import "fmt"
+
+func flock(path string) (func(), error) {
+	return nil, fmt.Errorf("file locks : %w", ErrUnsupported)
+}
+
+func flockSupported() error {
+	return fmt.Errorf("file locks : %w", ErrUnsupported)
+}
@@ -0,0 +1,88 @@
+//go:build unix
+
+package infra
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	// Separate backends on one directory stand in for separate processes
+	first, err := NewFileBackend(dir)
+	assert.Nil(t, err, "error should be nil")
+	second, _ := NewFileBackend(dir)
+	n := NewBackendLocker(first, ctx)
+	b := NewBackendLocker(second, ctx)
+	// Release before the directory is removed
+	defer n.Shutdown(ctx)
+	defer b.Shutdown(ctx)
+
+	h, err := n.Acquire(ctx, "jobs/x", time.Second*10, WithTraceID("trace-1"), WithData([]byte("payload")))
+	assert.Nil(t, err, "error should be nil")
+	if !assert.NotNil(t, h, "lock should be acquired") {
+		return
+	}
+	token := h.FencingToken()
+	ok, err := b.AcquireLock("jobs/x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "held lock should not be acquired")
+
+	info, found, err := b.GetLockInfo(ctx, "jobs/x")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock file should be found")
+	assert.Equal(t, n.ID(), info.LockerId, "the holder should be reported")
+	assert.Equal(t, "trace-1", info.TraceId, "the trace should be stored")
+	assert.Equal(t, []byte("payload"), info.Data, "the data should be stored")
+	held, err := b.LocksHeldBy(ctx, n.ID())
+	assert.Nil(t, err, "error should be nil")
+	if assert.Len(t, held, 1, "locks should be listed by holder") {
+		assert.Equal(t, "jobs/x", held[0].Name, "listed names should be unescaped")
+	}
+	assert.ErrorIs(t, second.ReleaseItem(ctx, "jobs/x", b.ID()), ErrNotHeld, "only the owner should release")
+
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	bh, err := b.Acquire(ctx, "jobs/x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	if assert.NotNil(t, bh, "released lock should be acquired") {
+		assert.Greater(t, bh.FencingToken(), token, "fencing tokens should grow across holders")
+		data, err := b.Data("jobs/x")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, []byte("payload"), data, "data should outlive the holder")
+	}
+}
+
+func TestFileBackendContention(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			backend, _ := NewFileBackend(dir)
+			if _, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: string(rune('a' + i))}, time.Second); ok && err == nil {
+				acquired.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), acquired.Load(), "only one acquirer should win")
+
+	backend, _ := NewFileBackend(dir)
+	_, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "y", LockerId: "a"}, time.Millisecond*20)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "free lock should be acquired")
+	time.Sleep(time.Millisecond * 30)
+	_, ok, _ = backend.AcquireItem(ctx, LockInfo{Name: "y", LockerId: "b"}, time.Second)
+	assert.True(t, ok, "lock should be acquired once its lease lapses")
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package infra
+
+import (
+	"os"
+	"syscall"
+)
+
+// flock takes an exclusive advisory lock on the file at path, creating it if
+// needed, and returns a function releasing it.
+func flock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// flockSupported reports whether this platform has advisory file locks.
+func flockSupported() error {
+	return nil
+}
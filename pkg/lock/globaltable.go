@@ -0,0 +1,71 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// ErrUnsafeGlobalTable is returned by CheckGlobalTable when Lockers could
+// write a Global Table's items in more than one region.
+var ErrUnsafeGlobalTable = errors.New("lock table is a Global Table without a home region")
+
+// WithHomeRegion sends every DynamoDB call the Locker makes to region,
+// whatever region its client was configured for. A Global Table replicates
+// writes between regions asynchronously and resolves conflicting ones by
+// keeping the last, so two Lockers writing the same lock in different
+// regions can both believe they hold it. Pinning every Locker sharing a
+// Global Table to the same home region keeps its conditional writes, and so
+// mutual exclusion, in one place; the other replicas only serve to survive
+// the loss of the home region's data.
+func WithHomeRegion(region string) Option {
+	return func(l *Locker) {
+		l.homeRegion = region
+	}
+}
+
+// NewGlobalTableLocker returns a FailoverLocker over two Lockers of a Global
+// Table, the primary pinned to home and the secondary to standby. With
+// FailClosed, locks are only ever acquired in home, and become unavailable
+// while it is down. With FailOpen, locks are acquired in standby while home
+// can't be reached, which gives up mutual exclusion with processes that can
+// still reach home, so it only suits locks where availability matters more.
+func NewGlobalTableLocker(client Client, ctx context.Context, lockTable, home, standby string, policy FailoverPolicy, opts ...Option) *FailoverLocker {
+	primary := NewLocker(client, ctx, lockTable, append(opts, WithHomeRegion(home))...)
+	secondary := NewLocker(client, ctx, lockTable, append(opts, WithHomeRegion(standby))...)
+	return NewFailoverLocker(primary, secondary, WithDefaultFailoverPolicy(policy))
+}
+
+// TableDescriber describes DynamoDB tables, as *dynamodb.Client does.
+type TableDescriber interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+}
+
+// CheckGlobalTable returns an error wrapping ErrUnsafeGlobalTable if the lock
+// table is a Global Table and home, the region its Lockers are pinned to
+// with WithHomeRegion, is empty or not one of its replicas. Call it when
+// starting up to refuse to run against a Global Table unguarded.
+func CheckGlobalTable(ctx context.Context, client TableDescriber, lockTable, home string) error {
+	described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(lockTable)})
+	if err != nil {
+		return fmt.Errorf("describing lock table %s : %w", lockTable, err)
+	}
+	var regions []string
+	for _, replica := range described.Table.Replicas {
+		regions = append(regions, aws.ToString(replica.RegionName))
+	}
+	if len(regions) == 0 {
+		return nil
+	}
+	for _, region := range regions {
+		if region == home {
+			return nil
+		}
+	}
+	return fmt.Errorf("lock table %s is replicated to %s but Lockers are pinned to %q : %w",
+		lockTable, strings.Join(regions, ", "), home, ErrUnsafeGlobalTable)
+}
@@ -0,0 +1,44 @@
+package infra
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type describedTable dynamodbtypes.TableDescription
+
+func (d describedTable) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	table := dynamodbtypes.TableDescription(d)
+	return &dynamodb.DescribeTableOutput{Table: &table}, nil
+}
+
+func TestHomeRegion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewLocker(NewMemoryClient(), ctx, "locks", WithHomeRegion("us-east-1"))
+	o := dynamodb.Options{Region: "eu-west-1"}
+	l.requestOptions(&o)
+	assert.Equal(t, "us-east-1", o.Region, "calls should be pinned to the home region")
+
+	f := NewGlobalTableLocker(NewMemoryClient(), ctx, "locks", "us-east-1", "us-west-2", FailClosed)
+	assert.Equal(t, "us-east-1", f.primary.homeRegion, "the primary should be pinned to home")
+	assert.Equal(t, "us-west-2", f.secondary.homeRegion, "the secondary should be pinned to standby")
+	assert.Equal(t, FailClosed, f.policy("x"), "the failover policy should apply to every lock")
+}
+
+func TestCheckGlobalTable(t *testing.T) {
+	ctx := context.Background()
+	global := describedTable{Replicas: []dynamodbtypes.ReplicaDescription{
+		{RegionName: aws.String("us-east-1")}, {RegionName: aws.String("eu-west-1")},
+	}}
+	assert.Nil(t, CheckGlobalTable(ctx, describedTable{}, "locks", ""), "a regional table needs no home region")
+	assert.ErrorIs(t, CheckGlobalTable(ctx, global, "locks", ""), ErrUnsafeGlobalTable, "a Global Table needs a home region")
+	assert.ErrorIs(t, CheckGlobalTable(ctx, global, "locks", "ap-south-1"), ErrUnsafeGlobalTable, "the home region should be a replica")
+	assert.Nil(t, CheckGlobalTable(ctx, global, "locks", "eu-west-1"), "a replica home region should be safe")
+}
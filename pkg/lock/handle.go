@@ -0,0 +1,201 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Lock is a handle on a lock held by a Locker, so callers can manage the lock
+// without passing its name around. A handle stays valid until the lock is no
+// longer held, which Done reports.
+type Lock struct {
+	locker *Locker
+	name   string
+	done   chan struct{}
+	// lostErr is why the lock was lost, if it was. Guarded by the Locker's mu.
+	lostErr error
+}
+
+// Acquire acquires a lock like AcquireLockContext and returns a handle on it.
+// It returns a nil Lock and a nil error if the lock is held by another Locker.
+// Use the handle's Context to have work stop when the lock is lost.
+func (l *Locker) Acquire(ctx context.Context, name string, lease time.Duration, opts ...AcquireOption) (*Lock, error) {
+	ok, err := l.AcquireLockContext(ctx, name, lease, opts...)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return l.Handle(name), nil
+}
+
+// Handle returns a handle on a lock this Locker holds, however it was
+// acquired, or nil if it doesn't hold the lock. Every call for the same
+// acquisition returns the same handle.
+func (l *Locker) Handle(name string) *Lock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if h, ok := l.handles[name]; ok {
+		return h
+	}
+	if _, held := l.locksHeld[name]; !held {
+		return nil
+	}
+	h := &Lock{locker: l, name: name, done: make(chan struct{})}
+	l.handles[name] = h
+	return h
+}
+
+// dropHandle closes the handle on a lock that is no longer held.
+func (l *Locker) dropHandle(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if h, ok := l.handles[name]; ok {
+		close(h.done)
+		delete(l.handles, name)
+	}
+}
+
+// current reports whether h is still the handle on a held lock, rather than
+// one whose lock has since been released and acquired again.
+func (h *Lock) current() bool {
+	h.locker.mu.Lock()
+	defer h.locker.mu.Unlock()
+	return h.locker.handles[h.name] == h
+}
+
+// Name returns the name of the lock.
+func (h *Lock) Name() string {
+	return h.name
+}
+
+// ExpiresAt returns when the lock's current lease runs out unless it is
+// refreshed, or the zero time once the lock is no longer held.
+func (h *Lock) ExpiresAt() time.Time {
+	l := h.locker
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.handles[h.name] != h {
+		return time.Time{}
+	}
+	if held, ok := l.locksHeld[h.name]; ok {
+		return held.expiresAt
+	}
+	return time.Time{}
+}
+
+// Done returns a channel that is closed when the lock is no longer held:
+// because it was released, its lease could not be refreshed, or the Locker
+// was closed.
+func (h *Lock) Done() <-chan struct{} {
+	return h.done
+}
+
+// Context returns a context derived from parent that is cancelled as soon as
+// the lock is no longer held, so a long critical section can select on its
+// Done channel instead of trusting the lease. If the heartbeater lost the
+// lock, because another Locker took it over or its lease lapsed without a
+// refresh, context.Cause reports why. Refreshes that fail while the lease is
+// still running are retried and don't cancel the context.
+func (h *Lock) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-h.done:
+			cancel(h.cause())
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+// cause is why the lock is no longer held.
+func (h *Lock) cause() error {
+	h.locker.mu.Lock()
+	defer h.locker.mu.Unlock()
+	if h.lostErr != nil {
+		return h.lostErr
+	}
+	return fmt.Errorf("lock %s is no longer held : %w", h.name, ErrNotHeld)
+}
+
+// Release releases the lock like ReleaseLockContext.
+func (h *Lock) Release(ctx context.Context) error {
+	if !h.current() {
+		return fmt.Errorf("releasing lock %s : %w", h.name, ErrNotHeld)
+	}
+	return h.locker.ReleaseLockContext(ctx, h.name)
+}
+
+// Extend renews the lock with a new lease starting now, which the heartbeater
+// keeps using for later refreshes.
+func (h *Lock) Extend(ctx context.Context, lease time.Duration) error {
+	if !h.current() {
+		return fmt.Errorf("extending lock %s : %w", h.name, ErrNotHeld)
+	}
+	return h.locker.requestExtend(ctx, extendRequest{ctx, h.name, lease, false, make(chan error, 1)})
+}
+
+// ExtendLock lengthens the lease of a held lock by additional, for work that
+// turns out to take longer than expected: the lock's expiry moves out by
+// additional straight away, and later refreshes use the longer lease. The
+// write is conditional on this Locker still owning the lock, and it returns
+// an error wrapping ErrNotHeld if it doesn't.
+func (l *Locker) ExtendLock(name string, additional time.Duration) error {
+	return l.requestExtend(l.ctx, extendRequest{l.ctx, name, additional, true, make(chan error, 1)})
+}
+
+func (l *Locker) requestExtend(ctx context.Context, req extendRequest) error {
+	if err := l.enter(); err != nil {
+		return err
+	}
+	if err := send(l, l.extender, req); err != nil {
+		return err
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type extendRequest struct {
+	ctx   context.Context
+	name  string
+	lease time.Duration
+	// add lengthens the current lease by lease instead of replacing it
+	add    bool
+	result chan error
+}
+
+// extend runs on the heartbeater.
+func (l *Locker) extend(ctx context.Context, name string, lease time.Duration, add bool) error {
+	l.mu.Lock()
+	lk, held := l.locksHeld[name]
+	l.mu.Unlock()
+	if !held {
+		return fmt.Errorf("extending lock %s : %w", name, ErrNotHeld)
+	}
+	start := time.Now()
+	expiresAt, timeout := start.Add(lease), lease
+	if add {
+		expiresAt, timeout = lk.expiresAt.Add(lease), lk.timeout+lease
+	}
+	ok, err := l.acquire(ctx, name, expiresAt.Sub(start))
+	if err != nil {
+		return fmt.Errorf("extending lock %s : %w", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("extending lock %s : %w", name, ErrNotHeld)
+	}
+	l.mu.Lock()
+	lk.timeout = timeout
+	lk.expiresAt = expiresAt
+	lk.refreshes = 0
+	lk.renewAt = start.Add(l.renewalDelay(lk))
+	l.renewals.fix(lk)
+	l.mu.Unlock()
+	l.armWarning(lk)
+	l.fitInterval(timeout)
+	return nil
+}
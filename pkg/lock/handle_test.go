@@ -0,0 +1,124 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockHandle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	h, err := n.Acquire(ctx, "handle", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	if !assert.NotNil(t, h, "lock should be acquired") {
+		return
+	}
+	assert.Equal(t, "handle", h.Name(), "handle should know its lock")
+	assert.Same(t, h, n.Handle("handle"), "a held lock should have one handle")
+	assert.WithinDuration(t, time.Now().Add(time.Second*10), h.ExpiresAt(), time.Second, "expiry should follow the lease")
+
+	assert.Nil(t, h.Extend(ctx, time.Second*30), "error should be nil")
+	assert.WithinDuration(t, time.Now().Add(time.Second*30), h.ExpiresAt(), time.Second, "extension should renew the lease")
+
+	b := NewLocker(client, ctx, "locks")
+	other, err := b.Acquire(ctx, "handle", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, other, "held lock should not be acquired")
+	assert.Nil(t, b.Handle("handle"), "locks not held should have no handle")
+
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("released lock should be done")
+	}
+	assert.True(t, h.ExpiresAt().IsZero(), "released lock should have no expiry")
+	assert.ErrorIs(t, h.Release(ctx), ErrNotHeld, "released handle should not release again")
+	assert.ErrorIs(t, h.Extend(ctx, time.Second), ErrNotHeld, "released handle should not extend")
+
+	again, err := n.Acquire(ctx, "handle", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.NotSame(t, h, again, "a new acquisition should get a new handle")
+	assert.Nil(t, n.Close(ctx), "error should be nil")
+	select {
+	case <-again.Done():
+	case <-time.After(time.Second):
+		t.Fatal("closing the locker should end its handles")
+	}
+}
+
+func TestLockContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	s := NewManualScheduler()
+	n := NewLocker(client, ctx, "locks", WithScheduler(func(time.Duration) Scheduler { return s }))
+
+	h, err := n.Acquire(ctx, "released", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	released, stop := h.Context(ctx)
+	defer stop()
+	assert.Nil(t, released.Err(), "a held lock's context should be live")
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	<-released.Done()
+	assert.ErrorIs(t, context.Cause(released), ErrNotHeld, "a released lock's context should say so")
+
+	h, err = n.Acquire(ctx, "stolen", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	stolen, stop := h.Context(ctx)
+	defer stop()
+	client.PutItem(ctx, &dynamodb.PutItemInput{
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":     &dynamodbtypes.AttributeValueMemberS{Value: "stolen"},
+			"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "someone-else"},
+		},
+		TableName: aws.String("locks"),
+	})
+	s.Tick(time.Now())
+	select {
+	case <-stolen.Done():
+	case <-time.After(time.Second):
+		t.Fatal("losing the lock should cancel its context")
+	}
+	assert.ErrorContains(t, context.Cause(stolen), "could not be refreshed", "the cause should be the heartbeater's error")
+	assert.ErrorIs(t, context.Cause(stolen), ErrNotHeld, "a lock taken over should not be held")
+}
+
+func TestExtendLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	h, err := n.Acquire(ctx, "long", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	expiry := h.ExpiresAt()
+
+	assert.Nil(t, n.ExtendLock("long", time.Second*20), "error should be nil")
+	assert.Equal(t, expiry.Add(time.Second*20), h.ExpiresAt(), "the expiry should move out by the extension")
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:       map[string]dynamodbtypes.AttributeValue{"name": &dynamodbtypes.AttributeValueMemberS{Value: "long"}},
+		TableName: aws.String("locks"),
+	})
+	assert.Nil(t, err, "error should be nil")
+	expireAtMs, err := numberAttribute(out.Item, "ExpireAtMs")
+	assert.Nil(t, err, "error should be nil")
+	assert.InDelta(t, h.ExpiresAt().UnixMilli(), expireAtMs, 50, "the extended expiry should be written")
+
+	assert.ErrorIs(t, n.ExtendLock("missing", time.Second), ErrNotHeld, "locks not held should not extend")
+	client.PutItem(ctx, &dynamodb.PutItemInput{
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":     &dynamodbtypes.AttributeValueMemberS{Value: "long"},
+			"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "someone-else"},
+		},
+		TableName: aws.String("locks"),
+	})
+	assert.ErrorIs(t, n.ExtendLock("long", time.Second), ErrNotHeld, "a lock taken over should not extend")
+}
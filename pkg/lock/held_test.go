@@ -0,0 +1,66 @@
+package infra
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+)
+
+// holdMany returns a Locker on a MemoryClient holding size locks.
+func holdMany(b *testing.B, ctx context.Context, size int) *Locker {
+	l := NewLocker(NewMemoryClient(), ctx, "locks",
+		WithHeartbeatLogLevel(slog.LevelWarn), WithAcquireLogLevel(slog.LevelWarn))
+	for i := 0; i < size; i++ {
+		if ok, err := l.AcquireLock(fmt.Sprintf("held-%d", i), time.Hour); !ok || err != nil {
+			b.Fatalf("acquiring held set: %v", err)
+		}
+	}
+	return l
+}
+
+// BenchmarkAcquireReleaseWithHeldLocks measures acquiring and releasing a lock
+// while many others are held, which should cost the same however many are.
+func BenchmarkAcquireReleaseWithHeldLocks(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000, 50000} {
+		b.Run(fmt.Sprintf("held-%d", size), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			l := holdMany(b, ctx, size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if ok, err := l.AcquireLock("extra", time.Hour); !ok || err != nil {
+					b.Fatalf("acquiring: %v", err)
+				}
+				if err := l.ReleaseLock("extra"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRenewalQueueOrder(t *testing.T) {
+	now := time.Now()
+	var q renewalQueue
+	locks := map[string]*lock{}
+	for i, offset := range []int{5, 1, 4, 2, 3} {
+		lk := &lock{name: fmt.Sprint(i), renewAt: now.Add(time.Duration(offset) * time.Second)}
+		locks[lk.name] = lk
+		heap.Push(&q, lk)
+	}
+	q.remove(locks["3"])
+	q.remove(locks["3"])
+	locks["0"].renewAt = now
+	q.fix(locks["0"])
+
+	var order []string
+	for q.Len() > 0 {
+		order = append(order, heap.Pop(&q).(*lock).name)
+	}
+	assert.Equal(t, []string{"0", "1", "4", "2"}, order, "locks should come out soonest first")
+}
@@ -0,0 +1,190 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// HistoryEntry records one holder of a lock. ReleasedAt is zero while the lock
+// is held, and stays zero if the holder lost the lock rather than releasing it.
+type HistoryEntry struct {
+	LockerId   string
+	TraceId    string
+	AcquiredAt time.Time
+	ReleasedAt time.Time
+}
+
+// defaultHistoryKeep is how many holders WithHistory keeps per lock when
+// asked to keep fewer than one.
+const defaultHistoryKeep = 10
+
+// WithHistory records the holders of each lock in a side table, keeping the
+// last keep of them per lock, so that who held a lock during an incident can be
+// looked up with History. The table is keyed by lock name and acquisition time
+// and can be created with EnsureHistoryTable. History is written on a best
+// effort basis: failing to record it is logged but doesn't fail acquisition or
+// release.
+func WithHistory(table string, keep int) Option {
+	return func(l *Locker) {
+		if keep < 1 {
+			keep = defaultHistoryKeep
+		}
+		l.historyTable = table
+		l.historyKeep = keep
+	}
+}
+
+// History returns the recorded holders of a lock, most recent first.
+func (l *Locker) History(ctx context.Context, name string) ([]HistoryEntry, error) {
+	if err := l.dynamoOnly("reading lock history"); err != nil {
+		return nil, err
+	}
+	if l.historyTable == "" {
+		return nil, errors.New("lock history is not enabled")
+	}
+	out, err := l.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:                aws.String(l.historyTable),
+		KeyConditionExpression:   aws.String("#name = :name"),
+		ExpressionAttributeNames: map[string]string{"#name": "name"},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":name": &dynamodbtypes.AttributeValueMemberS{Value: name},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(l.historyKeep)),
+		ConsistentRead:   aws.Bool(true),
+	}, l.requestOptions)
+	if err != nil {
+		return nil, fmt.Errorf("querying history of lock %s : %w", name, err)
+	}
+	entries := make([]HistoryEntry, 0, len(out.Items))
+	for _, item := range out.Items {
+		entries = append(entries, historyEntryFromItem(item))
+	}
+	return entries, nil
+}
+
+// recordAcquired adds a history entry for a lock this Locker has just
+// acquired and drops entries beyond the ones kept.
+func (l *Locker) recordAcquired(lk lock) {
+	if l.historyTable == "" || l.backend != nil {
+		return
+	}
+	item := map[string]dynamodbtypes.AttributeValue{
+		"name":         &dynamodbtypes.AttributeValueMemberS{Value: lk.name},
+		"acquiredAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(lk.acquiredAt.UnixMilli(), 10)},
+		"lockerId":     &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+	}
+	if lk.traceId != "" {
+		item["traceId"] = &dynamodbtypes.AttributeValueMemberS{Value: lk.traceId}
+	}
+	_, err := l.client.PutItem(l.ctx, &dynamodb.PutItemInput{TableName: aws.String(l.historyTable), Item: item}, l.requestOptions)
+	if err != nil {
+		l.adminLogger.Warn("Could not record lock history", "lockname", lk.name, "error", err)
+		return
+	}
+	if err := l.trimHistory(lk.name); err != nil {
+		l.adminLogger.Warn("Could not trim lock history", "lockname", lk.name, "error", err)
+	}
+}
+
+// recordReleased marks a lock's history entry as released.
+func (l *Locker) recordReleased(lk lock, at time.Time) {
+	if l.historyTable == "" || l.backend != nil {
+		return
+	}
+	_, err := l.client.UpdateItem(l.ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(l.historyTable),
+		Key: map[string]dynamodbtypes.AttributeValue{
+			"name":         &dynamodbtypes.AttributeValueMemberS{Value: lk.name},
+			"acquiredAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(lk.acquiredAt.UnixMilli(), 10)},
+		},
+		UpdateExpression:    aws.String("SET releasedAtMs = :releasedAtMs"),
+		ConditionExpression: aws.String("attribute_exists(acquiredAtMs)"),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":releasedAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(at.UnixMilli(), 10)},
+		},
+	}, l.requestOptions)
+	if err != nil && !isConditionalCheckFailed(err) {
+		l.adminLogger.Warn("Could not record lock release in history", "lockname", lk.name, "error", err)
+	}
+}
+
+// trimHistory deletes the entries of a lock older than the last historyKeep.
+func (l *Locker) trimHistory(name string) error {
+	paginator := dynamodb.NewQueryPaginator(l.client, &dynamodb.QueryInput{
+		TableName:                aws.String(l.historyTable),
+		KeyConditionExpression:   aws.String("#name = :name"),
+		ProjectionExpression:     aws.String("#name, acquiredAtMs"),
+		ExpressionAttributeNames: map[string]string{"#name": "name"},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":name": &dynamodbtypes.AttributeValueMemberS{Value: name},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+	seen := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(l.ctx, l.requestOptions)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			seen++
+			if seen <= l.historyKeep {
+				continue
+			}
+			if _, err := l.client.DeleteItem(l.ctx, &dynamodb.DeleteItemInput{TableName: aws.String(l.historyTable), Key: item}, l.requestOptions); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func historyEntryFromItem(item map[string]dynamodbtypes.AttributeValue) HistoryEntry {
+	var entry HistoryEntry
+	if v, ok := item["lockerId"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		entry.LockerId = v.Value
+	}
+	if v, ok := item["traceId"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		entry.TraceId = v.Value
+	}
+	if v, ok := item["acquiredAtMs"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if ms, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			entry.AcquiredAt = time.UnixMilli(ms)
+		}
+	}
+	if v, ok := item["releasedAtMs"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if ms, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			entry.ReleasedAt = time.UnixMilli(ms)
+		}
+	}
+	return entry
+}
+
+// EnsureHistoryTable creates the side table used by WithHistory if it doesn't
+// exist, and waits for it to become ACTIVE.
+func EnsureHistoryTable(ctx context.Context, client *dynamodb.Client, name string) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(name),
+		AttributeDefinitions: []dynamodbtypes.AttributeDefinition{
+			{AttributeName: aws.String("name"), AttributeType: dynamodbtypes.ScalarAttributeTypeS},
+			{AttributeName: aws.String("acquiredAtMs"), AttributeType: dynamodbtypes.ScalarAttributeTypeN},
+		},
+		KeySchema: []dynamodbtypes.KeySchemaElement{
+			{AttributeName: aws.String("name"), KeyType: dynamodbtypes.KeyTypeHash},
+			{AttributeName: aws.String("acquiredAtMs"), KeyType: dynamodbtypes.KeyTypeRange},
+		},
+		BillingMode: dynamodbtypes.BillingModePayPerRequest,
+	})
+	if err != nil && !errors.As(err, new(*dynamodbtypes.ResourceInUseException)) {
+		return fmt.Errorf("creating history table %s : %w", name, err)
+	}
+	return waitForTable(ctx, client, name)
+}
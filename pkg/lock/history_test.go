@@ -0,0 +1,56 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryEntryFromItem(t *testing.T) {
+	entry := historyEntryFromItem(map[string]dynamodbtypes.AttributeValue{
+		"name":         &dynamodbtypes.AttributeValueMemberS{Value: "orders"},
+		"lockerId":     &dynamodbtypes.AttributeValueMemberS{Value: "host-1"},
+		"acquiredAtMs": &dynamodbtypes.AttributeValueMemberN{Value: "1700000000250"},
+	})
+	assert.Equal(t, HistoryEntry{LockerId: "host-1", AcquiredAt: time.UnixMilli(1700000000250)}, entry,
+		"a held lock should have no release time")
+}
+
+func TestWithHistoryDefaultsKeep(t *testing.T) {
+	l := &Locker{}
+	WithHistory("lock-history", 0)(l)
+	assert.Equal(t, defaultHistoryKeep, l.historyKeep, "keep should default when not positive")
+}
+
+func TestLockHistory(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+	client := dynamodb.NewFromConfig(awsConf)
+	assert.Nil(t, EnsureHistoryTable(ctx, client, "lock-history"), "error should be nil")
+
+	n := NewLocker(client, ctx, "locks", WithHistory("lock-history", 2))
+	for i := 0; i < 3; i++ {
+		ok, err := n.AcquireLock(testLock, time.Second*10)
+		assert.True(t, ok, "lock should be acquired")
+		assert.Nil(t, err, "error should be nil")
+		assert.Nil(t, n.ReleaseMany(ctx, []string{testLock}), "error should be nil")
+	}
+
+	history, err := n.History(ctx, testLock)
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, history, 2, "only the last two holders should be kept")
+	for _, entry := range history {
+		assert.Equal(t, n.ID(), entry.LockerId, "holder should be recorded")
+		assert.False(t, entry.ReleasedAt.IsZero(), "release should be recorded")
+	}
+}
@@ -0,0 +1,54 @@
+package infra
+
+import (
+	"strings"
+	"time"
+)
+
+// WithHoldTimeAlert raises EventHoldExceeded when a lock whose name starts
+// with prefix has been held for longer than max, so that a stuck job sitting
+// on a critical lock is noticed before whatever waits on it stalls. An empty
+// prefix applies to every lock; when several prefixes match, the longest wins.
+// The alert is raised once per acquisition.
+func WithHoldTimeAlert(prefix string, max time.Duration) Option {
+	return func(l *Locker) {
+		if l.holdLimits == nil {
+			l.holdLimits = map[string]time.Duration{}
+		}
+		l.holdLimits[prefix] = max
+	}
+}
+
+// holdLimit returns the maximum expected hold time for a lock, or zero if none
+// is configured.
+func (l *Locker) holdLimit(name string) time.Duration {
+	var limit time.Duration
+	matched := -1
+	for prefix, max := range l.holdLimits {
+		if strings.HasPrefix(name, prefix) && len(prefix) > matched {
+			limit, matched = max, len(prefix)
+		}
+	}
+	return limit
+}
+
+// armHoldAlert schedules the hold-time alert for a newly recorded lock.
+func (l *Locker) armHoldAlert(lk *lock) {
+	limit := l.holdLimit(lk.name)
+	if limit <= 0 {
+		return
+	}
+	name, acquiredAt := lk.name, lk.acquiredAt
+	lk.holdAlert = time.AfterFunc(time.Until(acquiredAt.Add(limit)), func() {
+		held := time.Since(acquiredAt)
+		l.heartbeatLogger.Warn("Lock held longer than expected", "lockname", name, "held", held, "limit", limit)
+		l.emit(Event{Type: EventHoldExceeded, Lock: name, Elapsed: held})
+	})
+}
+
+func (l *Locker) disarmHoldAlert(lk *lock) {
+	if lk.holdAlert != nil {
+		lk.holdAlert.Stop()
+		lk.holdAlert = nil
+	}
+}
@@ -0,0 +1,51 @@
+package infra
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHoldLimitLongestPrefixWins(t *testing.T) {
+	l := &Locker{}
+	WithHoldTimeAlert("", time.Hour)(l)
+	WithHoldTimeAlert("billing/", time.Minute)(l)
+	assert.Equal(t, time.Minute, l.holdLimit("billing/invoices"), "the namespace limit should apply")
+	assert.Equal(t, time.Hour, l.holdLimit("orders"), "the default limit should apply")
+}
+
+func TestHoldAlertFires(t *testing.T) {
+	events := make(chan Event, 10)
+	l := &Locker{heartbeatLogger: slog.Default()}
+	WithHoldTimeAlert("", 50*time.Millisecond)(l)
+	WithEventHandler(func(e Event) { events <- e })(l)
+
+	lk := lock{name: "x", acquiredAt: time.Now()}
+	l.armHoldAlert(&lk)
+	select {
+	case e := <-events:
+		assert.Equal(t, EventHoldExceeded, e.Type, "hold alert should be raised")
+		assert.True(t, e.Elapsed >= 50*time.Millisecond, "elapsed should be the hold time")
+	case <-time.After(time.Second):
+		t.Fatal("no hold alert")
+	}
+}
+
+func TestHoldAlertDisarmedOnRelease(t *testing.T) {
+	events := make(chan Event, 10)
+	l := &Locker{heartbeatLogger: slog.Default()}
+	WithHoldTimeAlert("", 50*time.Millisecond)(l)
+	WithEventHandler(func(e Event) { events <- e })(l)
+
+	lk := lock{name: "x", acquiredAt: time.Now()}
+	l.armHoldAlert(&lk)
+	l.disarmHoldAlert(&lk)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %v", e.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,164 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// LockInfo describes a lock item as stored in the table.
+type LockInfo struct {
+	Name         string
+	LockerId     string
+	ExpiresAt    time.Time
+	TraceId      string
+	FencingToken int64
+	Data         []byte
+	// Contention is how many acquisitions failed on the lock while it was
+	// held, counted with WithContentionCounters.
+	Contention int64
+	// Owner describes the process holding the lock, if it was recorded.
+	Owner OwnerInfo
+}
+
+// Expired reports whether the lease had lapsed at the given time.
+func (i LockInfo) Expired(now time.Time) bool {
+	return !i.ExpiresAt.After(now)
+}
+
+// ID returns the identifier this Locker writes as the lockerId of the locks it holds.
+func (l *Locker) ID() string {
+	return l.lockerId
+}
+
+// LocksHeldBy lists the lock items owned by lockerId using HolderIndex, which
+// EnsureLockTable provisions. Items whose lease has expired are included; use
+// LockInfo.Expired to tell them apart. Index reads are eventually consistent.
+// Lockers created with NewBackendLocker filter the backend's ListItems instead.
+func (l *Locker) LocksHeldBy(ctx context.Context, lockerId string) ([]LockInfo, error) {
+	var infos []LockInfo
+	if l.backend != nil {
+		items, err := l.backend.ListItems(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing locks held by %s : %w", lockerId, err)
+		}
+		for _, item := range items {
+			if item.LockerId == lockerId {
+				infos = append(infos, item)
+			}
+		}
+		return infos, nil
+	}
+	paginator := dynamodb.NewQueryPaginator(l.client, &dynamodb.QueryInput{
+		TableName:                aws.String(l.lockTable),
+		IndexName:                aws.String(HolderIndex),
+		KeyConditionExpression:   aws.String("#owner = :lockerId"),
+		ExpressionAttributeNames: map[string]string{ownerPlaceholder: l.attrs.Owner},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: lockerId},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx, l.requestOptions)
+		if err != nil {
+			return nil, fmt.Errorf("querying locks held by %s : %w", lockerId, err)
+		}
+		for _, item := range page.Items {
+			infos = append(infos, l.attrs.lockInfo(item))
+		}
+	}
+	return infos, nil
+}
+
+// GetLockInfo reads the named lock item with a consistent read, to tell who
+// holds a lock and until when without trying to acquire it. It reports false
+// if there is no item. An item can outlive its holder, so check the LockerId
+// and Expired too: a released lock in cooldown has no LockerId, and an
+// expired lease may not have been taken over yet.
+func (l *Locker) GetLockInfo(ctx context.Context, name string) (LockInfo, bool, error) {
+	if l.backend != nil {
+		return l.backend.GetItem(ctx, name)
+	}
+	out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            l.attrs.key(name),
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	if out.Item == nil {
+		return LockInfo{Name: name}, false, nil
+	}
+	return l.attrs.lockInfo(out.Item), true, nil
+}
+
+// IsLocked reports whether any Locker holds the named lock with a lease that
+// hasn't lapsed. To keep it cheap it makes an eventually consistent read of
+// only the owner and expiry, so a change made in the last moment may not be
+// seen yet; use GetLockInfo or WouldAcquire where that matters. With
+// WithTerraformCompat or WithJavaLockClientCompat, locks held by Terraform or
+// by Java clients are reported as locked too.
+func (l *Locker) IsLocked(ctx context.Context, name string) (bool, error) {
+	if l.backend != nil {
+		info, _, err := l.backend.GetItem(ctx, name)
+		if err != nil {
+			return false, fmt.Errorf("reading lock %s : %w", name, err)
+		}
+		return info.LockerId != "" && !info.Expired(l.takeoverTime(time.Now())), nil
+	}
+	projection := "#owner, #expiry, ExpireAtMs"
+	if l.terraform {
+		projection += ", " + terraformInfoAttribute
+	}
+	if l.javaCompat {
+		projection += ", " + releasedAttribute
+	}
+	out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:                      l.attrs.key(name),
+		ProjectionExpression:     aws.String(projection),
+		ExpressionAttributeNames: l.attrs.expressionNames(nil, projection),
+		TableName:                aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil {
+		return false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	info := l.attrs.lockInfo(out.Item)
+	return l.terraformHeld(out.Item) || l.javaHeld(out.Item) || info.LockerId != "" && !info.Expired(l.takeoverTime(time.Now())), nil
+}
+
+// lockInfo reads a lock item written with these attribute names.
+func (a AttributeNames) lockInfo(item map[string]dynamodbtypes.AttributeValue) LockInfo {
+	var info LockInfo
+	if v, ok := item[a.Key].(*dynamodbtypes.AttributeValueMemberS); ok {
+		info.Name = v.Value
+	}
+	if v, ok := item[a.Owner].(*dynamodbtypes.AttributeValueMemberS); ok {
+		info.LockerId = v.Value
+	}
+	if v, ok := item["traceId"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		info.TraceId = v.Value
+	}
+	info.FencingToken, _ = numberAttr(item, fencingAttribute)
+	info.Contention, _ = numberAttr(item, contentionAttribute)
+	if info.LockerId != "" {
+		// Released items kept for a cooldown or payload still carry the last holder's
+		info.Owner = ownerInfo(item)
+	}
+	info.Data = itemData(item)
+	if v, ok := item["ExpireAtMs"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if ms, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			info.ExpiresAt = time.UnixMilli(ms)
+		}
+	} else if v, ok := item[a.Expiry].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if s, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			info.ExpiresAt = time.Unix(s, 0)
+		}
+	}
+	return info
+}
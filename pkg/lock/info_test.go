@@ -0,0 +1,119 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockInfoFromItem(t *testing.T) {
+	info := defaultAttributeNames.lockInfo(map[string]dynamodbtypes.AttributeValue{
+		"name":     &dynamodbtypes.AttributeValueMemberS{Value: "orders"},
+		"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "host-1"},
+		"ExpireAt": &dynamodbtypes.AttributeValueMemberN{Value: "1700000000"},
+	})
+	assert.Equal(t, LockInfo{Name: "orders", LockerId: "host-1", ExpiresAt: time.Unix(1700000000, 0)}, info,
+		"legacy second expiry should be read")
+	assert.True(t, info.Expired(time.Unix(1700000001, 0)), "lease should be expired after ExpiresAt")
+}
+
+func TestGetLockInfo(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := NewLocker(NewMemoryClient(), ctx, "locks")
+	ok, err := n.AcquireLock("orders", time.Second*10, WithTraceID("trace-1"), WithData([]byte("state")))
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	info, found, err := n.GetLockInfo(ctx, "orders")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock item should be found")
+	assert.Equal(t, n.ID(), info.LockerId, "the holder should be reported")
+	assert.Equal(t, "trace-1", info.TraceId, "the trace should be reported")
+	assert.Equal(t, []byte("state"), info.Data, "the payload should be reported")
+	assert.Equal(t, n.Handle("orders").FencingToken(), info.FencingToken, "the fencing token should be reported")
+	assert.WithinDuration(t, time.Now().Add(time.Second*10), info.ExpiresAt, time.Second, "the expiry should be reported")
+	locked, err := n.IsLocked(ctx, "orders")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, locked, "a held lock should be locked")
+
+	_, found, err = n.GetLockInfo(ctx, "missing")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, found, "a missing item should not be found")
+	locked, err = n.IsLocked(ctx, "missing")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, locked, "a missing lock should not be locked")
+}
+
+func TestLocksHeldBy(t *testing.T) {
+	names := []string{uuid.New().String(), uuid.New().String()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+	client := dynamodb.NewFromConfig(awsConf)
+	assert.Nil(t, EnsureLockTable(ctx, client, "locks"), "error should be nil")
+
+	n := NewLocker(client, ctx, "locks")
+	for _, name := range names {
+		ok, err := n.AcquireLock(name, time.Second*30)
+		assert.True(t, ok, "lock should be acquired")
+		assert.Nil(t, err, "error should be nil")
+	}
+
+	// The index is eventually consistent
+	var held []string
+	for i := 0; i < 10 && len(held) < len(names); i++ {
+		time.Sleep(500 * time.Millisecond)
+		infos, err := n.LocksHeldBy(ctx, n.ID())
+		assert.Nil(t, err, "error should be nil")
+		held = nil
+		for _, info := range infos {
+			held = append(held, info.Name)
+		}
+	}
+	assert.ElementsMatch(t, names, held, "index should list every held lock")
+}
+
+func TestExpiryShardIsStable(t *testing.T) {
+	assert.Equal(t, expiryShard("orders"), expiryShard("orders"), "a lock should always map to the same shard")
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		seen[expiryShard(uuid.New().String())] = true
+	}
+	assert.Len(t, seen, expiryShards, "locks should spread over every shard")
+}
+
+func TestExpiredLocks(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+	client := dynamodb.NewFromConfig(awsConf)
+	assert.Nil(t, EnsureLockTable(ctx, client, "locks"), "error should be nil")
+
+	n := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock(testLock, time.Second*1)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+	n.cancel()
+
+	found := false
+	for i := 0; i < 10 && !found; i++ {
+		time.Sleep(time.Second)
+		infos, err := n.ExpiredLocks(ctx, time.Now())
+		assert.Nil(t, err, "error should be nil")
+		for _, info := range infos {
+			found = found || info.Name == testLock
+		}
+	}
+	assert.True(t, found, "expired lock should be listed")
+}
@@ -0,0 +1,117 @@
+package infra
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attributes of the item layout used by the AWS DynamoDB Lock Client for
+// Java. Its locks have no absolute expiry: a client may take over a lock once
+// it has seen the lock's record version number stay unchanged for
+// leaseDuration milliseconds, and holders prove they are alive by changing it
+// on every heartbeat.
+const (
+	recordVersionAttribute = "recordVersionNumber"
+	leaseDurationAttribute = "leaseDuration"
+	releasedAttribute      = "isReleased"
+)
+
+// versionSeen is when a Locker first saw a lock item at a record version.
+type versionSeen struct {
+	version string
+	at      time.Time
+	lease   time.Duration
+}
+
+// WithJavaLockClientCompat makes the Locker share a table with services
+// using the AWS DynamoDB Lock Client for Java, with its default partition key
+// "key" and its item layout. The Locker writes ownerName, leaseDuration and a
+// new recordVersionNumber whenever it acquires or renews a lock, so Java
+// clients see its locks as held while it heartbeats. It takes over a lock
+// held by a Java client only once it has seen the record version number stay
+// unchanged for the lease the holder asked for, and takes released locks
+// straight away. Heartbeat intervals must be shorter than leases, as Java
+// clients take over a lock whose record version number doesn't change within
+// its lease. Use WithAttributeNames after this option if the Java clients set
+// a different partition key name.
+func WithJavaLockClientCompat() Option {
+	return func(l *Locker) {
+		l.attrs.Key = "key"
+		l.attrs.Owner = "ownerName"
+		l.javaCompat = true
+	}
+}
+
+// javaCondition lets a lock be taken when a Java client has released it, or
+// when its record version number has gone unchanged for a whole lease.
+func (l *Locker) javaCondition(name string, now time.Time, values map[string]dynamodbtypes.AttributeValue) string {
+	condition := releasedAttribute + " = :released"
+	values[":released"] = &dynamodbtypes.AttributeValueMemberBOOL{Value: true}
+	if stale := l.staleVersionCondition(name, now, values); stale != "" {
+		condition += " or " + stale
+	}
+	return condition
+}
+
+// javaUpdate adds a new record version and the lease to an update acquiring
+// or renewing a lock, for Java clients and WithRecordVersionLeases.
+func (l *Locker) javaUpdate(update string, values map[string]dynamodbtypes.AttributeValue, lease time.Duration, version string) string {
+	values[":leaseDuration"] = &dynamodbtypes.AttributeValueMemberS{Value: strconv.FormatInt(lease.Milliseconds(), 10)}
+	values[":recordVersion"] = &dynamodbtypes.AttributeValueMemberS{Value: version}
+	return update + ", " + leaseDurationAttribute + " = :leaseDuration, " + recordVersionAttribute + " = :recordVersion"
+}
+
+// javaRelease marks a lock item kept on release as released, which Java
+// clients look for before waiting out its lease.
+func javaRelease(update string, values map[string]dynamodbtypes.AttributeValue) string {
+	values[":released"] = &dynamodbtypes.AttributeValueMemberBOOL{Value: true}
+	if rest, ok := strings.CutPrefix(update, "SET "); ok {
+		return "SET " + releasedAttribute + " = :released, " + rest
+	}
+	return "SET " + releasedAttribute + " = :released " + update
+}
+
+// observeVersion records the record version number of a lock item held by
+// another client, unless it is the one already seen.
+func (l *Locker) observeVersion(name string, item map[string]dynamodbtypes.AttributeValue) {
+	if !l.versioned() {
+		return
+	}
+	version, ok := stringAttr(item, recordVersionAttribute)
+	if !ok {
+		return
+	}
+	var lease time.Duration
+	if raw, ok := stringAttr(item, leaseDurationAttribute); ok {
+		ms, _ := strconv.ParseInt(raw, 10, 64)
+		lease = time.Duration(ms) * time.Millisecond
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seen, ok := l.versionsSeen[name]; ok && seen.version == version {
+		return
+	}
+	l.versionsSeen[name] = versionSeen{version: version, at: time.Now(), lease: lease}
+}
+
+// forgetVersion drops the record version seen for a lock once it is taken.
+func (l *Locker) forgetVersion(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.versionsSeen, name)
+}
+
+// javaHeld reports whether a Java client holds a lock item. Its lease can't
+// be told from the item, so it is taken to be current.
+func (l *Locker) javaHeld(item map[string]dynamodbtypes.AttributeValue) bool {
+	if !l.javaCompat {
+		return false
+	}
+	_, hasOwner := stringAttr(item, l.attrs.Owner)
+	_, hasExpiry := numberAttr(item, l.attrs.Expiry)
+	released, _ := item[releasedAttribute].(*dynamodbtypes.AttributeValueMemberBOOL)
+	return hasOwner && !hasExpiry && (released == nil || !released.Value)
+}
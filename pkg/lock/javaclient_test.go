@@ -0,0 +1,81 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// javaLock writes a lock item the way the Java lock client does.
+func javaLock(ctx context.Context, client Client, name, version string, released bool) error {
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"key":                 &dynamodbtypes.AttributeValueMemberS{Value: name},
+			"ownerName":           &dynamodbtypes.AttributeValueMemberS{Value: "java-host"},
+			"leaseDuration":       &dynamodbtypes.AttributeValueMemberS{Value: "100"},
+			"recordVersionNumber": &dynamodbtypes.AttributeValueMemberS{Value: version},
+			"isReleased":          &dynamodbtypes.AttributeValueMemberBOOL{Value: released},
+		},
+	})
+	return err
+}
+
+func TestJavaLockClientCompat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	client.DefineTable("locks", "key")
+	n := NewLocker(client, ctx, "locks", WithJavaLockClientCompat())
+
+	assert.Nil(t, javaLock(ctx, client, "stale", "v1", false), "error should be nil")
+	ok, err := n.AcquireLock("stale", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a lock held by a Java client should not be acquired")
+	locked, err := n.IsLocked(ctx, "stale")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, locked, "a lock held by a Java client should be reported as held")
+	time.Sleep(time.Millisecond * 150)
+	ok, err = n.AcquireLock("stale", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a lock whose record version was unchanged for its lease should be taken over")
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("locks"),
+		Key:       map[string]dynamodbtypes.AttributeValue{"key": &dynamodbtypes.AttributeValueMemberS{Value: "stale"}},
+	})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberS{Value: n.ID()}, out.Item["ownerName"], "Java clients should see the new owner")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberS{Value: "10000"}, out.Item["leaseDuration"], "the lease should be recorded in milliseconds")
+	assert.NotEqual(t, &dynamodbtypes.AttributeValueMemberS{Value: "v1"}, out.Item["recordVersionNumber"], "the record version should change")
+	assert.NotContains(t, out.Item, "isReleased", "the lock should not be marked released")
+
+	assert.Nil(t, javaLock(ctx, client, "live", "v1", false), "error should be nil")
+	ok, _ = n.AcquireLock("live", time.Second*10)
+	assert.False(t, ok, "a lock held by a Java client should not be acquired")
+	time.Sleep(time.Millisecond * 150)
+	assert.Nil(t, javaLock(ctx, client, "live", "v2", false), "error should be nil")
+	ok, _ = n.AcquireLock("live", time.Second*10)
+	assert.False(t, ok, "a lock whose holder heartbeats should not be taken over")
+
+	assert.Nil(t, javaLock(ctx, client, "released", "v1", true), "error should be nil")
+	ok, err = n.AcquireLock("released", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a lock released by a Java client should be acquired")
+}
+
+func TestJavaRelease(t *testing.T) {
+	l := &Locker{javaCompat: true, cooldown: time.Second}
+	update, values := l.releaseUpdate(time.Now())
+	assert.Contains(t, update, "SET isReleased = :released, cooldownUntilMs", "a kept item should be marked released")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberBOOL{Value: true}, values[":released"], "the released value should be set")
+
+	l.cooldown = 0
+	update, _ = l.releaseUpdate(time.Now())
+	assert.Equal(t, "SET isReleased = :released REMOVE #owner, #expiry, ExpireAtMs, expiryShard, traceId", update, "a kept item should be marked released")
+}
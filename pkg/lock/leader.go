@@ -0,0 +1,113 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// LeaderCallbacks are called by a LeaderElector as it gains and loses
+// leadership.
+type LeaderCallbacks struct {
+	// OnElected is called on its own goroutine when leadership is won. Its
+	// context is cancelled when leadership is lost or given up, and it
+	// should return promptly once it is.
+	OnElected func(ctx context.Context)
+	// OnResigned is called once leadership has been lost or given up, after
+	// OnElected has returned.
+	OnResigned func()
+}
+
+// LeaderElector campaigns for leadership, held as a named lock of a Locker,
+// for as long as it runs. The Locker's heartbeater renews the lock while the
+// elector leads, and the elector campaigns again whenever leadership is lost.
+type LeaderElector struct {
+	locker    *Locker
+	name      string
+	lease     time.Duration
+	callbacks LeaderCallbacks
+	leading   atomic.Bool
+}
+
+// NewLeaderElector returns an elector campaigning for the named lock, held
+// with the given lease. Run starts the campaign.
+func NewLeaderElector(locker *Locker, name string, lease time.Duration, callbacks LeaderCallbacks) *LeaderElector {
+	return &LeaderElector{locker: locker, name: name, lease: lease, callbacks: callbacks}
+}
+
+// IsLeader reports whether the elector currently leads.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Run campaigns for leadership until ctx is done, waiting for the lock like
+// WaitForLock and campaigning again after it is lost. Electors sharing a
+// Locker and a name take turns, so only one of them leads at a time. Errors
+// acquiring the lock are logged and retried after the Locker's longest wait
+// backoff. When ctx is done, leadership is given up and ctx.Err() is
+// returned; if the Locker is closed, Run returns ErrClosed.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	l := e.locker
+	for {
+		if err := l.lockName(ctx, e.name); err != nil {
+			return err
+		}
+		err := l.WaitForLock(ctx, e.name, e.lease)
+		switch {
+		case ctx.Err() != nil:
+			l.unlockName(e.name)
+			return ctx.Err()
+		case errors.Is(err, ErrClosed):
+			l.unlockName(e.name)
+			return err
+		case err != nil:
+			l.unlockName(e.name)
+			l.acquireLogger.Warn("Campaign for leadership failed, retrying", "lockname", e.name, "error", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(l.waitMax):
+			}
+			continue
+		}
+		if h := l.Handle(e.name); h != nil {
+			e.lead(ctx, h)
+		}
+		l.unlockName(e.name)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// lead runs the callbacks for one term of leadership, which ends when the
+// lock is lost or ctx is done.
+func (e *LeaderElector) lead(ctx context.Context, h *Lock) {
+	l := e.locker
+	l.adminLogger.Info("Elected leader", "lockname", e.name)
+	e.leading.Store(true)
+	term, cancel := h.Context(ctx)
+	defer cancel()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		if e.callbacks.OnElected != nil {
+			e.callbacks.OnElected(term)
+		}
+	}()
+	<-term.Done()
+	<-finished
+	e.leading.Store(false)
+	if ctx.Err() != nil {
+		// Give leadership up straight away rather than leaving the other
+		// candidates to wait out the lease
+		if err := h.Release(context.Background()); err != nil && !errors.Is(err, ErrNotHeld) {
+			l.adminLogger.Warn("Resigning leadership failed", "lockname", e.name, "error", err)
+		}
+	}
+	l.adminLogger.Info("Resigned leadership", "lockname", e.name, "cause", context.Cause(term))
+	if e.callbacks.OnResigned != nil {
+		e.callbacks.OnResigned()
+	}
+}
@@ -0,0 +1,59 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderElector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	backoff := WithWaitBackoff(time.Millisecond, time.Millisecond*10, 2)
+	elected := make(chan string, 2)
+	resigned := make(chan string, 2)
+	candidate := func(id string) *LeaderElector {
+		return NewLeaderElector(NewLocker(client, ctx, "locks", backoff), "leader", time.Second*10, LeaderCallbacks{
+			OnElected: func(ctx context.Context) {
+				elected <- id
+				<-ctx.Done()
+			},
+			OnResigned: func() { resigned <- id },
+		})
+	}
+
+	aCtx, aCancel := context.WithCancel(ctx)
+	a := candidate("a")
+	aDone := make(chan error, 1)
+	go func() { aDone <- a.Run(aCtx) }()
+	assert.Equal(t, "a", <-elected, "the first candidate should be elected")
+	assert.True(t, a.IsLeader(), "the elected candidate should lead")
+
+	b := candidate("b")
+	bDone := make(chan error, 1)
+	go func() { bDone <- b.Run(ctx) }()
+	select {
+	case id := <-elected:
+		t.Fatalf("%s should not be elected while a leads", id)
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.False(t, b.IsLeader(), "a waiting candidate should not lead")
+
+	aCancel()
+	assert.ErrorIs(t, <-aDone, context.Canceled, "Run should return once its context is done")
+	assert.Equal(t, "a", <-resigned, "a stopped leader should resign")
+	assert.False(t, a.IsLeader(), "a resigned candidate should not lead")
+	select {
+	case id := <-elected:
+		assert.Equal(t, "b", id, "leadership should pass to the other candidate")
+	case <-time.After(time.Second):
+		t.Fatal("leadership should pass once the leader resigns")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-bDone, context.Canceled, "Run should return once its context is done")
+	assert.Equal(t, "b", <-resigned, "a stopped leader should resign")
+}
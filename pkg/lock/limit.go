@@ -0,0 +1,42 @@
+package infra
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooManyLocks is returned when acquiring a lock would take a Locker over
+// the limit set with WithMaxHeldLocks.
+var ErrTooManyLocks = errors.New("too many locks held")
+
+// WithMaxHeldLocks limits how many locks the Locker holds at once, counting
+// acquisitions in flight. Acquiring a lock beyond the limit fails with an
+// error wrapping ErrTooManyLocks, which protects the heartbeater and the table
+// from a runaway caller. Refreshing a lock that is already held is never
+// refused.
+func WithMaxHeldLocks(n int) Option {
+	return func(l *Locker) {
+		l.maxHeld = n
+	}
+}
+
+// reserve claims one of the Locker's lock slots for an acquisition. The
+// returned function gives the slot back and must be called once the
+// acquisition has either failed or been recorded by the heartbeater.
+func (l *Locker) reserve(name string) (func(), error) {
+	if l.maxHeld <= 0 {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.locksHeld)+l.acquiring >= l.maxHeld {
+		return nil, fmt.Errorf("acquiring %s with %d of %d locks held or being acquired : %w",
+			name, len(l.locksHeld)+l.acquiring, l.maxHeld, ErrTooManyLocks)
+	}
+	l.acquiring++
+	return func() {
+		l.mu.Lock()
+		l.acquiring--
+		l.mu.Unlock()
+	}, nil
+}
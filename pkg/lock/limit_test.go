@@ -0,0 +1,31 @@
+package infra
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserveEnforcesLimit(t *testing.T) {
+	l := &Locker{locksHeld: map[string]*lock{"a": {name: "a"}}}
+	WithMaxHeldLocks(2)(l)
+
+	release, err := l.reserve("b")
+	assert.Nil(t, err, "a slot should be free")
+	_, err = l.reserve("c")
+	assert.True(t, errors.Is(err, ErrTooManyLocks), "acquisitions in flight should count towards the limit")
+
+	release()
+	release, err = l.reserve("c")
+	assert.Nil(t, err, "released slot should be reusable")
+	release()
+}
+
+func TestReserveUnlimited(t *testing.T) {
+	l := &Locker{locksHeld: map[string]*lock{"a": {name: "a"}}}
+	release, err := l.reserve("b")
+	assert.Nil(t, err, "there should be no limit by default")
+	release()
+	assert.Equal(t, 0, l.acquiring, "unlimited lockers shouldn't count acquisitions")
+}
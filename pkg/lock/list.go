@@ -0,0 +1,122 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Scanner is implemented by clients that can scan a table, which ListLocks
+// needs. *dynamodb.Client and MemoryClient implement it.
+type Scanner interface {
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+var _ Scanner = (*dynamodb.Client)(nil)
+
+// ListOptions filters and pages the locks ListLocks returns.
+type ListOptions struct {
+	// Prefix only lists locks whose names start with it.
+	Prefix string
+	// ExpiredOnly only lists locks whose lease has lapsed.
+	ExpiredOnly bool
+	// Limit is the most locks a page holds, or 0 for all of them.
+	Limit int
+	// Cursor continues a listing from the Cursor of the LockPage before.
+	Cursor string
+}
+
+// LockPage is a page of ListLocks. Cursor is empty on the last page; a page
+// can be empty and still have a Cursor.
+type LockPage struct {
+	Locks  []LockInfo
+	Cursor string
+}
+
+// ListLocks lists held lock items with their holders, leases and payloads,
+// for dashboards and operational tooling. It scans the table, so it reads
+// every item, filtering on the server where it can; use LocksHeldBy or
+// ExpiredLocks to find one holder's locks or expired locks on large tables.
+// Locks released into cooldown, and the items of Semaphores and Once, are
+// left out. The client must implement Scanner, or ListLocks returns
+// ErrUnsupported. Scans are eventually consistent.
+func (l *Locker) ListLocks(ctx context.Context, opts ListOptions) (LockPage, error) {
+	if l.backend != nil {
+		return l.listBackendLocks(ctx, opts)
+	}
+	scanner, ok := l.client.(Scanner)
+	if !ok {
+		return LockPage{}, fmt.Errorf("listing locks : %w", ErrUnsupported)
+	}
+	filter := "attribute_exists(#owner)"
+	var values map[string]dynamodbtypes.AttributeValue
+	if opts.Prefix != "" {
+		filter += " and begins_with(#key, :prefix)"
+		values = map[string]dynamodbtypes.AttributeValue{":prefix": &dynamodbtypes.AttributeValueMemberS{Value: opts.Prefix}}
+	}
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(l.lockTable),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeNames:  l.attrs.expressionNames(nil, filter),
+		ExpressionAttributeValues: values,
+	}
+	if opts.Limit > 0 {
+		input.Limit = aws.Int32(int32(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		input.ExclusiveStartKey = l.attrs.key(opts.Cursor)
+	}
+	now := time.Now()
+	var page LockPage
+	for {
+		out, err := scanner.Scan(ctx, input, l.requestOptions)
+		if err != nil {
+			return LockPage{}, fmt.Errorf("listing locks : %w", err)
+		}
+		for _, item := range out.Items {
+			info := l.attrs.lockInfo(item)
+			if opts.ExpiredOnly && !info.Expired(now) {
+				continue
+			}
+			page.Locks = append(page.Locks, info)
+			if len(page.Locks) == opts.Limit {
+				// Scans resume after any key, so the last lock listed marks the page
+				page.Cursor = info.Name
+				return page, nil
+			}
+		}
+		if out.LastEvaluatedKey == nil {
+			return page, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// listBackendLocks pages the backend's ListItems in name order.
+func (l *Locker) listBackendLocks(ctx context.Context, opts ListOptions) (LockPage, error) {
+	items, err := l.backend.ListItems(ctx)
+	if err != nil {
+		return LockPage{}, fmt.Errorf("listing locks : %w", err)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	now := time.Now()
+	var page LockPage
+	for _, info := range items {
+		if info.LockerId == "" || !strings.HasPrefix(info.Name, opts.Prefix) ||
+			(opts.Cursor != "" && info.Name <= opts.Cursor) || (opts.ExpiredOnly && !info.Expired(now)) {
+			continue
+		}
+		page.Locks = append(page.Locks, info)
+		if len(page.Locks) == opts.Limit {
+			page.Cursor = info.Name
+			break
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,85 @@
+package infra
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListLocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	for _, name := range []string{"jobs/a", "jobs/b", "jobs/c", "reports/a"} {
+		ok, err := n.AcquireLock(name, time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+	expired := time.Now().Add(-time.Second)
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":       &dynamodbtypes.AttributeValueMemberS{Value: "jobs/dead"},
+			"lockerId":   &dynamodbtypes.AttributeValueMemberS{Value: "dead"},
+			"ExpireAt":   &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.Unix(), 10)},
+			"ExpireAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.UnixMilli(), 10)},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item:      map[string]dynamodbtypes.AttributeValue{"name": &dynamodbtypes.AttributeValueMemberS{Value: "jobs/cooling"}},
+	})
+	assert.Nil(t, err, "error should be nil")
+
+	var names []string
+	opts := ListOptions{Prefix: "jobs/", Limit: 2}
+	for pages := 0; pages < 10; pages++ {
+		page, err := n.ListLocks(ctx, opts)
+		assert.Nil(t, err, "error should be nil")
+		assert.LessOrEqual(t, len(page.Locks), 2, "a page should hold at most Limit locks")
+		for _, info := range page.Locks {
+			names = append(names, info.Name)
+		}
+		if page.Cursor == "" {
+			break
+		}
+		opts.Cursor = page.Cursor
+	}
+	assert.ElementsMatch(t, []string{"jobs/a", "jobs/b", "jobs/c", "jobs/dead"}, names, "every held lock with the prefix should be listed once")
+
+	page, err := n.ListLocks(ctx, ListOptions{ExpiredOnly: true})
+	assert.Nil(t, err, "error should be nil")
+	if assert.Len(t, page.Locks, 1, "only the expired lock should be listed") {
+		assert.Equal(t, "dead", page.Locks[0].LockerId, "the holder should be returned")
+	}
+	assert.Empty(t, page.Cursor, "an unlimited listing should have one page")
+}
+
+func TestListBackendLocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := NewBackendLocker(NewMemoryBackend(), ctx)
+	for _, name := range []string{"b", "a", "c"} {
+		ok, err := n.AcquireLock(name, time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+	page, err := n.ListLocks(ctx, ListOptions{Limit: 2})
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, page.Locks, 2, "the page should be full")
+	assert.Equal(t, "b", page.Cursor, "locks should be listed in name order")
+	page, err = n.ListLocks(ctx, ListOptions{Limit: 2, Cursor: page.Cursor})
+	assert.Nil(t, err, "error should be nil")
+	if assert.Len(t, page.Locks, 1, "the rest should be listed") {
+		assert.Equal(t, "c", page.Locks[0].Name, "listing should continue after the cursor")
+	}
+	assert.Empty(t, page.Cursor, "the last page should have no cursor")
+}
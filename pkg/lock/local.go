@@ -0,0 +1,63 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+)
+
+// WithEndpoint sends every DynamoDB call the Locker makes to endpoint, such
+// as DynamoDB Local at "http://localhost:8000" or LocalStack at
+// "http://localhost:4566", whatever endpoint its client was configured for.
+// WithHomeRegion likewise overrides the client's region.
+func WithEndpoint(endpoint string) Option {
+	return func(l *Locker) {
+		l.endpoint = endpoint
+	}
+}
+
+// NewLocalClient returns a client for DynamoDB Local or LocalStack at
+// endpoint, in region or else us-east-1, signing requests with placeholder
+// credentials that both accept, so no AWS configuration is needed.
+func NewLocalClient(endpoint, region string) *dynamodb.Client {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return dynamodb.New(dynamodb.Options{
+		Region:       region,
+		BaseEndpoint: aws.String(endpoint),
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local", Source: "gotrc"}, nil
+		}),
+	})
+}
+
+// NewLocalTestLocker creates a uniquely named lock table on DynamoDB Local
+// or LocalStack at endpoint and returns a Locker using it, along with a
+// function closing the Locker and deleting the table. It is meant for
+// integration tests, which can then run in parallel without sharing locks:
+//
+//	l, cleanup, err := infra.NewLocalTestLocker(ctx, "http://localhost:8000")
+//	if err != nil {
+//		t.Skip("DynamoDB Local is not running:", err)
+//	}
+//	defer cleanup()
+func NewLocalTestLocker(ctx context.Context, endpoint string, opts ...Option) (*Locker, func(), error) {
+	client := NewLocalClient(endpoint, "")
+	table := "gotrc-test-" + uuid.New().String()
+	if err := EnsureLockTable(ctx, client, table); err != nil {
+		return nil, nil, fmt.Errorf("creating test lock table at %s : %w", endpoint, err)
+	}
+	l := NewLocker(client, ctx, table, opts...)
+	cleanup := func() {
+		// The table goes next, so the locks are left behind rather than released
+		l.cancel()
+		if _, err := client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(table)}); err != nil {
+			l.adminLogger.Warn("Deleting test lock table failed", "table", table, "error", err)
+		}
+	}
+	return l, cleanup, nil
+}
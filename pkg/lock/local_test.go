@@ -0,0 +1,66 @@
+package infra
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEndpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewLocker(NewMemoryClient(), ctx, "locks", WithEndpoint("http://localhost:4566"))
+	o := dynamodb.Options{}
+	l.requestOptions(&o)
+	assert.Equal(t, "http://localhost:4566", aws.ToString(o.BaseEndpoint), "calls should go to the endpoint")
+
+	client := NewLocalClient("http://localhost:8000", "")
+	assert.Equal(t, "us-east-1", client.Options().Region, "the region should default")
+	assert.Equal(t, "http://localhost:8000", aws.ToString(client.Options().BaseEndpoint), "the endpoint should be set")
+}
+
+func TestNewLocalTestLocker(t *testing.T) {
+	// Stands in for DynamoDB Local, serving just the table lifecycle
+	var mu sync.Mutex
+	var operations []string
+	created := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		operations = append(operations, operation)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		switch {
+		case operation == "CreateTable":
+			created = true
+			w.Write([]byte(`{}`))
+		case operation == "DescribeTable" && !created:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"not found"}`))
+		case operation == "DescribeTable":
+			w.Write([]byte(`{"Table":{"TableStatus":"ACTIVE"}}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	l, cleanup, err := NewLocalTestLocker(context.Background(), server.URL)
+	if !assert.Nil(t, err, "error should be nil") {
+		return
+	}
+	assert.True(t, strings.HasPrefix(l.lockTable, "gotrc-test-"), "the table should be uniquely named")
+	cleanup()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"DescribeTable", "CreateTable", "DescribeTable", "DescribeTimeToLive", "UpdateTimeToLive", "DeleteTable"},
+		operations, "the table should be created, awaited and deleted")
+}
@@ -1,11 +1,14 @@
 package infra
 
 import (
+	"container/heap"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/exp/slog"
@@ -13,169 +16,879 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/smithy-go"
 	"github.com/google/uuid"
 )
 
+// acquireCondition lets a lock be taken when it is free, already ours, or its
+// lease has lapsed. Items written by clients that predate ExpireAtMs only carry
+// ExpireAt, and such a client may also have overwritten ExpireAt while leaving
+// a stale ExpireAtMs behind, so a millisecond expiry is only trusted when
+// ExpireAt agrees with it.
+const acquireCondition = "attribute_not_exists(#owner) or #owner = :lockerId" +
+	" or (attribute_not_exists(ExpireAtMs) and :now > #expiry)" +
+	" or (:nowMs > ExpireAtMs and :now >= #expiry)"
+
+// ownerCondition lets a lock item be changed only while it is ours.
+const ownerCondition = "#owner = :lockerId"
+
 type lock struct {
-	name    string
-	timeout time.Duration
+	name       string
+	timeout    time.Duration
+	traceId    string
+	expiresAt  time.Time
+	acquiredAt time.Time
+	refreshes  int
+	// failures counts the renewals that failed in a row
+	failures int
+	// fencingToken is the token written when the lock was acquired
+	fencingToken int64
+	warning      *time.Timer
+	holdAlert    *time.Timer
+	// renewAt is when the lock is next due for renewal, with per-lock
+	// renewal. Guarded by the Locker's mu.
+	renewAt time.Time
+	// index is the lock's position in the Locker's renewal queue
+	index int
 }
 
+// A Locker acquires locks in a DynamoDB table and keeps them held, refreshing
+// their leases in the background, until they are released. A Locker is safe
+// for concurrent use by multiple goroutines.
 type Locker struct {
-	ticker            *time.Ticker
+	ticker            Scheduler
 	HeartbeatInterval time.Duration
-	client            *dynamodb.Client
+	client            Client
+	backend           Backend
 	lockerId          string
+	attrs             AttributeNames
+	terraform         bool
+	javaCompat        bool
+	versionLeases     bool
+	skewMargin        time.Duration
+	batchRenewal      bool
+	lightRenewal      bool
+	skipFresh         float64
+	failureLimit      int
+	failureFraction   float64
+	jitter            float64
+	manualRenewal     bool
+	trackContention   bool
+	owner             OwnerInfo
 	ctx               context.Context
+	parent            context.Context
 	cancel            context.CancelFunc
 	lockTable         string
-	locksHeld         []lock
-	releaser          chan string
-	recorder          chan lock
-	confirm           chan string
+	locksHeld         map[string]*lock
+	renewals          renewalQueue
+	recordedLease     time.Duration
+	releaser          chan releaseRequest
+	recorded          chan struct{}
+	stopper           chan shutdownRequest
+	batchReleaser     chan batchRelease
 	logger            *slog.Logger
+	heartbeatLogger   *slog.Logger
+	acquireLogger     *slog.Logger
+	adminLogger       *slog.Logger
+	heartbeatLevel    slog.Leveler
+	acquireLevel      slog.Leveler
+	adminLevel        slog.Leveler
+	debugSample       int
+	eventHandlers     []func(Event)
+	watchdogFactor    int
+	expiryWarning     time.Duration
+	verifyAcquire     bool
+	lockOrder         *LockOrder
+	takeoverHandlers  []func(Takeover)
+	cooldown          time.Duration
+	cooldownMode      CooldownMode
+	historyTable      string
+	historyKeep       int
+	adaptiveAfter     int
+	adaptiveMax       time.Duration
+	newScheduler      func(time.Duration) Scheduler
+	maxHeld           int
+	acquiring         int
+	runLoop           bool
+	wake              chan struct{}
+	holdLimits        map[string]time.Duration
+	requestTimeout    time.Duration
+	homeRegion        string
+	endpoint          string
+	data              map[string][]byte
+	reentrant         bool
+	holds             map[string]int
+	names             map[string]*nameLock
+	rescheduler       chan rescheduleRequest
+	extender          chan extendRequest
+	renewer           chan renewRequest
+	handles           map[string]*Lock
+	lostHandlers      []func(name string, err error)
+	errs              chan error
+	retryer           atomic.Pointer[aws.Retryer]
+	heartbeatSwitch   levelSwitch
+	acquireSwitch     levelSwitch
+	adminSwitch       levelSwitch
+	waitInitial       time.Duration
+	waitMax           time.Duration
+	waitFactor        float64
+	waiters           *waitQueue
+	lastBeat          atomic.Int64
+	interval          atomic.Int64
+	mu                sync.Mutex
+	running           bool
+	pending           int
+	cancelsSeen       map[string]int64
+	versionsSeen      map[string]versionSeen
+	capacity          *capacityMeter
+	throttleRetries   int
+	throttleInitial   time.Duration
+	throttleMax       time.Duration
 }
 
-func NewLocker(client *dynamodb.Client, ctx context.Context, lockTable string) *Locker {
+func NewLocker(client Client, ctx context.Context, lockTable string, opts ...Option) *Locker {
 	innerCtx, cancel := context.WithCancel(context.Background())
 	id := uuid.New().String()
-	newLocker := Locker{time.NewTicker(1 * time.Minute),
-		1 * time.Minute,
-		client,
-		id,
-		innerCtx,
-		cancel,
-		lockTable,
-		nil,
-		make(chan string),
-		make(chan lock),
-		make(chan string),
-		slog.With("locker", id),
-	}
-	go newLocker.heartBeater(ctx) // We use the original context here in case we are shutting down the inner context
+	newLocker := Locker{
+		HeartbeatInterval: 1 * time.Minute,
+		client:            client,
+		lockerId:          id,
+		attrs:             defaultAttributeNames,
+		ctx:               innerCtx,
+		parent:            ctx, // The heartbeater uses the original context in case we are shutting down the inner context
+		cancel:            cancel,
+		lockTable:         lockTable,
+		locksHeld:         map[string]*lock{},
+		releaser:          make(chan releaseRequest),
+		recorded:          make(chan struct{}, 1),
+		stopper:           make(chan shutdownRequest),
+		batchReleaser:     make(chan batchRelease),
+		rescheduler:       make(chan rescheduleRequest),
+		extender:          make(chan extendRequest),
+		renewer:           make(chan renewRequest),
+		handles:           map[string]*Lock{},
+		errs:              make(chan error, errorBuffer),
+		cancelsSeen:       map[string]int64{},
+		versionsSeen:      map[string]versionSeen{},
+		waitInitial:       defaultWaitInitial,
+		waitMax:           defaultWaitMax,
+		waitFactor:        defaultWaitFactor,
+		throttleRetries:   defaultThrottleRetries,
+		throttleInitial:   defaultThrottleInitial,
+		throttleMax:       defaultThrottleMax,
+		waiters:           newWaitQueue(),
+		logger:            slog.Default(),
+		owner:             processOwner(),
+	}
+	for _, opt := range opts {
+		opt(&newLocker)
+	}
+	if newLocker.waiters.slots != nil {
+		// Waiter records live in the lock table, so they share its key
+		newLocker.waiters.slots.attrs = newLocker.attrs
+	}
+	newLocker.logger = newLocker.logger.With("locker", id)
+	newLocker.heartbeatSwitch.set(newLocker.heartbeatLevel)
+	newLocker.acquireSwitch.set(newLocker.acquireLevel)
+	newLocker.adminSwitch.set(newLocker.adminLevel)
+	newLocker.heartbeatLogger = componentLogger(newLocker.logger, "heartbeat", &newLocker.heartbeatSwitch, newLocker.debugSample)
+	newLocker.acquireLogger = componentLogger(newLocker.logger, "acquire", &newLocker.acquireSwitch, newLocker.debugSample)
+	newLocker.adminLogger = componentLogger(newLocker.logger, "admin", &newLocker.adminSwitch, 0)
 	return &newLocker
 }
 
+// closed reports whether the Locker was closed or its parent context is done.
+func (l *Locker) closed() bool {
+	return l.ctx.Err() != nil || l.parent.Err() != nil
+}
+
+// enter starts the heartbeater if it isn't running and registers a pending
+// handoff to it, so it won't go idle while the caller is about to send.
+func (l *Locker) enter() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed() {
+		return ErrClosed
+	}
+	l.pending++
+	l.start()
+	return nil
+}
+
+// start starts the heartbeater if it isn't running. It is called with mu held.
+func (l *Locker) start() {
+	if l.running {
+		return
+	}
+	l.running = true
+	l.ticker = l.scheduler()
+	if l.runLoop {
+		l.wake <- struct{}{}
+	} else {
+		go l.heartBeater(l.parent)
+	}
+}
+
+// send hands a value to the heartbeater, giving up if the Locker closes first.
+func send[T any](l *Locker, ch chan<- T, v T) error {
+	select {
+	case ch <- v:
+		return nil
+	case <-l.ctx.Done():
+		return ErrClosed
+	}
+}
+
+// handled marks a handoff as processed and stops the heartbeater when no
+// locks are held and no other handoffs are pending. It reports whether the
+// heartbeater should exit.
+func (l *Locker) handled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending--
+	if len(l.locksHeld) > 0 || l.pending > 0 {
+		return false
+	}
+	l.heartbeatLogger.Debug("Heartbeater idle")
+	l.running = false
+	l.ticker.Stop()
+	return true
+}
+
 func (l *Locker) refresh() {
-	for _, lock := range l.locksHeld {
-		ok, err := l.AcquireLock(lock.name, lock.timeout)
-		if !ok || err != nil {
-			panic(fmt.Errorf("lock %s held by %s could not be refreshed : %w", lock.name, l.lockerId, err))
+	if l.manualRenewal {
+		return
+	}
+	var lost []lostLock
+	// Stop tracking lost locks once done renewing
+	defer func() {
+		for _, lk := range lost {
+			l.lose(lk.name, lk.err)
+		}
+	}()
+	now := time.Now()
+	var due []*lock
+	l.mu.Lock()
+	taken := l.takeDue(now)
+	for _, lock := range taken {
+		// A lock skipped or failing to renew now is due again an interval later
+		lock.renewAt = now.Add(l.renewalDelay(lock))
+		if !l.dueForRefresh(lock, now) || l.fresh(lock, now) {
+			continue
+		}
+		l.adaptLease(lock)
+		lock.renewAt = now.Add(l.renewalDelay(lock))
+		due = append(due, lock)
+	}
+	l.requeue(taken)
+	l.mu.Unlock()
+	var batch []*lock
+	for _, lock := range due {
+		if l.ctx.Err() != nil {
+			return
+		}
+		if l.batchRenewal && l.backend == nil {
+			if batch = append(batch, lock); len(batch) == maxTransactItems {
+				l.renewBatch(batch, &lost)
+				batch = nil
+			}
+			continue
+		}
+		start := time.Now()
+		ok, err := l.renew(lock)
+		if l.ctx.Err() != nil {
+			return
+		}
+		l.renewed(lock, start, ok, err, &lost)
+	}
+	if len(batch) > 0 && l.ctx.Err() == nil {
+		l.renewBatch(batch, &lost)
+	}
+	l.schedule(time.Now())
+}
+
+// renewed records the outcome of a refresh of a lock started at start,
+// adding the lock to lost if it can no longer be saved.
+func (l *Locker) renewed(lock *lock, start time.Time, ok bool, err error, lost *[]lostLock) {
+	if err != nil {
+		lock.failures++
+		if !l.givenUp(lock, start) {
+			// The lease hasn't lapsed yet, so the next tick can still save it
+			l.reportError(fmt.Errorf("lock %s held by %s could not be refreshed : %w", lock.name, l.lockerId, err))
+			return
 		}
 	}
+	if !ok || err != nil {
+		if err == nil {
+			err = ErrNotHeld
+		}
+		*lost = append(*lost, lostLock{lock.name, fmt.Errorf("lock %s held by %s could not be refreshed : %w", lock.name, l.lockerId, err)})
+		return
+	}
+	// Lock handles read the expiry from other goroutines
+	l.mu.Lock()
+	lock.expiresAt = start.Add(lock.timeout)
+	lock.refreshes++
+	l.mu.Unlock()
+	lock.failures = 0
+	l.armWarning(lock)
+}
+
+// fitInterval shortens the heartbeat interval to half a new lease if the
+// lease is shorter than the interval, refreshing straight away. With per-lock
+// renewal the heartbeat interval is left alone and only the next wakeup moves.
+func (l *Locker) fitInterval(timeout time.Duration) {
+	if l.perLockRenewal() {
+		l.schedule(time.Now())
+		return
+	}
+	timeout = l.renewalLease(timeout)
+	if timeout >= l.HeartbeatInterval {
+		return
+	}
+	l.mu.Lock()
+	l.HeartbeatInterval = timeout / 2
+	l.mu.Unlock()
+	l.interval.Store(int64(l.HeartbeatInterval))
+	l.ticker.Reset(l.HeartbeatInterval)
+	l.refresh()
+	l.beat()
 }
 
 func (l *Locker) heartBeater(ctx context.Context) {
+	l.interval.Store(int64(l.HeartbeatInterval))
+	l.beat()
+	if l.watchdogFactor > 0 && !l.manualRenewal {
+		stop := make(chan struct{})
+		defer close(stop)
+		go l.watchdog(stop)
+	}
 	for {
-		l.logger.Debug("Heartbeater running")
+		l.heartbeatLogger.Debug("Heartbeater running")
 		select {
-		case <-l.ticker.C:
-			l.logger.Debug("Tick refresh")
+		case <-l.ticker.C():
+			l.heartbeatLogger.Debug("Tick refresh")
 			l.refresh()
-		case toRelease := <-l.releaser:
-			l.logger.Debug("Lock release")
-			l.releaseLock(toRelease)
-		case toRecord := <-l.recorder:
-			l.logger.Debug("Lock record", slog.String("lockname", toRecord.name))
-			l.locksHeld = append(l.locksHeld, toRecord)
-			if toRecord.timeout < l.HeartbeatInterval {
-				l.HeartbeatInterval = toRecord.timeout / 2
-				l.ticker.Reset(l.HeartbeatInterval)
-				l.refresh()
+			l.beat()
+		case req := <-l.releaser:
+			l.heartbeatLogger.Debug("Lock release")
+			err := l.release(req.ctx, req.name)
+			if err != nil && req.lapse && !errors.Is(err, ErrNotHeld) {
+				l.untrack(req.name, false)
+			}
+			req.result <- err
+			if l.handled() {
+				return
+			}
+		case <-l.recorded:
+			l.heartbeatLogger.Debug("Locks recorded")
+			l.mu.Lock()
+			lease := l.recordedLease
+			l.recordedLease = 0
+			l.mu.Unlock()
+			if lease > 0 {
+				l.fitInterval(lease)
 			}
 		case <-ctx.Done():
-			l.logger.Debug("Ctx done")
-			for _, lock := range l.locksHeld {
-				l.releaseLock(lock.name)
+			l.heartbeatLogger.Debug("Ctx done")
+			for _, name := range l.heldNames() {
+				l.releaseLock(name)
 			}
-			close(l.releaser)
-			close(l.recorder)
+			l.mu.Lock()
+			l.running = false
+			l.ticker.Stop()
+			l.mu.Unlock()
 			l.cancel()
 			return
-		case <-l.confirm:
-
+		case <-l.ctx.Done():
+			l.heartbeatLogger.Debug("Locker closed")
+			names := l.heldNames()
+			l.mu.Lock()
+			for _, lk := range l.locksHeld {
+				l.disarmWarning(lk)
+				l.disarmHoldAlert(lk)
+			}
+			l.mu.Unlock()
+			for _, name := range names {
+				l.dropHandle(name)
+			}
+			l.mu.Lock()
+			l.running = false
+			l.ticker.Stop()
+			l.mu.Unlock()
+			return
+		case req := <-l.batchReleaser:
+			l.heartbeatLogger.Debug("Batch release", "count", len(req.names))
+			req.result <- l.releaseMany(req.ctx, req.names)
+			if l.handled() {
+				return
+			}
+		case req := <-l.extender:
+			req.result <- l.extend(req.ctx, req.name, req.lease, req.add)
+			if l.handled() {
+				return
+			}
+		case req := <-l.renewer:
+			req.result <- l.renewNow(req.name)
+			if l.handled() {
+				return
+			}
+		case req := <-l.rescheduler:
+			l.reschedule(req.interval)
+			close(req.done)
+			if l.handled() {
+				return
+			}
+		case req := <-l.stopper:
+			l.heartbeatLogger.Debug("Locker shutdown")
+			report := l.releaseAll(req.ctx)
+			l.mu.Lock()
+			l.running = false
+			l.ticker.Stop()
+			l.mu.Unlock()
+			l.cancel()
+			req.report <- report
+			return
 		}
 	}
 }
 
-func (l *Locker) Close() {
-	l.cancel()
+// Close releases every held lock and shuts the Locker down, blocking until
+// the locks have been released or ctx is done. It returns the errors of the
+// releases that failed or were cut short by ctx, joined; locks that weren't
+// released stay held until their leases lapse. Subsequent calls to the
+// Locker's methods return ErrClosed, and closing a Locker that is already
+// closed does nothing.
+func (l *Locker) Close(ctx context.Context) error {
+	l.mu.Lock()
+	idle := len(l.locksHeld) == 0 || l.closed()
+	if idle {
+		// Nothing to release, so don't wait on a heartbeater that may not run
+		l.cancel()
+	}
+	l.mu.Unlock()
+	if idle {
+		return nil
+	}
+	return l.Shutdown(ctx).Err()
 }
 
+// releaseLock releases a lock in the background, when the context the Locker
+// runs under ends. If the release fails the lock is no longer refreshed, so it
+// lapses with its lease, and the error is reported.
 func (l *Locker) releaseLock(name string) {
-	_, err := l.client.DeleteItem(l.ctx, &dynamodb.DeleteItemInput{
-		Key: map[string]dynamodbtypes.AttributeValue{
-			"name": &dynamodbtypes.AttributeValueMemberS{Value: name},
-		},
-		ConditionExpression: aws.String("lockerId = :lockerId"),
-		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
-			":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
-		},
-		TableName: aws.String(l.lockTable),
-	})
-	var updatedLocksHeld []lock
+	if err := l.release(l.ctx, name); err != nil && !errors.Is(err, ErrNotHeld) {
+		l.reportError(err)
+		l.untrack(name, false)
+	}
+}
+
+// release deletes a held lock, or clears its ownership when the item has to
+// outlive it, and stops tracking it. It runs on the heartbeater and reports
+// ErrNotHeld if the lock had already been lost.
+func (l *Locker) release(ctx context.Context, name string) error {
+	key := l.attrs.key(name)
+	var err error
+	if l.backend != nil {
+		err = l.backend.ReleaseItem(ctx, name, l.lockerId)
+	} else if l.cooldown > 0 || l.hasData(name) {
+		update, values := l.releaseUpdate(time.Now())
+		err = l.withBackoff(ctx, l.heartbeatLogger, "release", func() error {
+			_, err := l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				Key:                       key,
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String(ownerCondition),
+				ExpressionAttributeNames:  l.attrs.expressionNames(nil, update, ownerCondition),
+				ExpressionAttributeValues: values,
+				TableName:                 aws.String(l.lockTable),
+			}, l.requestOptions)
+			return err
+		})
+	} else {
+		err = l.withBackoff(ctx, l.heartbeatLogger, "release", func() error {
+			_, err := l.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				Key:                      key,
+				ConditionExpression:      aws.String(ownerCondition),
+				ExpressionAttributeNames: l.attrs.expressionNames(nil, ownerCondition),
+				ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+					":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+				},
+				TableName: aws.String(l.lockTable),
+			}, l.requestOptions)
+			return err
+		})
+	}
 	if err != nil {
-		var oe *smithy.OperationError
-		if errors.As(err, &oe) && strings.Contains(oe.Error(), "ConditionalCheckFailedException") {
-			l.logger.Debug("Lock not found when deletion attempted")
-		} else {
-			panic(fmt.Errorf("lock %s held by %s could not be released : %w", name, l.lockerId, err))
+		if !isConditionalCheckFailed(err) && !errors.Is(err, ErrNotHeld) {
+			return fmt.Errorf("lock %s held by %s could not be released : %w", name, l.lockerId, err)
 		}
+		l.adminLogger.Debug("Lock not found when deletion attempted")
+		err = fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	} else {
+		l.emit(Event{Type: EventReleased, Lock: name})
 	}
+	l.untrack(name, err == nil)
+	return err
+}
 
-	if err == nil {
-		for _, existingLock := range l.locksHeld {
-			if existingLock.name != name {
-				updatedLocksHeld = append(updatedLocksHeld, existingLock)
-			}
-		}
+// untrack stops tracking a lock that is no longer held, recording it as
+// released if it was.
+func (l *Locker) untrack(name string, released bool) {
+	l.mu.Lock()
+	lk, ok := l.locksHeld[name]
+	if ok {
+		delete(l.locksHeld, name)
+		l.renewals.remove(lk)
+		l.disarmWarning(lk)
+		l.disarmHoldAlert(lk)
+	}
+	delete(l.data, name)
+	delete(l.holds, name)
+	l.mu.Unlock()
+	if ok && released {
+		l.recordReleased(*lk, time.Now())
+	}
+	l.dropHandle(name)
+}
+
+// heldNames returns the names of the locks currently held, in order. It is
+// safe to call from any goroutine.
+func (l *Locker) heldNames() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.locksHeld))
+	for name := range l.locksHeld {
+		names = append(names, name)
 	}
-	l.locksHeld = updatedLocksHeld
+	sort.Strings(names)
+	return names
 }
 
-func (l *Locker) ReleaseLock(name string) {
-	l.releaser <- name
+// ReleaseLock releases a held lock, waiting until the release has been
+// processed, and returns the error from DynamoDB if it failed, or one
+// wrapping ErrNotHeld if the lock was no longer held by this Locker. A lock
+// that can't be released is no longer refreshed either, so it lapses with
+// its lease. A reentrant lock acquired more than once only loses one hold.
+func (l *Locker) ReleaseLock(name string) error {
+	if l.closed() {
+		return ErrClosed
+	}
+	if l.dropHold(name) {
+		return nil
+	}
+	if err := l.enter(); err != nil {
+		return err
+	}
+	req := releaseRequest{l.ctx, name, true, make(chan error, 1)}
+	if err := send(l, l.releaser, req); err != nil {
+		return err
+	}
+	return <-req.result
+}
+
+type releaseRequest struct {
+	ctx  context.Context
+	name string
+	// lapse stops refreshing the lock if it can't be released
+	lapse  bool
+	result chan error
 }
 
-func (l *Locker) AcquireLock(name string, timeout time.Duration) (bool, error) {
-	held := false
-	for _, heldLock := range l.locksHeld {
-		if heldLock.name == name {
-			held = true
-			break
+// ReleaseLockContext releases a lock like ReleaseLock, bounding the DynamoDB
+// call with ctx. It returns ctx's error if ctx is done first, in which case
+// the lock may or may not have been released. Unlike with ReleaseLock, a lock
+// that can't be released is still held and refreshed, so the release can be
+// retried.
+func (l *Locker) ReleaseLockContext(ctx context.Context, name string) error {
+	if l.closed() {
+		return ErrClosed
+	}
+	if l.dropHold(name) {
+		return nil
+	}
+	if err := l.enter(); err != nil {
+		return err
+	}
+	req := releaseRequest{ctx, name, false, make(chan error, 1)}
+	if err := send(l, l.releaser, req); err != nil {
+		return err
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Locker) AcquireLock(name string, timeout time.Duration, opts ...AcquireOption) (bool, error) {
+	if l.closed() {
+		return false, ErrClosed
+	}
+	return l.acquireHold(l.ctx, name, timeout, opts...)
+}
+
+// AcquireLockContext acquires a lock like AcquireLock, bounding the DynamoDB
+// calls with ctx as well as the Locker's lifetime, so a single acquisition can
+// be cancelled or given a deadline. If ctx is done while the lock is being
+// written, the write may still have taken effect; the lock is then left to
+// expire with its lease.
+func (l *Locker) AcquireLockContext(ctx context.Context, name string, timeout time.Duration, opts ...AcquireOption) (bool, error) {
+	if l.closed() {
+		return false, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	ctx, cancel := l.bound(ctx)
+	defer cancel()
+	return l.acquireHold(ctx, name, timeout, opts...)
+}
+
+// TryAcquire acquires a lock like AcquireLockContext, but reports a lock held
+// by another Locker as a *ContendedError wrapping ErrContended instead of as
+// false, so callers can tell contention from failures with errors.Is.
+func (l *Locker) TryAcquire(ctx context.Context, name string, lease time.Duration, opts ...AcquireOption) error {
+	holder := LockInfo{Name: name}
+	opts = append(opts[:len(opts):len(opts)], func(o *acquireOptions) {
+		o.holder = &holder
+	})
+	ok, err := l.AcquireLockContext(ctx, name, lease, opts...)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &ContendedError{Holder: holder}
+	}
+	return nil
+}
+
+// bound derives a context that is done when either ctx is or the Locker is
+// closed.
+func (l *Locker) bound(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-l.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (l *Locker) acquire(ctx context.Context, name string, timeout time.Duration, opts ...AcquireOption) (bool, error) {
+	var acquireOpts acquireOptions
+	for _, opt := range opts {
+		opt(&acquireOpts)
+	}
+	if acquireOpts.err != nil {
+		return false, acquireOpts.err
+	}
+	if err := checkDataSize(acquireOpts.data); err != nil {
+		return false, fmt.Errorf("acquiring lock %s : %w", name, err)
+	}
+	held := l.holding(name)
+	if !held && l.lockOrder != nil {
+		if err := l.lockOrder.check(name, l.heldNames()); err != nil {
+			l.acquireLogger.Warn("Lock order violation", "lockname", name, "error", err)
+			return false, err
+		}
+	}
+	if !held {
+		unreserve, err := l.reserve(name)
+		if err != nil {
+			l.acquireLogger.Warn("Lock limit reached", "lockname", name, "error", err)
+			return false, err
 		}
+		// The heartbeater has recorded the lock by the time acquire returns
+		defer unreserve()
+	}
+	l.acquireLogger.Debug("Attempting to acquire lock", "locker", l.lockerId, "name", name, "held", held)
+	if l.backend != nil {
+		return l.acquireFromBackend(ctx, name, timeout, held, acquireOpts)
 	}
-	l.logger.Debug("Attempting to acquire lock", "locker", l.lockerId, "name", name, "held", held)
-	out, err := l.client.UpdateItem(l.ctx, &dynamodb.UpdateItemInput{
-		Key: map[string]dynamodbtypes.AttributeValue{
-			"name": &dynamodbtypes.AttributeValueMemberS{Value: name},
-		},
-		UpdateExpression:    aws.String("SET lockerId = :lockerId, ExpireAt = :expiry"),
-		ConditionExpression: aws.String("attribute_not_exists(lockerId) or lockerId = :lockerId or :now > ExpireAt"),
-		ReturnValues:        dynamodbtypes.ReturnValueUpdatedNew,
-		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
-			":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
-			":now":      &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())},
-			":expiry":   &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Add(timeout).Unix())},
-		},
-		TableName: aws.String(l.lockTable),
+	now := time.Now()
+	expiry := now.Add(timeout)
+	update, values, names := l.acquireUpdate(name, now, expiry, held, acquireOpts)
+	condition := l.acquireExpression(name, now, values)
+	var out *dynamodb.UpdateItemOutput
+	err := l.withBackoff(ctx, l.acquireLogger, "acquire", func() error {
+		var err error
+		out, err = l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			Key:                 l.attrs.key(name),
+			UpdateExpression:    aws.String(update),
+			ConditionExpression: aws.String(condition),
+			ReturnValues:        dynamodbtypes.ReturnValueAllOld,
+			// The old item tells a waiter whether the operation has been cancelled
+			ReturnValuesOnConditionCheckFailure: dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+			ExpressionAttributeNames:            l.attrs.expressionNames(names, update, condition),
+			ExpressionAttributeValues:           values,
+			TableName:                           aws.String(l.lockTable),
+		}, l.requestOptions)
+		return err
 	})
 	x, _ := json.Marshal(out)
-	l.logger.Debug("update result:", "result", string(x))
+	l.acquireLogger.Debug("update result:", "result", string(x))
 	if err == nil {
+		l.observeCancel(name, out.Attributes)
 		if !held {
-			l.recorder <- lock{name, timeout}
-			l.confirm <- ""
+			l.forgetVersion(name)
+			if l.verifyAcquire {
+				if err := l.verifyOwnership(ctx, name); err != nil {
+					return false, l.abandon(name, err)
+				}
+			}
+			acquired := lock{name: name, timeout: timeout, traceId: acquireOpts.traceId, expiresAt: expiry, acquiredAt: now,
+				fencingToken: nextFencingToken(out.Attributes, now)}
+			data := acquireOpts.data
+			if data == nil {
+				data = itemData(out.Attributes)
+			}
+			if err := l.track(acquired, data, out.Attributes); err != nil {
+				return false, l.abandon(name, err)
+			}
+		} else if acquireOpts.data != nil {
+			l.storeData(name, acquireOpts.data)
 		}
 	} else {
-		var oe *smithy.OperationError
-		if errors.As(err, &oe) && strings.Contains(oe.Error(), "ConditionalCheckFailedException") {
-			return false, nil
-		} else {
+		var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+		if !errors.As(err, &conditionFailed) {
 			return false, err
 		}
+		l.observeCancel(name, conditionFailed.Item)
+		l.observeVersion(name, conditionFailed.Item)
+		if acquireOpts.holder != nil {
+			*acquireOpts.holder = l.attrs.lockInfo(conditionFailed.Item)
+			acquireOpts.holder.Name = name
+		}
+		if !held {
+			l.recordContention(ctx, name)
+		}
+		return false, nil
 	}
 
 	return true, nil
 }
+
+// acquireExpression is the condition every acquisition is made under, adding
+// any values it needs to values.
+func (l *Locker) acquireExpression(name string, now time.Time, values map[string]dynamodbtypes.AttributeValue) string {
+	condition := acquireCondition
+	if l.versionLeases {
+		condition = versionLeaseCondition
+		if stale := l.staleVersionCondition(name, now, values); stale != "" {
+			condition += " or " + stale
+		}
+	}
+	if l.javaCompat {
+		condition += " or " + l.javaCondition(name, now, values)
+	}
+	condition = "(" + condition + ") and (" + cooldownCondition + ")"
+	if l.terraform {
+		condition += " and (" + terraformCondition + ")"
+	}
+	return condition
+}
+
+// acquireUpdate builds the update expression that takes or renews a lock,
+// with the values and names it refers to.
+func (l *Locker) acquireUpdate(name string, now, expiry time.Time, held bool, acquireOpts acquireOptions) (string, map[string]dynamodbtypes.AttributeValue, map[string]string) {
+	// ExpireAt keeps whole seconds (floored, so older clients never consider a
+	// lease expired early) while ExpireAtMs carries the precise expiry.
+	values := map[string]dynamodbtypes.AttributeValue{
+		":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+		":now":      &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", l.takeoverTime(now).Unix())},
+		":nowMs":    &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", l.takeoverTime(now).UnixMilli())},
+		":expiry":   &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expiry.Unix())},
+		":expiryMs": &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expiry.UnixMilli())},
+	}
+	update := "SET #owner = :lockerId, #expiry = :expiry, ExpireAtMs = :expiryMs, expiryShard = :expiryShard"
+	values[":expiryShard"] = &dynamodbtypes.AttributeValueMemberS{Value: expiryShard(name)}
+	if acquireOpts.traceId != "" {
+		update += ", traceId = :traceId"
+		values[":traceId"] = &dynamodbtypes.AttributeValueMemberS{Value: acquireOpts.traceId}
+	}
+	if l.versioned() {
+		update = l.javaUpdate(update, values, expiry.Sub(now), uuid.New().String())
+	}
+	var names map[string]string
+	if acquireOpts.data != nil {
+		update += ", #data = :data, " + bumpDataVersion
+		values[":data"] = &dynamodbtypes.AttributeValueMemberB{Value: acquireOpts.data}
+		values[":zero"] = &dynamodbtypes.AttributeValueMemberN{Value: "0"}
+		values[":one"] = &dynamodbtypes.AttributeValueMemberN{Value: "1"}
+		names = map[string]string{"#data": dataAttribute}
+	}
+	if !held {
+		update += ", " + bumpFencingToken
+		fencingValues(values, now)
+		update = l.ownerUpdate(update, values, now)
+		if l.terraform {
+			update += ", Info = :terraformInfo"
+			values[":terraformInfo"] = &dynamodbtypes.AttributeValueMemberS{Value: l.terraformInfo(name, acquireOpts.traceId, now)}
+		}
+		// Don't leave a previous owner's trace or a finished cooldown on the item
+		if acquireOpts.traceId == "" {
+			update += " REMOVE traceId, cooldownUntilMs, cooldownExempt"
+		} else {
+			update += " REMOVE cooldownUntilMs, cooldownExempt"
+		}
+		if l.owner.Description == "" {
+			update += ", " + descriptionAttribute
+		}
+		if l.javaCompat {
+			update += ", " + releasedAttribute
+		}
+	}
+	return update, values, names
+}
+
+// track records a newly acquired lock for the heartbeater to renew and
+// records the acquisition. old is the item as it was before, if known.
+func (l *Locker) track(acquired lock, data []byte, old map[string]dynamodbtypes.AttributeValue) error {
+	// The heartbeater owns the recorded copy
+	held := acquired
+	if err := l.record(&held); err != nil {
+		return err
+	}
+	l.storeData(acquired.name, data)
+	l.emit(Event{Type: EventAcquired, Lock: acquired.name})
+	l.observeTakeover(acquired.name, old)
+	l.recordAcquired(acquired)
+	return nil
+}
+
+// record adds a lock to the held locks, starting the heartbeater if it isn't
+// running and waking it to schedule the lock's renewal. A lock acquired by
+// another goroutine in the meantime keeps its lease, which is renewed straight
+// away to cover this acquisition, and takes its fencing token.
+func (l *Locker) record(lk *lock) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed() {
+		return ErrClosed
+	}
+	if held, ok := l.locksHeld[lk.name]; ok {
+		held.fencingToken = lk.fencingToken
+		held.renewAt = lk.acquiredAt
+		l.renewals.fix(held)
+		lk = held
+	} else {
+		l.armWarning(lk)
+		l.armHoldAlert(lk)
+		l.locksHeld[lk.name] = lk
+		lk.renewAt = lk.acquiredAt.Add(l.renewalDelay(lk))
+		heap.Push(&l.renewals, lk)
+	}
+	// The heartbeater only looks at the leases recorded since it last woke
+	if l.recordedLease == 0 || lk.timeout < l.recordedLease {
+		l.recordedLease = lk.timeout
+	}
+	l.heartbeatLogger.Debug("Lock record", slog.String("lockname", lk.name))
+	l.start()
+	select {
+	case l.recorded <- struct{}{}:
+	default:
+	}
+	return nil
+}
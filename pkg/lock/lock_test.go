@@ -2,13 +2,16 @@ package infra
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	smithy "github.com/aws/smithy-go"
 	"github.com/google/uuid"
 	"golang.org/x/exp/slog"
@@ -64,13 +67,11 @@ func TestGetExpiredAcquiredLock(t *testing.T) {
 	awsConf, err := config.LoadDefaultConfig(ctx)
 	assert.Nil(t, err, "error should be nil")
 
-	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	// Nothing renews the lease, so it lapses
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks", WithManualRenewal())
 	ok, err := n.AcquireLock(testLock, time.Second*1)
 	assert.True(t, ok, "lock should be acquired")
 	assert.Nil(t, err, "error should be nil")
-	t.Logf("Stopping ticker %+v", n.ticker)
-	time.Sleep(1 * time.Second)
-	n.ticker.Stop()
 
 	time.Sleep(2 * time.Second)
 	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
@@ -96,7 +97,7 @@ func TestGetReleasedLock(t *testing.T) {
 
 	}
 	assert.Nil(t, err, "error should be nil")
-	n.ReleaseLock(testLock)
+	assert.Nil(t, n.ReleaseLock(testLock), "error should be nil")
 
 	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
 	ok, err = b.AcquireLock(testLock, time.Second*10)
@@ -115,9 +116,275 @@ func TestReaquireHeldLock(t *testing.T) {
 	ok, err := n.AcquireLock(testLock, time.Second*10)
 	assert.True(t, ok, "lock should be acquired")
 	assert.Nil(t, err, "error should be nil")
-	n.ReleaseLock(testLock)
+	assert.Nil(t, n.ReleaseLock(testLock), "error should be nil")
 
 	ok, err = n.AcquireLock(testLock, time.Second*10)
 	assert.Nil(t, err, "error should be nil")
 	assert.True(t, ok, "lock should be acquired")
 }
+
+func TestLockRecordsTraceID(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	client := dynamodb.NewFromConfig(awsConf)
+	n := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock(testLock, time.Second*10, WithTraceID("trace-1234"))
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:       map[string]dynamodbtypes.AttributeValue{"name": &dynamodbtypes.AttributeValueMemberS{Value: testLock}},
+		TableName: aws.String("locks"),
+	})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberS{Value: "trace-1234"}, out.Item["traceId"], "trace id should be recorded")
+}
+
+func TestIdleLockerHasNoHeartbeater(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := NewLocker(nil, ctx, "locks")
+	assert.False(t, n.running, "heartbeater should not run before a lock is held")
+	assert.Nil(t, n.ticker, "ticker should not be created before a lock is held")
+}
+
+func TestClosedLockerFailsFast(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := NewLocker(nil, ctx, "locks")
+	n.Close(ctx)
+	ok, err := n.AcquireLock(uuid.New().String(), time.Second*10)
+	assert.False(t, ok, "lock should not be acquired")
+	assert.ErrorIs(t, err, ErrClosed, "closed locker should refuse acquisition")
+	assert.ErrorIs(t, n.ReleaseLock(uuid.New().String()), ErrClosed, "closed locker should refuse release")
+
+	parentCtx, parentCancel := context.WithCancel(context.Background())
+	b := NewLocker(nil, parentCtx, "locks")
+	parentCancel()
+	_, err = b.AcquireLock(uuid.New().String(), time.Second*10)
+	assert.ErrorIs(t, err, ErrClosed, "cancelled parent context should close the locker")
+}
+
+func TestGetExpiredSubSecondLock(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks", WithManualRenewal())
+	ok, err := n.AcquireLock(testLock, time.Millisecond*500)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err = b.AcquireLock(testLock, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "lock should not be acquired before the lease lapses")
+
+	time.Sleep(600 * time.Millisecond)
+	ok, err = b.AcquireLock(testLock, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired after a sub-second lease")
+}
+
+func TestVerifiedAcquire(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks", WithVerifiedAcquire())
+	ok, err := n.AcquireLock(testLock, time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+}
+
+func TestReleaseMany(t *testing.T) {
+	names := []string{uuid.New().String(), uuid.New().String(), uuid.New().String()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	for _, name := range names[:2] {
+		ok, err := n.AcquireLock(name, time.Second*10)
+		assert.True(t, ok, "lock should be acquired")
+		assert.Nil(t, err, "error should be nil")
+	}
+	assert.ErrorIs(t, n.ReleaseMany(ctx, names), ErrNotHeld, "unheld lock should abort the batch")
+	assert.ElementsMatch(t, names[:2], n.heldNames(), "failed batch should release nothing")
+
+	assert.Nil(t, n.ReleaseMany(ctx, names[:2]), "error should be nil")
+	assert.Empty(t, n.heldNames(), "batch should release every lock")
+	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err := b.AcquireLock(names[0], time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "released lock should be acquired")
+}
+
+// stallingUpdates is a MemoryClient whose updates block until their context
+// is done.
+type stallingUpdates struct {
+	*MemoryClient
+}
+
+func (c stallingUpdates) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestVerifyHeld(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	b := NewLocker(client, ctx, "locks", WithClockSkewMargin(time.Minute))
+	ok, err := n.AcquireLock("held", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, n.VerifyHeld(ctx, "held"), "a held lock should be verified")
+	assert.ErrorIs(t, b.VerifyHeld(ctx, "held"), ErrNotVerified, "a lock held by another locker should not be verified")
+	assert.ErrorIs(t, n.VerifyHeld(ctx, "free"), ErrNotVerified, "a free lock should not be verified")
+
+	ok, err = b.AcquireLock("short", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	assert.ErrorIs(t, b.VerifyHeld(ctx, "short"), ErrNotVerified, "a lease ending within the skew margin should not be verified")
+
+	n.Close(ctx)
+	assert.ErrorIs(t, n.VerifyHeld(ctx, "held"), ErrClosed, "a closed locker should fail fast")
+}
+
+// failingReads is a MemoryClient whose reads fail, as a verifying read might.
+type failingReads struct {
+	*MemoryClient
+}
+
+func (c failingReads) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestFailedVerificationReleasesLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(failingReads{client}, ctx, "locks", WithVerifiedAcquire())
+	ok, err := n.AcquireLock("unverified", time.Second*10)
+	assert.NotNil(t, err, "a failed verification should be reported")
+	assert.False(t, ok, "lock should not be acquired")
+	assert.Empty(t, n.heldNames(), "an unverified lock should not be tracked")
+
+	b := NewLocker(client, ctx, "locks")
+	ok, err = b.AcquireLock("unverified", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "an unverified lock should be released rather than left to lapse")
+}
+
+func TestAcquireLockContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := NewLocker(stallingUpdates{NewMemoryClient()}, ctx, "locks")
+	bounded, boundedCancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer boundedCancel()
+	ok, err := n.AcquireLockContext(bounded, "stalled", time.Second*10)
+	assert.False(t, ok, "lock should not be acquired")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "acquisition should honour the caller's deadline")
+
+	b := NewLocker(NewMemoryClient(), ctx, "locks")
+	ok, err = b.AcquireLockContext(ctx, "released", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, b.ReleaseLockContext(ctx, "released"), "error should be nil")
+	assert.Empty(t, b.heldNames(), "released lock should not be tracked")
+	assert.ErrorIs(t, b.ReleaseLockContext(ctx, "released"), ErrNotHeld, "lock should not be released twice")
+}
+
+func TestTryAcquire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	b := NewLocker(client, ctx, "locks")
+	assert.Nil(t, n.TryAcquire(ctx, "contended", time.Minute), "lock should be acquired")
+
+	err := b.TryAcquire(ctx, "contended", time.Minute)
+	assert.ErrorIs(t, err, ErrContended, "a held lock should be reported as contended")
+	var contended *ContendedError
+	if assert.ErrorAs(t, err, &contended, "the holder should be reported") {
+		assert.Equal(t, "contended", contended.Holder.Name, "the lock should be named")
+		assert.Equal(t, n.ID(), contended.Holder.LockerId, "the holder should be read from the lock item")
+	}
+
+	broken := NewLocker(&fakeClient{updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		return nil, &smithy.OperationError{ServiceID: "DynamoDB", OperationName: "UpdateItem",
+			Err: errors.New("proxy rejected ConditionalCheckFailedException payload")}
+	}}, ctx, "locks")
+	err = broken.TryAcquire(ctx, "broken", time.Minute)
+	assert.NotNil(t, err, "a failed write should be reported")
+	assert.NotErrorIs(t, err, ErrContended, "only condition failures should count as contention")
+}
+
+func TestReleaseLockReportsFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := NewLocker(failingDeletes{NewMemoryClient(), "stuck"}, ctx, "locks")
+	for _, name := range []string{"released", "stuck"} {
+		ok, err := n.AcquireLock(name, time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+
+	assert.Nil(t, n.ReleaseLock("released"), "error should be nil")
+	assert.Equal(t, []string{"stuck"}, n.heldNames(), "release should be done once ReleaseLock returns")
+	assert.ErrorIs(t, n.ReleaseLock("released"), ErrNotHeld, "lock should not be released twice")
+
+	assert.ErrorContains(t, n.ReleaseLock("stuck"), "connection reset", "a failed release should be returned")
+	assert.Empty(t, n.heldNames(), "a lock that can't be released should be left to lapse")
+}
+
+func TestAcquireLocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	b := NewLocker(client, ctx, "locks")
+
+	ok, err := b.AcquireLock("b", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	ok, err = n.AcquireLocks(ctx, []string{"a", "b", "c"}, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a set with a contended lock should not be acquired")
+	assert.Empty(t, n.heldNames(), "no lock of a contended set should be held")
+	ok, err = b.AcquireLock("a", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "locks of a failed set should be left free")
+	assert.Nil(t, b.ReleaseMany(ctx, []string{"a", "b"}), "error should be nil")
+
+	ok, err = n.AcquireLocks(ctx, []string{"a", "b", "c"}, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a free set should be acquired")
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, n.heldNames(), "every lock of the set should be held")
+	assert.NotZero(t, n.Handle("a").FencingToken(), "locks acquired in a set should get fencing tokens")
+	ok, err = b.AcquireLock("c", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "locks of an acquired set should be held")
+
+	ok, err = n.AcquireLocks(ctx, []string{"c", "d"}, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a set overlapping held locks should be acquired")
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, n.heldNames(), "held locks should be tracked once")
+
+	_, err = n.AcquireLocks(ctx, []string{"e", "e"}, time.Second*10)
+	assert.Error(t, err, "a set naming a lock twice should be refused")
+}
@@ -0,0 +1,109 @@
+package infra
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/exp/slog"
+)
+
+// levelHandler filters records below its own level before handing them to
+// the wrapped handler, so each Locker component can be tuned separately.
+// A nil level defers to the wrapped handler.
+type levelHandler struct {
+	level   slog.Leveler
+	handler slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	min := h.level
+	if s, ok := min.(*levelSwitch); ok {
+		min = s.get()
+	}
+	if min == nil {
+		return h.handler.Enabled(ctx, level)
+	}
+	return level >= min.Level()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{h.level, h.handler.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{h.level, h.handler.WithGroup(name)}
+}
+
+// levelSwitch is a component level that can be changed while the Locker is
+// logging. Unset, it defers to the wrapped handler like a nil level.
+type levelSwitch struct {
+	level atomic.Pointer[slog.Leveler]
+}
+
+func (s *levelSwitch) set(level slog.Leveler) {
+	s.level.Store(&level)
+}
+
+func (s *levelSwitch) get() slog.Leveler {
+	if level := s.level.Load(); level != nil {
+		return *level
+	}
+	return nil
+}
+
+func (s *levelSwitch) Level() slog.Level {
+	if level := s.get(); level != nil {
+		return level.Level()
+	}
+	return slog.LevelInfo
+}
+
+// samplingHandler passes the first and then every Nth debug record with a
+// given message, and all records above debug. Handlers derived through
+// WithAttrs and WithGroup share the same counters.
+type samplingHandler struct {
+	every   uint64
+	counts  *sync.Map
+	handler slog.Handler
+}
+
+func newSamplingHandler(every int, handler slog.Handler) *samplingHandler {
+	return &samplingHandler{uint64(every), &sync.Map{}, handler}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level <= slog.LevelDebug {
+		counter, _ := h.counts.LoadOrStore(r.Message, new(atomic.Uint64))
+		if (counter.(*atomic.Uint64).Add(1)-1)%h.every != 0 {
+			return nil
+		}
+	}
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{h.every, h.counts, h.handler.WithAttrs(attrs)}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{h.every, h.counts, h.handler.WithGroup(name)}
+}
+
+// componentLogger derives the logger for one Locker component. Debug records
+// are sampled 1 in sample when sample is above 1.
+func componentLogger(base *slog.Logger, component string, level slog.Leveler, sample int) *slog.Logger {
+	handler := base.Handler()
+	if sample > 1 {
+		handler = newSamplingHandler(sample, handler)
+	}
+	return slog.New(&levelHandler{level, handler}).With("component", component)
+}
@@ -0,0 +1,49 @@
+package infra
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComponentLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	quiet := componentLogger(base, "heartbeat", slog.LevelWarn, 0)
+	quiet.Info("silenced")
+	assert.Empty(t, buf.String(), "info should be filtered by the component level")
+
+	verbose := componentLogger(base, "acquire", slog.LevelDebug, 0)
+	verbose.Debug("shown")
+	assert.Contains(t, buf.String(), "shown", "debug should pass the component level")
+	assert.Contains(t, buf.String(), "component=acquire", "component should be attached")
+
+	buf.Reset()
+	inherited := componentLogger(base, "admin", nil, 0)
+	inherited.Debug("hidden")
+	assert.Empty(t, buf.String(), "nil level should defer to the handler")
+	inherited.Info("visible")
+	assert.Contains(t, buf.String(), "visible", "info should pass the handler level")
+}
+
+func TestDebugLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logger := componentLogger(base, "heartbeat", nil, 3)
+
+	for i := 0; i < 7; i++ {
+		logger.Debug("Tick refresh")
+		logger.With("lockname", "x").Debug("Lock record")
+	}
+	logger.Info("Not sampled")
+	logger.Info("Not sampled")
+
+	assert.Equal(t, 3, strings.Count(buf.String(), "Tick refresh"), "first and every 3rd debug record should be kept")
+	assert.Equal(t, 3, strings.Count(buf.String(), "Lock record"), "messages should be counted independently")
+	assert.Equal(t, 2, strings.Count(buf.String(), "Not sampled"), "info records should not be sampled")
+}
@@ -0,0 +1,93 @@
+package infra
+
+import (
+	"time"
+)
+
+// errorBuffer is how many background errors Errors holds before dropping
+// them.
+const errorBuffer = 16
+
+type lostLock struct {
+	name string
+	err  error
+}
+
+// WithLockLostHandler registers a function called when a held lock can no
+// longer be refreshed, either because another Locker took it or because its
+// lease lapsed while DynamoDB could not be reached. The lock is no longer
+// tracked by then, so the application decides how to react: stop the work
+// the lock guarded, reacquire it, or shut down. Handlers run on the
+// heartbeater and must not block.
+func WithLockLostHandler(handler func(name string, err error)) Option {
+	return func(l *Locker) {
+		l.lostHandlers = append(l.lostHandlers, handler)
+	}
+}
+
+// WithRenewalFailureThreshold declares a lock lost before its lease lapses
+// when renewing it keeps failing: after failures renewals failed in a row, or
+// once fraction of its lease has gone by since it was last renewed, whichever
+// comes first. Zero leaves out either condition. By default a lock whose
+// renewals fail is only lost once its lease has lapsed, which leaves the lock
+// guarding nothing for the last moments the application believes it holds
+// it. A renewal refused because another Locker holds the lock always loses it
+// straight away.
+func WithRenewalFailureThreshold(failures int, fraction float64) Option {
+	return func(l *Locker) {
+		l.failureLimit = failures
+		l.failureFraction = fraction
+	}
+}
+
+// givenUp reports whether a lock whose renewal failed at now should be
+// declared lost.
+func (l *Locker) givenUp(lk *lock, now time.Time) bool {
+	if !now.Before(lk.expiresAt) {
+		return true
+	}
+	if l.failureLimit > 0 && lk.failures >= l.failureLimit {
+		return true
+	}
+	renewed := lk.expiresAt.Add(-lk.timeout)
+	return l.failureFraction > 0 && now.Sub(renewed) >= time.Duration(l.failureFraction*float64(lk.timeout))
+}
+
+// Errors returns a channel of the errors the heartbeater runs into in the
+// background: refreshes that failed, locks lost because of them, and
+// releases that failed when the Locker's context ended. A refresh that fails
+// while the lease is still running is retried on the next tick, unless
+// WithRenewalFailureThreshold gives up on the lock sooner. Errors that
+// aren't read before the channel's buffer fills up are logged and dropped.
+func (l *Locker) Errors() <-chan error {
+	return l.errs
+}
+
+func (l *Locker) reportError(err error) {
+	l.heartbeatLogger.Warn("Heartbeater error", "error", err)
+	select {
+	case l.errs <- err:
+	default:
+		l.heartbeatLogger.Warn("Error buffer full, dropping error", "error", err)
+	}
+}
+
+// lose stops tracking a lock that could not be refreshed and tells the
+// application.
+func (l *Locker) lose(name string, err error) {
+	l.heartbeatLogger.Error("Lock lost", "lockname", name, "error", err)
+	l.emit(Event{Type: EventLost, Lock: name, Err: err})
+	l.mu.Lock()
+	if h, ok := l.handles[name]; ok {
+		h.lostErr = err
+	}
+	l.mu.Unlock()
+	l.untrack(name, false)
+	select {
+	case l.errs <- err:
+	default:
+	}
+	for _, handler := range l.lostHandlers {
+		handler(name, err)
+	}
+}
@@ -0,0 +1,92 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshFailureLosesLock(t *testing.T) {
+	failing := false
+	client := &fakeClient{
+		updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			if failing {
+				return nil, errors.New("connection reset")
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		deleteItem: func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := make(chan string, 1)
+	s := NewManualScheduler()
+	l := NewLocker(client, ctx, "locks", WithScheduler(func(time.Duration) Scheduler { return s }),
+		WithLockLostHandler(func(name string, err error) { lost <- name }))
+	ok, err := l.AcquireLock("x", time.Millisecond*200)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	client.mu.Lock()
+	failing = true
+	client.mu.Unlock()
+	s.Tick(time.Now())
+	assert.ErrorContains(t, <-l.Errors(), "connection reset", "a failed refresh should be reported")
+	assert.Equal(t, []string{"x"}, l.heldNames(), "a lock within its lease should be kept")
+
+	time.Sleep(time.Millisecond * 250)
+	s.Tick(time.Now())
+	assert.Equal(t, "x", <-lost, "a lapsed lock should be lost")
+	assert.ErrorContains(t, <-l.Errors(), "connection reset", "the lost lock should be reported")
+	assert.Empty(t, l.heldNames(), "a lost lock should no longer be tracked")
+	assert.False(t, l.closed(), "losing a lock should not close the Locker")
+}
+
+func TestRenewalFailureThreshold(t *testing.T) {
+	failing := false
+	client := &fakeClient{
+		updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			if failing {
+				return nil, errors.New("connection reset")
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lost := make(chan string, 1)
+	s := NewManualScheduler()
+	l := NewLocker(client, ctx, "locks", WithScheduler(func(time.Duration) Scheduler { return s }),
+		WithRenewalFailureThreshold(2, 0), WithLockLostHandler(func(name string, err error) { lost <- name }))
+	ok, err := l.AcquireLock("x", time.Hour)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	client.mu.Lock()
+	failing = true
+	client.mu.Unlock()
+	s.Tick(time.Now())
+	assert.ErrorContains(t, <-l.Errors(), "connection reset", "a failed refresh should be reported")
+	assert.Equal(t, []string{"x"}, l.heldNames(), "a single failure should not lose the lock")
+
+	s.Tick(time.Now())
+	assert.Equal(t, "x", <-lost, "the lock should be lost after two failures in a row")
+	assert.Empty(t, l.heldNames(), "a lost lock should no longer be tracked")
+}
+
+func TestRenewalFailureFraction(t *testing.T) {
+	l := &Locker{}
+	WithRenewalFailureThreshold(0, 0.5)(l)
+	now := time.Now()
+	lk := lock{name: "x", timeout: 10 * time.Second, expiresAt: now.Add(6 * time.Second), failures: 5}
+	assert.False(t, l.givenUp(&lk, now), "a lock with most of its lease left should be kept")
+	lk.expiresAt = now.Add(5 * time.Second)
+	assert.True(t, l.givenUp(&lk, now), "a lock past the fraction of its lease should be lost")
+}
@@ -0,0 +1,71 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithManualRenewal stops the heartbeater from renewing locks by itself, for
+// callers such as step-driven batch jobs that want to decide when leases are
+// extended. Locks are then only renewed by Renew, and lapse with their lease
+// if it isn't called in time. Releases, extensions and the other requests
+// served by the heartbeater work as usual; WithScheduler, WithAdaptiveLease,
+// WithHeartbeatJitter and WithWatchdog have no effect.
+func WithManualRenewal() Option {
+	return func(l *Locker) {
+		l.manualRenewal = true
+	}
+}
+
+type renewRequest struct {
+	name   string
+	result chan error
+}
+
+// Renew renews the lease of a held lock straight away, as the heartbeater
+// would, and returns once the renewal has been written. It returns an error
+// wrapping ErrNotHeld if the lock is no longer held by this Locker, in which
+// case it is lost, as it is when its lease has lapsed by the time a renewal
+// fails. It is what keeps locks held under WithManualRenewal, but can be used
+// alongside the heartbeater too. If ctx is done first, ctx's error is
+// returned and the renewal may or may not have taken effect.
+func (l *Locker) Renew(ctx context.Context, name string) error {
+	if err := l.enter(); err != nil {
+		return err
+	}
+	req := renewRequest{name, make(chan error, 1)}
+	if err := send(l, l.renewer, req); err != nil {
+		return err
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// renewNow runs on the heartbeater.
+func (l *Locker) renewNow(name string) error {
+	l.mu.Lock()
+	lk, held := l.locksHeld[name]
+	l.mu.Unlock()
+	if !held {
+		return fmt.Errorf("renewing lock %s : %w", name, ErrNotHeld)
+	}
+	start := time.Now()
+	ok, err := l.renew(lk)
+	var lost []lostLock
+	l.renewed(lk, start, ok, err, &lost)
+	for _, lk := range lost {
+		l.lose(lk.name, lk.err)
+	}
+	if err != nil {
+		return fmt.Errorf("renewing lock %s : %w", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("renewing lock %s : %w", name, ErrNotHeld)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManualRenewal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &countingClient{MemoryClient: NewMemoryClient()}
+	l := NewLocker(client, ctx, "locks", WithManualRenewal())
+	ok, err := l.AcquireLock("step", 200*time.Millisecond)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	acquired := l.Handle("step").ExpiresAt()
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, int32(1), client.updates.Load(), "the lock should not be renewed in the background")
+
+	assert.Nil(t, l.Renew(ctx, "step"), "error should be nil")
+	assert.Equal(t, int32(2), client.updates.Load(), "Renew should write the renewal")
+	assert.True(t, l.Handle("step").ExpiresAt().After(acquired), "Renew should move the expiry out")
+
+	err = l.Renew(ctx, "other")
+	assert.True(t, errors.Is(err, ErrNotHeld), "renewing a lock that isn't held should fail")
+}
@@ -0,0 +1,777 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// MemoryClient is a Client that keeps tables in process memory, for local
+// development and tests without DynamoDB. It evaluates the condition, update
+// and key condition expressions the Locker uses, with the same semantics as
+// DynamoDB, so Lockers sharing a MemoryClient contend for locks as they would
+// on a real table. Nothing is persisted and nothing is shared between
+// processes.
+//
+// Tables are created on first use and keyed by "name" unless defined
+// otherwise with DefineTable.
+type MemoryClient struct {
+	mu     sync.Mutex
+	tables map[string]*memoryTable
+}
+
+type memoryTable struct {
+	keys  []string
+	items map[string]map[string]dynamodbtypes.AttributeValue
+}
+
+// NewMemoryClient returns an empty MemoryClient.
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{tables: map[string]*memoryTable{}}
+}
+
+// DefineTable sets the key attributes of a table, partition key first. The
+// history table used by WithHistory is keyed by "name" and "acquiredAtMs".
+func (c *MemoryClient) DefineTable(name string, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables[name] = newMemoryTable(keys...)
+}
+
+// defineTableIfMissing is DefineTable for a table that hasn't been used yet.
+func (c *MemoryClient) defineTableIfMissing(name string, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.tables[name]; !ok {
+		c.tables[name] = newMemoryTable(keys...)
+	}
+}
+
+func newMemoryTable(keys ...string) *memoryTable {
+	return &memoryTable{keys: keys, items: map[string]map[string]dynamodbtypes.AttributeValue{}}
+}
+
+func (c *MemoryClient) table(name *string) *memoryTable {
+	t, ok := c.tables[aws.ToString(name)]
+	if !ok {
+		t = newMemoryTable("name")
+		c.tables[aws.ToString(name)] = t
+	}
+	return t
+}
+
+// keyOf encodes the key attributes of an item or key.
+func (t *memoryTable) keyOf(item map[string]dynamodbtypes.AttributeValue) (string, error) {
+	var parts []string
+	for _, k := range t.keys {
+		v, ok := item[k]
+		if !ok {
+			return "", fmt.Errorf("missing key attribute %s", k)
+		}
+		parts = append(parts, fmt.Sprintf("%#v", v))
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+func memoryError(operation string, err error) error {
+	return &smithy.OperationError{ServiceID: "DynamoDB", OperationName: operation, Err: err}
+}
+
+func conditionFailure(operation string, old map[string]dynamodbtypes.AttributeValue, returnOld bool) error {
+	e := &dynamodbtypes.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	if returnOld {
+		e.Item = copyItem(old)
+	}
+	return memoryError(operation, e)
+}
+
+func copyItem(item map[string]dynamodbtypes.AttributeValue) map[string]dynamodbtypes.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	c := make(map[string]dynamodbtypes.AttributeValue, len(item))
+	for k, v := range item {
+		c[k] = v
+	}
+	return c
+}
+
+func (c *MemoryClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.table(params.TableName)
+	key, err := t.keyOf(params.Key)
+	if err != nil {
+		return nil, memoryError("GetItem", err)
+	}
+	item, ok := t.items[key]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	e := evaluator{names: params.ExpressionAttributeNames}
+	return &dynamodb.GetItemOutput{Item: e.project(params.ProjectionExpression, item)}, nil
+}
+
+func (c *MemoryClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.table(params.TableName)
+	key, err := t.keyOf(params.Item)
+	if err != nil {
+		return nil, memoryError("PutItem", err)
+	}
+	old := t.items[key]
+	e := evaluator{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues}
+	ok, err := e.condition(params.ConditionExpression, old)
+	if err != nil {
+		return nil, memoryError("PutItem", err)
+	}
+	if !ok {
+		return nil, conditionFailure("PutItem", old, params.ReturnValuesOnConditionCheckFailure == dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld)
+	}
+	t.items[key] = copyItem(params.Item)
+	out := &dynamodb.PutItemOutput{}
+	if params.ReturnValues == dynamodbtypes.ReturnValueAllOld {
+		out.Attributes = copyItem(old)
+	}
+	return out, nil
+}
+
+func (c *MemoryClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.table(params.TableName)
+	e := evaluator{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues}
+	old, updated, err := c.update(t, params.Key, params.UpdateExpression, params.ConditionExpression, e)
+	if err == errConditionFailed {
+		return nil, conditionFailure("UpdateItem", old, params.ReturnValuesOnConditionCheckFailure == dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld)
+	}
+	if err != nil {
+		return nil, memoryError("UpdateItem", err)
+	}
+	out := &dynamodb.UpdateItemOutput{}
+	switch params.ReturnValues {
+	case dynamodbtypes.ReturnValueAllOld:
+		out.Attributes = copyItem(old)
+	case dynamodbtypes.ReturnValueAllNew:
+		out.Attributes = copyItem(updated)
+	}
+	return out, nil
+}
+
+func (c *MemoryClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.table(params.TableName)
+	key, err := t.keyOf(params.Key)
+	if err != nil {
+		return nil, memoryError("DeleteItem", err)
+	}
+	old := t.items[key]
+	e := evaluator{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues}
+	ok, err := e.condition(params.ConditionExpression, old)
+	if err != nil {
+		return nil, memoryError("DeleteItem", err)
+	}
+	if !ok {
+		return nil, conditionFailure("DeleteItem", old, params.ReturnValuesOnConditionCheckFailure == dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld)
+	}
+	delete(t.items, key)
+	out := &dynamodb.DeleteItemOutput{}
+	if params.ReturnValues == dynamodbtypes.ReturnValueAllOld {
+		out.Attributes = copyItem(old)
+	}
+	return out, nil
+}
+
+// Query evaluates the key condition against every item of the table, whether
+// or not an index is named, and returns the matches in a single page ordered
+// by the table's sort key, or by partition key for tables without one.
+func (c *MemoryClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.table(params.TableName)
+	e := evaluator{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues}
+	var items []map[string]dynamodbtypes.AttributeValue
+	for _, item := range t.items {
+		ok, err := e.condition(params.KeyConditionExpression, item)
+		if err != nil {
+			return nil, memoryError("Query", err)
+		}
+		if ok {
+			items = append(items, item)
+		}
+	}
+	order := t.keys[len(t.keys)-1]
+	sort.Slice(items, func(i, j int) bool {
+		if c, ok := compare(items[i][order], items[j][order]); ok {
+			return c < 0
+		}
+		return false
+	})
+	if params.ScanIndexForward != nil && !*params.ScanIndexForward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if params.Limit != nil && int(*params.Limit) < len(items) {
+		items = items[:*params.Limit]
+	}
+	out := &dynamodb.QueryOutput{}
+	for _, item := range items {
+		out.Items = append(out.Items, e.project(params.ProjectionExpression, item))
+	}
+	out.Count = int32(len(out.Items))
+	return out, nil
+}
+
+// Scan returns the items of the table matching the filter expression, in
+// key order. As in DynamoDB, Limit bounds the items read before filtering,
+// and LastEvaluatedKey is set when the page stopped short of the table's end.
+func (c *MemoryClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.table(params.TableName)
+	keys := make([]string, 0, len(t.items))
+	for key := range t.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if params.ExclusiveStartKey != nil {
+		start, err := t.keyOf(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, memoryError("Scan", err)
+		}
+		keys = keys[sort.Search(len(keys), func(i int) bool { return keys[i] > start }):]
+	}
+	out := &dynamodb.ScanOutput{}
+	if params.Limit != nil && int(*params.Limit) < len(keys) {
+		keys = keys[:*params.Limit]
+		last := t.items[keys[len(keys)-1]]
+		out.LastEvaluatedKey = map[string]dynamodbtypes.AttributeValue{}
+		for _, k := range t.keys {
+			out.LastEvaluatedKey[k] = last[k]
+		}
+	}
+	e := evaluator{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues}
+	for _, key := range keys {
+		item := t.items[key]
+		ok, err := e.condition(params.FilterExpression, item)
+		if err != nil {
+			return nil, memoryError("Scan", err)
+		}
+		if ok {
+			out.Items = append(out.Items, e.project(params.ProjectionExpression, item))
+		}
+	}
+	out.Count = int32(len(out.Items))
+	out.ScannedCount = int32(len(keys))
+	return out, nil
+}
+
+// TransactWriteItems checks the conditions of every item before applying any
+// of the writes, and cancels the whole transaction if one fails.
+func (c *MemoryClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reasons := make([]dynamodbtypes.CancellationReason, len(params.TransactItems))
+	cancelled := false
+	for i, op := range params.TransactItems {
+		var table, condition *string
+		var key map[string]dynamodbtypes.AttributeValue
+		var e evaluator
+		returnOld := false
+		switch {
+		case op.Update != nil:
+			table, key, condition = op.Update.TableName, op.Update.Key, op.Update.ConditionExpression
+			e = evaluator{names: op.Update.ExpressionAttributeNames, values: op.Update.ExpressionAttributeValues}
+			returnOld = op.Update.ReturnValuesOnConditionCheckFailure == dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld
+		case op.Delete != nil:
+			table, key, condition = op.Delete.TableName, op.Delete.Key, op.Delete.ConditionExpression
+			e = evaluator{names: op.Delete.ExpressionAttributeNames, values: op.Delete.ExpressionAttributeValues}
+		case op.Put != nil:
+			table, key, condition = op.Put.TableName, op.Put.Item, op.Put.ConditionExpression
+			e = evaluator{names: op.Put.ExpressionAttributeNames, values: op.Put.ExpressionAttributeValues}
+		case op.ConditionCheck != nil:
+			table, key, condition = op.ConditionCheck.TableName, op.ConditionCheck.Key, op.ConditionCheck.ConditionExpression
+			e = evaluator{names: op.ConditionCheck.ExpressionAttributeNames, values: op.ConditionCheck.ExpressionAttributeValues}
+		}
+		t := c.table(table)
+		k, err := t.keyOf(key)
+		if err != nil {
+			return nil, memoryError("TransactWriteItems", err)
+		}
+		ok, err := e.condition(condition, t.items[k])
+		if err != nil {
+			return nil, memoryError("TransactWriteItems", err)
+		}
+		reasons[i].Code = aws.String("None")
+		if !ok {
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			if returnOld {
+				reasons[i].Item = copyItem(t.items[k])
+			}
+			cancelled = true
+		}
+	}
+	if cancelled {
+		return nil, memoryError("TransactWriteItems", &dynamodbtypes.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled"),
+			CancellationReasons: reasons,
+		})
+	}
+	for _, op := range params.TransactItems {
+		switch {
+		case op.Update != nil:
+			e := evaluator{names: op.Update.ExpressionAttributeNames, values: op.Update.ExpressionAttributeValues}
+			if _, _, err := c.update(c.table(op.Update.TableName), op.Update.Key, op.Update.UpdateExpression, nil, e); err != nil {
+				return nil, memoryError("TransactWriteItems", err)
+			}
+		case op.Delete != nil:
+			t := c.table(op.Delete.TableName)
+			k, _ := t.keyOf(op.Delete.Key)
+			delete(t.items, k)
+		case op.Put != nil:
+			t := c.table(op.Put.TableName)
+			k, _ := t.keyOf(op.Put.Item)
+			t.items[k] = copyItem(op.Put.Item)
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+var errConditionFailed = fmt.Errorf("conditional check failed")
+
+// update applies an update expression to the item with the given key,
+// creating it if needed, and returns the item before and after.
+func (c *MemoryClient) update(t *memoryTable, key map[string]dynamodbtypes.AttributeValue, update, condition *string, e evaluator) (old, updated map[string]dynamodbtypes.AttributeValue, err error) {
+	k, err := t.keyOf(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	old = t.items[k]
+	ok, err := e.condition(condition, old)
+	if err != nil {
+		return old, nil, err
+	}
+	if !ok {
+		return old, nil, errConditionFailed
+	}
+	updated = copyItem(old)
+	if updated == nil {
+		updated = copyItem(key)
+	}
+	if err := e.apply(update, old, updated); err != nil {
+		return old, nil, err
+	}
+	t.items[k] = updated
+	return old, updated, nil
+}
+
+// evaluator evaluates expressions with the placeholders of one request.
+type evaluator struct {
+	names  map[string]string
+	values map[string]dynamodbtypes.AttributeValue
+}
+
+func (e evaluator) condition(expr *string, item map[string]dynamodbtypes.AttributeValue) (bool, error) {
+	if expr == nil || strings.TrimSpace(*expr) == "" {
+		return true, nil
+	}
+	p := &exprParser{tokens: tokenize(*expr), e: e, item: item}
+	ok, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q in condition %q", p.tokens[p.pos], *expr)
+	}
+	return ok, err
+}
+
+// apply evaluates the SET and REMOVE clauses of an update expression against
+// old, writing the results into item.
+func (e evaluator) apply(expr *string, old, item map[string]dynamodbtypes.AttributeValue) error {
+	if expr == nil {
+		return nil
+	}
+	p := &exprParser{tokens: tokenize(*expr), e: e, item: old}
+	for p.pos < len(p.tokens) {
+		clause := strings.ToUpper(p.next())
+		for {
+			name, err := p.path()
+			if err != nil {
+				return err
+			}
+			switch clause {
+			case "SET":
+				if p.next() != "=" {
+					return fmt.Errorf("expected = in update expression %q", *expr)
+				}
+				v, err := p.value()
+				if err != nil {
+					return err
+				}
+				item[name] = v
+			case "REMOVE":
+				delete(item, name)
+			default:
+				return fmt.Errorf("unsupported clause %s in update expression %q", clause, *expr)
+			}
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	return nil
+}
+
+func (e evaluator) project(expr *string, item map[string]dynamodbtypes.AttributeValue) map[string]dynamodbtypes.AttributeValue {
+	if expr == nil {
+		return copyItem(item)
+	}
+	projected := map[string]dynamodbtypes.AttributeValue{}
+	for _, name := range strings.Split(*expr, ",") {
+		name = e.name(strings.TrimSpace(name))
+		if v, ok := item[name]; ok {
+			projected[name] = v
+		}
+	}
+	return projected
+}
+
+func (e evaluator) name(token string) string {
+	if strings.HasPrefix(token, "#") {
+		return e.names[token]
+	}
+	return token
+}
+
+func tokenize(expr string) []string {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		r := rune(expr[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("(),+-", r):
+			tokens = append(tokens, string(r))
+			i++
+		case strings.ContainsRune("<>=", r):
+			j := i + 1
+			if j < len(expr) && strings.ContainsRune("<>=", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(expr) && !unicode.IsSpace(rune(expr[j])) && !strings.ContainsRune("(),+-<>=", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	e      evaluator
+	item   map[string]dynamodbtypes.AttributeValue
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) or() (bool, error) {
+	result, err := p.and()
+	for err == nil && strings.EqualFold(p.peek(), "or") {
+		p.next()
+		var right bool
+		right, err = p.and()
+		result = result || right
+	}
+	return result, err
+}
+
+func (p *exprParser) and() (bool, error) {
+	result, err := p.not()
+	for err == nil && strings.EqualFold(p.peek(), "and") {
+		p.next()
+		var right bool
+		right, err = p.not()
+		result = result && right
+	}
+	return result, err
+}
+
+func (p *exprParser) not() (bool, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		result, err := p.not()
+		return !result, err
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (bool, error) {
+	switch t := p.peek(); {
+	case t == "(":
+		p.next()
+		result, err := p.or()
+		if err == nil && p.next() != ")" {
+			err = fmt.Errorf("unbalanced parentheses in condition")
+		}
+		return result, err
+	case t == "attribute_exists" || t == "attribute_not_exists":
+		p.next()
+		if p.next() != "(" {
+			return false, fmt.Errorf("expected ( after %s", t)
+		}
+		name, err := p.path()
+		if err != nil {
+			return false, err
+		}
+		if p.next() != ")" {
+			return false, fmt.Errorf("expected ) after %s", t)
+		}
+		_, exists := p.item[name]
+		return exists == (t == "attribute_exists"), nil
+	case t == "begins_with":
+		p.next()
+		if p.next() != "(" {
+			return false, fmt.Errorf("expected ( after begins_with")
+		}
+		name, err := p.path()
+		if err != nil {
+			return false, err
+		}
+		if p.next() != "," {
+			return false, fmt.Errorf("expected , in begins_with")
+		}
+		prefix, err := p.operand()
+		if err != nil {
+			return false, err
+		}
+		if p.next() != ")" {
+			return false, fmt.Errorf("expected ) after begins_with")
+		}
+		v, ok := p.item[name].(*dynamodbtypes.AttributeValueMemberS)
+		pre, isString := prefix.(*dynamodbtypes.AttributeValueMemberS)
+		return ok && isString && strings.HasPrefix(v.Value, pre.Value), nil
+	}
+	left, err := p.operand()
+	if err != nil {
+		return false, err
+	}
+	op := p.next()
+	right, err := p.operand()
+	if err != nil {
+		return false, err
+	}
+	if left == nil || right == nil {
+		// Comparisons with a missing attribute are false, and so not
+		// equal is too
+		return false, nil
+	}
+	switch op {
+	case "=":
+		return equal(left, right), nil
+	case "<>":
+		return !equal(left, right), nil
+	}
+	c, ok := compare(left, right)
+	if !ok {
+		return false, nil
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("unsupported comparison %q", op)
+}
+
+// path reads an attribute name, resolving placeholders.
+func (p *exprParser) path() (string, error) {
+	t := p.next()
+	if t == "" || strings.HasPrefix(t, ":") || strings.ContainsAny(t, "(),") {
+		return "", fmt.Errorf("expected attribute name, got %q", t)
+	}
+	name := p.e.name(t)
+	if name == "" {
+		return "", fmt.Errorf("undefined attribute name placeholder %s", t)
+	}
+	return name, nil
+}
+
+// operand reads a value placeholder, an attribute or if_not_exists, returning
+// nil for a missing attribute.
+func (p *exprParser) operand() (dynamodbtypes.AttributeValue, error) {
+	t := p.peek()
+	switch {
+	case strings.HasPrefix(t, ":"):
+		p.next()
+		v, ok := p.e.values[t]
+		if !ok {
+			return nil, fmt.Errorf("undefined value placeholder %s", t)
+		}
+		return v, nil
+	case t == "if_not_exists":
+		p.next()
+		if p.next() != "(" {
+			return nil, fmt.Errorf("expected ( after if_not_exists")
+		}
+		name, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != "," {
+			return nil, fmt.Errorf("expected , in if_not_exists")
+		}
+		fallback, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("expected ) after if_not_exists")
+		}
+		if v, ok := p.item[name]; ok {
+			return v, nil
+		}
+		return fallback, nil
+	}
+	name, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	return p.item[name], nil
+}
+
+// value reads the right-hand side of a SET action.
+func (p *exprParser) value() (dynamodbtypes.AttributeValue, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); op == "+" || op == "-" {
+		p.next()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic(left, op, right)
+	}
+	if left == nil {
+		return nil, fmt.Errorf("SET refers to a missing attribute")
+	}
+	return left, nil
+}
+
+func arithmetic(left dynamodbtypes.AttributeValue, op string, right dynamodbtypes.AttributeValue) (dynamodbtypes.AttributeValue, error) {
+	l, lok := left.(*dynamodbtypes.AttributeValueMemberN)
+	r, rok := right.(*dynamodbtypes.AttributeValueMemberN)
+	if !lok || !rok {
+		return nil, fmt.Errorf("arithmetic on a non-number")
+	}
+	a, errA := strconv.ParseInt(l.Value, 10, 64)
+	b, errB := strconv.ParseInt(r.Value, 10, 64)
+	if errA == nil && errB == nil {
+		if op == "-" {
+			b = -b
+		}
+		return &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(a+b, 10)}, nil
+	}
+	x, errA := strconv.ParseFloat(l.Value, 64)
+	y, errB := strconv.ParseFloat(r.Value, 64)
+	if errA != nil || errB != nil {
+		return nil, fmt.Errorf("invalid number")
+	}
+	if op == "-" {
+		y = -y
+	}
+	return &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatFloat(x+y, 'f', -1, 64)}, nil
+}
+
+func equal(a, b dynamodbtypes.AttributeValue) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders two scalar values of the same type.
+func compare(a, b dynamodbtypes.AttributeValue) (int, bool) {
+	switch a := a.(type) {
+	case *dynamodbtypes.AttributeValueMemberN:
+		b, ok := b.(*dynamodbtypes.AttributeValueMemberN)
+		if !ok {
+			return 0, false
+		}
+		// Compare exactly when both fit in an int64, as millisecond
+		// timestamps do
+		i, errI := strconv.ParseInt(a.Value, 10, 64)
+		j, errJ := strconv.ParseInt(b.Value, 10, 64)
+		if errI == nil && errJ == nil {
+			switch {
+			case i < j:
+				return -1, true
+			case i > j:
+				return 1, true
+			}
+			return 0, true
+		}
+		x, errX := strconv.ParseFloat(a.Value, 64)
+		y, errY := strconv.ParseFloat(b.Value, 64)
+		if errX != nil || errY != nil {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case *dynamodbtypes.AttributeValueMemberS:
+		b, ok := b.(*dynamodbtypes.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a.Value, b.Value), true
+	case *dynamodbtypes.AttributeValueMemberB:
+		b, ok := b.(*dynamodbtypes.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(a.Value, b.Value), true
+	}
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package infra
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryClientLocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+
+	n := NewLocker(client, ctx, "locks")
+	b := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock("memory", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	ok, err = b.AcquireLock("memory", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "lock should not be acquired while held")
+
+	assert.NotNil(t, n.ReleaseMany(ctx, []string{"memory", "memory"}), "duplicate names should be rejected")
+	assert.True(t, n.holding("memory"), "a rejected release should leave the lock held")
+	assert.Nil(t, n.ReleaseMany(ctx, []string{"memory"}), "error should be nil")
+	ok, err = b.AcquireLock("memory", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired after release")
+}
+
+func TestMemoryClientExpiredLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	expired := time.Now().Add(-time.Second)
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":       &dynamodbtypes.AttributeValueMemberS{Value: "memory"},
+			"lockerId":   &dynamodbtypes.AttributeValueMemberS{Value: "dead"},
+			"ExpireAt":   &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.Unix(), 10)},
+			"ExpireAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.UnixMilli(), 10)},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock("memory", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "an expired lock should be taken over")
+	held, err := n.LocksHeldBy(ctx, n.ID())
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, held, 1, "the holder index should find the lock")
+}
+
+func TestMemoryClientUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := NewMemoryClient()
+	key := map[string]dynamodbtypes.AttributeValue{"name": &dynamodbtypes.AttributeValueMemberS{Value: "counter"}}
+	update := &dynamodb.UpdateItemInput{
+		TableName:                aws.String("locks"),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET #n = if_not_exists(#n, :zero) + :one REMOVE gone"),
+		ConditionExpression:      aws.String("attribute_not_exists(#n) or (#n < :max and not #n = :zero)"),
+		ExpressionAttributeNames: map[string]string{"#n": "n"},
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":zero": &dynamodbtypes.AttributeValueMemberN{Value: "0"},
+			":one":  &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+			":max":  &dynamodbtypes.AttributeValueMemberN{Value: "2"},
+		},
+		ReturnValues:                        dynamodbtypes.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: dynamodbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+	out, err := client.UpdateItem(ctx, update)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberN{Value: "1"}, out.Attributes["n"], "missing attribute should start from zero")
+	_, err = client.UpdateItem(ctx, update)
+	assert.Nil(t, err, "error should be nil")
+
+	_, err = client.UpdateItem(ctx, update)
+	assert.True(t, isConditionalCheckFailed(err), "condition should fail at the maximum")
+	var failed *dynamodbtypes.ConditionalCheckFailedException
+	assert.ErrorAs(t, err, &failed, "error should be a conditional check failure")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberN{Value: "2"}, failed.Item["n"], "failure should return the old item")
+}
+
+func TestOpenFallsBackToMemory(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n, err := Open(ctx, "dynamodb://fallback-locks?region=us-east-1&fallback=mem")
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, sharedMemory, n.client, "lockers without credentials should fall back to memory")
+	b, err := Open(ctx, "mem://fallback-locks")
+	assert.Nil(t, err, "error should be nil")
+
+	ok, err := n.AcquireLock("fallback", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	ok, err = b.AcquireLock("fallback", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "mem lockers in one process should share tables")
+
+	_, err = Open(ctx, "dynamodb://fallback-locks?fallback=file")
+	assert.NotNil(t, err, "unknown fallback should fail")
+}
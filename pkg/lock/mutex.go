@@ -0,0 +1,124 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Mutex adapts one lock of a Locker to sync.Locker, so code written against
+// sync.Locker can be handed a distributed lock unchanged.
+type Mutex struct {
+	locker *Locker
+	name   string
+	lease  time.Duration
+}
+
+var _ sync.Locker = (*Mutex)(nil)
+
+// Mutex returns a sync.Locker for the named lock, held with the given lease
+// while locked.
+func (l *Locker) Mutex(name string, lease time.Duration) *Mutex {
+	return &Mutex{locker: l, name: name, lease: lease}
+}
+
+// Lock blocks until the lock is acquired, like WaitForLock. Goroutines
+// locking the same name through one Locker exclude each other too, as the
+// table can't tell them apart. As sync.Locker can't return an error, Lock
+// panics if the lock can't be acquired for any reason other than contention,
+// such as the Locker having been closed; use WaitForLock where such errors
+// must be handled.
+func (m *Mutex) Lock() {
+	m.locker.lockName(context.Background(), m.name)
+	if err := m.locker.WaitForLock(context.Background(), m.name, m.lease); err != nil {
+		m.locker.unlockName(m.name)
+		panic(fmt.Errorf("locking %s : %w", m.name, err))
+	}
+}
+
+// Unlock releases the lock like ReleaseLock. As sync.Locker can't return an
+// error, a failed release is only logged; the lock then lapses with its lease.
+func (m *Mutex) Unlock() {
+	defer m.locker.unlockName(m.name)
+	err := m.locker.ReleaseLock(m.name)
+	if err != nil && !errors.Is(err, ErrNotHeld) && !errors.Is(err, ErrClosed) {
+		m.locker.adminLogger.Warn("Unlock failed", "lockname", m.name, "error", err)
+	}
+}
+
+// nameLock excludes the goroutines of one Locker using the same lock name.
+// refs counts the goroutines holding or waiting for it, so it is dropped once
+// the last of them is done.
+type nameLock struct {
+	held chan struct{}
+	refs int
+}
+
+// lockName blocks until no other goroutine of this Locker holds the name
+// locally, or ctx is done.
+func (l *Locker) lockName(ctx context.Context, name string) error {
+	l.mu.Lock()
+	if l.names == nil {
+		l.names = map[string]*nameLock{}
+	}
+	nl := l.names[name]
+	if nl == nil {
+		nl = &nameLock{held: make(chan struct{}, 1)}
+		l.names[name] = nl
+	}
+	nl.refs++
+	l.mu.Unlock()
+	select {
+	case nl.held <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.dropName(name, nl)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// tryLockName locks the name locally if no other goroutine of this Locker
+// holds it, reporting whether it did.
+func (l *Locker) tryLockName(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.names == nil {
+		l.names = map[string]*nameLock{}
+	}
+	nl := l.names[name]
+	if nl == nil {
+		nl = &nameLock{held: make(chan struct{}, 1)}
+		l.names[name] = nl
+	}
+	select {
+	case nl.held <- struct{}{}:
+		nl.refs++
+		return true
+	default:
+		return false
+	}
+}
+
+// unlockName lets the next goroutine waiting for the name have it. Unlocking
+// a name that isn't locked does nothing.
+func (l *Locker) unlockName(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	nl := l.names[name]
+	if nl == nil || len(nl.held) == 0 {
+		return
+	}
+	<-nl.held
+	l.dropName(name, nl)
+}
+
+// dropName drops a reference to a name's lock. It runs with mu held.
+func (l *Locker) dropName(name string, nl *nameLock) {
+	if nl.refs--; nl.refs == 0 {
+		delete(l.names, name)
+	}
+}
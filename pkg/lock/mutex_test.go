@@ -0,0 +1,73 @@
+package infra
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	backoff := WithWaitBackoff(time.Millisecond, time.Millisecond*10, 2)
+	lockers := []sync.Locker{
+		NewLocker(client, ctx, "locks", backoff).Mutex("counter", time.Second*10),
+		NewLocker(client, ctx, "locks", backoff).Mutex("counter", time.Second*10),
+	}
+
+	inside, count := 0, 0
+	var wg sync.WaitGroup
+	for _, m := range lockers {
+		wg.Add(1)
+		go func(m sync.Locker) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				m.Lock()
+				inside++
+				assert.Equal(t, 1, inside, "only one holder should be inside")
+				count++
+				inside--
+				m.Unlock()
+			}
+		}(m)
+	}
+	wg.Wait()
+	assert.Equal(t, 10, count, "every critical section should run")
+
+	closed := NewLocker(client, ctx, "locks")
+	closed.Close(ctx)
+	assert.Panics(t, closed.Mutex("counter", time.Second).Lock, "locking a closed Locker should panic")
+}
+
+func TestMutexSharedLocker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewLocker(NewMemoryClient(), ctx, "locks")
+
+	var inside atomic.Int32
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := l.Mutex("counter", time.Second*10)
+			for i := 0; i < 5; i++ {
+				m.Lock()
+				assert.Equal(t, int32(1), inside.Add(1), "only one goroutine should be inside")
+				time.Sleep(time.Millisecond)
+				inside.Add(-1)
+				m.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, l.heldNames(), "the lock should be released")
+	l.mu.Lock()
+	assert.Empty(t, l.names, "no goroutine should be left waiting")
+	l.mu.Unlock()
+}
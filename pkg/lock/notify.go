@@ -0,0 +1,159 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// WebhookNotifier POSTs Events to a webhook endpoint. Register its Handle
+// method with WithEventHandler. Events are queued and delivered from a
+// background goroutine so the Locker is never blocked on the network; events
+// are dropped, with a warning, if the queue is full.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+	types  map[EventType]bool
+	slack  bool
+	queue  chan Event
+	done   chan struct{}
+	logger *slog.Logger
+}
+
+// NotifierOption configures a WebhookNotifier.
+type NotifierOption func(*WebhookNotifier)
+
+// WithNotifyTypes restricts the notifier to the given event types. By default
+// it notifies about every event.
+func WithNotifyTypes(types ...EventType) NotifierOption {
+	return func(n *WebhookNotifier) {
+		n.types = map[EventType]bool{}
+		for _, t := range types {
+			n.types[t] = true
+		}
+	}
+}
+
+// WithSlackFormat sends Slack incoming-webhook payloads instead of the
+// structured JSON event.
+func WithSlackFormat() NotifierOption {
+	return func(n *WebhookNotifier) {
+		n.slack = true
+	}
+}
+
+// WithHTTPClient sets the client used to deliver notifications. The default
+// is a client with a 10 second timeout.
+func WithHTTPClient(client *http.Client) NotifierOption {
+	return func(n *WebhookNotifier) {
+		n.client = client
+	}
+}
+
+// NewWebhookNotifier starts a notifier delivering to url. Close it to stop
+// its delivery goroutine.
+func NewWebhookNotifier(url string, opts ...NotifierOption) *WebhookNotifier {
+	n := &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Event, 100),
+		done:   make(chan struct{}),
+		logger: slog.With("notifier", url),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	go n.deliver()
+	return n
+}
+
+// Handle queues an event for delivery.
+func (n *WebhookNotifier) Handle(e Event) {
+	if n.types != nil && !n.types[e.Type] {
+		return
+	}
+	select {
+	case n.queue <- e:
+	default:
+		n.logger.Warn("Notification queue full, dropping event", "type", e.Type, "lockname", e.Lock)
+	}
+}
+
+// Close stops the notifier after delivering queued events.
+func (n *WebhookNotifier) Close() {
+	close(n.queue)
+	<-n.done
+}
+
+func (n *WebhookNotifier) deliver() {
+	defer close(n.done)
+	for e := range n.queue {
+		if err := n.post(e); err != nil {
+			n.logger.Warn("Notification failed", "type", e.Type, "lockname", e.Lock, "error", err)
+		}
+	}
+}
+
+type webhookPayload struct {
+	Type        EventType `json:"type"`
+	LockerId    string    `json:"locker_id"`
+	Lock        string    `json:"lock,omitempty"`
+	Time        time.Time `json:"time"`
+	ElapsedMs   int64     `json:"elapsed_ms,omitempty"`
+	RemainingMs int64     `json:"remaining_ms,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Previous    string    `json:"previous_locker_id,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+func (n *WebhookNotifier) post(e Event) error {
+	var body any
+	if n.slack {
+		text := fmt.Sprintf("goTRC lock event *%s* from locker %s", e.Type, e.LockerId)
+		if e.Lock != "" {
+			text += fmt.Sprintf(" on lock `%s`", e.Lock)
+		}
+		if e.Reason != "" {
+			text += ": " + e.Reason
+		}
+		if e.Err != nil {
+			text += ": " + e.Err.Error()
+		}
+		body = slackPayload{text}
+	} else {
+		payload := webhookPayload{Type: e.Type, LockerId: e.LockerId, Lock: e.Lock, Time: e.Time, ElapsedMs: e.Elapsed.Milliseconds(),
+			RemainingMs: e.Remaining.Milliseconds(), Reason: e.Reason,
+			Previous: e.PreviousLockerId}
+		if e.Err != nil {
+			payload.Error = e.Err.Error()
+		}
+		body = payload
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, n.url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package infra
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookNotifierPostsEvents(t *testing.T) {
+	received := make(chan webhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&p), "payload should decode")
+		received <- p
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.URL, WithNotifyTypes(EventLost))
+	n.Handle(Event{Type: EventAcquired, Lock: "ignored"})
+	n.Handle(Event{Type: EventLost, LockerId: "locker-1", Lock: "orders", Err: errors.New("boom")})
+	n.Close()
+
+	assert.Len(t, received, 1, "only the selected event type should be sent")
+	p := <-received
+	assert.Equal(t, EventLost, p.Type, "type should be sent")
+	assert.Equal(t, "orders", p.Lock, "lock should be sent")
+	assert.Equal(t, "boom", p.Error, "error should be sent")
+}
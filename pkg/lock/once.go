@@ -0,0 +1,97 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// oncePrefix namespaces the locks and completion records of Once so they can
+// share a table with locks.
+const oncePrefix = "once:"
+
+// Once runs a function once across every process sharing a lock table, such
+// as a migration run from many replicas. The first caller to claim it runs
+// the function while holding a lock, and records its completion in the
+// table; later callers see the record and skip it. A caller that fails, or
+// dies and lets its lease lapse, leaves it to the next caller to try again.
+type Once struct {
+	locker *Locker
+	name   string
+	lease  time.Duration
+}
+
+// Once returns a Once for the given name, holding its lock with lease while
+// the function runs.
+func (l *Locker) Once(name string, lease time.Duration) *Once {
+	return &Once{locker: l, name: name, lease: lease}
+}
+
+// Do runs fn unless it has already completed, waiting while another caller
+// runs it. It reports whether this call ran fn to completion, and returns
+// the error from fn, which leaves fn to be run again by a later call. The
+// context passed to fn is cancelled if the lock is lost.
+func (o *Once) Do(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	if done, err := o.Done(ctx); done || err != nil {
+		return false, err
+	}
+	ran := false
+	err := o.locker.WithLock(ctx, oncePrefix+o.name, o.lease, func(ctx context.Context) error {
+		// The caller that held the lock before may have completed it
+		if done, err := o.Done(ctx); done || err != nil {
+			return err
+		}
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		ran = true
+		return o.complete(ctx)
+	})
+	return ran, err
+}
+
+// Done reports whether the function has completed.
+func (o *Once) Done(ctx context.Context) (bool, error) {
+	if err := o.locker.dynamoOnly("reading completion"); err != nil {
+		return false, err
+	}
+	l := o.locker
+	out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            o.key(),
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil {
+		return false, fmt.Errorf("reading completion of %s : %w", o.name, err)
+	}
+	return out.Item != nil, nil
+}
+
+// complete records that the function has completed.
+func (o *Once) complete(ctx context.Context) error {
+	l := o.locker
+	item := o.key()
+	item["completedBy"] = &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId}
+	item["completedAtMs"] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixMilli(), 10)}
+	_, err := l.client.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#key)"),
+		ExpressionAttributeNames: l.attrs.expressionNames(nil, "#key"),
+		TableName:                aws.String(l.lockTable),
+	}, l.requestOptions)
+	var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return fmt.Errorf("recording completion of %s : %w", o.name, err)
+	}
+	return nil
+}
+
+func (o *Once) key() map[string]dynamodbtypes.AttributeValue {
+	return o.locker.attrs.key(oncePrefix + o.name + ":done")
+}
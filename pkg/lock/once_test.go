@@ -0,0 +1,51 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	backoff := WithWaitBackoff(time.Millisecond, time.Millisecond*10, 2)
+
+	failed := errors.New("failed")
+	first := NewLocker(client, ctx, "locks", backoff).Once("migration", time.Second*10)
+	ran, err := first.Do(ctx, func(context.Context) error { return failed })
+	assert.ErrorIs(t, err, failed, "the error from fn should be returned")
+	assert.False(t, ran, "a failed run should not count")
+
+	var runs atomic.Int32
+	var ranCount atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			once := NewLocker(client, ctx, "locks", backoff).Once("migration", time.Second*10)
+			ran, err := once.Do(ctx, func(context.Context) error {
+				runs.Add(1)
+				time.Sleep(time.Millisecond * 20)
+				return nil
+			})
+			assert.Nil(t, err, "error should be nil")
+			if ran {
+				ranCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), runs.Load(), "fn should run once after the failure")
+	assert.Equal(t, int32(1), ranCount.Load(), "only the caller that ran fn should say so")
+	done, err := first.Done(ctx)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, done, "completion should be recorded")
+}
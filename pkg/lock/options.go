@@ -0,0 +1,68 @@
+package infra
+
+import (
+	"golang.org/x/exp/slog"
+)
+
+// Option configures a Locker at construction time.
+type Option func(*Locker)
+
+// WithLogger sets the logger the Locker derives its component loggers from.
+// The default is slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(l *Locker) {
+		l.logger = logger
+	}
+}
+
+// WithHeartbeatLogLevel sets the minimum level logged by the heartbeater,
+// independently of the level configured on the underlying handler.
+func WithHeartbeatLogLevel(level slog.Leveler) Option {
+	return func(l *Locker) {
+		l.heartbeatLevel = level
+	}
+}
+
+// WithAcquireLogLevel sets the minimum level logged on the lock acquisition path.
+func WithAcquireLogLevel(level slog.Leveler) Option {
+	return func(l *Locker) {
+		l.acquireLevel = level
+	}
+}
+
+// WithAdminLogLevel sets the minimum level logged by release and shutdown operations.
+func WithAdminLogLevel(level slog.Leveler) Option {
+	return func(l *Locker) {
+		l.adminLevel = level
+	}
+}
+
+// WithDebugLogSampling logs only the first and then every nth occurrence of each
+// debug message from the heartbeater and acquisition path, which otherwise log
+// on every tick and attempt. Records above debug level are never sampled.
+func WithDebugLogSampling(n int) Option {
+	return func(l *Locker) {
+		l.debugSample = n
+	}
+}
+
+type acquireOptions struct {
+	traceId string
+	data    []byte
+	// holder is filled in with the lock item when another Locker holds it
+	holder *LockInfo
+	// err fails the acquisition, for options that couldn't be applied
+	err error
+}
+
+// AcquireOption configures a single lock acquisition.
+type AcquireOption func(*acquireOptions)
+
+// WithTraceID records the acquiring request's trace or correlation ID on the
+// lock item as the traceId attribute, so a stuck lock can be traced back to
+// its owner. Heartbeat refreshes leave the attribute untouched.
+func WithTraceID(traceId string) AcquireOption {
+	return func(o *acquireOptions) {
+		o.traceId = traceId
+	}
+}
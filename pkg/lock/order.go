@@ -0,0 +1,161 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLockOrderCycle is returned when declaring an ordering would make the
+// lock order cyclic.
+var ErrLockOrderCycle = errors.New("lock order would contain a cycle")
+
+// ErrLockOrderViolation is returned when a lock is acquired while holding a
+// lock that the declared order says must be taken after it.
+var ErrLockOrderViolation = errors.New("lock acquired out of declared order")
+
+// LockOrder is a partial order over lock classes. Locks must be acquired in
+// that order; acquiring a lock while holding one that is ordered after it is
+// the pattern that lets two processes deadlock each other. By default a lock's
+// class is its name; NewLockOrder can derive classes from names instead, for
+// example with ByNamespace.
+type LockOrder struct {
+	class func(name string) string
+	mu    sync.RWMutex
+	after map[string]map[string]bool
+}
+
+// NewLockOrder creates an empty order. class maps a lock name to the class
+// the order is declared on; nil uses the lock name itself.
+func NewLockOrder(class func(name string) string) *LockOrder {
+	if class == nil {
+		class = func(name string) string { return name }
+	}
+	return &LockOrder{class: class, after: map[string]map[string]bool{}}
+}
+
+// ByNamespace classifies locks by the part of their name before the first sep,
+// so "accounts/42" belongs to class "accounts".
+func ByNamespace(sep string) func(name string) string {
+	return func(name string) string {
+		namespace, _, _ := strings.Cut(name, sep)
+		return namespace
+	}
+}
+
+// Declare records that each class must be acquired before the ones after it,
+// as in Declare("accounts", "orders", "payments").
+func (o *LockOrder) Declare(classes ...string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := 0; i+1 < len(classes); i++ {
+		before, after := classes[i], classes[i+1]
+		if before == after || o.reachable(after, before) {
+			return fmt.Errorf("declaring %s before %s : %w", before, after, ErrLockOrderCycle)
+		}
+		if o.after[before] == nil {
+			o.after[before] = map[string]bool{}
+		}
+		o.after[before][after] = true
+	}
+	return nil
+}
+
+// reachable reports whether to is ordered after from. Callers hold mu.
+func (o *LockOrder) reachable(from, to string) bool {
+	seen := map[string]bool{}
+	stack := []string{from}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if next == to {
+			return true
+		}
+		if seen[next] {
+			continue
+		}
+		seen[next] = true
+		for after := range o.after[next] {
+			stack = append(stack, after)
+		}
+	}
+	return false
+}
+
+// check returns ErrLockOrderViolation if name is ordered before any held lock.
+func (o *LockOrder) check(name string, held []string) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	class := o.class(name)
+	for _, heldName := range held {
+		heldClass := o.class(heldName)
+		if heldClass != class && o.reachable(class, heldClass) {
+			return fmt.Errorf("acquiring %s while holding %s : %w", name, heldName, ErrLockOrderViolation)
+		}
+	}
+	return nil
+}
+
+// WithLockOrder makes the Locker reject acquisitions that violate order.
+func WithLockOrder(order *LockOrder) Option {
+	return func(l *Locker) {
+		l.lockOrder = order
+	}
+}
+
+// AcquireOrdered acquires the named locks one at a time in sorted order,
+// waiting at most wait for each like WaitForLock; zero waits until ctx is
+// done. If a lock can't be acquired, the locks it acquired are released again
+// and the error is returned, so no partial set is left held.
+//
+// The ordering discipline is what keeps two callers taking overlapping sets
+// from deadlocking: neither can hold a lock the other needs while waiting for
+// one the other holds. To keep it, AcquireOrdered refuses with
+// ErrLockOrderViolation to take locks that sort before a lock already held
+// that isn't part of the set.
+func (l *Locker) AcquireOrdered(ctx context.Context, names []string, lease, wait time.Duration, opts ...AcquireOption) error {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	held := map[string]bool{}
+	for _, name := range l.heldNames() {
+		held[name] = true
+	}
+	wanted := map[string]bool{}
+	for _, name := range sorted {
+		wanted[name] = true
+	}
+	for name := range held {
+		if !wanted[name] && len(sorted) > 0 && sorted[0] < name {
+			return fmt.Errorf("acquiring %s while holding %s : %w", sorted[0], name, ErrLockOrderViolation)
+		}
+	}
+
+	var acquired []string
+	for i, name := range sorted {
+		if held[name] || (i > 0 && sorted[i-1] == name) {
+			continue
+		}
+		waitCtx, cancel := ctx, context.CancelFunc(func() {})
+		if wait > 0 {
+			waitCtx, cancel = context.WithTimeout(ctx, wait)
+		}
+		err := l.WaitForLock(waitCtx, name, lease, opts...)
+		cancel()
+		if err != nil {
+			// One at a time, as ReleaseMany is limited in size and
+			// unsupported on a Backend
+			for _, acquiredName := range acquired {
+				if releaseErr := l.ReleaseLock(acquiredName); releaseErr != nil {
+					l.acquireLogger.Warn("Partially acquired lock could not be released", "lockname", acquiredName, "error", releaseErr)
+				}
+			}
+			return fmt.Errorf("acquiring %s of %v : %w", name, sorted, err)
+		}
+		acquired = append(acquired, name)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockOrderRejectsCycles(t *testing.T) {
+	o := NewLockOrder(nil)
+	assert.Nil(t, o.Declare("a", "b", "c"), "error should be nil")
+	assert.ErrorIs(t, o.Declare("c", "a"), ErrLockOrderCycle, "transitive cycle should be rejected")
+	assert.ErrorIs(t, o.Declare("b", "b"), ErrLockOrderCycle, "self edge should be rejected")
+	assert.Nil(t, o.Declare("a", "d"), "branching order should be allowed")
+}
+
+func TestLockOrderCheck(t *testing.T) {
+	o := NewLockOrder(ByNamespace("/"))
+	assert.Nil(t, o.Declare("accounts", "orders", "payments"), "error should be nil")
+
+	assert.Nil(t, o.check("payments/1", []string{"accounts/7", "orders/3"}), "in-order acquisition should pass")
+	assert.Nil(t, o.check("orders/4", []string{"orders/3"}), "same class should pass")
+	assert.Nil(t, o.check("unrelated", []string{"payments/1"}), "undeclared classes should pass")
+	assert.ErrorIs(t, o.check("accounts/7", []string{"payments/1"}), ErrLockOrderViolation, "out-of-order acquisition should fail")
+}
+
+func TestAcquireOrdered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	backoff := WithWaitBackoff(time.Millisecond, time.Millisecond*10, 2)
+	n := NewLocker(client, ctx, "locks", backoff)
+	b := NewLocker(client, ctx, "locks", backoff)
+
+	ok, err := b.AcquireLock("c", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	err = n.AcquireOrdered(ctx, []string{"c", "b", "a"}, time.Second*10, time.Millisecond*50)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "a lock not acquired in time should fail the set")
+	assert.Empty(t, n.heldNames(), "a failed set should be released")
+
+	assert.Nil(t, b.ReleaseLock("c"), "error should be nil")
+	assert.Nil(t, n.AcquireOrdered(ctx, []string{"c", "b", "a", "b"}, time.Second*10, 0), "error should be nil")
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, n.heldNames(), "every lock of the set should be held")
+
+	ok, err = b.AcquireLock("z", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	assert.ErrorIs(t, b.AcquireOrdered(ctx, []string{"y"}, time.Second*10, 0), ErrLockOrderViolation,
+		"locks sorting before a held lock should be refused")
+}
+
+func TestAcquireOrderedRollbackOnBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := NewMemoryBackend()
+	backoff := WithWaitBackoff(time.Millisecond, time.Millisecond*10, 2)
+	n := NewBackendLocker(backend, ctx, backoff)
+	b := NewBackendLocker(backend, ctx, backoff)
+
+	ok, err := b.AcquireLock("c", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	err = n.AcquireOrdered(ctx, []string{"a", "b", "c"}, time.Second*10, time.Millisecond*50)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "a lock not acquired in time should fail the set")
+	assert.Empty(t, n.heldNames(), "a failed set should be released without ReleaseMany")
+	ok, err = b.AcquireLock("a", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "released locks should be free to acquire")
+}
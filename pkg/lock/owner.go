@@ -0,0 +1,71 @@
+package infra
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attributes describing the process holding a lock, written when it is
+// acquired.
+const (
+	hostAttribute        = "host"
+	pidAttribute         = "pid"
+	heldSinceAttribute   = "heldSinceMs"
+	descriptionAttribute = "ownerDescription"
+)
+
+// OwnerInfo describes the process holding a lock, so that an operator can
+// tell which instance to look at without mapping locker IDs to hosts.
+type OwnerInfo struct {
+	Host string
+	PID  int
+	// Since is when the holder acquired the lock.
+	Since       time.Time
+	Description string
+}
+
+// WithOwnerDescription records description, such as a service and the job
+// it is running, on every lock the Locker acquires, next to the host name,
+// process ID and acquisition time recorded on every lock. GetLockInfo,
+// ListLocks and LocksHeldBy report them as LockInfo.Owner.
+func WithOwnerDescription(description string) Option {
+	return func(l *Locker) {
+		l.owner.Description = description
+	}
+}
+
+// processOwner describes this process.
+func processOwner() OwnerInfo {
+	host, _ := os.Hostname()
+	return OwnerInfo{Host: host, PID: os.Getpid()}
+}
+
+// ownerUpdate records the holder's metadata on a lock being acquired.
+func (l *Locker) ownerUpdate(update string, values map[string]dynamodbtypes.AttributeValue, now time.Time) string {
+	values[":host"] = &dynamodbtypes.AttributeValueMemberS{Value: l.owner.Host}
+	values[":pid"] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.Itoa(l.owner.PID)}
+	values[":heldSince"] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)}
+	update += ", " + hostAttribute + " = :host, " + pidAttribute + " = :pid, " + heldSinceAttribute + " = :heldSince"
+	if l.owner.Description != "" {
+		values[":description"] = &dynamodbtypes.AttributeValueMemberS{Value: l.owner.Description}
+		update += ", " + descriptionAttribute + " = :description"
+	}
+	return update
+}
+
+// ownerInfo reads the holder's metadata from a lock item.
+func ownerInfo(item map[string]dynamodbtypes.AttributeValue) OwnerInfo {
+	var owner OwnerInfo
+	owner.Host, _ = stringAttr(item, hostAttribute)
+	owner.Description, _ = stringAttr(item, descriptionAttribute)
+	if pid, ok := numberAttr(item, pidAttribute); ok {
+		owner.PID = int(pid)
+	}
+	if ms, ok := numberAttr(item, heldSinceAttribute); ok {
+		owner.Since = time.UnixMilli(ms)
+	}
+	return owner
+}
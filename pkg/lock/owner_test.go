@@ -0,0 +1,43 @@
+package infra
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnerInfo(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks", WithOwnerDescription("orders-worker nightly export"))
+	before := time.Now()
+	ok, err := n.AcquireLock("export", time.Millisecond*100)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	host, _ := os.Hostname()
+	info, _, err := n.GetLockInfo(ctx, "export")
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, host, info.Owner.Host, "the host should be recorded")
+	assert.Equal(t, os.Getpid(), info.Owner.PID, "the process ID should be recorded")
+	assert.Equal(t, "orders-worker nightly export", info.Owner.Description, "the description should be recorded")
+	assert.WithinDuration(t, before, info.Owner.Since, time.Second, "the acquisition time should be recorded")
+
+	b := NewLocker(client, ctx, "locks")
+	err = b.TryAcquire(ctx, "export", time.Minute)
+	assert.ErrorContains(t, err, "on "+host, "contention should name the holder's host")
+
+	// The holder dies without releasing the lock
+	n.cancel()
+	time.Sleep(time.Millisecond * 150)
+	ok, err = b.AcquireLock("export", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a lapsed lock should be taken over")
+	info, _, _ = b.GetLockInfo(ctx, "export")
+	assert.Empty(t, info.Owner.Description, "the previous holder's description should be removed")
+	assert.True(t, info.Owner.Since.After(before.Add(100*time.Millisecond)), "the new holder's acquisition time should be recorded")
+}
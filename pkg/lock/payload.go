@@ -0,0 +1,72 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MaxDataSize is the largest payload a lock can carry, leaving room in the
+// DynamoDB item for the lock itself.
+const MaxDataSize = 64 << 10
+
+// ErrDataTooLarge is returned when a payload exceeds MaxDataSize.
+var ErrDataTooLarge = errors.New("lock data is too large")
+
+// checkDataSize rejects payloads larger than MaxDataSize.
+func checkDataSize(data []byte) error {
+	if len(data) > MaxDataSize {
+		return fmt.Errorf("%d bytes : %w", len(data), ErrDataTooLarge)
+	}
+	return nil
+}
+
+// WithJSONData stores v, encoded as JSON, with the lock when it is acquired,
+// like WithData. If v can't be encoded, the acquisition fails with the
+// encoding error.
+func WithJSONData(v interface{}) AcquireOption {
+	data, err := json.Marshal(v)
+	return func(o *acquireOptions) {
+		o.data = data
+		if err != nil {
+			o.err = fmt.Errorf("encoding lock data : %w", err)
+		}
+	}
+}
+
+// SetJSONData replaces the payload of a held lock with v encoded as JSON,
+// like SetData.
+func (l *Locker) SetJSONData(ctx context.Context, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding data of lock %s : %w", name, err)
+	}
+	return l.SetData(ctx, name, data)
+}
+
+// JSONData decodes the JSON payload of a held lock into v, as returned by
+// Data. It leaves v alone if the lock carries no payload.
+func (l *Locker) JSONData(name string, v interface{}) error {
+	data, err := l.Data(name)
+	if err != nil || data == nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding data of lock %s : %w", name, err)
+	}
+	return nil
+}
+
+// JSONData decodes the JSON payload of a lock item into v, so that observers
+// reading a lock with GetLockInfo or ListLocks can see what its holder is
+// doing. It leaves v alone if the lock carries no payload.
+func (i LockInfo) JSONData(v interface{}) error {
+	if i.Data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(i.Data, v); err != nil {
+		return fmt.Errorf("decoding data of lock %s : %w", i.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type migration struct {
+	Step  string `json:"step"`
+	Shard int    `json:"shard"`
+}
+
+func TestJSONData(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock("migrate", time.Minute, WithJSONData(migration{Step: "backfill", Shard: 3}))
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	var held migration
+	assert.Nil(t, n.JSONData("migrate", &held), "the holder should decode its payload")
+	assert.Equal(t, migration{Step: "backfill", Shard: 3}, held, "the payload should round-trip")
+
+	assert.Nil(t, n.SetJSONData(ctx, "migrate", migration{Step: "verify", Shard: 4}), "error should be nil")
+	b := NewLocker(client, ctx, "locks")
+	info, _, err := b.GetLockInfo(ctx, "migrate")
+	assert.Nil(t, err, "error should be nil")
+	var observed migration
+	assert.Nil(t, info.JSONData(&observed), "observers should decode the payload")
+	assert.Equal(t, migration{Step: "verify", Shard: 4}, observed, "observers should see the latest payload")
+
+	ok, err = n.AcquireLock("bad", time.Minute, WithJSONData(func() {}))
+	assert.False(t, ok, "lock should not be acquired")
+	assert.ErrorContains(t, err, "encoding lock data", "a payload that can't be encoded should fail the acquisition")
+
+	big := make([]byte, MaxDataSize+1)
+	ok, err = n.AcquireLock("big", time.Minute, WithData(big))
+	assert.False(t, ok, "lock should not be acquired")
+	assert.ErrorIs(t, err, ErrDataTooLarge, "an oversized payload should fail the acquisition")
+	assert.ErrorIs(t, n.SetData(ctx, "migrate", big), ErrDataTooLarge, "an oversized payload should not be written")
+}
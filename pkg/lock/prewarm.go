@@ -0,0 +1,106 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// prewarmRetryInterval is how often Prewarm retries locks it doesn't hold yet.
+const prewarmRetryInterval = time.Second
+
+// PrewarmSet is a set of locks acquired at startup and held for the Locker's
+// lifetime. Gate readiness on Ready or Wait instead of ordering init code
+// around AcquireLock.
+type PrewarmSet struct {
+	ready chan struct{}
+	done  chan struct{}
+	err   error
+}
+
+// Prewarm starts acquiring every named lock in the background, retrying the
+// contended ones until all are held, ctx is done or the Locker is closed. The
+// locks are then kept by the heartbeater like any other held lock, and
+// WithLock, Mutex and LeaderElector calls on this Locker wait for them as
+// though they were held elsewhere.
+func (l *Locker) Prewarm(ctx context.Context, lease time.Duration, names ...string) *PrewarmSet {
+	p := &PrewarmSet{ready: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		pending := append([]string(nil), names...)
+		for {
+			var still []string
+			for _, name := range pending {
+				// A name in use by WithLock or a Mutex of this Locker is
+				// contended like any other
+				if !l.tryLockName(name) {
+					still = append(still, name)
+					continue
+				}
+				ok, err := l.AcquireLockContext(ctx, name, lease)
+				if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+					l.unlockName(name)
+					p.err = l.prewarmStopped(ctx, pending)
+					return
+				}
+				if err != nil {
+					l.acquireLogger.Warn("Prewarm acquisition failed", "lockname", name, "error", err)
+				}
+				if !ok {
+					l.unlockName(name)
+					still = append(still, name)
+				}
+			}
+			pending = still
+			if len(pending) == 0 {
+				l.acquireLogger.Info("Prewarmed locks held", "count", len(names))
+				close(p.ready)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				p.err = l.prewarmStopped(ctx, pending)
+				return
+			case <-l.ctx.Done():
+				p.err = l.prewarmStopped(ctx, pending)
+				return
+			case <-time.After(prewarmRetryInterval):
+			}
+		}
+	}()
+	return p
+}
+
+// prewarmStopped is the error of a Prewarm given up on before pending were
+// held, because ctx is done or the Locker closed.
+func (l *Locker) prewarmStopped(ctx context.Context, pending []string) error {
+	err := ctx.Err()
+	if err == nil {
+		err = ErrClosed
+	}
+	return fmt.Errorf("prewarming locks, still waiting for %v : %w", pending, err)
+}
+
+// Ready is closed once every lock in the set is held.
+func (p *PrewarmSet) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// Wait blocks until every lock in the set is held, returning an error if the
+// context passed to Prewarm or ctx ends first.
+func (p *PrewarmSet) Wait(ctx context.Context) error {
+	select {
+	case <-p.ready:
+		return nil
+	case <-p.done:
+		select {
+		case <-p.ready:
+			return nil
+		default:
+			return p.err
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
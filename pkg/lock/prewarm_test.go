@@ -0,0 +1,56 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrewarmWaitsForContendedLock(t *testing.T) {
+	names := []string{uuid.New().String(), uuid.New().String()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	other := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err := other.AcquireLock(names[1], time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	set := n.Prewarm(ctx, time.Second*10, names...)
+	select {
+	case <-set.Ready():
+		t.Fatal("set should not be ready while a lock is contended")
+	case <-time.After(2 * time.Second):
+	}
+
+	assert.Nil(t, other.ReleaseLock(names[1]), "error should be nil")
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	assert.Nil(t, set.Wait(waitCtx), "set should become ready once the lock is released")
+}
+
+func TestPrewarmStopsWhenClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	other := NewLocker(client, ctx, "locks")
+	ok, err := other.AcquireLock("contended", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	n := NewLocker(client, ctx, "locks")
+	set := n.Prewarm(ctx, time.Second*10, "contended")
+	n.Close(ctx)
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	assert.ErrorIs(t, set.Wait(waitCtx), ErrClosed, "prewarming should stop once the Locker is closed")
+}
@@ -0,0 +1,128 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// QuorumLocker acquires each lock on several independent Lockers, typically
+// backed by tables in different regions, and considers it held only while a
+// majority of them hold it, in the manner of Redlock. Losing any minority of
+// the tables, such as to a regional outage, neither blocks acquisitions nor
+// breaks mutual exclusion, since two holders can't both have a majority. Each
+// Locker's heartbeater renews its copy of the lock as usual.
+type QuorumLocker struct {
+	lockers []*Locker
+}
+
+// NewQuorumLocker returns a QuorumLocker over the given Lockers, of which an
+// odd number, such as three, makes best use of the majority.
+func NewQuorumLocker(lockers ...*Locker) *QuorumLocker {
+	return &QuorumLocker{lockers: lockers}
+}
+
+// quorum is the number of Lockers that make a majority.
+func (q *QuorumLocker) quorum() int {
+	return len(q.lockers)/2 + 1
+}
+
+// AcquireLock acquires the lock on every Locker at once, succeeding if a
+// majority acquired it within timeout. Otherwise the copies this call took
+// are released again, leaving any a Locker already held, and AcquireLock
+// reports false if the lock is held
+// elsewhere, or returns the errors that kept a majority out of reach.
+func (q *QuorumLocker) AcquireLock(name string, timeout time.Duration, opts ...AcquireOption) (bool, error) {
+	start := time.Now()
+	acquired := make([]bool, len(q.lockers))
+	errs := make([]error, len(q.lockers))
+	// Copies already held are only renewed, so failing must not release them
+	taken := make([]bool, len(q.lockers))
+	var wg sync.WaitGroup
+	for i, l := range q.lockers {
+		wg.Add(1)
+		go func(i int, l *Locker) {
+			defer wg.Done()
+			had := l.holding(name) && !l.reentrant
+			acquired[i], errs[i] = l.AcquireLock(name, timeout, opts...)
+			taken[i] = acquired[i] && !had
+		}(i, l)
+	}
+	wg.Wait()
+	held, failed := 0, 0
+	for i := range q.lockers {
+		if acquired[i] {
+			held++
+		}
+		if errs[i] != nil {
+			failed++
+		}
+	}
+	// A majority acquired more slowly than the lease may already have lapsed
+	// on the first of them
+	if held >= q.quorum() && time.Since(start) < timeout {
+		for i, err := range errs {
+			if err != nil {
+				q.lockers[i].acquireLogger.Warn("Lock acquired without one of its quorum", "lockname", name, "error", err)
+			}
+		}
+		return true, nil
+	}
+	for i, l := range q.lockers {
+		if taken[i] {
+			if err := l.ReleaseLock(name); err != nil {
+				l.acquireLogger.Warn("Releasing minority of quorum lock failed", "lockname", name, "error", err)
+			}
+		}
+	}
+	if failed > len(q.lockers)-q.quorum() {
+		return false, fmt.Errorf("acquiring quorum for lock %s : %w", name, errors.Join(errs...))
+	}
+	return false, nil
+}
+
+// Held reports whether a majority of the Lockers still hold the lock.
+func (q *QuorumLocker) Held(name string) bool {
+	held := 0
+	for _, l := range q.lockers {
+		if l.Handle(name) != nil {
+			held++
+		}
+	}
+	return held >= q.quorum()
+}
+
+// ReleaseLock releases the lock on every Locker holding it, returning an
+// error wrapping ErrNotHeld if none did.
+func (q *QuorumLocker) ReleaseLock(name string) error {
+	var errs []error
+	released := false
+	for _, l := range q.lockers {
+		err := l.ReleaseLock(name)
+		switch {
+		case err == nil:
+			released = true
+		case !errors.Is(err, ErrNotHeld):
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("releasing quorum lock %s : %w", name, errors.Join(errs...))
+	}
+	if !released {
+		return fmt.Errorf("releasing quorum lock %s : %w", name, ErrNotHeld)
+	}
+	return nil
+}
+
+// Close closes every Locker, releasing the locks each holds, and returns
+// their errors joined.
+func (q *QuorumLocker) Close(ctx context.Context) error {
+	errs := make([]error, len(q.lockers))
+	for i, l := range q.lockers {
+		errs[i] = l.Close(ctx)
+	}
+	return errors.Join(errs...)
+}
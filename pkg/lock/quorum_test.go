@@ -0,0 +1,69 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unavailableClient is a MemoryClient standing in for a region that can't be
+// reached.
+type unavailableClient struct {
+	*MemoryClient
+}
+
+func (c unavailableClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return nil, errors.New("region unavailable")
+}
+
+func TestQuorumLocker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	regions := []Client{NewMemoryClient(), NewMemoryClient(), unavailableClient{NewMemoryClient()}}
+	process := func(clients ...Client) *QuorumLocker {
+		var lockers []*Locker
+		for _, client := range clients {
+			lockers = append(lockers, NewLocker(client, ctx, "locks"))
+		}
+		return NewQuorumLocker(lockers...)
+	}
+	n := process(regions...)
+	b := process(regions...)
+
+	ok, err := n.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a majority should be enough despite one region being down")
+	assert.True(t, n.Held("x"), "lock should be held with a majority")
+	ok, err = b.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "held lock should not be acquired")
+	assert.False(t, b.Held("x"), "the loser should release the copies it acquired")
+
+	minority := process(unavailableClient{NewMemoryClient()}, unavailableClient{NewMemoryClient()}, NewMemoryClient())
+	ok, err = minority.AcquireLock("y", time.Second*10)
+	assert.NotNil(t, err, "a majority out of reach should be an error")
+	assert.False(t, ok, "lock should not be acquired without a majority")
+	assert.Nil(t, minority.lockers[2].Handle("y"), "the minority copy should be released")
+
+	// A failed re-acquisition leaves the copies that were already held
+	single, err := b.lockers[0].AcquireLock("z", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, single, "lock should be acquired")
+	_, err = process(regions[1]).lockers[0].AcquireLock("z", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	ok, err = b.AcquireLock("z", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "lock should not be acquired without a majority")
+	assert.NotNil(t, b.lockers[0].Handle("z"), "a copy held before the call should still be held")
+
+	assert.Nil(t, n.ReleaseLock("x"), "error should be nil")
+	assert.ErrorIs(t, n.ReleaseLock("x"), ErrNotHeld, "lock should not be released twice")
+	ok, err = b.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "released lock should be acquired")
+}
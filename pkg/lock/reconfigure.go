@@ -0,0 +1,105 @@
+package infra
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// WithHeartbeatInterval sets how often the heartbeater refreshes held locks.
+// The default is a minute. Each lock is renewed at least that often, and every
+// half lease if its lease is shorter, without affecting other locks. Under
+// WithScheduler the heartbeater instead shortens the interval of every lock
+// to half the lease of any lock whose timeout is shorter.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(l *Locker) {
+		l.HeartbeatInterval = d
+	}
+}
+
+// WithRetryer sets the retry policy of every DynamoDB call the Locker makes,
+// overriding the one the client was built with.
+func WithRetryer(retryer aws.Retryer) Option {
+	return func(l *Locker) {
+		l.retryer.Store(&retryer)
+	}
+}
+
+// Reconfigure changes the heartbeat interval, retry policy and log levels of
+// a live Locker, without dropping the locks it holds. It accepts
+// WithHeartbeatInterval, WithRetryer and the log level options; other options
+// only take effect when passed to NewLocker and are ignored here.
+//
+// A new heartbeat interval is applied by the heartbeater between refreshes. If
+// it is longer than half the lease of a held lock, it is shortened as it would
+// be on acquisition, and locks due for a refresh under the new interval are
+// refreshed straight away, so no lease lapses while waiting for the first
+// tick. Reconfigure returns once the new interval is in effect.
+func (l *Locker) Reconfigure(opts ...Option) error {
+	if l.closed() {
+		return ErrClosed
+	}
+	next := Locker{
+		heartbeatLevel: l.heartbeatSwitch.get(),
+		acquireLevel:   l.acquireSwitch.get(),
+		adminLevel:     l.adminSwitch.get(),
+	}
+	for _, opt := range opts {
+		opt(&next)
+	}
+	l.heartbeatSwitch.set(next.heartbeatLevel)
+	l.acquireSwitch.set(next.acquireLevel)
+	l.adminSwitch.set(next.adminLevel)
+	if retryer := next.retryer.Load(); retryer != nil {
+		l.retryer.Store(retryer)
+	}
+	if next.HeartbeatInterval <= 0 {
+		return nil
+	}
+	if err := l.enter(); err != nil {
+		return err
+	}
+	req := rescheduleRequest{next.HeartbeatInterval, make(chan struct{})}
+	if err := send(l, l.rescheduler, req); err != nil {
+		return err
+	}
+	<-req.done
+	return nil
+}
+
+type rescheduleRequest struct {
+	interval time.Duration
+	done     chan struct{}
+}
+
+// reschedule runs on the heartbeater.
+func (l *Locker) reschedule(interval time.Duration) {
+	if l.perLockRenewal() {
+		l.adminLogger.Info("Heartbeat interval changed", "from", l.HeartbeatInterval, "to", interval)
+		l.mu.Lock()
+		l.HeartbeatInterval = interval
+		for _, lk := range l.locksHeld {
+			// Bring forward renewals that are further off than the new interval allows
+			if due := lk.expiresAt.Add(-lk.timeout).Add(l.renewalInterval(lk)); due.Before(lk.renewAt) {
+				lk.renewAt = due
+			}
+		}
+		heap.Init(&l.renewals)
+		l.mu.Unlock()
+		l.refresh()
+		l.beat()
+		return
+	}
+	if lease := l.shortestLease(); lease > 0 && lease/2 < interval {
+		interval = lease / 2
+	}
+	l.adminLogger.Info("Heartbeat interval changed", "from", l.HeartbeatInterval, "to", interval)
+	l.mu.Lock()
+	l.HeartbeatInterval = interval
+	l.mu.Unlock()
+	l.interval.Store(int64(interval))
+	l.ticker.Reset(interval)
+	l.refresh()
+	l.beat()
+}
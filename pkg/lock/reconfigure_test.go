@@ -0,0 +1,40 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"golang.org/x/exp/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconfigure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	n := NewLocker(NewMemoryClient(), ctx, "locks", WithLogger(logger), WithAdminLogLevel(slog.LevelError), WithHeartbeatLogLevel(slog.LevelError))
+	ok, err := n.AcquireLock("reconfigure", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	assert.Nil(t, n.Reconfigure(WithHeartbeatInterval(time.Second*2)), "error should be nil")
+	assert.Equal(t, int64(time.Second*2), n.interval.Load(), "heartbeat interval should change")
+	assert.NotContains(t, buf.String(), "Heartbeat interval changed", "admin info should still be filtered")
+
+	retryer := retry.NewStandard()
+	assert.Nil(t, n.Reconfigure(WithHeartbeatInterval(time.Hour), WithAdminLogLevel(slog.LevelInfo), WithRetryer(retryer)), "error should be nil")
+	assert.Equal(t, int64(time.Second*5), n.interval.Load(), "interval should stay within half the lease")
+	assert.Contains(t, buf.String(), "Heartbeat interval changed", "admin level should change")
+	var o dynamodb.Options
+	n.requestOptions(&o)
+	assert.Equal(t, retryer, o.Retryer, "retry policy should change")
+
+	assert.Nil(t, n.Close(ctx), "error should be nil")
+	assert.ErrorIs(t, n.Reconfigure(WithHeartbeatInterval(time.Second)), ErrClosed, "closed locker should not reconfigure")
+}
@@ -0,0 +1,266 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisClient runs Lua scripts on a Redis server, which is all RedisBackend
+// needs apart from listing locks, so it works with any Redis client library.
+// With go-redis, wrap the client in a RedisEvalFunc:
+//
+//	infra.RedisEvalFunc(func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return rdb.Eval(ctx, script, keys, args...).Result()
+//	})
+type RedisClient interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisEvalFunc adapts a function to RedisClient.
+type RedisEvalFunc func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+
+func (f RedisEvalFunc) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return f(ctx, script, keys, args...)
+}
+
+// RedisScanner is implemented by a RedisClient that can also run SCAN, which
+// RedisBackend's ListItems needs. go-redis clients have a matching Scan method
+// once its result is unwrapped; on Redis Cluster, Scan must visit every
+// master node, as ClusterClient.ForEachMaster does.
+type RedisScanner interface {
+	Scan(ctx context.Context, cursor uint64, match string, count int64) ([]string, uint64, error)
+}
+
+// redisRetention is how long a lock's fencing token counter and its trace and
+// data outlive the lock's last use. A lock unused for longer starts over from
+// the first fencing token.
+const redisRetention = 7 * 24 * time.Hour
+
+// Each lock uses three keys sharing a hash tag, so they live in the same
+// cluster slot: the lock itself, holding the owner and expiring with the
+// lease, a fencing token counter and a hash of the trace and data, both
+// expiring redisRetention after the lock was last used.
+const (
+	redisAcquireScript = `
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return {0, 0, 0, ''}
+end
+if owner then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+elseif not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return {0, 0, 0, ''}
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('HSET', KEYS[3], 'trace', ARGV[3])
+if ARGV[5] == '1' then
+	redis.call('HSET', KEYS[3], 'data', ARGV[4])
+end
+redis.call('PEXPIRE', KEYS[2], ARGV[6])
+redis.call('PEXPIRE', KEYS[3], ARGV[6])
+local data = redis.call('HGET', KEYS[3], 'data')
+if data then
+	return {1, token, 1, data}
+end
+return {1, token, 0, ''}
+`
+	redisRenewScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+redis.call('PEXPIRE', KEYS[3], ARGV[3])
+return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+`
+	redisReleaseScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('HDEL', KEYS[3], 'trace')
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+redis.call('PEXPIRE', KEYS[3], ARGV[2])
+return redis.call('DEL', KEYS[1])
+`
+	redisGetScript = `
+local owner = redis.call('GET', KEYS[1])
+if not owner then
+	return {0, '', 0, 0, '', 0, ''}
+end
+local data = redis.call('HGET', KEYS[3], 'data')
+return {1, owner, redis.call('PTTL', KEYS[1]), tonumber(redis.call('GET', KEYS[2]) or '0'),
+	redis.call('HGET', KEYS[3], 'trace') or '', data and 1 or 0, data or ''}
+`
+)
+
+// RedisBackend is a Backend storing locks in Redis. A lock is a key set with
+// SET NX PX to its owner, so it expires with its lease, and Lua scripts make
+// renewals and releases conditional on the owner still holding it. Fencing
+// tokens come from a counter per lock that outlives it.
+type RedisBackend struct {
+	client RedisClient
+	prefix string
+}
+
+var _ Backend = (*RedisBackend)(nil)
+
+// NewRedisBackend returns a backend storing locks under keys starting with
+// prefix, "gotrc:" if empty.
+func NewRedisBackend(client RedisClient, prefix string) *RedisBackend {
+	if prefix == "" {
+		prefix = "gotrc:"
+	}
+	return &RedisBackend{client: client, prefix: prefix}
+}
+
+func (b *RedisBackend) keys(name string) []string {
+	tag := b.prefix + "{" + name + "}"
+	return []string{tag + ":lock", tag + ":token", tag + ":meta"}
+}
+
+func (b *RedisBackend) AcquireItem(ctx context.Context, req LockInfo, lease time.Duration) (LockInfo, bool, error) {
+	hasData := "0"
+	if req.Data != nil {
+		hasData = "1"
+	}
+	now := time.Now()
+	reply, err := b.client.Eval(ctx, redisAcquireScript, b.keys(req.Name),
+		req.LockerId, lease.Milliseconds(), req.TraceId, string(req.Data), hasData, (lease + redisRetention).Milliseconds())
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("acquiring lock %s : %w", req.Name, err)
+	}
+	values, err := redisValues(reply, 4)
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("acquiring lock %s : %w", req.Name, err)
+	}
+	if redisInt(values[0]) == 0 {
+		return LockInfo{}, false, nil
+	}
+	item := req
+	item.ExpiresAt = now.Add(lease)
+	item.FencingToken = redisInt(values[1])
+	item.Data = nil
+	if redisInt(values[2]) == 1 {
+		item.Data = []byte(redisString(values[3]))
+	}
+	return item, true, nil
+}
+
+func (b *RedisBackend) RenewItem(ctx context.Context, name, owner string, lease time.Duration) (bool, error) {
+	reply, err := b.client.Eval(ctx, redisRenewScript, b.keys(name), owner, lease.Milliseconds(), (lease + redisRetention).Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("renewing lock %s : %w", name, err)
+	}
+	return redisInt(reply) == 1, nil
+}
+
+func (b *RedisBackend) ReleaseItem(ctx context.Context, name, owner string) error {
+	reply, err := b.client.Eval(ctx, redisReleaseScript, b.keys(name), owner, redisRetention.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("releasing lock %s : %w", name, err)
+	}
+	if redisInt(reply) == 0 {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	return nil
+}
+
+func (b *RedisBackend) GetItem(ctx context.Context, name string) (LockInfo, bool, error) {
+	now := time.Now()
+	reply, err := b.client.Eval(ctx, redisGetScript, b.keys(name))
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	values, err := redisValues(reply, 7)
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	if redisInt(values[0]) == 0 {
+		return LockInfo{Name: name}, false, nil
+	}
+	info := LockInfo{
+		Name:         name,
+		LockerId:     redisString(values[1]),
+		ExpiresAt:    now.Add(time.Duration(redisInt(values[2])) * time.Millisecond),
+		FencingToken: redisInt(values[3]),
+		TraceId:      redisString(values[4]),
+	}
+	if redisInt(values[5]) == 1 {
+		info.Data = []byte(redisString(values[6]))
+	}
+	return info, true, nil
+}
+
+// ListItems scans the keyspace for lock keys a page at a time and reads each
+// lock on its own, so it is meant for operational tooling rather than hot
+// paths. A lock released between the scan and reading it is left out. It
+// returns ErrUnsupported unless the client is also a RedisScanner.
+func (b *RedisBackend) ListItems(ctx context.Context) ([]LockInfo, error) {
+	scanner, ok := b.client.(RedisScanner)
+	if !ok {
+		return nil, fmt.Errorf("listing locks needs a RedisScanner : %w", ErrUnsupported)
+	}
+	var names []string
+	seen := map[string]bool{}
+	var cursor uint64
+	for {
+		keys, next, err := scanner.Scan(ctx, cursor, b.prefix+"{*}:lock", 1000)
+		if err != nil {
+			return nil, fmt.Errorf("listing locks : %w", err)
+		}
+		for _, key := range keys {
+			// SCAN may return a key more than once
+			name := strings.TrimSuffix(strings.TrimPrefix(key, b.prefix+"{"), "}:lock")
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	var infos []LockInfo
+	for _, name := range names {
+		info, found, err := b.GetItem(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// redisValues checks that a script returned an array of at least n values.
+func redisValues(reply interface{}, n int) ([]interface{}, error) {
+	values, ok := reply.([]interface{})
+	if !ok || len(values) < n {
+		return nil, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	return values, nil
+}
+
+func redisInt(v interface{}) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+func redisString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
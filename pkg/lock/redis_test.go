@@ -0,0 +1,194 @@
+package infra
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// respClient speaks just enough of the Redis protocol to run RedisBackend's
+// scripts and scans, so they are tested against miniredis's Lua rather than
+// an emulation of them.
+type respClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRespClient(t *testing.T) (*respClient, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &respClient{conn: conn, r: bufio.NewReader(conn)}, server
+}
+
+func (c *respClient) do(args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		s := fmt.Sprint(arg)
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(s), s)
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *respClient) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil, nil
+		}
+		bulk := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, bulk); err != nil {
+			return nil, err
+		}
+		return string(bulk[:n]), nil
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+func (c *respClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	cmd := []interface{}{"EVAL", script, len(keys)}
+	for _, key := range keys {
+		cmd = append(cmd, key)
+	}
+	return c.do(append(cmd, args...)...)
+}
+
+func (c *respClient) Scan(ctx context.Context, cursor uint64, match string, count int64) ([]string, uint64, error) {
+	reply, err := c.do("SCAN", cursor, "MATCH", match, "COUNT", count)
+	if err != nil {
+		return nil, 0, err
+	}
+	page, err := redisValues(reply, 2)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys, err := redisValues(page[1], 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	var names []string
+	for _, key := range keys {
+		names = append(names, redisString(key))
+	}
+	return names, uint64(redisInt(page[0])), nil
+}
+
+func TestRedisBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, _ := newRespClient(t)
+	backend := NewRedisBackend(client, "")
+	n := NewBackendLocker(backend, ctx)
+	b := NewBackendLocker(backend, ctx)
+
+	h, err := n.Acquire(ctx, "x", time.Second*10, WithTraceID("trace-1"), WithData([]byte("payload")))
+	assert.Nil(t, err, "error should be nil")
+	if !assert.NotNil(t, h, "lock should be acquired") {
+		return
+	}
+	assert.Equal(t, int64(1), h.FencingToken(), "the first holder should get the first token")
+	ok, err := b.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "held lock should not be acquired")
+
+	info, found, err := b.GetLockInfo(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock item should be found")
+	assert.Equal(t, n.ID(), info.LockerId, "the holder should be reported")
+	assert.Equal(t, "trace-1", info.TraceId, "the trace should be stored")
+	assert.Equal(t, []byte("payload"), info.Data, "the data should be stored")
+	held, err := b.LocksHeldBy(ctx, n.ID())
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, held, 1, "locks should be listed by holder")
+
+	ok, err = backend.RenewItem(ctx, "x", b.ID(), time.Second)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "only the owner should renew")
+	assert.ErrorIs(t, backend.ReleaseItem(ctx, "x", b.ID()), ErrNotHeld, "only the owner should release")
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	locked, err := b.IsLocked(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, locked, "released lock should be free")
+
+	bh, err := b.Acquire(ctx, "x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	if assert.NotNil(t, bh, "released lock should be acquired") {
+		assert.Equal(t, int64(2), bh.FencingToken(), "fencing tokens should grow across holders")
+		data, err := b.Data("x")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, []byte("payload"), data, "data should outlive the holder")
+	}
+}
+
+func TestRedisBackendKeys(t *testing.T) {
+	ctx := context.Background()
+	client, server := newRespClient(t)
+	backend := NewRedisBackend(client, "")
+
+	_, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "a", TraceId: "trace-1"}, time.Second)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	server.FastForward(time.Second * 2)
+	assert.False(t, server.Exists("gotrc:{x}:lock"), "the lock should expire with its lease")
+	assert.True(t, server.Exists("gotrc:{x}:token"), "the fencing token should outlive the lease")
+	assert.Greater(t, server.TTL("gotrc:{x}:token"), time.Duration(0), "the fencing token should expire")
+	assert.Greater(t, server.TTL("gotrc:{x}:meta"), time.Duration(0), "the trace and data should expire")
+
+	info, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "b"}, time.Second)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a lapsed lock should be acquired")
+	assert.Equal(t, int64(2), info.FencingToken, "fencing tokens should grow across leases")
+	assert.Nil(t, backend.ReleaseItem(ctx, "x", "b"), "error should be nil")
+	server.FastForward(redisRetention + time.Second)
+	assert.Empty(t, server.Keys(), "an unused lock should leave no keys behind")
+
+	_, err = NewRedisBackend(RedisEvalFunc(client.Eval), "").ListItems(ctx)
+	assert.ErrorIs(t, err, ErrUnsupported, "listing should need a scanner")
+}
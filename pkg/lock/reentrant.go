@@ -0,0 +1,67 @@
+package infra
+
+import (
+	"context"
+	"time"
+)
+
+// WithReentrantLocks makes locks reentrant: acquiring a lock this Locker
+// already holds adds a hold, and releasing it drops one, so the lock is only
+// released once every acquisition has been released. Without it, a second
+// acquisition just renews the lease and the first release gives the lock up.
+// Shutdown, ReleaseMany and a lost lease still give up a lock whatever its
+// hold count.
+func WithReentrantLocks() Option {
+	return func(l *Locker) {
+		l.reentrant = true
+	}
+}
+
+// acquireHold acquires a lock for a caller, counting an extra hold if the
+// Locker is reentrant and already held the lock.
+func (l *Locker) acquireHold(ctx context.Context, name string, timeout time.Duration, opts ...AcquireOption) (bool, error) {
+	reentry := l.reentrant && l.holding(name)
+	ok, err := l.acquire(ctx, name, timeout, opts...)
+	if ok && err == nil && reentry {
+		l.mu.Lock()
+		if l.holds == nil {
+			l.holds = map[string]int{}
+		}
+		l.holds[name]++
+		l.mu.Unlock()
+	}
+	return ok, err
+}
+
+// dropHold drops an extra hold on a lock, reporting false if there was none
+// and the lock should be released.
+func (l *Locker) dropHold(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holds[name] == 0 {
+		return false
+	}
+	l.holds[name]--
+	if l.holds[name] == 0 {
+		delete(l.holds, name)
+	}
+	return true
+}
+
+// Holds returns how many times the named lock is held: zero if this Locker
+// doesn't hold it, and more than one only for reentrant locks acquired again.
+func (l *Locker) Holds(name string) int {
+	if !l.holding(name) {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return 1 + l.holds[name]
+}
+
+func (l *Locker) holding(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, held := l.locksHeld[name]
+	return held
+}
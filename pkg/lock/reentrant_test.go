@@ -0,0 +1,53 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReentrantLocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks", WithReentrantLocks())
+	for i := 0; i < 2; i++ {
+		ok, err := n.AcquireLock("nested", time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+	assert.Equal(t, 2, n.Holds("nested"), "each acquisition should add a hold")
+
+	assert.Nil(t, n.ReleaseLock("nested"), "error should be nil")
+	assert.Equal(t, 1, n.Holds("nested"), "a release should drop one hold")
+	other := NewLocker(client, ctx, "locks")
+	ok, err := other.AcquireLock("nested", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a lock with holds left should still be held")
+
+	assert.Nil(t, n.ReleaseLock("nested"), "error should be nil")
+	assert.Equal(t, 0, n.Holds("nested"), "the last release should give the lock up")
+	ok, err = other.AcquireLock("nested", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a fully released lock should be free")
+
+	plain := NewLocker(client, ctx, "locks")
+	for i := 0; i < 2; i++ {
+		ok, err := plain.AcquireLock("flat", time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+	assert.Equal(t, 1, plain.Holds("flat"), "locks should not be reentrant by default")
+	assert.Nil(t, plain.ReleaseLock("flat"), "error should be nil")
+	assert.Equal(t, 0, plain.Holds("flat"), "one release should give a plain lock up")
+
+	for i := 0; i < 2; i++ {
+		ok, err := n.AcquireLock("batch", time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+	assert.Nil(t, n.ReleaseMany(ctx, []string{"batch"}), "error should be nil")
+	assert.Equal(t, 0, n.Holds("batch"), "ReleaseMany should give a lock up whatever its holds")
+}
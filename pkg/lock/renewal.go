@@ -0,0 +1,144 @@
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// WithBatchedRenewal makes the heartbeater renew the locks due on a tick in
+// DynamoDB transactions of up to 100 locks, instead of one UpdateItem per
+// lock, so processes holding hundreds of locks make a handful of requests a
+// tick. A transaction renews every lock in it or none: when some of its
+// locks have been lost, those are dropped and the rest are renewed one by
+// one for that tick. Transactional writes consume twice the write capacity
+// of plain ones, and don't return the items they change, so holders no
+// longer see BroadcastCancel marks when they refresh.
+func WithBatchedRenewal() Option {
+	return func(l *Locker) {
+		l.batchRenewal = true
+	}
+}
+
+// WithLightRenewal makes the heartbeater renew a lock by setting only its
+// expiry, under the condition that the lock is still ours, rather than going
+// through the whole acquisition update and reading the item back. Renewals
+// write less, but holders no longer see BroadcastCancel marks when they
+// refresh, and renewals leave other attributes, such as a trace ID, as they
+// are.
+func WithLightRenewal() Option {
+	return func(l *Locker) {
+		l.lightRenewal = true
+	}
+}
+
+// WithSkipFreshRenewal leaves locks acquired within the last fraction of
+// their lease out of heartbeat refreshes, so a lock taken just before a tick
+// isn't written again straight away. Fractions of a half or more risk a lock
+// going unrenewed for most of its lease.
+func WithSkipFreshRenewal(fraction float64) Option {
+	return func(l *Locker) {
+		l.skipFresh = fraction
+	}
+}
+
+// fresh reports whether a lock was acquired too recently to be renewed.
+func (l *Locker) fresh(lk *lock, now time.Time) bool {
+	return l.skipFresh > 0 && now.Sub(lk.acquiredAt) < time.Duration(l.skipFresh*float64(lk.timeout))
+}
+
+// renew extends the lease of a held lock on a heartbeat.
+func (l *Locker) renew(lk *lock) (bool, error) {
+	if !l.lightRenewal || l.backend != nil {
+		return l.acquire(l.ctx, lk.name, lk.timeout)
+	}
+	update, condition, values := l.lightRenewalUpdate(time.Now().Add(lk.timeout), lk.timeout)
+	err := l.withBackoff(l.ctx, l.heartbeatLogger, "renew", func() error {
+		_, err := l.client.UpdateItem(l.ctx, &dynamodb.UpdateItemInput{
+			Key:                       l.attrs.key(lk.name),
+			UpdateExpression:          aws.String(update),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  l.attrs.expressionNames(nil, update, condition),
+			ExpressionAttributeValues: values,
+			TableName:                 aws.String(l.lockTable),
+		}, l.requestOptions)
+		return err
+	})
+	if isConditionalCheckFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// lightRenewalUpdate sets just the expiry of a lock that is still ours, and
+// with record versions a new version.
+func (l *Locker) lightRenewalUpdate(expiry time.Time, lease time.Duration) (string, string, map[string]dynamodbtypes.AttributeValue) {
+	values := map[string]dynamodbtypes.AttributeValue{
+		":lockerId": &dynamodbtypes.AttributeValueMemberS{Value: l.lockerId},
+		":expiry":   &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expiry.Unix())},
+		":expiryMs": &dynamodbtypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expiry.UnixMilli())},
+	}
+	update := "SET #expiry = :expiry, ExpireAtMs = :expiryMs"
+	if l.versioned() {
+		update = l.javaUpdate(update, values, lease, uuid.New().String())
+	}
+	return update, ownerCondition, values
+}
+
+// renewBatch renews locks in a single transaction, adding those that can no
+// longer be saved to lost.
+func (l *Locker) renewBatch(batch []*lock, lost *[]lostLock) {
+	start := time.Now()
+	items := make([]dynamodbtypes.TransactWriteItem, len(batch))
+	for i, lk := range batch {
+		var update, condition string
+		var values map[string]dynamodbtypes.AttributeValue
+		var names map[string]string
+		if l.lightRenewal {
+			update, condition, values = l.lightRenewalUpdate(start.Add(lk.timeout), lk.timeout)
+		} else {
+			update, values, names = l.acquireUpdate(lk.name, start, start.Add(lk.timeout), true, acquireOptions{})
+			condition = l.acquireExpression(lk.name, start, values)
+		}
+		items[i].Update = &dynamodbtypes.Update{
+			Key:                       l.attrs.key(lk.name),
+			UpdateExpression:          aws.String(update),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  l.attrs.expressionNames(names, update, condition),
+			ExpressionAttributeValues: values,
+			TableName:                 aws.String(l.lockTable),
+		}
+	}
+	err := l.withBackoff(l.ctx, l.heartbeatLogger, "renew", func() error {
+		_, err := l.client.TransactWriteItems(l.ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items}, l.requestOptions)
+		return err
+	})
+	if l.ctx.Err() != nil {
+		return
+	}
+	var cancelled *dynamodbtypes.TransactionCanceledException
+	if errors.As(err, &cancelled) && len(cancelled.CancellationReasons) == len(batch) {
+		l.heartbeatLogger.Debug("Batched renewal cancelled, renewing locks one by one", "count", len(batch))
+		for i, lk := range batch {
+			if aws.ToString(cancelled.CancellationReasons[i].Code) == "ConditionalCheckFailed" {
+				l.renewed(lk, start, false, nil, lost)
+				continue
+			}
+			retried := time.Now()
+			ok, err := l.renew(lk)
+			if l.ctx.Err() != nil {
+				return
+			}
+			l.renewed(lk, retried, ok, err, lost)
+		}
+		return
+	}
+	for _, lk := range batch {
+		l.renewed(lk, start, err == nil, err, lost)
+	}
+}
@@ -0,0 +1,112 @@
+package infra
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingClient counts the writes made through a MemoryClient.
+type countingClient struct {
+	*MemoryClient
+	updates, transactions atomic.Int32
+}
+
+func (c *countingClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.updates.Add(1)
+	return c.MemoryClient.UpdateItem(ctx, params, optFns...)
+}
+
+func (c *countingClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	c.transactions.Add(1)
+	return c.MemoryClient.TransactWriteItems(ctx, params, optFns...)
+}
+
+func TestBatchedRenewal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &countingClient{MemoryClient: NewMemoryClient()}
+	lost := make(chan string, 3)
+	s := NewManualScheduler()
+	l := NewLocker(client, ctx, "locks", WithBatchedRenewal(), WithScheduler(func(time.Duration) Scheduler { return s }),
+		WithLockLostHandler(func(name string, err error) { lost <- name }))
+	for _, name := range []string{"a", "b", "c"} {
+		ok, err := l.AcquireLock(name, 2*time.Minute)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+
+	s.Tick(time.Now())
+	assert.Eventually(t, func() bool { return client.transactions.Load() == 1 }, time.Second, 10*time.Millisecond,
+		"the held locks should be renewed in one transaction")
+	assert.Equal(t, int32(3), client.updates.Load(), "no lock should be renewed on its own")
+
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":     &dynamodbtypes.AttributeValueMemberS{Value: "b"},
+			"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "thief"},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+	s.Tick(time.Now())
+	assert.Equal(t, "b", <-lost, "the lock taken by another locker should be lost")
+	assert.Equal(t, int32(2), client.transactions.Load(), "the batch should have been tried first")
+	assert.Equal(t, int32(5), client.updates.Load(), "the remaining locks should be renewed one by one")
+	assert.ElementsMatch(t, []string{"a", "c"}, l.heldNames(), "the remaining locks should be kept")
+}
+
+func TestLightRenewal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var updates []*dynamodb.UpdateItemInput
+	memory := NewMemoryClient()
+	client := &fakeClient{Client: memory, updateItem: func(params *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		updates = append(updates, params)
+		return memory.UpdateItem(ctx, params)
+	}, deleteItem: func(params *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+		return memory.DeleteItem(ctx, params)
+	}}
+	s := NewManualScheduler()
+	l := NewLocker(client, ctx, "locks", WithLightRenewal(), WithScheduler(func(time.Duration) Scheduler { return s }))
+	ok, err := l.AcquireLock("light", 2*time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	s.Tick(time.Now())
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(updates) == 2
+	}, time.Second, 10*time.Millisecond, "the lock should be renewed")
+	client.mu.Lock()
+	renewal := updates[1]
+	client.mu.Unlock()
+	assert.Equal(t, "SET #expiry = :expiry, ExpireAtMs = :expiryMs", aws.ToString(renewal.UpdateExpression), "only the expiry should be set")
+	assert.Equal(t, ownerCondition, aws.ToString(renewal.ConditionExpression), "the renewal should only require ownership")
+	assert.Empty(t, renewal.ReturnValues, "the renewal should not read the item back")
+	assert.Equal(t, []string{"light"}, l.heldNames(), "the lock should still be held")
+}
+
+func TestSkipFreshRenewal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &countingClient{MemoryClient: NewMemoryClient()}
+	s := NewManualScheduler()
+	l := NewLocker(client, ctx, "locks", WithSkipFreshRenewal(0.25), WithScheduler(func(time.Duration) Scheduler { return s }))
+	ok, err := l.AcquireLock("fresh", 400*time.Millisecond)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	assert.Equal(t, int32(1), client.updates.Load(), "a lock acquired just now should not be renewed")
+
+	time.Sleep(150 * time.Millisecond)
+	s.Tick(time.Now())
+	assert.Eventually(t, func() bool { return client.updates.Load() == 2 }, time.Second, 10*time.Millisecond,
+		"a lock past the fresh fraction of its lease should be renewed")
+}
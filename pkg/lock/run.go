@@ -0,0 +1,82 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithRunLoop stops the Locker from starting its own heartbeater goroutine.
+// The heartbeater instead runs inside Run, which the application must call,
+// typically from an errgroup or similar, before locks are acquired.
+func WithRunLoop() Option {
+	return func(l *Locker) {
+		l.runLoop = true
+		l.wake = make(chan struct{}, 1)
+	}
+}
+
+// Run runs the heartbeater of a Locker created with WithRunLoop until ctx is
+// done, the Locker is closed or the heartbeater fails. When ctx is done, held
+// locks are released, the Locker is closed and ctx.Err() is returned. Closing
+// the Locker makes Run return nil. Locks that could not be refreshed are
+// reported through WithLockLostHandler and Errors and don't stop Run, but a
+// panic on the heartbeater, such as one raised by an event handler, closes the
+// Locker and is returned, so that it can be observed instead of crashing the
+// process.
+func (l *Locker) Run(ctx context.Context) error {
+	if !l.runLoop {
+		return fmt.Errorf("locker %s was not created with WithRunLoop", l.lockerId)
+	}
+	for {
+		select {
+		case <-l.wake:
+			if err := l.runHeartbeater(ctx); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			l.cancel()
+			return ctx.Err()
+		case <-l.parent.Done():
+			l.cancel()
+			return l.parent.Err()
+		case <-l.ctx.Done():
+			return nil
+		}
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case l.parent.Err() != nil:
+			return l.parent.Err()
+		case l.ctx.Err() != nil:
+			return nil
+		}
+	}
+}
+
+// runHeartbeater runs the heartbeater until it goes idle or shuts down,
+// turning a panic into an error.
+func (l *Locker) runHeartbeater(ctx context.Context) (err error) {
+	// The heartbeater releases locks when its context is done, which must
+	// happen for either Run's context or the one the Locker was created with
+	hbCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.parent.Done():
+			cancel()
+		case <-hbCtx.Done():
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			l.cancel()
+			if e, ok := r.(error); ok {
+				err = fmt.Errorf("heartbeater failed : %w", e)
+			} else {
+				err = fmt.Errorf("heartbeater failed : %v", r)
+			}
+		}
+	}()
+	l.heartBeater(hbCtx)
+	return nil
+}
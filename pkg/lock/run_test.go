@@ -0,0 +1,74 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runAsync(l *Locker, ctx context.Context) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- l.Run(ctx)
+	}()
+	return result
+}
+
+func waitRun(t *testing.T, result <-chan error) error {
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return")
+		return nil
+	}
+}
+
+func TestRunRequiresRunLoop(t *testing.T) {
+	l := NewLocker(nil, context.Background(), "locks")
+	defer l.Close(context.Background())
+	assert.NotNil(t, l.Run(context.Background()), "Run should refuse a Locker with its own heartbeater")
+}
+
+func TestRunHostsHeartbeater(t *testing.T) {
+	l := NewLocker(nil, context.Background(), "locks", WithRunLoop())
+	result := runAsync(l, context.Background())
+
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, l.Reconfigure(WithHeartbeatInterval(time.Minute)), "Run should be serving the heartbeater")
+	}
+	assert.Nil(t, l.Close(context.Background()), "error should be nil")
+	assert.Nil(t, waitRun(t, result), "closing the Locker should stop Run cleanly")
+}
+
+func TestRunReturnsContextError(t *testing.T) {
+	l := NewLocker(nil, context.Background(), "locks", WithRunLoop())
+	ctx, cancel := context.WithCancel(context.Background())
+	result := runAsync(l, ctx)
+	cancel()
+	assert.True(t, errors.Is(waitRun(t, result), context.Canceled), "Run should return its context's error")
+	assert.True(t, l.closed(), "the Locker should be closed")
+}
+
+func TestRunReportsHeartbeaterFailure(t *testing.T) {
+	client := &fakeClient{updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		return nil, errors.New("connection reset")
+	}}
+	l := NewLocker(client, context.Background(), "locks", WithRunLoop(), WithLockLostHandler(func(name string, err error) {
+		panic(err)
+	}))
+	l.locksHeld = map[string]*lock{"x": {name: "x", timeout: time.Second}}
+	s := NewManualScheduler()
+	WithScheduler(func(time.Duration) Scheduler { return s })(l)
+	result := runAsync(l, context.Background())
+
+	assert.Nil(t, l.enter(), "error should be nil")
+	s.Tick(time.Now())
+	assert.NotNil(t, waitRun(t, result), "a panic on the heartbeater should be returned")
+	assert.True(t, l.closed(), "the Locker should be closed")
+}
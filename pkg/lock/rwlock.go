@@ -0,0 +1,444 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+// rwLockPrefix namespaces read-write lock items so they can share a table with locks.
+const rwLockPrefix = "rwlock:"
+
+// rwState is the decoded state of a read-write lock item. The writer field
+// names the writer that holds the lock, or is waiting for readers to leave.
+type rwState struct {
+	writer         string
+	writerExpireMs int64
+	readers        map[string]int64
+}
+
+func (s *rwState) liveReaders(now int64) int {
+	for id, expireMs := range s.readers {
+		if expireMs < now {
+			delete(s.readers, id)
+		}
+	}
+	return len(s.readers)
+}
+
+func (s *rwState) liveWriter(now int64) string {
+	if s.writerExpireMs < now {
+		s.writer = ""
+	}
+	return s.writer
+}
+
+// RWLocker is a lease-backed read-write lock stored in the lock table. Any
+// number of readers may hold a named lock at once, while a writer holds it
+// alone. A waiting writer stops new readers from joining, so a steady stream
+// of readers can't starve it. As with Semaphore, holders renew their leases
+// in the background, so a lock held by a process that dies frees up once its
+// lease lapses.
+//
+// Each lock taken through an RWLocker is its own RWHold, so goroutines
+// sharing an RWLocker hold and release their locks independently, as they
+// would through separate RWLockers.
+//
+// Each item records the live readers' leases and a readerCount attribute,
+// and every change is a conditional write on the item's version.
+type RWLocker struct {
+	client   Client
+	table    string
+	lease    time.Duration
+	holderId string
+	attrs    AttributeNames
+	logger   *slog.Logger
+}
+
+// RWLockerOption configures an RWLocker at construction time.
+type RWLockerOption func(*RWLocker)
+
+// WithRWLockAttributeNames keys read-write lock items by names.Key, for
+// tables whose key isn't "name", as WithAttributeNames does for a Locker. The
+// other attributes of a read-write lock item are its own.
+func WithRWLockAttributeNames(names AttributeNames) RWLockerOption {
+	return func(rw *RWLocker) {
+		rw.attrs = names.withDefaults()
+	}
+}
+
+// NewRWLocker returns an RWLocker keeping read-write locks in table, each
+// hold leased for lease and renewed every half lease. It panics if the lease
+// is shorter than a millisecond, the precision lock items record leases to.
+func NewRWLocker(client Client, table string, lease time.Duration, opts ...RWLockerOption) *RWLocker {
+	if lease < time.Millisecond {
+		panic("lock: NewRWLocker lease must be at least a millisecond")
+	}
+	id := uuid.New().String()
+	rw := &RWLocker{
+		client:   client,
+		table:    table,
+		lease:    lease,
+		holderId: id,
+		attrs:    defaultAttributeNames,
+		logger:   slog.With("rwlocker", id),
+	}
+	for _, opt := range opts {
+		opt(rw)
+	}
+	return rw
+}
+
+// RWHold is one hold of a read-write lock, for reading or writing, renewed in
+// the background until Unlock is called or the hold is lost, which Done
+// reports.
+type RWHold struct {
+	rw    *RWLocker
+	name  string
+	id    string
+	write bool
+	stop  context.CancelFunc
+	done  chan struct{}
+	mu    sync.Mutex
+	// lostErr is why the hold ended, once done is closed
+	lostErr error
+}
+
+// newHold returns a hold with an id of its own, which the item records in
+// place of the RWLocker's.
+func (rw *RWLocker) newHold(name string, write bool) *RWHold {
+	return &RWHold{rw: rw, name: name, id: rw.holderId + "/" + uuid.New().String(), write: write, done: make(chan struct{})}
+}
+
+// Lock acquires the named lock for writing, waiting until ctx is done for
+// other writers and then readers to leave. Readers can't join while it waits.
+func (rw *RWLocker) Lock(ctx context.Context, name string) (*RWHold, error) {
+	h := rw.newHold(name, true)
+	for {
+		ok, err := h.tryLock(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return h, nil
+		}
+		select {
+		case <-ctx.Done():
+			rw.update(context.Background(), name, func(s *rwState, now int64) bool {
+				if s.writer != h.id {
+					return false
+				}
+				s.writer = ""
+				return true
+			})
+			return nil, ctx.Err()
+		case <-time.After(semaphorePollInterval):
+		}
+	}
+}
+
+// TryLock acquires the named lock for writing if it is free right now,
+// returning a nil hold if it isn't.
+func (rw *RWLocker) TryLock(ctx context.Context, name string) (*RWHold, error) {
+	h := rw.newHold(name, true)
+	if ok, err := h.tryLock(ctx, false); !ok || err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// tryLock acquires the lock for writing if it is free. If only readers hold
+// it and claim is set, it claims the lock for this hold, so readers can't
+// join until the writer has come and gone or its claim lapses.
+func (h *RWHold) tryLock(ctx context.Context, claim bool) (bool, error) {
+	rw := h.rw
+	held := false
+	start := time.Now()
+	_, err := rw.update(ctx, h.name, func(s *rwState, now int64) bool {
+		if w := s.liveWriter(now); w != "" && w != h.id {
+			return false
+		}
+		if s.liveReaders(now) > 0 && !claim {
+			return false
+		}
+		s.writer = h.id
+		s.writerExpireMs = now + rw.lease.Milliseconds()
+		held = s.liveReaders(now) == 0
+		return true
+	})
+	if err != nil || !held {
+		return false, err
+	}
+	h.startRenewing(start)
+	return true, nil
+}
+
+// RLock acquires the named lock for reading, waiting until ctx is done for a
+// writer holding the lock or waiting for it to leave.
+func (rw *RWLocker) RLock(ctx context.Context, name string) (*RWHold, error) {
+	for {
+		h, err := rw.TryRLock(ctx, name)
+		if h != nil || err != nil {
+			return h, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(semaphorePollInterval):
+		}
+	}
+}
+
+// TryRLock acquires the named lock for reading if no writer holds or waits
+// for it right now, returning a nil hold if one does.
+func (rw *RWLocker) TryRLock(ctx context.Context, name string) (*RWHold, error) {
+	h := rw.newHold(name, false)
+	start := time.Now()
+	ok, err := rw.update(ctx, name, func(s *rwState, now int64) bool {
+		if s.liveWriter(now) != "" {
+			return false
+		}
+		s.liveReaders(now)
+		s.readers[h.id] = now + rw.lease.Milliseconds()
+		return true
+	})
+	if !ok || err != nil {
+		return nil, err
+	}
+	h.startRenewing(start)
+	return h, nil
+}
+
+// Name returns the name of the held lock.
+func (h *RWHold) Name() string {
+	return h.name
+}
+
+// Done returns a channel that is closed when the hold ends: because it was
+// unlocked, or because its lease lapsed or was taken over before it could be
+// renewed.
+func (h *RWHold) Done() <-chan struct{} {
+	return h.done
+}
+
+// Context returns a context derived from parent that is cancelled as soon as
+// the hold ends, with context.Cause reporting why. Renewals that fail while
+// the lease is still running are retried and don't cancel the context.
+func (h *RWHold) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-h.done:
+			cancel(h.cause())
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+func (h *RWHold) cause() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lostErr
+}
+
+// end closes done with err as the reason, unless the hold already ended.
+func (h *RWHold) end(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lostErr != nil {
+		return
+	}
+	h.lostErr = err
+	close(h.done)
+}
+
+// Unlock releases the hold, whether it is for reading or writing. Other holds
+// of the same lock, including those of the same RWLocker, are left alone.
+func (h *RWHold) Unlock(ctx context.Context) error {
+	h.stop()
+	h.end(fmt.Errorf("read-write lock %s was unlocked : %w", h.name, ErrNotHeld))
+	_, err := h.rw.update(ctx, h.name, func(s *rwState, now int64) bool {
+		if h.write {
+			if s.writer != h.id {
+				return false
+			}
+			s.writer = ""
+			return true
+		}
+		if _, ok := s.readers[h.id]; !ok {
+			return false
+		}
+		delete(s.readers, h.id)
+		return true
+	})
+	return err
+}
+
+// startRenewing renews the hold's lease, granted no earlier than start, every
+// half lease. A renewal that fails is retried until the lease lapses, and the
+// hold ends once it has lapsed or the item no longer records it.
+func (h *RWHold) startRenewing(start time.Time) {
+	rw := h.rw
+	ctx, cancel := context.WithCancel(context.Background())
+	h.stop = cancel
+	go func() {
+		expiresAt := start.Add(rw.lease)
+		timer := time.NewTimer(rw.lease / 2)
+		defer timer.Stop()
+		var lastErr error
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			renewedAt := time.Now()
+			if !renewedAt.Before(expiresAt) {
+				rw.logger.Warn("Read-write lock lease lapsed before it could be renewed", "name", h.name, "error", lastErr)
+				h.end(fmt.Errorf("read-write lock %s lease lapsed : %w", h.name, lastErr))
+				return
+			}
+			ok, err := rw.update(ctx, h.name, func(s *rwState, now int64) bool {
+				expireMs := now + rw.lease.Milliseconds()
+				if h.write && s.liveWriter(now) == h.id {
+					s.writerExpireMs = expireMs
+					return true
+				}
+				if readerExpireMs, held := s.readers[h.id]; !h.write && held && readerExpireMs >= now {
+					s.readers[h.id] = expireMs
+					return true
+				}
+				return false
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			switch {
+			case ok:
+				expiresAt = renewedAt.Add(rw.lease)
+				timer.Reset(rw.lease / 2)
+			case err == nil:
+				rw.logger.Warn("Read-write lock hold was lost", "name", h.name)
+				h.end(fmt.Errorf("read-write lock %s is no longer held : %w", h.name, ErrNotHeld))
+				return
+			default:
+				rw.logger.Warn("Read-write lock lease could not be renewed, retrying", "name", h.name, "error", err)
+				lastErr = err
+				retry := rw.lease / 8
+				if remaining := time.Until(expiresAt); remaining < retry {
+					retry = remaining
+				}
+				timer.Reset(retry)
+			}
+		}
+	}()
+}
+
+// update applies change to the lock's state with optimistic concurrency,
+// retrying when another holder wrote in between. It reports whether change
+// accepted the new state.
+func (rw *RWLocker) update(ctx context.Context, name string, change func(s *rwState, now int64) bool) (bool, error) {
+	key := rw.attrs.key(rwLockPrefix + name)
+	for {
+		out, err := rw.client.GetItem(ctx, &dynamodb.GetItemInput{
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+			TableName:      aws.String(rw.table),
+		})
+		if err != nil {
+			return false, fmt.Errorf("reading read-write lock %s : %w", name, err)
+		}
+		state, version, err := decodeRWState(out.Item)
+		if err != nil {
+			return false, fmt.Errorf("decoding read-write lock %s : %w", name, err)
+		}
+		now := time.Now().UnixMilli()
+		if !change(state, now) {
+			return false, nil
+		}
+
+		readers := map[string]dynamodbtypes.AttributeValue{}
+		for id, expireMs := range state.readers {
+			readers[id] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expireMs, 10)}
+		}
+		values := map[string]dynamodbtypes.AttributeValue{
+			":readers":     &dynamodbtypes.AttributeValueMemberM{Value: readers},
+			":readerCount": &dynamodbtypes.AttributeValueMemberN{Value: strconv.Itoa(state.liveReaders(now))},
+			":version":     &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+			":next":        &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+		}
+		update := "SET #readers = :readers, #readerCount = :readerCount, #version = :next"
+		if state.writer == "" {
+			update += " REMOVE #writer, #writerExpireMs"
+		} else {
+			update += ", #writer = :writer, #writerExpireMs = :writerExpireMs"
+			values[":writer"] = &dynamodbtypes.AttributeValueMemberS{Value: state.writer}
+			values[":writerExpireMs"] = &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(state.writerExpireMs, 10)}
+		}
+		_, err = rw.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			Key:                 key,
+			UpdateExpression:    aws.String(update),
+			ConditionExpression: aws.String("attribute_not_exists(#version) or #version = :version"),
+			// version is a DynamoDB reserved word
+			ExpressionAttributeNames: map[string]string{
+				"#readers":        "readers",
+				"#readerCount":    "readerCount",
+				"#writer":         "writer",
+				"#writerExpireMs": "writerExpireMs",
+				"#version":        "version",
+			},
+			ExpressionAttributeValues: values,
+			TableName:                 aws.String(rw.table),
+		})
+		var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			rw.logger.Debug("Read-write lock changed concurrently, retrying", "name", name)
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("writing read-write lock %s : %w", name, err)
+		}
+		return true, nil
+	}
+}
+
+func decodeRWState(item map[string]dynamodbtypes.AttributeValue) (*rwState, int64, error) {
+	state := &rwState{readers: map[string]int64{}}
+	var version int64
+	if _, ok := item["version"]; ok {
+		parsed, err := numberAttribute(item, "version")
+		if err != nil {
+			return nil, 0, err
+		}
+		version = parsed
+	}
+	if w, ok := item["writer"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		expireMs, err := numberAttribute(item, "writerExpireMs")
+		if err != nil {
+			return nil, 0, err
+		}
+		state.writer, state.writerExpireMs = w.Value, expireMs
+	}
+	m, _ := item["readers"].(*dynamodbtypes.AttributeValueMemberM)
+	if m == nil {
+		return state, version, nil
+	}
+	for id := range m.Value {
+		expireMs, err := numberAttribute(m.Value, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		state.readers[id] = expireMs
+	}
+	return state, version, nil
+}
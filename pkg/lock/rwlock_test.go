@@ -0,0 +1,148 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRWLocker(t *testing.T) {
+	ctx := context.Background()
+	client := NewMemoryClient()
+	readers := []*RWLocker{NewRWLocker(client, "locks", time.Second*10), NewRWLocker(client, "locks", time.Second*10)}
+	writer := NewRWLocker(client, "locks", time.Second*10)
+
+	var reads []*RWHold
+	for _, r := range readers {
+		h, err := r.TryRLock(ctx, "report")
+		assert.Nil(t, err, "error should be nil")
+		assert.NotNil(t, h, "readers should share the lock")
+		reads = append(reads, h)
+	}
+	h, err := writer.TryLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, h, "a writer should not join readers")
+
+	locked := make(chan *RWHold, 1)
+	go func() {
+		h, err := writer.Lock(ctx, "report")
+		assert.Nil(t, err, "error should be nil")
+		locked <- h
+	}()
+	assert.Eventually(t, func() bool {
+		h, err := NewRWLocker(client, "locks", time.Second*10).TryRLock(ctx, "report")
+		return h == nil && err == nil
+	}, time.Second*2, time.Millisecond*50, "a waiting writer should keep new readers out")
+
+	for _, h := range reads {
+		assert.Nil(t, h.Unlock(ctx), "error should be nil")
+	}
+	var write *RWHold
+	select {
+	case write = <-locked:
+	case <-time.After(time.Second * 2):
+		t.Fatal("writer should get the lock once readers leave")
+	}
+	h, err = readers[0].TryRLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, h, "readers should not join a writer")
+
+	assert.Nil(t, write.Unlock(ctx), "error should be nil")
+	h, err = readers[0].TryRLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.NotNil(t, h, "readers should get the lock once the writer leaves")
+	assert.Nil(t, h.Unlock(ctx), "error should be nil")
+
+	bounded, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+	h, err = readers[1].TryRLock(ctx, "abandoned")
+	assert.Nil(t, err, "error should be nil")
+	assert.NotNil(t, h, "lock should be acquired")
+	_, err = writer.Lock(bounded, "abandoned")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "a writer should give up with its context")
+	h, err = readers[0].TryRLock(ctx, "abandoned")
+	assert.Nil(t, err, "error should be nil")
+	assert.NotNil(t, h, "a writer that gave up should not keep readers out")
+}
+
+func TestRWLockerSharedByGoroutines(t *testing.T) {
+	ctx := context.Background()
+	rw := NewRWLocker(NewMemoryClient(), "locks", time.Second*10)
+
+	first, err := rw.TryRLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	second, err := rw.TryRLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, first.Unlock(ctx), "error should be nil")
+	h, err := rw.TryLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, h, "one reader leaving should not drop the other's hold")
+	assert.Nil(t, second.Unlock(ctx), "error should be nil")
+
+	write, err := rw.TryLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.NotNil(t, write, "lock should be acquired")
+	h, err = rw.TryLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.Nil(t, h, "a write hold should not be shared with another caller")
+	assert.Nil(t, write.Unlock(ctx), "error should be nil")
+}
+
+func TestRWLockerLease(t *testing.T) {
+	ctx := context.Background()
+	assert.Panics(t, func() { NewRWLocker(NewMemoryClient(), "locks", 0) }, "a zero lease should be refused")
+	assert.Panics(t, func() { NewRWLocker(NewMemoryClient(), "locks", time.Nanosecond) }, "a lease too short to record should be refused")
+
+	client := &outageClient{MemoryClient: NewMemoryClient()}
+	rw := NewRWLocker(client, "locks", time.Millisecond*200)
+	h, err := rw.TryLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.NotNil(t, h, "lock should be acquired")
+	held, cancel := h.Context(ctx)
+	defer cancel()
+
+	// A renewal failing for less than a lease is retried
+	client.down.Store(true)
+	time.Sleep(time.Millisecond * 120)
+	client.down.Store(false)
+	time.Sleep(time.Millisecond * 200)
+	assert.Nil(t, held.Err(), "a hold renewed in time should not be lost")
+
+	client.down.Store(true)
+	select {
+	case <-held.Done():
+	case <-time.After(time.Second * 2):
+		t.Fatal("a lapsed hold should be reported")
+	}
+	var sendErr *smithyhttp.RequestSendError
+	assert.True(t, errors.As(context.Cause(held), &sendErr), "the cause should be the failed renewal")
+	client.down.Store(false)
+	var other *RWHold
+	assert.Eventually(t, func() bool {
+		other, err = NewRWLocker(client, "locks", time.Second*10).TryLock(ctx, "report")
+		return other != nil && err == nil
+	}, time.Second, time.Millisecond*10, "a lapsed hold should free the lock")
+
+	unlocked, cancelUnlocked := other.Context(ctx)
+	defer cancelUnlocked()
+	assert.Nil(t, other.Unlock(ctx), "error should be nil")
+	<-unlocked.Done()
+	assert.ErrorIs(t, context.Cause(unlocked), ErrNotHeld, "an unlocked hold should be reported as no longer held")
+}
+
+func TestRWLockerAttributeNames(t *testing.T) {
+	ctx := context.Background()
+	client := NewMemoryClient()
+	client.DefineTable("locks", "LockID")
+	rw := NewRWLocker(client, "locks", time.Second*10, WithRWLockAttributeNames(AttributeNames{Key: "LockID"}))
+
+	h, err := rw.TryLock(ctx, "report")
+	assert.Nil(t, err, "error should be nil")
+	assert.NotNil(t, h, "lock should be acquired")
+	assert.Nil(t, h.Unlock(ctx), "error should be nil")
+}
@@ -0,0 +1,259 @@
+package infra
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+)
+
+// Scheduler decides when the heartbeater refreshes held locks. The heartbeater
+// refreshes every lock each time a value arrives on C, asks for a new interval
+// with Reset when a lock with a shorter lease is acquired, and calls Stop when
+// it goes idle or the Locker shuts down.
+//
+// Without WithScheduler, each lock is instead renewed on its own schedule,
+// every half lease or HeartbeatInterval, whichever is shorter, and the
+// heartbeater only wakes when the next lock falls due.
+type Scheduler interface {
+	C() <-chan time.Time
+	Reset(interval time.Duration)
+	Stop()
+}
+
+// WithScheduler replaces the default ticker with schedulers made by
+// newScheduler, which is called with the heartbeat interval each time the
+// heartbeater starts, and which then refreshes every held lock on each tick.
+// Refreshes can then be driven by an application's own event loop, a test
+// clock or batch windows. A scheduler must fire at least as often as the
+// interval it is given, or leases will lapse.
+func WithScheduler(newScheduler func(interval time.Duration) Scheduler) Option {
+	return func(l *Locker) {
+		l.newScheduler = newScheduler
+	}
+}
+
+// renewalWindow is the fraction of its renewal interval by which a lock may be
+// renewed early, so that locks falling due close together share a wakeup and,
+// with batched renewal, a transaction.
+const renewalWindow = 4
+
+// minRenewalWait keeps a lock that is overdue from spinning the heartbeater.
+const minRenewalWait = time.Millisecond
+
+// perLockRenewal reports whether each held lock is renewed on its own
+// schedule, which it is unless WithScheduler drives the heartbeater.
+func (l *Locker) perLockRenewal() bool {
+	return l.newScheduler == nil
+}
+
+// scheduler makes the Scheduler the heartbeater waits on.
+func (l *Locker) scheduler() Scheduler {
+	if l.manualRenewal {
+		// Nothing ticks, so locks are only renewed by Renew
+		return NewManualScheduler()
+	}
+	if l.perLockRenewal() {
+		return NewTickerScheduler(l.HeartbeatInterval)
+	}
+	return l.newScheduler(l.HeartbeatInterval)
+}
+
+// renewalInterval is how often a held lock is renewed: every half lease, and
+// at least every HeartbeatInterval.
+func (l *Locker) renewalInterval(lk *lock) time.Duration {
+	interval := l.renewalLease(lk.timeout) / 2
+	if l.HeartbeatInterval < interval {
+		interval = l.HeartbeatInterval
+	}
+	return interval
+}
+
+// WithHeartbeatJitter renews each lock up to fraction of its renewal interval
+// early, at random, so Lockers started together don't keep writing to the
+// table at the same moments. With a fraction of 0.2, a lock renewed every 10s
+// is renewed 8 to 10s after its last renewal. Jitter only ever brings
+// renewals forward, so it can't put a lease at risk; fractions above a half
+// are capped at a half. It has no effect under WithScheduler.
+func WithHeartbeatJitter(fraction float64) Option {
+	return func(l *Locker) {
+		l.jitter = fraction
+		if l.jitter > maxJitter {
+			l.jitter = maxJitter
+		}
+	}
+}
+
+// maxJitter is the largest fraction of a renewal interval jitter takes off.
+const maxJitter = 0.5
+
+// renewalDelay is how long after a renewal a lock is next due, less any
+// jitter.
+func (l *Locker) renewalDelay(lk *lock) time.Duration {
+	interval := l.renewalInterval(lk)
+	if l.jitter <= 0 {
+		return interval
+	}
+	return interval - time.Duration(rand.Int63n(int64(l.jitter*float64(interval))+1))
+}
+
+// dueAt reports whether a held lock's renewal falls due at now, allowing it
+// to be renewed a little early so renewals falling close together share a
+// wakeup.
+func (l *Locker) dueAt(lk *lock, now time.Time) bool {
+	return !now.Before(lk.renewAt.Add(-l.renewalInterval(lk) / renewalWindow))
+}
+
+// takeDue removes the locks due for renewal at now from the renewal queue,
+// soonest first, for requeue to put back once they are rescheduled. Every lock
+// is due on each tick of a Scheduler given with WithScheduler. It runs with mu
+// held.
+func (l *Locker) takeDue(now time.Time) []*lock {
+	if !l.perLockRenewal() {
+		due := make([]*lock, 0, len(l.locksHeld))
+		for _, lk := range l.locksHeld {
+			due = append(due, lk)
+		}
+		return due
+	}
+	var due []*lock
+	for len(l.renewals) > 0 && l.dueAt(l.renewals[0], now) {
+		due = append(due, heap.Pop(&l.renewals).(*lock))
+	}
+	return due
+}
+
+// requeue puts the locks taken by takeDue back in the renewal queue at their
+// new renewal times. It runs with mu held.
+func (l *Locker) requeue(taken []*lock) {
+	if !l.perLockRenewal() {
+		heap.Init(&l.renewals)
+		return
+	}
+	for _, lk := range taken {
+		heap.Push(&l.renewals, lk)
+	}
+}
+
+// shortestLease is the shortest lease of the held locks, or zero if none are
+// held.
+func (l *Locker) shortestLease() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var shortest time.Duration
+	for _, lk := range l.locksHeld {
+		if shortest == 0 || lk.timeout < shortest {
+			shortest = lk.timeout
+		}
+	}
+	return shortest
+}
+
+// schedule sets the heartbeater to wake when the next held lock falls due,
+// and the watchdog to expect it within that lock's renewal interval. It runs
+// on the heartbeater.
+func (l *Locker) schedule(now time.Time) {
+	if !l.perLockRenewal() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	next, expected := l.HeartbeatInterval, l.HeartbeatInterval
+	if len(l.renewals) > 0 {
+		lk := l.renewals[0]
+		next, expected = lk.renewAt.Sub(now), l.renewalInterval(lk)
+	}
+	if next < minRenewalWait {
+		next = minRenewalWait
+	}
+	l.interval.Store(int64(expected))
+	l.ticker.Reset(next)
+}
+
+// renewalQueue is a heap of the held locks ordered by when they are next due
+// for renewal, so the heartbeater finds the locks it has to renew without
+// looking at the rest.
+type renewalQueue []*lock
+
+func (q renewalQueue) Len() int {
+	return len(q)
+}
+
+func (q renewalQueue) Less(i, j int) bool {
+	return q[i].renewAt.Before(q[j].renewAt)
+}
+
+func (q renewalQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *renewalQueue) Push(x any) {
+	lk := x.(*lock)
+	lk.index = len(*q)
+	*q = append(*q, lk)
+}
+
+func (q *renewalQueue) Pop() any {
+	old := *q
+	lk := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	lk.index = -1
+	return lk
+}
+
+// fix moves a lock whose renewal time changed to its place in the queue.
+func (q *renewalQueue) fix(lk *lock) {
+	if q.holds(lk) {
+		heap.Fix(q, lk.index)
+	}
+}
+
+// remove takes a lock out of the queue if it is in it.
+func (q *renewalQueue) remove(lk *lock) {
+	if q.holds(lk) {
+		heap.Remove(q, lk.index)
+	}
+}
+
+func (q renewalQueue) holds(lk *lock) bool {
+	return lk.index >= 0 && lk.index < len(q) && q[lk.index] == lk
+}
+
+// NewTickerScheduler returns the default Scheduler, which fires every interval.
+func NewTickerScheduler(interval time.Duration) Scheduler {
+	return tickerScheduler{time.NewTicker(interval)}
+}
+
+type tickerScheduler struct {
+	*time.Ticker
+}
+
+func (s tickerScheduler) C() <-chan time.Time {
+	return s.Ticker.C
+}
+
+// ManualScheduler is a Scheduler that only fires when Tick is called. Reset
+// and Stop have no effect.
+type ManualScheduler struct {
+	c chan time.Time
+}
+
+// NewManualScheduler returns a ManualScheduler.
+func NewManualScheduler() *ManualScheduler {
+	return &ManualScheduler{c: make(chan time.Time)}
+}
+
+func (s *ManualScheduler) C() <-chan time.Time {
+	return s.c
+}
+
+func (s *ManualScheduler) Reset(time.Duration) {}
+
+func (s *ManualScheduler) Stop() {}
+
+// Tick fires the scheduler, blocking until the heartbeater takes the tick.
+func (s *ManualScheduler) Tick(now time.Time) {
+	s.c <- now
+}
@@ -0,0 +1,97 @@
+package infra
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTickerScheduler(t *testing.T) {
+	s := NewTickerScheduler(10 * time.Millisecond)
+	defer s.Stop()
+	select {
+	case <-s.C():
+	case <-time.After(time.Second):
+		t.Fatal("ticker scheduler did not fire")
+	}
+}
+
+func TestManualSchedulerDrivesRefresh(t *testing.T) {
+	testLock := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	s := NewManualScheduler()
+	n := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks",
+		WithScheduler(func(time.Duration) Scheduler { return s }))
+	ok, err := n.AcquireLock(testLock, time.Second*2)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+
+	time.Sleep(time.Second)
+	s.Tick(time.Now())
+	time.Sleep(time.Second * 2)
+
+	b := NewLocker(dynamodb.NewFromConfig(awsConf), ctx, "locks")
+	ok, err = b.AcquireLock(testLock, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "lock refreshed by the manual tick should still be held")
+}
+
+func TestPerLockRenewal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	memory := NewMemoryClient()
+	var mu sync.Mutex
+	renewals := map[string]int{}
+	client := &fakeClient{Client: memory, updateItem: func(params *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		mu.Lock()
+		renewals[params.Key["name"].(*dynamodbtypes.AttributeValueMemberS).Value]++
+		mu.Unlock()
+		return memory.UpdateItem(ctx, params)
+	}, deleteItem: func(params *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+		return memory.DeleteItem(ctx, params)
+	}}
+	n := NewLocker(client, ctx, "locks")
+	for name, lease := range map[string]time.Duration{"short": 200 * time.Millisecond, "long": time.Hour} {
+		ok, err := n.AcquireLock(name, lease)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+	assert.Equal(t, time.Minute, n.HeartbeatInterval, "a short lease should not change the heartbeat interval")
+
+	time.Sleep(time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, renewals["short"], 4, "the short lock should be renewed every half lease")
+	assert.Equal(t, 1, renewals["long"], "the long lock should not be renewed along with it")
+}
+
+func TestHeartbeatJitter(t *testing.T) {
+	l := &Locker{HeartbeatInterval: time.Minute}
+	lk := lock{name: "x", timeout: 20 * time.Second}
+	assert.Equal(t, 10*time.Second, l.renewalDelay(&lk), "renewals should not be jittered by default")
+
+	WithHeartbeatJitter(0.2)(l)
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := l.renewalDelay(&lk)
+		assert.GreaterOrEqual(t, delay, 8*time.Second, "jitter should stay within its fraction")
+		assert.LessOrEqual(t, delay, 10*time.Second, "jitter should never delay a renewal")
+		seen[delay] = true
+	}
+	assert.Greater(t, len(seen), 1, "renewals should be spread out")
+
+	WithHeartbeatJitter(3)(l)
+	assert.Equal(t, maxJitter, l.jitter, "jitter should be capped")
+}
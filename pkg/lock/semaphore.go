@@ -0,0 +1,469 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+// semaphorePrefix namespaces semaphore items so they can share a table with locks.
+const semaphorePrefix = "semaphore:"
+
+// semaphorePollInterval is how often a blocked Acquire retries.
+const semaphorePollInterval = 250 * time.Millisecond
+
+// holder is one Semaphore's reservation of permits.
+type holder struct {
+	permits  int64
+	expireMs int64
+}
+
+// Semaphore is a weighted, lease-backed counting semaphore stored in the lock
+// table. Each named semaphore has a fixed capacity; holders reserve a number of
+// permits and renew the reservation in the background, so the permits of a
+// holder that dies return to the pool once its lease lapses.
+//
+// All participants must agree on a semaphore's capacity.
+type Semaphore struct {
+	client   Client
+	table    string
+	capacity int64
+	lease    time.Duration
+	holderId string
+	attrs    AttributeNames
+	logger   *slog.Logger
+	mu       sync.Mutex
+	renewers map[string]*renewal
+	waiters  *waitQueue
+}
+
+// renewal is the background renewal of a reservation. Its fields other than
+// cancel are guarded by the Semaphore's mu.
+type renewal struct {
+	cancel    context.CancelFunc
+	expiresAt time.Time
+	done      chan struct{}
+	// err is why the reservation ended, once done is closed
+	err error
+}
+
+// SemaphoreOption configures a Semaphore at construction time.
+type SemaphoreOption func(*Semaphore)
+
+// WithMaxSemaphoreWaiters bounds how many acquirers may block in Acquire on
+// the same semaphore: at most goroutines of this process, and at most
+// processes Semaphores across all processes, counted through waiter records
+// in the table. Zero leaves either unbounded. Acquire fails fast with
+// ErrTooManyWaiters when the limit is reached.
+func WithMaxSemaphoreWaiters(goroutines, processes int) SemaphoreOption {
+	return func(s *Semaphore) {
+		s.waiters.max = goroutines
+		s.waiters.slots = nil
+		if processes > 0 {
+			s.waiters.slots = NewSemaphore(s.client, s.table, processes, s.lease)
+		}
+	}
+}
+
+// WithSemaphoreStarvationAlert calls handler with an EventStarving event when
+// an acquirer has been blocked in Acquire for longer than after, and again
+// each time its wait doubles, so chronically starved jobs become visible.
+// The handler runs on its own goroutine and must not block.
+func WithSemaphoreStarvationAlert(after time.Duration, handler func(Event)) SemaphoreOption {
+	return func(s *Semaphore) {
+		s.waiters.starveAfter = after
+		s.waiters.emit = func(e Event) {
+			e.LockerId = s.holderId
+			e.Time = time.Now()
+			handler(e)
+		}
+	}
+}
+
+// WithSemaphoreAttributeNames keys semaphore items by names.Key, for tables
+// whose key isn't "name", as WithAttributeNames does for a Locker. The other
+// attributes of a semaphore item are its own.
+func WithSemaphoreAttributeNames(names AttributeNames) SemaphoreOption {
+	return func(s *Semaphore) {
+		s.attrs = names.withDefaults()
+	}
+}
+
+// NewSemaphore returns a Semaphore holding permits with the given lease. It
+// panics if the lease is shorter than a millisecond, the precision semaphore
+// items record leases to, as the reservation could never be renewed.
+func NewSemaphore(client Client, table string, capacity int, lease time.Duration, opts ...SemaphoreOption) *Semaphore {
+	if lease < time.Millisecond {
+		panic("lock: NewSemaphore lease must be at least a millisecond")
+	}
+	id := uuid.New().String()
+	s := &Semaphore{
+		client:   client,
+		table:    table,
+		capacity: int64(capacity),
+		lease:    lease,
+		holderId: id,
+		attrs:    defaultAttributeNames,
+		logger:   slog.With("semaphore", id),
+		renewers: map[string]*renewal{},
+		waiters:  newWaitQueue(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.waiters.slots != nil {
+		s.waiters.slots.attrs = s.attrs
+	}
+	return s
+}
+
+// ErrSemaphoreWeight is returned when fewer than one permit, or more permits
+// than the semaphore has, are requested.
+var ErrSemaphoreWeight = errors.New("requested permits out of range for semaphore capacity")
+
+// Acquire reserves n permits of the named semaphore, waiting until they are
+// available or ctx is done. Acquiring again adds to the permits already held.
+// If the permits aren't available straight away and the waiter limits set
+// with WithMaxSemaphoreWaiters are reached, it returns ErrTooManyWaiters.
+func (s *Semaphore) Acquire(ctx context.Context, name string, n int) error {
+	ok, err := s.TryAcquire(ctx, name, n)
+	if ok || err != nil {
+		return err
+	}
+	leave, err := s.waiters.join(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer leave()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(semaphorePollInterval):
+		}
+		ok, err := s.TryAcquire(ctx, name, n)
+		if ok || err != nil {
+			return err
+		}
+	}
+}
+
+// TryAcquire reserves n permits if they are available right now.
+func (s *Semaphore) TryAcquire(ctx context.Context, name string, n int) (bool, error) {
+	if n < 1 || int64(n) > s.capacity {
+		return false, fmt.Errorf("acquiring %d of %d permits of semaphore %s : %w", n, s.capacity, name, ErrSemaphoreWeight)
+	}
+	start := time.Now()
+	ok, err := s.update(ctx, name, func(holders map[string]holder, now int64) bool {
+		return reserve(holders, s.holderId, int64(n), s.capacity, now+s.lease.Milliseconds(), now)
+	})
+	if ok && err == nil {
+		s.startRenewing(name, start)
+	}
+	return ok, err
+}
+
+// Release returns all permits held on the named semaphore.
+func (s *Semaphore) Release(ctx context.Context, name string) error {
+	s.stopRenewing(name)
+	_, err := s.update(ctx, name, func(holders map[string]holder, now int64) bool {
+		delete(holders, s.holderId)
+		return true
+	})
+	return err
+}
+
+// Close stops renewing every reservation and returns the permits held, so
+// they are free straight away rather than once their leases lapse. It returns
+// the errors of any releases that failed.
+func (s *Semaphore) Close(ctx context.Context) error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.renewers))
+	for name := range s.renewers {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if err := s.Release(ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Done returns a channel that is closed when this Semaphore no longer holds
+// permits on name: because they were released, or their lease lapsed or was
+// taken over before it could be renewed. The channel is already closed if no
+// permits are held.
+func (s *Semaphore) Done(name string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.renewers[name]; ok {
+		return r.done
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// Context returns a context derived from parent that is cancelled as soon as
+// this Semaphore no longer holds permits on name, with context.Cause
+// reporting why. Renewals that fail while the lease is still running are
+// retried and don't cancel the context.
+func (s *Semaphore) Context(parent context.Context, name string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	s.mu.Lock()
+	r, ok := s.renewers[name]
+	s.mu.Unlock()
+	if !ok {
+		cancel(fmt.Errorf("semaphore %s permits are not held : %w", name, ErrNotHeld))
+		return ctx, func() { cancel(nil) }
+	}
+	go func() {
+		select {
+		case <-r.done:
+			s.mu.Lock()
+			err := r.err
+			s.mu.Unlock()
+			cancel(err)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+func (s *Semaphore) stopRenewing(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.renewers[name]; ok {
+		s.endRenewal(name, r, fmt.Errorf("semaphore %s permits were released : %w", name, ErrNotHeld))
+	}
+}
+
+// endRenewal stops r and closes its done channel with err as the reason,
+// unless it already ended. The caller must hold s.mu.
+func (s *Semaphore) endRenewal(name string, r *renewal, err error) {
+	r.cancel()
+	if s.renewers[name] == r {
+		delete(s.renewers, name)
+	}
+	if r.err != nil {
+		return
+	}
+	r.err = err
+	close(r.done)
+}
+
+// startRenewing renews the reservation on name, granted no earlier than
+// start, every half lease until it is released. A renewal that fails is
+// retried until the lease lapses, and the reservation ends once it has lapsed
+// or the item no longer records it, after which the permits are left to
+// lapse.
+func (s *Semaphore) startRenewing(name string, start time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt := start.Add(s.lease)
+	if r, ok := s.renewers[name]; ok {
+		if expiresAt.After(r.expiresAt) {
+			r.expiresAt = expiresAt
+		}
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &renewal{cancel: cancel, expiresAt: expiresAt, done: make(chan struct{})}
+	s.renewers[name] = r
+	go s.renew(ctx, name, r)
+}
+
+func (s *Semaphore) renew(ctx context.Context, name string, r *renewal) {
+	lose := func(err error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.endRenewal(name, r, err)
+	}
+	timer := time.NewTimer(s.lease / 2)
+	defer timer.Stop()
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		renewedAt := time.Now()
+		s.mu.Lock()
+		expiresAt := r.expiresAt
+		s.mu.Unlock()
+		if !renewedAt.Before(expiresAt) {
+			s.logger.Warn("Semaphore permits lapsed before they could be renewed", "name", name, "error", lastErr)
+			lose(fmt.Errorf("semaphore %s lease lapsed : %w", name, lastErr))
+			return
+		}
+		ok, err := s.update(ctx, name, func(holders map[string]holder, now int64) bool {
+			h, held := holders[s.holderId]
+			if !held || h.expireMs < now {
+				return false
+			}
+			h.expireMs = now + s.lease.Milliseconds()
+			holders[s.holderId] = h
+			return true
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case ok:
+			s.mu.Lock()
+			r.expiresAt = renewedAt.Add(s.lease)
+			s.mu.Unlock()
+			timer.Reset(s.lease / 2)
+		case err == nil:
+			s.logger.Warn("Semaphore permits were lost", "name", name)
+			lose(fmt.Errorf("semaphore %s permits are no longer held : %w", name, ErrNotHeld))
+			return
+		default:
+			s.logger.Warn("Semaphore permits could not be renewed, retrying", "name", name, "error", err)
+			lastErr = err
+			retry := s.lease / 8
+			if remaining := time.Until(expiresAt); remaining < retry {
+				retry = remaining
+			}
+			timer.Reset(retry)
+		}
+	}
+}
+
+// reserve adds n permits for self to holders, dropping expired reservations,
+// and reports whether they fit within capacity.
+func reserve(holders map[string]holder, self string, n, capacity, expireMs, now int64) bool {
+	var used int64
+	for id, h := range holders {
+		if h.expireMs < now {
+			delete(holders, id)
+			continue
+		}
+		used += h.permits
+	}
+	if used+n > capacity {
+		return false
+	}
+	h := holders[self]
+	holders[self] = holder{h.permits + n, expireMs}
+	return true
+}
+
+// update applies change to the semaphore's holders with optimistic
+// concurrency, retrying when another holder wrote in between. It reports
+// whether change accepted the new state.
+func (s *Semaphore) update(ctx context.Context, name string, change func(holders map[string]holder, now int64) bool) (bool, error) {
+	key := s.attrs.key(semaphorePrefix + name)
+	for {
+		out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+			TableName:      aws.String(s.table),
+		})
+		if err != nil {
+			return false, fmt.Errorf("reading semaphore %s : %w", name, err)
+		}
+		holders, version, err := decodeHolders(out.Item)
+		if err != nil {
+			return false, fmt.Errorf("decoding semaphore %s : %w", name, err)
+		}
+		if !change(holders, time.Now().UnixMilli()) {
+			return false, nil
+		}
+
+		values := map[string]dynamodbtypes.AttributeValue{
+			":holders":  encodeHolders(holders),
+			":version":  &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+			":next":     &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+			":capacity": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(s.capacity, 10)},
+		}
+		_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			Key:                 key,
+			UpdateExpression:    aws.String("SET #holders = :holders, #version = :next, #capacity = :capacity"),
+			ConditionExpression: aws.String("attribute_not_exists(#version) or #version = :version"),
+			// capacity is a DynamoDB reserved word
+			ExpressionAttributeNames: map[string]string{
+				"#holders":  "holders",
+				"#version":  "version",
+				"#capacity": "capacity",
+			},
+			ExpressionAttributeValues: values,
+			TableName:                 aws.String(s.table),
+		})
+		var conditionFailed *dynamodbtypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			s.logger.Debug("Semaphore changed concurrently, retrying", "name", name)
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("writing semaphore %s : %w", name, err)
+		}
+		return true, nil
+	}
+}
+
+func decodeHolders(item map[string]dynamodbtypes.AttributeValue) (map[string]holder, int64, error) {
+	holders := map[string]holder{}
+	var version int64
+	if v, ok := item["version"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		parsed, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+		version = parsed
+	}
+	m, _ := item["holders"].(*dynamodbtypes.AttributeValueMemberM)
+	if m == nil {
+		return holders, version, nil
+	}
+	for id, av := range m.Value {
+		entry, ok := av.(*dynamodbtypes.AttributeValueMemberM)
+		if !ok {
+			return nil, 0, fmt.Errorf("holder %s is not a map", id)
+		}
+		permits, err := numberAttribute(entry.Value, "permits")
+		if err != nil {
+			return nil, 0, err
+		}
+		expireMs, err := numberAttribute(entry.Value, "expireMs")
+		if err != nil {
+			return nil, 0, err
+		}
+		holders[id] = holder{permits, expireMs}
+	}
+	return holders, version, nil
+}
+
+func encodeHolders(holders map[string]holder) dynamodbtypes.AttributeValue {
+	m := map[string]dynamodbtypes.AttributeValue{}
+	for id, h := range holders {
+		m[id] = &dynamodbtypes.AttributeValueMemberM{Value: map[string]dynamodbtypes.AttributeValue{
+			"permits":  &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(h.permits, 10)},
+			"expireMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(h.expireMs, 10)},
+		}}
+	}
+	return &dynamodbtypes.AttributeValueMemberM{Value: m}
+}
+
+func numberAttribute(item map[string]dynamodbtypes.AttributeValue, name string) (int64, error) {
+	n, ok := item[name].(*dynamodbtypes.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("attribute %s is missing or not a number", name)
+	}
+	return strconv.ParseInt(n.Value, 10, 64)
+}
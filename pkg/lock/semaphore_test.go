@@ -0,0 +1,152 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserveWeights(t *testing.T) {
+	holders := map[string]holder{
+		"big":     {4, 2000},
+		"expired": {5, 500},
+	}
+	assert.True(t, reserve(holders, "me", 6, 10, 3000, 1000), "expired permits should return to the pool")
+	assert.NotContains(t, holders, "expired", "expired holder should be dropped")
+	assert.Equal(t, holder{6, 3000}, holders["me"], "permits should be recorded")
+	assert.False(t, reserve(holders, "other", 1, 10, 3000, 1000), "capacity should not be exceeded")
+	assert.True(t, reserve(holders, "me", 0, 10, 4000, 1000), "reserving nothing should renew")
+	assert.Equal(t, holder{6, 4000}, holders["me"], "permits should accumulate")
+}
+
+func TestWeightedSemaphore(t *testing.T) {
+	name := uuid.New().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	awsConf, err := config.LoadDefaultConfig(ctx)
+	assert.Nil(t, err, "error should be nil")
+
+	a := NewSemaphore(dynamodb.NewFromConfig(awsConf), "locks", 10, time.Second*10)
+	b := NewSemaphore(dynamodb.NewFromConfig(awsConf), "locks", 10, time.Second*10)
+	ok, err := a.TryAcquire(ctx, name, 4)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "permits should be acquired")
+	ok, err = b.TryAcquire(ctx, name, 7)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "permits beyond capacity should not be acquired")
+	ok, err = b.TryAcquire(ctx, name, 6)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "remaining permits should be acquired")
+
+	assert.Nil(t, a.Release(ctx, name), "error should be nil")
+	ok, err = b.TryAcquire(ctx, name, 4)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "released permits should be available")
+	assert.Nil(t, b.Release(ctx, name), "error should be nil")
+}
+
+func TestSemaphoreRenewal(t *testing.T) {
+	ctx := context.Background()
+	client := NewMemoryClient()
+	client.DefineTable("locks", "LockID")
+	keyed := WithSemaphoreAttributeNames(AttributeNames{Key: "LockID"})
+	s := NewSemaphore(client, "locks", 2, time.Millisecond*100, keyed)
+	ok, err := s.TryAcquire(ctx, "pool", 1)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "permits should be acquired")
+	out, err := client.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("locks")})
+	assert.Nil(t, err, "error should be nil")
+	if assert.Len(t, out.Items, 1, "the semaphore should have one item") {
+		assert.Contains(t, out.Items[0], "LockID", "the item should use the configured key")
+	}
+
+	// A reservation taken away from under the holder stops its renewal
+	held, cancel := s.Context(ctx, "pool")
+	defer cancel()
+	_, err = s.update(ctx, "pool", func(holders map[string]holder, now int64) bool {
+		delete(holders, s.holderId)
+		return true
+	})
+	assert.Nil(t, err, "error should be nil")
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.renewers) == 0
+	}, time.Second, time.Millisecond*10, "renewal should stop once the reservation is gone")
+	<-held.Done()
+	assert.ErrorIs(t, context.Cause(held), ErrNotHeld, "the holder should be told the reservation is gone")
+	select {
+	case <-s.Done("pool"):
+	default:
+		t.Error("Done should be closed once the reservation is gone")
+	}
+
+	ok, err = s.TryAcquire(ctx, "pool", 2)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "permits should be acquired")
+	assert.Nil(t, s.Close(ctx), "error should be nil")
+	s.mu.Lock()
+	assert.Empty(t, s.renewers, "Close should stop renewals")
+	s.mu.Unlock()
+	other := NewSemaphore(client, "locks", 2, time.Second*10, keyed)
+	ok, err = other.TryAcquire(ctx, "pool", 2)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "Close should return the permits")
+
+	assert.Panics(t, func() { NewSemaphore(client, "locks", 1, 0) }, "a zero lease should be rejected")
+	assert.Panics(t, func() { NewSemaphore(client, "locks", 1, time.Nanosecond) }, "a lease too short to record should be rejected")
+}
+
+func TestSemaphoreRenewalRetries(t *testing.T) {
+	ctx := context.Background()
+	client := &outageClient{MemoryClient: NewMemoryClient()}
+	s := NewSemaphore(client, "locks", 2, time.Millisecond*200)
+	ok, err := s.TryAcquire(ctx, "pool", 1)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "permits should be acquired")
+	held, cancel := s.Context(ctx, "pool")
+	defer cancel()
+
+	// A renewal failing for less than a lease is retried
+	client.down.Store(true)
+	time.Sleep(time.Millisecond * 120)
+	client.down.Store(false)
+	time.Sleep(time.Millisecond * 200)
+	assert.Nil(t, held.Err(), "permits renewed in time should not be lost")
+
+	client.down.Store(true)
+	select {
+	case <-held.Done():
+	case <-time.After(time.Second * 2):
+		t.Fatal("lapsed permits should be reported")
+	}
+	var sendErr *smithyhttp.RequestSendError
+	assert.True(t, errors.As(context.Cause(held), &sendErr), "the cause should be the failed renewal")
+	s.mu.Lock()
+	assert.Empty(t, s.renewers, "renewal should stop once the lease lapsed")
+	s.mu.Unlock()
+}
+
+func TestSemaphoreWeights(t *testing.T) {
+	ctx := context.Background()
+	s := NewSemaphore(NewMemoryClient(), "locks", 2, time.Second*10)
+	for _, n := range []int{-1, 0, 3} {
+		ok, err := s.TryAcquire(ctx, "pool", n)
+		assert.ErrorIs(t, err, ErrSemaphoreWeight, "%d permits should be rejected", n)
+		assert.False(t, ok, "%d permits should not be acquired", n)
+		assert.ErrorIs(t, s.Acquire(ctx, "pool", n), ErrSemaphoreWeight, "%d permits should be rejected", n)
+	}
+	ok, err := s.TryAcquire(ctx, "pool", 2)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "the full capacity should be acquired")
+	assert.Nil(t, s.Close(ctx), "error should be nil")
+}
@@ -0,0 +1,119 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ReleaseOutcome is what happened to a held lock when its Locker shut down.
+type ReleaseOutcome string
+
+const (
+	// ReleaseSucceeded means the lock was released.
+	ReleaseSucceeded ReleaseOutcome = "released"
+	// ReleaseFailed means releasing the lock failed. If the error wraps
+	// ErrNotHeld the lock had already been lost; otherwise it may still be
+	// held until its lease lapses.
+	ReleaseFailed ReleaseOutcome = "failed"
+	// ReleaseSkipped means no release was attempted, because the Locker was
+	// already closed or the shutdown ran out of time. The lock stays held
+	// until its lease lapses.
+	ReleaseSkipped ReleaseOutcome = "skipped"
+)
+
+// LockRelease reports the outcome of releasing one lock on shutdown.
+type LockRelease struct {
+	Name    string
+	Outcome ReleaseOutcome
+	Err     error
+}
+
+// ShutdownReport lists every lock held when a Locker shut down and what
+// happened to it.
+type ShutdownReport struct {
+	Locks []LockRelease
+}
+
+// Clean reports whether no lock was left behind: every lock was either
+// released or had already been lost.
+func (r ShutdownReport) Clean() bool {
+	return len(r.LeftBehind()) == 0
+}
+
+// LeftBehind returns the locks that may still be held by the Locker, which
+// other Lockers can't acquire until their leases lapse unless they are
+// cleaned up by hand.
+func (r ShutdownReport) LeftBehind() []LockRelease {
+	var left []LockRelease
+	for _, lr := range r.Locks {
+		if lr.Outcome == ReleaseSucceeded || errors.Is(lr.Err, ErrNotHeld) {
+			continue
+		}
+		left = append(left, lr)
+	}
+	return left
+}
+
+// Err joins the errors of the locks that may still be held by the Locker, or
+// returns nil if the shutdown was clean.
+func (r ShutdownReport) Err() error {
+	var errs []error
+	for _, lr := range r.LeftBehind() {
+		errs = append(errs, lr.Err)
+	}
+	return errors.Join(errs...)
+}
+
+type shutdownRequest struct {
+	ctx    context.Context
+	report chan ShutdownReport
+}
+
+// Shutdown releases every held lock and closes the Locker, reporting the
+// outcome for each lock so deploy tooling can tell whether any were left
+// behind. Releases stop once ctx is done, and the locks not released by then
+// are reported as skipped. Close does the same, but only returns the errors.
+func (l *Locker) Shutdown(ctx context.Context) ShutdownReport {
+	if err := l.enter(); err != nil {
+		return skippedReport(l.heldNames(), err)
+	}
+	req := shutdownRequest{ctx, make(chan ShutdownReport, 1)}
+	if err := send(l, l.stopper, req); err != nil {
+		return skippedReport(l.heldNames(), err)
+	}
+	select {
+	case report := <-req.report:
+		return report
+	case <-ctx.Done():
+		// The heartbeater is stuck, most likely on a request to DynamoDB
+		l.adminLogger.Warn("Timed out releasing locks", "error", ctx.Err())
+		l.cancel()
+		return skippedReport(l.heldNames(), ctx.Err())
+	}
+}
+
+// releaseAll runs on the heartbeater.
+func (l *Locker) releaseAll(ctx context.Context) ShutdownReport {
+	var report ShutdownReport
+	for _, name := range l.heldNames() {
+		if err := ctx.Err(); err != nil {
+			report.Locks = append(report.Locks, LockRelease{name, ReleaseSkipped, fmt.Errorf("releasing lock %s : %w", name, err)})
+			continue
+		}
+		if err := l.release(ctx, name); err != nil {
+			report.Locks = append(report.Locks, LockRelease{name, ReleaseFailed, err})
+			continue
+		}
+		report.Locks = append(report.Locks, LockRelease{name, ReleaseSucceeded, nil})
+	}
+	return report
+}
+
+func skippedReport(names []string, err error) ShutdownReport {
+	var report ShutdownReport
+	for _, name := range names {
+		report.Locks = append(report.Locks, LockRelease{name, ReleaseSkipped, fmt.Errorf("releasing lock %s : %w", name, err)})
+	}
+	return report
+}
@@ -0,0 +1,105 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingDeletes is a MemoryClient whose deletes of one lock fail.
+type failingDeletes struct {
+	*MemoryClient
+	name string
+}
+
+func (c failingDeletes) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if params.Key["name"].(*dynamodbtypes.AttributeValueMemberS).Value == c.name {
+		return nil, errors.New("connection reset")
+	}
+	return c.MemoryClient.DeleteItem(ctx, params, optFns...)
+}
+
+func TestShutdownReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := failingDeletes{NewMemoryClient(), "stuck"}
+	n := NewLocker(client, ctx, "locks")
+	for _, name := range []string{"released", "lost", "stuck"} {
+		ok, err := n.AcquireLock(name, time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+	_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String("locks"),
+		Key:              map[string]dynamodbtypes.AttributeValue{"name": &dynamodbtypes.AttributeValueMemberS{Value: "lost"}},
+		UpdateExpression: aws.String("SET lockerId = :other"),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":other": &dynamodbtypes.AttributeValueMemberS{Value: "other"},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+
+	report := n.Shutdown(ctx)
+	assert.Len(t, report.Locks, 3, "every held lock should be reported")
+	outcomes := map[string]LockRelease{}
+	for _, lr := range report.Locks {
+		outcomes[lr.Name] = lr
+	}
+	assert.Equal(t, ReleaseSucceeded, outcomes["released"].Outcome, "free lock should be released")
+	assert.Equal(t, ReleaseFailed, outcomes["lost"].Outcome, "lost lock should fail to release")
+	assert.ErrorIs(t, outcomes["lost"].Err, ErrNotHeld, "lost lock should not be held")
+	assert.Equal(t, ReleaseFailed, outcomes["stuck"].Outcome, "failing delete should fail")
+	assert.False(t, report.Clean(), "a lock was left behind")
+	if left := report.LeftBehind(); assert.Len(t, left, 1, "only the failed delete needs cleanup") {
+		assert.Equal(t, "stuck", left[0].Name, "the failed delete needs cleanup")
+	}
+
+	_, err = n.AcquireLock("released", time.Second*10)
+	assert.ErrorIs(t, err, ErrClosed, "locker should be closed after shutdown")
+}
+
+func TestShutdownClosedLocker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := NewLocker(NewMemoryClient(), ctx, "locks")
+	ok, err := n.AcquireLock("held", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	n.cancel()
+
+	report := n.Shutdown(ctx)
+	assert.Len(t, report.Locks, 1, "held lock should be reported")
+	assert.Equal(t, ReleaseSkipped, report.Locks[0].Outcome, "closed locker should skip releases")
+	assert.ErrorIs(t, report.Locks[0].Err, ErrClosed, "skip should be explained")
+}
+
+func TestCloseReleasesLocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := failingDeletes{NewMemoryClient(), "stuck"}
+	n := NewLocker(client, ctx, "locks")
+	for _, name := range []string{"released", "stuck"} {
+		ok, err := n.AcquireLock(name, time.Second*10)
+		assert.Nil(t, err, "error should be nil")
+		assert.True(t, ok, "lock should be acquired")
+	}
+
+	err := n.Close(ctx)
+	assert.ErrorContains(t, err, "connection reset", "the failed release should be returned")
+	assert.ErrorContains(t, err, "stuck", "the error should name the lock left behind")
+	b := NewLocker(client, ctx, "locks")
+	ok, err := b.AcquireLock("released", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a lock released on close should be free")
+
+	assert.Nil(t, n.Close(ctx), "closing again should do nothing")
+	_, err = n.AcquireLock("released", time.Second*10)
+	assert.ErrorIs(t, err, ErrClosed, "locker should be closed")
+}
@@ -0,0 +1,51 @@
+package infra
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ReleaseOnSignal installs a handler that, when one of signals arrives
+// (SIGINT and SIGTERM by default), releases every held lock, waiting at most
+// deadline, and closes the Locker. The signal is then delivered again with the
+// handler removed, so the process terminates as it would have without it.
+// This keeps pod terminations from leaving locks held until they expire.
+// The returned function uninstalls the handler.
+func (l *Locker) ReleaseOnSignal(deadline time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	received := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(received, signals...)
+	go func() {
+		select {
+		case sig := <-received:
+			l.adminLogger.Info("Releasing locks on signal", "signal", sig)
+			report := l.shutdown(deadline)
+			for _, lr := range report.LeftBehind() {
+				l.adminLogger.Warn("Lock left behind on shutdown", "lockname", lr.Name, "outcome", lr.Outcome, "error", lr.Err)
+			}
+			signal.Stop(received)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(sig)
+			}
+		case <-done:
+			signal.Stop(received)
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// shutdown releases all held locks and closes the Locker, giving up waiting
+// after deadline.
+func (l *Locker) shutdown(deadline time.Duration) ShutdownReport {
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	return l.Shutdown(ctx)
+}
@@ -0,0 +1,21 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownClosesIdleLocker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := NewLocker(nil, ctx, "locks")
+	n.shutdown(time.Second)
+	_, err := n.AcquireLock(uuid.New().String(), time.Second*10)
+	assert.ErrorIs(t, err, ErrClosed, "locker should be closed after shutdown")
+}
@@ -0,0 +1,34 @@
+package infra
+
+import (
+	"time"
+)
+
+// WithClockSkewMargin allows for the clocks of hosts sharing a lock table
+// differing by up to margin. A lock is only taken over once its expiry is
+// more than margin behind this host's clock, and held locks are renewed as
+// though their leases ran out margin early, so a host whose clock is off by
+// less than margin neither steals a live lock nor has its own taken from it.
+// Leases should be longer than twice the margin. WouldAcquire and IsLocked
+// apply the margin too; so does the cooldown check, which then lasts up to
+// margin longer. Unlike WithRecordVersionLeases, every Locker keeps trusting
+// clocks, within the margin.
+func WithClockSkewMargin(margin time.Duration) Option {
+	return func(l *Locker) {
+		l.skewMargin = margin
+	}
+}
+
+// takeoverTime is the time expiries are compared with when deciding whether
+// a lease held by another Locker has lapsed.
+func (l *Locker) takeoverTime(now time.Time) time.Time {
+	return now.Add(-l.skewMargin)
+}
+
+// renewalLease is how much of a lease renewals are scheduled within.
+func (l *Locker) renewalLease(timeout time.Duration) time.Duration {
+	if l.skewMargin <= 0 || l.skewMargin >= timeout {
+		return timeout
+	}
+	return timeout - l.skewMargin
+}
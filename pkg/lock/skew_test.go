@@ -0,0 +1,53 @@
+package infra
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSkewMargin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	// By our clock the lease lapsed two seconds ago
+	expired := time.Now().Add(-2 * time.Second)
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":       &dynamodbtypes.AttributeValueMemberS{Value: "skewed"},
+			"lockerId":   &dynamodbtypes.AttributeValueMemberS{Value: "other"},
+			"ExpireAt":   &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.Unix(), 10)},
+			"ExpireAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.UnixMilli(), 10)},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(client, ctx, "locks", WithClockSkewMargin(5*time.Second))
+	ok, err := n.WouldAcquire(ctx, "skewed")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a lease lapsed within the margin should not be acquirable")
+	locked, err := n.IsLocked(ctx, "skewed")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, locked, "a lease lapsed within the margin should be reported as held")
+	ok, err = n.AcquireLock("skewed", 12*time.Second)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a lease lapsed within the margin should not be taken over")
+
+	b := NewLocker(client, ctx, "locks")
+	ok, err = b.AcquireLock("skewed", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "without a margin the lapsed lease should be taken over")
+
+	ok, err = n.AcquireLock("renewed", 12*time.Second)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+	assert.Eventually(t, func() bool { return time.Duration(n.interval.Load()) == 3500*time.Millisecond }, time.Second, 10*time.Millisecond,
+		"renewals should be scheduled within the lease less the margin")
+}
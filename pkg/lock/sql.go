@@ -0,0 +1,253 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlDialect holds the statements that differ between SQL databases.
+type sqlDialect struct {
+	// numbered placeholders are written $1, $2 rather than ?
+	numbered bool
+	// insertIgnore inserts a row unless one with its key exists
+	insertIgnore string
+	createTable  string
+}
+
+var postgresDialect = sqlDialect{
+	numbered:     true,
+	insertIgnore: "INSERT INTO %s (name, owner, trace, expires_at_ms, fencing_token) VALUES (?, '', '', 0, 0) ON CONFLICT (name) DO NOTHING",
+	createTable: `CREATE TABLE IF NOT EXISTS %s (
+	name TEXT PRIMARY KEY,
+	owner TEXT NOT NULL,
+	trace TEXT NOT NULL,
+	data BYTEA,
+	expires_at_ms BIGINT NOT NULL,
+	fencing_token BIGINT NOT NULL
+)`,
+}
+
+var mysqlDialect = sqlDialect{
+	insertIgnore: "INSERT IGNORE INTO %s (name, owner, trace, expires_at_ms, fencing_token) VALUES (?, '', '', 0, 0)",
+	createTable: `CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(255) PRIMARY KEY,
+	owner VARCHAR(255) NOT NULL,
+	trace VARCHAR(255) NOT NULL,
+	data LONGBLOB,
+	expires_at_ms BIGINT NOT NULL,
+	fencing_token BIGINT NOT NULL
+)`,
+}
+
+var sqliteDialect = sqlDialect{
+	insertIgnore: "INSERT OR IGNORE INTO %s (name, owner, trace, expires_at_ms, fencing_token) VALUES (?, '', '', 0, 0)",
+	createTable: `CREATE TABLE IF NOT EXISTS %s (
+	name TEXT PRIMARY KEY,
+	owner TEXT NOT NULL,
+	trace TEXT NOT NULL,
+	data BLOB,
+	expires_at_ms INTEGER NOT NULL,
+	fencing_token INTEGER NOT NULL
+)`,
+}
+
+// sqlQueries are a SQLBackend's statements, written for its dialect and table.
+type sqlQueries struct {
+	insert, acquire, acquireData, renew, release, get, list string
+}
+
+func newSQLQueries(d sqlDialect, table string) sqlQueries {
+	columns := "owner, trace, data, expires_at_ms, fencing_token"
+	acquire := "UPDATE %s SET owner = ?, trace = ?, expires_at_ms = ?, fencing_token = fencing_token + 1%s " +
+		"WHERE name = ? AND (owner = '' OR owner = ? OR expires_at_ms < ?)"
+	q := sqlQueries{
+		insert:      fmt.Sprintf(d.insertIgnore, table),
+		acquire:     fmt.Sprintf(acquire, table, ""),
+		acquireData: fmt.Sprintf(acquire, table, ", data = ?"),
+		renew:       fmt.Sprintf("UPDATE %s SET expires_at_ms = ? WHERE name = ? AND owner = ?", table),
+		release:     fmt.Sprintf("UPDATE %s SET owner = '', trace = '', expires_at_ms = 0 WHERE name = ? AND owner = ?", table),
+		get:         fmt.Sprintf("SELECT %s FROM %s WHERE name = ?", columns, table),
+		list:        fmt.Sprintf("SELECT name, %s FROM %s WHERE owner <> '' ORDER BY name", columns, table),
+	}
+	if d.numbered {
+		for _, query := range []*string{&q.insert, &q.acquire, &q.acquireData, &q.renew, &q.release, &q.get, &q.list} {
+			*query = numberPlaceholders(*query)
+		}
+	}
+	return q
+}
+
+// numberPlaceholders rewrites each ? in query as $1, $2 and so on.
+func numberPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// SQLBackend is a Backend storing locks as rows of a SQL table, one per lock
+// name, with every change a conditional UPDATE. A row outlives the locks
+// taken on it, keeping its fencing token counting up and its data for the
+// next holder. Expiry times come from the clocks of the processes holding
+// locks, as they do with DynamoDB.
+type SQLBackend struct {
+	db      *sql.DB
+	dialect sqlDialect
+	table   string
+	q       sqlQueries
+}
+
+var _ Backend = (*SQLBackend)(nil)
+
+// NewPostgresBackend returns a backend storing locks in the named PostgreSQL
+// table, which CreateTable can create. The table name is written into
+// statements as is, so it must not come from untrusted input.
+func NewPostgresBackend(db *sql.DB, table string) *SQLBackend {
+	return newSQLBackend(db, postgresDialect, table)
+}
+
+// NewMySQLBackend returns a backend storing locks in the named MySQL table,
+// which CreateTable can create. MySQL counts only the rows an UPDATE changes
+// unless the connection sets the CLIENT_FOUND_ROWS flag, so a renewal within
+// the millisecond of the last one would be reported as lost: open db with
+// clientFoundRows=true in the go-sql-driver/mysql DSN. The table name is
+// written into statements as is, so it must not come from untrusted input.
+func NewMySQLBackend(db *sql.DB, table string) *SQLBackend {
+	return newSQLBackend(db, mysqlDialect, table)
+}
+
+// NewSQLiteBackend returns a backend storing locks in the named table of a
+// SQLite database, which CreateTable can create. Pointing the processes of a
+// development machine or CI job at the same database file gives them real
+// leases, expiry and contention without a network service. SQLite lets one
+// connection write at a time, so open db with a busy timeout, such as
+// _pragma=busy_timeout(5000) with modernc.org/sqlite, for writers to wait
+// their turn rather than fail. The table name is written into statements as
+// is, so it must not come from untrusted input.
+func NewSQLiteBackend(db *sql.DB, table string) *SQLBackend {
+	return newSQLBackend(db, sqliteDialect, table)
+}
+
+func newSQLBackend(db *sql.DB, dialect sqlDialect, table string) *SQLBackend {
+	return &SQLBackend{db: db, dialect: dialect, table: table, q: newSQLQueries(dialect, table)}
+}
+
+// CreateTable creates the lock table if it doesn't exist.
+func (b *SQLBackend) CreateTable(ctx context.Context) error {
+	if _, err := b.db.ExecContext(ctx, fmt.Sprintf(b.dialect.createTable, b.table)); err != nil {
+		return fmt.Errorf("creating lock table %s : %w", b.table, err)
+	}
+	return nil
+}
+
+func (b *SQLBackend) AcquireItem(ctx context.Context, req LockInfo, lease time.Duration) (LockInfo, bool, error) {
+	if _, err := b.db.ExecContext(ctx, b.q.insert, req.Name); err != nil {
+		return LockInfo{}, false, fmt.Errorf("acquiring lock %s : %w", req.Name, err)
+	}
+	now := time.Now()
+	expiresAt := now.Add(lease)
+	query, args := b.q.acquire, []interface{}{req.LockerId, req.TraceId, expiresAt.UnixMilli()}
+	if req.Data != nil {
+		query, args = b.q.acquireData, append(args, req.Data)
+	}
+	res, err := b.db.ExecContext(ctx, query, append(args, req.Name, req.LockerId, now.UnixMilli())...)
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("acquiring lock %s : %w", req.Name, err)
+	}
+	if ok, err := affected(res); err != nil || !ok {
+		return LockInfo{}, false, err
+	}
+	item, _, err := b.GetItem(ctx, req.Name)
+	if err != nil {
+		return LockInfo{}, false, err
+	}
+	item.ExpiresAt = expiresAt
+	return item, true, nil
+}
+
+func (b *SQLBackend) RenewItem(ctx context.Context, name, owner string, lease time.Duration) (bool, error) {
+	res, err := b.db.ExecContext(ctx, b.q.renew, time.Now().Add(lease).UnixMilli(), name, owner)
+	if err != nil {
+		return false, fmt.Errorf("renewing lock %s : %w", name, err)
+	}
+	return affected(res)
+}
+
+func (b *SQLBackend) ReleaseItem(ctx context.Context, name, owner string) error {
+	res, err := b.db.ExecContext(ctx, b.q.release, name, owner)
+	if err != nil {
+		return fmt.Errorf("releasing lock %s : %w", name, err)
+	}
+	ok, err := affected(res)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	return nil
+}
+
+func (b *SQLBackend) GetItem(ctx context.Context, name string) (LockInfo, bool, error) {
+	info := LockInfo{Name: name}
+	err := scanLockRow(b.db.QueryRowContext(ctx, b.q.get, name), &info)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LockInfo{Name: name}, false, nil
+	}
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	return info, info.LockerId != "", nil
+}
+
+func (b *SQLBackend) ListItems(ctx context.Context) ([]LockInfo, error) {
+	rows, err := b.db.QueryContext(ctx, b.q.list)
+	if err != nil {
+		return nil, fmt.Errorf("listing locks : %w", err)
+	}
+	defer rows.Close()
+	var infos []LockInfo
+	for rows.Next() {
+		var info LockInfo
+		if err := scanLockRow(rows, &info, &info.Name); err != nil {
+			return nil, fmt.Errorf("listing locks : %w", err)
+		}
+		infos = append(infos, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing locks : %w", err)
+	}
+	return infos, nil
+}
+
+// scanLockRow scans the lock columns selected by a SQLBackend into info,
+// after any leading columns.
+func scanLockRow(row interface{ Scan(...interface{}) error }, info *LockInfo, leading ...interface{}) error {
+	var expiresAtMs int64
+	if err := row.Scan(append(leading, &info.LockerId, &info.TraceId, &info.Data, &expiresAtMs, &info.FencingToken)...); err != nil {
+		return err
+	}
+	info.ExpiresAt = time.UnixMilli(expiresAtMs)
+	return nil
+}
+
+// affected reports whether a conditional UPDATE matched its row.
+func affected(res sql.Result) (bool, error) {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("reading rows affected : %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,232 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQL is a database/sql driver running SQLBackend's statements against
+// in-memory rows, so the backend can be tested without a database server.
+type fakeSQL struct {
+	mu   sync.Mutex
+	q    sqlQueries
+	rows map[string][]driver.Value
+}
+
+var (
+	fakeSQLDatabases sync.Map
+	registerFakeSQL  sync.Once
+)
+
+// openFakeSQL returns a database whose statements are run by a fakeSQL
+// expecting the queries of the given dialect.
+func openFakeSQL(t *testing.T, dialect sqlDialect, table string) *sql.DB {
+	registerFakeSQL.Do(func() { sql.Register("fakesql", fakeSQLDriver{}) })
+	fakeSQLDatabases.Store(t.Name(), &fakeSQL{q: newSQLQueries(dialect, table), rows: map[string][]driver.Value{}})
+	db, err := sql.Open("fakesql", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeSQLDriver struct{}
+
+func (fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	db, ok := fakeSQLDatabases.Load(name)
+	if !ok {
+		return nil, errors.New("unknown database")
+	}
+	return fakeSQLConn{db.(*fakeSQL)}, nil
+}
+
+type fakeSQLConn struct{ db *fakeSQL }
+
+func (c fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeSQLStmt{c.db, query}, nil
+}
+
+func (c fakeSQLConn) Close() error { return nil }
+
+func (c fakeSQLConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type fakeSQLStmt struct {
+	db    *fakeSQL
+	query string
+}
+
+func (s fakeSQLStmt) Close() error  { return nil }
+func (s fakeSQLStmt) NumInput() int { return -1 }
+
+// Rows hold the owner, trace, data, expires_at_ms and fencing_token columns.
+func (s fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch s.query {
+	case db.q.insert:
+		if _, ok := db.rows[args[0].(string)]; !ok {
+			db.rows[args[0].(string)] = []driver.Value{"", "", nil, int64(0), int64(0)}
+		}
+		return driver.RowsAffected(1), nil
+	case db.q.acquire, db.q.acquireData:
+		n := len(args)
+		row, ok := db.rows[args[n-3].(string)]
+		if !ok || row[0] != "" && row[0] != args[n-2] && row[3].(int64) >= args[n-1].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		row[0], row[1], row[3], row[4] = args[0], args[1], args[2], row[4].(int64)+1
+		if s.query == db.q.acquireData {
+			row[2] = args[3]
+		}
+		return driver.RowsAffected(1), nil
+	case db.q.renew:
+		row, ok := db.rows[args[1].(string)]
+		if !ok || row[0] != args[2] {
+			return driver.RowsAffected(0), nil
+		}
+		row[3] = args[0]
+		return driver.RowsAffected(1), nil
+	case db.q.release:
+		row, ok := db.rows[args[0].(string)]
+		if !ok || row[0] != args[1] {
+			return driver.RowsAffected(0), nil
+		}
+		row[0], row[1], row[3] = "", "", int64(0)
+		return driver.RowsAffected(1), nil
+	}
+	if strings.HasPrefix(s.query, "CREATE TABLE") {
+		return driver.RowsAffected(0), nil
+	}
+	return nil, errors.New("unexpected statement " + s.query)
+}
+
+func (s fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	rows := &fakeSQLRows{}
+	switch s.query {
+	case db.q.get:
+		if row, ok := db.rows[args[0].(string)]; ok {
+			rows.values = append(rows.values, append([]driver.Value{}, row...))
+		}
+	case db.q.list:
+		for name, row := range db.rows {
+			if row[0] != "" {
+				rows.values = append(rows.values, append([]driver.Value{name}, row...))
+			}
+		}
+		sort.Slice(rows.values, func(i, j int) bool { return rows.values[i][0].(string) < rows.values[j][0].(string) })
+	default:
+		return nil, errors.New("unexpected query " + s.query)
+	}
+	return rows, nil
+}
+
+type fakeSQLRows struct{ values [][]driver.Value }
+
+func (r *fakeSQLRows) Columns() []string {
+	columns := []string{"owner", "trace", "data", "expires_at_ms", "fencing_token"}
+	if len(r.values) > 0 && len(r.values[0]) > len(columns) {
+		return append([]string{"name"}, columns...)
+	}
+	return columns
+}
+
+func (r *fakeSQLRows) Close() error { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSQLBackend(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		backend := NewPostgresBackend(openFakeSQL(t, postgresDialect, "locks"), "locks")
+		assert.Contains(t, backend.q.acquire, "$6", "Postgres placeholders should be numbered")
+		testSQLBackend(t, backend)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		backend := NewSQLiteBackend(openFakeSQL(t, sqliteDialect, "locks"), "locks")
+		assert.True(t, strings.HasPrefix(backend.q.insert, "INSERT OR IGNORE"), "SQLite should ignore existing rows")
+		testSQLBackend(t, backend)
+	})
+}
+
+func testSQLBackend(t *testing.T, backend *SQLBackend) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Nil(t, backend.CreateTable(ctx), "error should be nil")
+	n := NewBackendLocker(backend, ctx)
+	b := NewBackendLocker(backend, ctx)
+
+	h, err := n.Acquire(ctx, "x", time.Second*10, WithTraceID("trace-1"), WithData([]byte("payload")))
+	assert.Nil(t, err, "error should be nil")
+	if !assert.NotNil(t, h, "lock should be acquired") {
+		return
+	}
+	token := h.FencingToken()
+	ok, err := b.AcquireLock("x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "held lock should not be acquired")
+
+	info, found, err := b.GetLockInfo(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock row should be found")
+	assert.Equal(t, n.ID(), info.LockerId, "the holder should be reported")
+	assert.Equal(t, "trace-1", info.TraceId, "the trace should be stored")
+	assert.Equal(t, []byte("payload"), info.Data, "the data should be stored")
+	assert.Equal(t, token, info.FencingToken, "the fencing token should be reported")
+	held, err := b.LocksHeldBy(ctx, n.ID())
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, held, 1, "locks should be listed by holder")
+
+	ok, err = backend.RenewItem(ctx, "x", b.ID(), time.Second)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "only the owner should renew")
+	assert.ErrorIs(t, backend.ReleaseItem(ctx, "x", b.ID()), ErrNotHeld, "only the owner should release")
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	locked, err := b.IsLocked(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, locked, "released lock should be free")
+
+	bh, err := b.Acquire(ctx, "x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	if assert.NotNil(t, bh, "released lock should be acquired") {
+		assert.Greater(t, bh.FencingToken(), token, "fencing tokens should grow across holders")
+		data, err := b.Data("x")
+		assert.Nil(t, err, "error should be nil")
+		assert.Equal(t, []byte("payload"), data, "data should outlive the holder")
+	}
+}
+
+func TestSQLBackendLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMySQLBackend(openFakeSQL(t, mysqlDialect, "locks"), "locks")
+	assert.True(t, strings.HasPrefix(backend.q.insert, "INSERT IGNORE"), "MySQL should ignore existing rows")
+	assert.NotContains(t, backend.q.acquire, "$", "MySQL placeholders should not be numbered")
+	_, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "a"}, time.Millisecond*20)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "free lock should be acquired")
+	_, ok, _ = backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "b"}, time.Second)
+	assert.False(t, ok, "held lock should not be acquired")
+	time.Sleep(time.Millisecond * 30)
+	_, ok, _ = backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "b"}, time.Second)
+	assert.True(t, ok, "lock should be acquired once its lease lapses")
+}
@@ -0,0 +1,158 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	defaultSweepInterval = 10 * time.Minute
+	defaultSweepRate     = 25
+	sweepPageSize        = 100
+)
+
+// sweepCondition deletes a lock item only if it is still held by the owner
+// it was listed with and its lease lapsed before the cutoff, so a lock taken
+// over or renewed in the meantime is never deleted. Items carrying a payload
+// are kept for the next holder.
+const sweepCondition = "#owner = :owner and #expiry < :cutoff" +
+	" and (attribute_not_exists(ExpireAtMs) or ExpireAtMs < :cutoffMs) and attribute_not_exists(#data)"
+
+// Sweeper deletes lock items whose lease lapsed long ago, left behind by
+// processes that died holding them, so that tables without TTL don't grow
+// without bound. Enabling TTL is cheaper where possible; see EnableTTL.
+type Sweeper struct {
+	locker   *Locker
+	grace    time.Duration
+	interval time.Duration
+	rate     int
+}
+
+// SweeperOption configures a Sweeper.
+type SweeperOption func(*Sweeper)
+
+// WithSweepInterval sets how long Run waits between sweeps. The default is
+// ten minutes.
+func WithSweepInterval(d time.Duration) SweeperOption {
+	return func(s *Sweeper) {
+		s.interval = d
+	}
+}
+
+// WithSweepRate limits a sweep to perSecond deletions a second, so it
+// doesn't compete with lock traffic for the table's capacity. The default is
+// 25; 0 removes the limit.
+func WithSweepRate(perSecond int) SweeperOption {
+	return func(s *Sweeper) {
+		s.rate = perSecond
+	}
+}
+
+// NewSweeper returns a Sweeper deleting items from the locker's table whose
+// lease lapsed more than grace ago. Grace should comfortably exceed the
+// longest pause a holder could recover from.
+func NewSweeper(locker *Locker, grace time.Duration, opts ...SweeperOption) *Sweeper {
+	s := &Sweeper{locker: locker, grace: grace, interval: defaultSweepInterval, rate: defaultSweepRate}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run sweeps the table every interval until ctx is done, logging errors and
+// trying again on the next sweep. It returns ctx.Err().
+func (s *Sweeper) Run(ctx context.Context) error {
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			s.locker.adminLogger.Warn("Sweeping expired locks failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+// Sweep makes one pass over the table, deleting lock items whose lease
+// lapsed more than grace ago, and returns how many it deleted. It scans the
+// table with ListLocks, so the Locker's client must implement Scanner.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	l := s.locker
+	if err := l.dynamoOnly("sweeping expired locks"); err != nil {
+		return 0, err
+	}
+	var pace <-chan time.Time
+	if s.rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(s.rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	cutoff := time.Now().Add(-s.grace)
+	deleted := 0
+	opts := ListOptions{ExpiredOnly: true, Limit: sweepPageSize}
+	for {
+		page, err := l.ListLocks(ctx, opts)
+		if err != nil {
+			return deleted, fmt.Errorf("sweeping expired locks : %w", err)
+		}
+		for _, info := range page.Locks {
+			if !info.ExpiresAt.Before(cutoff) || info.Data != nil {
+				continue
+			}
+			if pace != nil {
+				select {
+				case <-ctx.Done():
+					return deleted, ctx.Err()
+				case <-pace:
+				}
+			}
+			ok, err := s.delete(ctx, info, cutoff)
+			if err != nil {
+				return deleted, err
+			}
+			if ok {
+				deleted++
+			}
+		}
+		if page.Cursor == "" {
+			break
+		}
+		opts.Cursor = page.Cursor
+	}
+	if deleted > 0 {
+		l.adminLogger.Info("Swept expired locks", "deleted", deleted)
+	}
+	return deleted, nil
+}
+
+// delete removes a lapsed lock item, reporting false if it had changed
+// since it was listed.
+func (s *Sweeper) delete(ctx context.Context, info LockInfo, cutoff time.Time) (bool, error) {
+	l := s.locker
+	_, err := l.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		Key:                      l.attrs.key(info.Name),
+		ConditionExpression:      aws.String(sweepCondition),
+		ExpressionAttributeNames: l.attrs.expressionNames(map[string]string{"#data": dataAttribute}, sweepCondition),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":owner":    &dynamodbtypes.AttributeValueMemberS{Value: info.LockerId},
+			":cutoff":   &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(cutoff.Unix(), 10)},
+			":cutoffMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(cutoff.UnixMilli(), 10)},
+		},
+		TableName: aws.String(l.lockTable),
+	}, l.requestOptions)
+	if isConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("deleting expired lock %s : %w", info.Name, err)
+	}
+	l.adminLogger.Debug("Deleted expired lock", "lockname", info.Name, "locker", info.LockerId)
+	return true, nil
+}
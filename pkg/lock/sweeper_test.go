@@ -0,0 +1,61 @@
+package infra
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSweeper(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock("live", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	put := func(name string, expired time.Time, extra map[string]dynamodbtypes.AttributeValue) {
+		item := map[string]dynamodbtypes.AttributeValue{
+			"name":       &dynamodbtypes.AttributeValueMemberS{Value: name},
+			"lockerId":   &dynamodbtypes.AttributeValueMemberS{Value: "dead"},
+			"ExpireAt":   &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.Unix(), 10)},
+			"ExpireAtMs": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.UnixMilli(), 10)},
+		}
+		for k, v := range extra {
+			item[k] = v
+		}
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("locks"), Item: item})
+		assert.Nil(t, err, "error should be nil")
+	}
+	for i := 0; i < 5; i++ {
+		put("abandoned-"+strconv.Itoa(i), time.Now().Add(-time.Hour*2), nil)
+	}
+	put("recent", time.Now().Add(-time.Minute), nil)
+	put("payload", time.Now().Add(-time.Hour*2), map[string]dynamodbtypes.AttributeValue{
+		dataAttribute: &dynamodbtypes.AttributeValueMemberB{Value: []byte("cursor=42")},
+	})
+
+	s := NewSweeper(n, time.Hour, WithSweepRate(1000))
+	deleted, err := s.Sweep(ctx)
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, 5, deleted, "only locks that lapsed before the grace period should be deleted")
+
+	page, err := n.ListLocks(ctx, ListOptions{})
+	assert.Nil(t, err, "error should be nil")
+	var names []string
+	for _, info := range page.Locks {
+		names = append(names, info.Name)
+	}
+	assert.ElementsMatch(t, []string{"live", "recent", "payload"}, names, "live, recent and payload locks should be kept")
+
+	deleted, err = s.Sweep(ctx)
+	assert.Nil(t, err, "error should be nil")
+	assert.Zero(t, deleted, "a second sweep should find nothing")
+}
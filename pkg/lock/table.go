@@ -0,0 +1,403 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// HolderIndex is the global secondary index on the owner attribute, lockerId
+// unless set with WithTableAttributes, used to find the locks held by a given
+// Locker.
+const HolderIndex = "lockerId-index"
+
+// ExpiryIndex is the global secondary index on lease expiry used to find
+// expired locks without scanning the table. Its partition key is
+// expiryShard, which spreads lock items over expiryShards partitions, and its
+// sort key is ExpireAtMs.
+const ExpiryIndex = "expiry-index"
+
+// tableWaitTimeout bounds how long EnsureLockTable waits for the table and
+// its indexes to become ACTIVE.
+const tableWaitTimeout = 5 * time.Minute
+
+type tableOptions struct {
+	holderIndex bool
+	expiryIndex bool
+	ttl         bool
+	sse         *dynamodbtypes.SSESpecification
+	tags        map[string]string
+	attrs       AttributeNames
+}
+
+// TableOption configures EnsureLockTable.
+type TableOption func(*tableOptions)
+
+// WithoutHolderIndex skips provisioning HolderIndex, which LocksHeldBy needs.
+func WithoutHolderIndex() TableOption {
+	return func(o *tableOptions) {
+		o.holderIndex = false
+	}
+}
+
+// WithoutExpiryIndex skips provisioning ExpiryIndex, which ExpiredLocks needs.
+func WithoutExpiryIndex() TableOption {
+	return func(o *tableOptions) {
+		o.expiryIndex = false
+	}
+}
+
+// WithTableAttributes lays the table out for Lockers created with
+// WithAttributeNames(names): names.Key is the partition key, HolderIndex is
+// on names.Owner and TTL is on names.Expiry.
+func WithTableAttributes(names AttributeNames) TableOption {
+	return func(o *tableOptions) {
+		o.attrs = names.withDefaults()
+	}
+}
+
+// TableClient is the part of the DynamoDB control plane API that
+// EnsureLockTable uses. *dynamodb.Client implements it.
+type TableClient interface {
+	TableDescriber
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error)
+	TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error)
+}
+
+var _ TableClient = (*dynamodb.Client)(nil)
+
+// WithoutTTL leaves TTL on the table as it is. By default EnsureLockTable
+// enables it on ExpireAt, so DynamoDB deletes lock items abandoned by
+// crashed processes.
+func WithoutTTL() TableOption {
+	return func(o *tableOptions) {
+		o.ttl = false
+	}
+}
+
+// WithTableEncryption encrypts the table with the KMS key kmsKeyId, or the
+// AWS managed key for DynamoDB if it is empty, rather than the AWS owned key
+// DynamoDB uses by default. It is applied to existing tables too.
+func WithTableEncryption(kmsKeyId string) TableOption {
+	return func(o *tableOptions) {
+		o.sse = &dynamodbtypes.SSESpecification{Enabled: aws.Bool(true), SSEType: dynamodbtypes.SSETypeKms}
+		if kmsKeyId != "" {
+			o.sse.KMSMasterKeyId = aws.String(kmsKeyId)
+		}
+	}
+}
+
+// WithTableTags tags the table with tags, for cost allocation and access
+// policies. Tags missing from an existing table, or set to another value, are
+// applied too; other tags on it are left alone.
+func WithTableTags(tags map[string]string) TableOption {
+	return func(o *tableOptions) {
+		if o.tags == nil {
+			o.tags = map[string]string{}
+		}
+		for key, value := range tags {
+			o.tags[key] = value
+		}
+	}
+}
+
+// EnsureLockTable creates the lock table if it doesn't exist, with the key
+// schema the Locker expects, on-demand billing and TTL on ExpireAt, and adds
+// any missing indexes, TTL, encryption settings and tags to an existing table. It
+// waits for the table and indexes to become ACTIVE.
+func EnsureLockTable(ctx context.Context, client TableClient, name string, opts ...TableOption) error {
+	o := tableOptions{holderIndex: true, expiryIndex: true, ttl: true, attrs: defaultAttributeNames}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+	var notFound *dynamodbtypes.ResourceNotFoundException
+	switch {
+	case errors.As(err, &notFound):
+		if err := createLockTable(ctx, client, name, o); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("describing lock table %s : %w", name, err)
+	default:
+		// DynamoDB allows only one index to be created per UpdateTable
+		if o.holderIndex && !hasIndex(described.Table, HolderIndex) {
+			if err := addIndex(ctx, client, name, holderIndex(o.attrs.Owner)); err != nil {
+				return err
+			}
+		}
+		if o.expiryIndex && !hasIndex(described.Table, ExpiryIndex) {
+			if err := waitForTable(ctx, client, name); err != nil {
+				return err
+			}
+			if err := addIndex(ctx, client, name, expiryIndex()); err != nil {
+				return err
+			}
+		}
+		if o.sse != nil && !encrypted(described.Table, o.sse) {
+			if err := waitForTable(ctx, client, name); err != nil {
+				return err
+			}
+			if _, err := client.UpdateTable(ctx, &dynamodb.UpdateTableInput{TableName: aws.String(name), SSESpecification: o.sse}); err != nil {
+				return fmt.Errorf("encrypting lock table %s : %w", name, err)
+			}
+		}
+		if len(o.tags) > 0 {
+			if err := tagTable(ctx, client, name, aws.ToString(described.Table.TableArn), o.tags); err != nil {
+				return err
+			}
+		}
+	}
+	if err := waitForTable(ctx, client, name); err != nil {
+		return err
+	}
+	if o.ttl {
+		return enableTTL(ctx, client, name, o.attrs.Expiry)
+	}
+	return nil
+}
+
+// encrypted reports whether the table is already encrypted as sse asks.
+// DescribeTable reports the key's ARN, so a key given by alias is taken to
+// match any customer managed key.
+func encrypted(table *dynamodbtypes.TableDescription, sse *dynamodbtypes.SSESpecification) bool {
+	d := table.SSEDescription
+	if d == nil || d.Status != dynamodbtypes.SSEStatusEnabled || d.SSEType != dynamodbtypes.SSETypeKms {
+		return false
+	}
+	key, arn := aws.ToString(sse.KMSMasterKeyId), aws.ToString(d.KMSMasterKeyArn)
+	return key == "" || strings.HasPrefix(key, "alias/") || key == arn || strings.HasSuffix(arn, "/"+key)
+}
+
+// tagTable applies the tags an existing table is missing. Tagging doesn't
+// change the table's status, so it needn't wait for the table.
+func tagTable(ctx context.Context, client TableClient, name, arn string, tags map[string]string) error {
+	current := map[string]string{}
+	input := &dynamodb.ListTagsOfResourceInput{ResourceArn: aws.String(arn)}
+	for {
+		out, err := client.ListTagsOfResource(ctx, input)
+		if err != nil {
+			return fmt.Errorf("listing tags of lock table %s : %w", name, err)
+		}
+		for _, tag := range out.Tags {
+			current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+	var missing []dynamodbtypes.Tag
+	for _, tag := range tableTags(tags) {
+		if value, ok := current[aws.ToString(tag.Key)]; !ok || value != aws.ToString(tag.Value) {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if _, err := client.TagResource(ctx, &dynamodb.TagResourceInput{ResourceArn: aws.String(arn), Tags: missing}); err != nil {
+		return fmt.Errorf("tagging lock table %s : %w", name, err)
+	}
+	return nil
+}
+
+// tableTags returns tags sorted by key, so requests are repeatable.
+func tableTags(tags map[string]string) []dynamodbtypes.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var out []dynamodbtypes.Tag
+	for _, key := range keys {
+		out = append(out, dynamodbtypes.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return out
+}
+
+// EnableTTL enables TTL on the expiry attribute of an existing lock table,
+// ExpireAt unless set with WithTableAttributes, for tables that aren't
+// managed with EnsureLockTable. Every lock item carries its lease expiry there
+// in epoch seconds, so DynamoDB deletes the items of locks abandoned by
+// crashed processes. Items kept on release for their payload have no expiry
+// and are kept. It fails if TTL is already enabled on another attribute.
+func EnableTTL(ctx context.Context, client TableClient, name string, opts ...TableOption) error {
+	o := tableOptions{attrs: defaultAttributeNames}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return enableTTL(ctx, client, name, o.attrs.Expiry)
+}
+
+// enableTTL enables TTL on attribute, which holds lease expiry in epoch
+// seconds, unless it already is. TTL can only be on one attribute, so TTL on
+// another one is an error.
+func enableTTL(ctx context.Context, client TableClient, name, attribute string) error {
+	out, err := client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(name)})
+	if err != nil {
+		return fmt.Errorf("describing TTL of lock table %s : %w", name, err)
+	}
+	if ttl := out.TimeToLiveDescription; ttl != nil {
+		switch ttl.TimeToLiveStatus {
+		case dynamodbtypes.TimeToLiveStatusEnabled, dynamodbtypes.TimeToLiveStatusEnabling:
+			if enabled := aws.ToString(ttl.AttributeName); enabled != attribute {
+				return fmt.Errorf("lock table %s has TTL on %s rather than %s", name, enabled, attribute)
+			}
+			return nil
+		}
+	}
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(name),
+		TimeToLiveSpecification: &dynamodbtypes.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("enabling TTL on lock table %s : %w", name, err)
+	}
+	return nil
+}
+
+func createLockTable(ctx context.Context, client TableClient, name string, o tableOptions) error {
+	input := &dynamodb.CreateTableInput{
+		TableName: aws.String(name),
+		AttributeDefinitions: []dynamodbtypes.AttributeDefinition{
+			{AttributeName: aws.String(o.attrs.Key), AttributeType: dynamodbtypes.ScalarAttributeTypeS},
+		},
+		KeySchema: []dynamodbtypes.KeySchemaElement{
+			{AttributeName: aws.String(o.attrs.Key), KeyType: dynamodbtypes.KeyTypeHash},
+		},
+		BillingMode:      dynamodbtypes.BillingModePayPerRequest,
+		SSESpecification: o.sse,
+		Tags:             tableTags(o.tags),
+	}
+	var indexes []indexDefinition
+	if o.holderIndex {
+		indexes = append(indexes, holderIndex(o.attrs.Owner))
+	}
+	if o.expiryIndex {
+		indexes = append(indexes, expiryIndex())
+	}
+	for _, index := range indexes {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, index.attributes...)
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, index.index)
+	}
+	if _, err := client.CreateTable(ctx, input); err != nil {
+		var inUse *dynamodbtypes.ResourceInUseException
+		if errors.As(err, &inUse) {
+			return nil // Created concurrently
+		}
+		return fmt.Errorf("creating lock table %s : %w", name, err)
+	}
+	return nil
+}
+
+type indexDefinition struct {
+	attributes []dynamodbtypes.AttributeDefinition
+	index      dynamodbtypes.GlobalSecondaryIndex
+}
+
+func holderIndex(owner string) indexDefinition {
+	return indexDefinition{
+		attributes: []dynamodbtypes.AttributeDefinition{
+			{AttributeName: aws.String(owner), AttributeType: dynamodbtypes.ScalarAttributeTypeS},
+		},
+		index: dynamodbtypes.GlobalSecondaryIndex{
+			IndexName: aws.String(HolderIndex),
+			KeySchema: []dynamodbtypes.KeySchemaElement{
+				{AttributeName: aws.String(owner), KeyType: dynamodbtypes.KeyTypeHash},
+			},
+			Projection: &dynamodbtypes.Projection{ProjectionType: dynamodbtypes.ProjectionTypeAll},
+		},
+	}
+}
+
+func expiryIndex() indexDefinition {
+	return indexDefinition{
+		attributes: []dynamodbtypes.AttributeDefinition{
+			{AttributeName: aws.String("expiryShard"), AttributeType: dynamodbtypes.ScalarAttributeTypeS},
+			{AttributeName: aws.String("ExpireAtMs"), AttributeType: dynamodbtypes.ScalarAttributeTypeN},
+		},
+		index: dynamodbtypes.GlobalSecondaryIndex{
+			IndexName: aws.String(ExpiryIndex),
+			KeySchema: []dynamodbtypes.KeySchemaElement{
+				{AttributeName: aws.String("expiryShard"), KeyType: dynamodbtypes.KeyTypeHash},
+				{AttributeName: aws.String("ExpireAtMs"), KeyType: dynamodbtypes.KeyTypeRange},
+			},
+			Projection: &dynamodbtypes.Projection{ProjectionType: dynamodbtypes.ProjectionTypeAll},
+		},
+	}
+}
+
+func hasIndex(table *dynamodbtypes.TableDescription, name string) bool {
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func addIndex(ctx context.Context, client TableClient, table string, def indexDefinition) error {
+	_, err := client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:            aws.String(table),
+		AttributeDefinitions: def.attributes,
+		GlobalSecondaryIndexUpdates: []dynamodbtypes.GlobalSecondaryIndexUpdate{{
+			Create: &dynamodbtypes.CreateGlobalSecondaryIndexAction{
+				IndexName:  def.index.IndexName,
+				KeySchema:  def.index.KeySchema,
+				Projection: def.index.Projection,
+			},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("adding index %s to lock table %s : %w", aws.ToString(def.index.IndexName), table, err)
+	}
+	return nil
+}
+
+// waitForTable waits until the table and all of its indexes are ACTIVE.
+func waitForTable(ctx context.Context, client TableClient, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, tableWaitTimeout)
+	defer cancel()
+	for {
+		described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+		if err != nil && !errors.As(err, new(*dynamodbtypes.ResourceNotFoundException)) {
+			return fmt.Errorf("waiting for lock table %s : %w", name, err)
+		}
+		if err == nil && tableActive(described.Table) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for lock table %s : %w", name, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func tableActive(table *dynamodbtypes.TableDescription) bool {
+	if table.TableStatus != dynamodbtypes.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if index.IndexStatus != dynamodbtypes.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
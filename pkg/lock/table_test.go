@@ -0,0 +1,170 @@
+package infra
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTables is a TableClient whose tables become ACTIVE as soon as they
+// are created or updated.
+type fakeTables struct {
+	mu     sync.Mutex
+	tables map[string]*dynamodbtypes.TableDescription
+	ttl    map[string]*dynamodbtypes.TimeToLiveDescription
+	tags   map[string]map[string]string
+}
+
+func (f *fakeTables) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table, ok := f.tables[aws.ToString(params.TableName)]
+	if !ok {
+		return nil, &dynamodbtypes.ResourceNotFoundException{}
+	}
+	return &dynamodb.DescribeTableOutput{Table: table}, nil
+}
+
+func (f *fakeTables) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := &dynamodbtypes.TableDescription{TableName: params.TableName, TableStatus: dynamodbtypes.TableStatusActive,
+		TableArn:  aws.String("arn:aws:dynamodb:us-east-1:123456789012:table/" + aws.ToString(params.TableName)),
+		KeySchema: params.KeySchema, BillingModeSummary: &dynamodbtypes.BillingModeSummary{BillingMode: params.BillingMode}}
+	for _, index := range params.GlobalSecondaryIndexes {
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, dynamodbtypes.GlobalSecondaryIndexDescription{
+			IndexName: index.IndexName, KeySchema: index.KeySchema, IndexStatus: dynamodbtypes.IndexStatusActive})
+	}
+	if params.SSESpecification != nil {
+		table.SSEDescription = &dynamodbtypes.SSEDescription{Status: dynamodbtypes.SSEStatusEnabled, SSEType: params.SSESpecification.SSEType}
+	}
+	f.tables[aws.ToString(params.TableName)] = table
+	f.tag(aws.ToString(table.TableArn), params.Tags)
+	return &dynamodb.CreateTableOutput{TableDescription: table}, nil
+}
+
+func (f *fakeTables) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := f.tables[aws.ToString(params.TableName)]
+	for _, update := range params.GlobalSecondaryIndexUpdates {
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, dynamodbtypes.GlobalSecondaryIndexDescription{
+			IndexName: update.Create.IndexName, IndexStatus: dynamodbtypes.IndexStatusActive})
+	}
+	if params.SSESpecification != nil {
+		table.SSEDescription = &dynamodbtypes.SSEDescription{Status: dynamodbtypes.SSEStatusEnabled, SSEType: params.SSESpecification.SSEType,
+			KMSMasterKeyArn: aws.String("arn:aws:kms:us-east-1:123456789012:key/" + aws.ToString(params.SSESpecification.KMSMasterKeyId))}
+	}
+	return &dynamodb.UpdateTableOutput{TableDescription: table}, nil
+}
+
+func (f *fakeTables) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: f.ttl[aws.ToString(params.TableName)]}, nil
+}
+
+func (f *fakeTables) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ttl[aws.ToString(params.TableName)] = &dynamodbtypes.TimeToLiveDescription{
+		AttributeName: params.TimeToLiveSpecification.AttributeName, TimeToLiveStatus: dynamodbtypes.TimeToLiveStatusEnabling}
+	return &dynamodb.UpdateTimeToLiveOutput{}, nil
+}
+
+func (f *fakeTables) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.ListTagsOfResourceOutput{}
+	for key, value := range f.tags[aws.ToString(params.ResourceArn)] {
+		out.Tags = append(out.Tags, dynamodbtypes.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return out, nil
+}
+
+func (f *fakeTables) TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tag(aws.ToString(params.ResourceArn), params.Tags)
+	return &dynamodb.TagResourceOutput{}, nil
+}
+
+func (f *fakeTables) tag(arn string, tags []dynamodbtypes.Tag) {
+	if f.tags == nil {
+		f.tags = map[string]map[string]string{}
+	}
+	if f.tags[arn] == nil {
+		f.tags[arn] = map[string]string{}
+	}
+	for _, tag := range tags {
+		f.tags[arn][aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+}
+
+func TestEnsureLockTable(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeTables{tables: map[string]*dynamodbtypes.TableDescription{}, ttl: map[string]*dynamodbtypes.TimeToLiveDescription{}}
+	assert.Nil(t, EnsureLockTable(ctx, client, "locks", WithoutExpiryIndex(), WithTableEncryption("")), "error should be nil")
+	table := client.tables["locks"]
+	if !assert.NotNil(t, table, "table should be created") {
+		return
+	}
+	assert.Equal(t, "name", aws.ToString(table.KeySchema[0].AttributeName), "the key should be name")
+	assert.Equal(t, dynamodbtypes.BillingModePayPerRequest, table.BillingModeSummary.BillingMode, "billing should be on demand")
+	assert.True(t, hasIndex(table, HolderIndex), "the holder index should be created")
+	assert.False(t, hasIndex(table, ExpiryIndex), "skipped indexes should not be created")
+	assert.Equal(t, dynamodbtypes.SSETypeKms, table.SSEDescription.SSEType, "the table should be encrypted with KMS")
+	assert.Equal(t, "ExpireAt", aws.ToString(client.ttl["locks"].AttributeName), "TTL should be enabled on ExpireAt")
+
+	assert.Nil(t, EnsureLockTable(ctx, client, "locks", WithTableEncryption("1234abcd")), "error should be nil")
+	assert.True(t, hasIndex(client.tables["locks"], ExpiryIndex), "missing indexes should be added")
+	assert.Contains(t, aws.ToString(client.tables["locks"].SSEDescription.KMSMasterKeyArn), "1234abcd", "a different key should be applied")
+
+	client.ttl["other"] = &dynamodbtypes.TimeToLiveDescription{AttributeName: aws.String("expires"), TimeToLiveStatus: dynamodbtypes.TimeToLiveStatusEnabled}
+	assert.NotNil(t, EnsureLockTable(ctx, client, "other"), "TTL on another attribute should be an error")
+	assert.Nil(t, EnsureLockTable(ctx, client, "other", WithoutTTL()), "error should be nil")
+}
+
+func TestEnsureLockTableAttributes(t *testing.T) {
+	client := &fakeTables{tables: map[string]*dynamodbtypes.TableDescription{}, ttl: map[string]*dynamodbtypes.TimeToLiveDescription{}}
+	names := AttributeNames{Key: "LockID", Owner: "owner", Expiry: "expires"}
+	err := EnsureLockTable(context.Background(), client, "locks", WithTableAttributes(names), WithoutExpiryIndex())
+	assert.Nil(t, err, "error should be nil")
+
+	table := client.tables["locks"]
+	assert.Equal(t, "LockID", aws.ToString(table.KeySchema[0].AttributeName), "the table should be keyed by the configured key")
+	assert.Equal(t, "owner", aws.ToString(table.GlobalSecondaryIndexes[0].KeySchema[0].AttributeName), "the holder index should be on the configured owner")
+	assert.Equal(t, "expires", aws.ToString(client.ttl["locks"].AttributeName), "TTL should be on the configured expiry")
+}
+
+func TestEnsureLockTableTags(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeTables{tables: map[string]*dynamodbtypes.TableDescription{}, ttl: map[string]*dynamodbtypes.TimeToLiveDescription{}}
+	arn := "arn:aws:dynamodb:us-east-1:123456789012:table/locks"
+	assert.Nil(t, EnsureLockTable(ctx, client, "locks", WithTableTags(map[string]string{"team": "platform"})), "error should be nil")
+	assert.Equal(t, map[string]string{"team": "platform"}, client.tags[arn], "the table should be created with its tags")
+
+	client.tags[arn]["owner"] = "someone"
+	tags := map[string]string{"team": "infra", "cost-center": "42"}
+	assert.Nil(t, EnsureLockTable(ctx, client, "locks", WithTableTags(tags)), "error should be nil")
+	assert.Equal(t, map[string]string{"team": "infra", "cost-center": "42", "owner": "someone"}, client.tags[arn],
+		"missing and changed tags should be applied, and others kept")
+}
+
+func TestEnableTTL(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeTables{tables: map[string]*dynamodbtypes.TableDescription{}, ttl: map[string]*dynamodbtypes.TimeToLiveDescription{}}
+	assert.Nil(t, EnableTTL(ctx, client, "locks"), "error should be nil")
+	assert.Equal(t, "ExpireAt", aws.ToString(client.ttl["locks"].AttributeName), "TTL should be enabled on ExpireAt")
+	assert.Nil(t, EnableTTL(ctx, client, "locks"), "enabling TTL again should succeed")
+
+	assert.Nil(t, EnableTTL(ctx, client, "other", WithTableAttributes(AttributeNames{Expiry: "expires"})), "error should be nil")
+	assert.Equal(t, "expires", aws.ToString(client.ttl["other"].AttributeName), "TTL should be enabled on the configured expiry")
+	assert.NotNil(t, EnableTTL(ctx, client, "other"), "TTL on another attribute should be an error")
+}
@@ -0,0 +1,46 @@
+package infra
+
+import (
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Takeover describes an acquisition that succeeded because the previous
+// holder's lease expired, rather than because the lock was free.
+type Takeover struct {
+	Lock             string
+	PreviousLockerId string
+	// PreviousTraceId is the trace ID the previous holder acquired with, if any.
+	PreviousTraceId string
+	// ExpiredAt is when the previous holder's lease ran out.
+	ExpiredAt time.Time
+	// Item is the lock item as the previous holder left it, including any
+	// application attributes.
+	Item map[string]dynamodbtypes.AttributeValue
+}
+
+// WithTakeoverHandler registers a function called when this Locker takes over
+// a lock whose previous holder's lease expired. It runs before AcquireLock
+// returns, so the new owner can recover from half-finished work before it
+// proceeds. An EventTakeover is raised as well.
+func WithTakeoverHandler(handler func(Takeover)) Option {
+	return func(l *Locker) {
+		l.takeoverHandlers = append(l.takeoverHandlers, handler)
+	}
+}
+
+// observeTakeover inspects the item as it was before a new acquisition.
+func (l *Locker) observeTakeover(name string, old map[string]dynamodbtypes.AttributeValue) {
+	previous, _ := old[l.attrs.Owner].(*dynamodbtypes.AttributeValueMemberS)
+	if previous == nil || previous.Value == l.lockerId {
+		return
+	}
+	info := l.attrs.lockInfo(old)
+	t := Takeover{Lock: name, PreviousLockerId: info.LockerId, PreviousTraceId: info.TraceId, ExpiredAt: info.ExpiresAt, Item: old}
+	l.acquireLogger.Info("Took over expired lock", "lockname", name, "previous", t.PreviousLockerId)
+	l.emit(Event{Type: EventTakeover, Lock: name, PreviousLockerId: t.PreviousLockerId})
+	for _, handler := range l.takeoverHandlers {
+		handler(t)
+	}
+}
@@ -0,0 +1,54 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveTakeover(t *testing.T) {
+	var takeovers []Takeover
+	n := NewLocker(nil, context.Background(), "locks", WithTakeoverHandler(func(t Takeover) { takeovers = append(takeovers, t) }))
+
+	n.observeTakeover("free", map[string]dynamodbtypes.AttributeValue{})
+	n.observeTakeover("mine", map[string]dynamodbtypes.AttributeValue{
+		"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: n.lockerId},
+	})
+	assert.Empty(t, takeovers, "free and already held locks are not takeovers")
+
+	n.observeTakeover("stale", map[string]dynamodbtypes.AttributeValue{
+		"lockerId":   &dynamodbtypes.AttributeValueMemberS{Value: "dead-host"},
+		"traceId":    &dynamodbtypes.AttributeValueMemberS{Value: "trace-1"},
+		"ExpireAtMs": &dynamodbtypes.AttributeValueMemberN{Value: "1700000000123"},
+	})
+	assert.Len(t, takeovers, 1, "expired holder should be reported")
+	assert.Equal(t, "dead-host", takeovers[0].PreviousLockerId, "previous holder should be reported")
+	assert.Equal(t, "trace-1", takeovers[0].PreviousTraceId, "previous trace should be reported")
+	assert.Equal(t, time.UnixMilli(1700000000123), takeovers[0].ExpiredAt, "expiry should be reported")
+}
+
+func TestAcquireReportsTakeover(t *testing.T) {
+	client := &fakeClient{updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		assert.Equal(t, dynamodbtypes.ReturnValueAllOld, input.ReturnValues, "the previous holder is only in the old item")
+		return &dynamodb.UpdateItemOutput{Attributes: map[string]dynamodbtypes.AttributeValue{
+			"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "crashed"},
+		}}, nil
+	}, deleteItem: func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var takeovers []Takeover
+	n := NewLocker(client, ctx, "locks", WithTakeoverHandler(func(t Takeover) { takeovers = append(takeovers, t) }))
+
+	ok, err := n.AcquireLock("x", time.Second*10)
+	assert.True(t, ok, "lock should be acquired")
+	assert.Nil(t, err, "error should be nil")
+	assert.Len(t, takeovers, 1, "takeover should be reported")
+	assert.Equal(t, "crashed", takeovers[0].PreviousLockerId, "previous holder should be reported")
+}
@@ -0,0 +1,104 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// terraformInfoAttribute is the attribute Terraform's S3 backend records
+// its lock info in, as JSON.
+const terraformInfoAttribute = "Info"
+
+// terraformCondition keeps acquisitions off locks held by Terraform, whose
+// items carry Info but no owner. They have no lease: they stay held until
+// Terraform unlocks them or someone runs terraform force-unlock.
+const terraformCondition = "attribute_exists(#owner) or attribute_not_exists(Info)"
+
+// TerraformLockInfo is the lock info Terraform records with a state lock,
+// and which a Locker in Terraform compatibility mode records with its own
+// locks so that Terraform can report who holds them.
+type TerraformLockInfo struct {
+	ID        string
+	Operation string
+	Info      string
+	Who       string
+	Version   string
+	Created   time.Time
+	Path      string
+}
+
+// WithTerraformCompat makes the Locker share a Terraform state-lock table,
+// keyed by LockID. Locks Terraform holds are never acquired, however old,
+// and locks the Locker holds carry Terraform lock info, so Terraform refuses
+// to lock state while they are held and names the Locker as the holder.
+// TerraformLockID gives the name of the lock on a state file. Terraform can
+// only lock a state file whose item doesn't exist, so a lock item kept on
+// release by WithReleaseCooldown or a payload keeps Terraform out.
+func WithTerraformCompat() Option {
+	return func(l *Locker) {
+		l.attrs.Key = "LockID"
+		l.terraform = true
+	}
+}
+
+// TerraformLockID returns the LockID Terraform's S3 backend locks the state
+// file at path in bucket with. For workspaces other than the default, path
+// is the workspace key prefix, the workspace and the key joined by slashes.
+func TerraformLockID(bucket, path string) string {
+	return bucket + "/" + path
+}
+
+// TerraformLock reads the Terraform lock info of the named lock, whether it
+// was written by Terraform or by a Locker in Terraform compatibility mode. It
+// reports false if the lock isn't held by either.
+func (l *Locker) TerraformLock(ctx context.Context, name string) (TerraformLockInfo, bool, error) {
+	if err := l.dynamoOnly("reading Terraform lock info"); err != nil {
+		return TerraformLockInfo{}, false, err
+	}
+	out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            l.attrs.key(name),
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil {
+		return TerraformLockInfo{}, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	raw, ok := stringAttr(out.Item, terraformInfoAttribute)
+	if !ok {
+		return TerraformLockInfo{}, false, nil
+	}
+	var info TerraformLockInfo
+	if err := json.Unmarshal([]byte(raw), &info); err != nil {
+		return TerraformLockInfo{}, false, fmt.Errorf("decoding Terraform lock info of %s : %w", name, err)
+	}
+	return info, true, nil
+}
+
+// terraformInfo is the lock info recorded with a lock this Locker acquires.
+func (l *Locker) terraformInfo(name, traceId string, now time.Time) string {
+	host, _ := os.Hostname()
+	info, _ := json.Marshal(TerraformLockInfo{
+		ID:        l.lockerId,
+		Operation: "gotrc",
+		Info:      traceId,
+		Who:       l.lockerId + "@" + host,
+		Version:   "gotrc",
+		Created:   now.UTC(),
+		Path:      name,
+	})
+	return string(info)
+}
+
+// terraformHeld reports whether Terraform holds a lock item.
+func (l *Locker) terraformHeld(item map[string]dynamodbtypes.AttributeValue) bool {
+	_, hasInfo := stringAttr(item, terraformInfoAttribute)
+	_, hasOwner := stringAttr(item, l.attrs.Owner)
+	return l.terraform && hasInfo && !hasOwner
+}
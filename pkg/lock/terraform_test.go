@@ -0,0 +1,65 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// terraformLock locks state the way Terraform's S3 backend does.
+func terraformLock(ctx context.Context, client Client, lockID, info string) error {
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("terraform-locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"LockID": &dynamodbtypes.AttributeValueMemberS{Value: lockID},
+			"Info":   &dynamodbtypes.AttributeValueMemberS{Value: info},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockID)"),
+	})
+	return err
+}
+
+func TestTerraformCompat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	client.DefineTable("terraform-locks", "LockID")
+	n := NewLocker(client, ctx, "terraform-locks", WithTerraformCompat())
+	state := TerraformLockID("states", "prod/terraform.tfstate")
+	assert.Equal(t, "states/prod/terraform.tfstate", state, "the LockID should be the bucket and path")
+
+	info := `{"ID":"4f1c","Operation":"OperationTypeApply","Info":"","Who":"alice@laptop","Version":"1.6.0","Created":"2024-01-02T03:04:05Z","Path":"states/prod/terraform.tfstate"}`
+	assert.Nil(t, terraformLock(ctx, client, state, info), "error should be nil")
+	ok, err := n.AcquireLock(state, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a lock held by Terraform should not be acquired")
+	locked, err := n.IsLocked(ctx, state)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, locked, "a lock held by Terraform should be reported as held")
+	ok, err = n.WouldAcquire(ctx, state)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a lock held by Terraform could not be acquired")
+	held, found, err := n.TerraformLock(ctx, state)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "Terraform's lock info should be found")
+	assert.Equal(t, "alice@laptop", held.Who, "Terraform's lock info should be decoded")
+
+	other := TerraformLockID("states", "dev/terraform.tfstate")
+	ok, err = n.AcquireLock(other, time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a free state lock should be acquired")
+	assert.NotNil(t, terraformLock(ctx, client, other, info), "Terraform should not lock state the Locker holds")
+	held, found, err = n.TerraformLock(ctx, other)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the Locker should record Terraform lock info")
+	assert.Equal(t, n.ID(), held.ID, "Terraform should see the Locker as the holder")
+	assert.Equal(t, other, held.Path, "the lock info should name the state")
+
+	assert.Nil(t, n.ReleaseLock(other), "error should be nil")
+	assert.Nil(t, terraformLock(ctx, client, other, info), "Terraform should lock state once it is released")
+}
@@ -0,0 +1,83 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/aws/smithy-go"
+)
+
+const (
+	defaultThrottleRetries = 4
+	defaultThrottleInitial = 50 * time.Millisecond
+	defaultThrottleMax     = 2 * time.Second
+)
+
+// transientErrorCodes are the DynamoDB errors that go away by themselves,
+// when the table is throttled or the service is briefly unavailable.
+var transientErrorCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+	"InternalServerError":                    true,
+	"ServiceUnavailable":                     true,
+	"TransactionConflictException":           true,
+}
+
+// WithThrottleBackoff sets how the Locker retries acquisitions, renewals and
+// releases failing with throttling or other transient DynamoDB errors, on top
+// of the client's own retries: up to retries times, waiting a random delay of
+// up to initial before the first retry and doubling it for every retry after,
+// up to max. The default retries 4 times, starting at 50ms, up to 2s; 0
+// retries turns it off.
+func WithThrottleBackoff(retries int, initial, max time.Duration) Option {
+	return func(l *Locker) {
+		l.throttleRetries = retries
+		l.throttleInitial = initial
+		l.throttleMax = max
+	}
+}
+
+// isTransient reports whether a DynamoDB call failed with an error that a
+// retry after a pause can be expected to get past.
+func isTransient(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && transientErrorCodes[apiErr.ErrorCode()] {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// withBackoff makes a DynamoDB call, retrying it with exponential backoff and
+// jitter while it fails with a transient error. It gives up when ctx is done,
+// returning the last error.
+func (l *Locker) withBackoff(ctx context.Context, logger *slog.Logger, op string, call func() error) error {
+	delay := l.throttleInitial
+	for retry := 0; ; retry++ {
+		err := call()
+		if err == nil || retry >= l.throttleRetries || !isTransient(err) {
+			return err
+		}
+		// Full jitter, so Lockers throttled together don't retry together
+		var wait time.Duration
+		if delay > 0 {
+			wait = time.Duration(rand.Int63n(int64(delay) + 1))
+		}
+		logger.Debug("Retrying transient DynamoDB error", "operation", op, "delay", wait, "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if delay *= 2; delay > l.throttleMax || delay <= 0 {
+			delay = l.throttleMax
+		}
+	}
+}
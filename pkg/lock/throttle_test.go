@@ -0,0 +1,57 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	throttled := &dynamodbtypes.ProvisionedThroughputExceededException{Message: new(string)}
+	updates, deletes := 0, 0
+	client := &fakeClient{
+		updateItem: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			if updates++; updates <= 2 {
+				return nil, &smithy.OperationError{ServiceID: "DynamoDB", OperationName: "UpdateItem", Err: throttled}
+			}
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+		deleteItem: func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+			if deletes++; deletes == 1 {
+				return nil, &smithy.GenericAPIError{Code: "ThrottlingException"}
+			}
+			return &dynamodb.DeleteItemOutput{}, nil
+		},
+	}
+	l := NewLocker(client, ctx, "locks", WithThrottleBackoff(3, time.Millisecond, 5*time.Millisecond))
+	ok, err := l.AcquireLock("throttled", 2*time.Minute)
+	assert.Nil(t, err, "a throttled acquisition should be retried")
+	assert.True(t, ok, "lock should be acquired")
+	assert.Equal(t, 3, updates, "the acquisition should be retried until it succeeds")
+	assert.Nil(t, l.ReleaseLock("throttled"), "a throttled release should be retried")
+	assert.Equal(t, 2, deletes, "the release should be retried until it succeeds")
+
+	updates = -10
+	ok, err = l.AcquireLock("exhausted", 2*time.Minute)
+	assert.False(t, ok, "lock should not be acquired")
+	assert.True(t, errors.As(err, &throttled), "the last transient error should be returned")
+	assert.Equal(t, -6, updates, "the acquisition should give up after its retries")
+
+	failed := 0
+	client.updateItem = func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		failed++
+		return nil, errors.New("validation failed")
+	}
+	_, err = l.AcquireLock("invalid", 2*time.Minute)
+	assert.NotNil(t, err, "error should not be nil")
+	assert.Equal(t, 1, failed, "errors that aren't transient should not be retried")
+}
@@ -0,0 +1,78 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// WithRequestTimeout bounds each attempt of every DynamoDB call the Locker
+// makes, independently of lock lease durations. An attempt stuck on a hung
+// connection then fails after d and is retried by the client's retry policy,
+// instead of blocking the heartbeater until leases have lapsed.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(l *Locker) {
+		l.requestTimeout = d
+	}
+}
+
+// requestOptions applies the endpoint, home region, retry policy,
+// capacity reporting and per-attempt timeout to a DynamoDB call. It is passed to each client call
+// the Locker makes.
+func (l *Locker) requestOptions(o *dynamodb.Options) {
+	if l.endpoint != "" {
+		o.BaseEndpoint = &l.endpoint
+	}
+	if l.homeRegion != "" {
+		o.Region = l.homeRegion
+	}
+	if retryer := l.retryer.Load(); retryer != nil {
+		o.Retryer = *retryer
+	}
+	if l.capacity != nil {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(l.capacity.middleware(l.attrs.Key), middleware.After)
+		})
+	}
+	if l.requestTimeout <= 0 {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		// After the retry middleware, so each attempt gets its own deadline
+		return stack.Finalize.Insert(attemptTimeout(l.requestTimeout), "Retry", middleware.After)
+	})
+}
+
+func attemptTimeout(d time.Duration) middleware.FinalizeMiddleware {
+	return middleware.FinalizeMiddlewareFunc("AttemptTimeout", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		attemptCtx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		out, metadata, err := next.HandleFinalize(attemptCtx, in)
+		if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			// The client treats a cancelled context as final, so report the
+			// attempt's own deadline as a retryable timeout instead
+			err = &attemptTimeoutError{d}
+		}
+		return out, metadata, err
+	})
+}
+
+type attemptTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *attemptTimeoutError) Error() string {
+	return fmt.Sprintf("request attempt timed out after %s", e.timeout)
+}
+
+func (e *attemptTimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *attemptTimeoutError) RetryableError() bool {
+	return true
+}
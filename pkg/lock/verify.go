@@ -0,0 +1,92 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrNotVerified is returned when a strongly consistent read after
+// acquisition doesn't show the lock as held by this Locker.
+var ErrNotVerified = errors.New("lock ownership could not be verified")
+
+// WithVerifiedAcquire makes every new acquisition confirm its result with a
+// strongly consistent read of the lock item, checking the owner and expiry,
+// before reporting success. It costs an extra read per acquisition and is
+// meant for workflows where a false-positive acquisition is catastrophic.
+func WithVerifiedAcquire() Option {
+	return func(l *Locker) {
+		l.verifyAcquire = true
+	}
+}
+
+// VerifyHeld confirms with a strongly consistent read that this Locker owns an
+// unexpired lease on the named lock, for callers about to take an
+// irreversible action under it. It returns an error wrapping ErrNotVerified
+// if the lock is held by someone else, free, or its lease has lapsed, allowing
+// for WithClockSkewMargin. The lease can still lapse as soon as VerifyHeld
+// returns, so the action should take well under the remaining lease.
+func (l *Locker) VerifyHeld(ctx context.Context, name string) error {
+	if l.closed() {
+		return ErrClosed
+	}
+	return l.verifyOwnership(ctx, name)
+}
+
+// abandon releases a lock whose item was written but whose acquisition then
+// failed, so it doesn't keep others out until its lease lapses, and returns
+// err. A lock that turns out not to be ours is left alone.
+func (l *Locker) abandon(name string, err error) error {
+	// The caller's context may be what failed
+	if relErr := l.release(context.Background(), name); relErr != nil && !errors.Is(relErr, ErrNotHeld) {
+		l.acquireLogger.Warn("Abandoned lock could not be released", "lockname", name, "error", relErr)
+	}
+	return err
+}
+
+// verifyOwnership reads the lock item with a strongly consistent read and
+// checks that this Locker owns an unexpired lease on it.
+func (l *Locker) verifyOwnership(ctx context.Context, name string) error {
+	// A peer whose clock runs ahead may see the lease lapse up to the margin early
+	now := time.Now().Add(l.skewMargin)
+	if l.backend != nil {
+		info, _, err := l.backend.GetItem(ctx, name)
+		if err != nil {
+			return fmt.Errorf("reading lock %s : %w", name, err)
+		}
+		if info.LockerId != l.lockerId {
+			return fmt.Errorf("lock %s is not held by %s : %w", name, l.lockerId, ErrNotVerified)
+		}
+		if info.Expired(now) {
+			return fmt.Errorf("lock %s lease has expired : %w", name, ErrNotVerified)
+		}
+		return nil
+	}
+	out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            l.attrs.key(name),
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(l.lockTable),
+	}, l.requestOptions)
+	if err != nil {
+		return fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	owner, _ := out.Item[l.attrs.Owner].(*dynamodbtypes.AttributeValueMemberS)
+	if owner == nil || owner.Value != l.lockerId {
+		return fmt.Errorf("lock %s is not held by %s : %w", name, l.lockerId, ErrNotVerified)
+	}
+	expiry, _ := out.Item["ExpireAtMs"].(*dynamodbtypes.AttributeValueMemberN)
+	if expiry == nil {
+		return fmt.Errorf("lock %s has no expiry : %w", name, ErrNotVerified)
+	}
+	expiresAt, err := strconv.ParseInt(expiry.Value, 10, 64)
+	if err != nil || expiresAt <= now.UnixMilli() {
+		return fmt.Errorf("lock %s lease has expired : %w", name, ErrNotVerified)
+	}
+	return nil
+}
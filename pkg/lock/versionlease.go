@@ -0,0 +1,51 @@
+package infra
+
+import (
+	"time"
+
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// versionLeaseCondition lets a lock be taken when it is free or already ours.
+// Locks written by a Locker that doesn't record version numbers fall back to
+// their wall-clock expiry, so none is stranded.
+const versionLeaseCondition = "attribute_not_exists(#owner) or #owner = :lockerId" +
+	" or (attribute_not_exists(" + recordVersionAttribute + ") and (" +
+	"(attribute_not_exists(ExpireAtMs) and :now > #expiry) or (:nowMs > ExpireAtMs and :now >= #expiry)))"
+
+// WithRecordVersionLeases makes lock takeover independent of clocks agreeing
+// across hosts. Every acquisition and renewal writes a new
+// recordVersionNumber along with the lease, and a lock held by another
+// Locker is only taken over once this Locker has itself seen the record
+// version stay unchanged for a whole lease, timed on its own monotonic
+// clock, rather than once the holder's expiry has passed by this host's
+// clock. Takeover then needs at least two attempts a lease apart, which
+// WaitForLock makes; a single AcquireLock only notes the version it saw.
+//
+// Every Locker sharing the table must use this option, as a Locker that
+// doesn't still trusts ExpireAt. Expiry is still written, for TTL and for
+// IsLocked and the other read-only helpers, which go on comparing it with the
+// local clock.
+func WithRecordVersionLeases() Option {
+	return func(l *Locker) {
+		l.versionLeases = true
+	}
+}
+
+// versioned reports whether the Locker writes and watches record versions.
+func (l *Locker) versioned() bool {
+	return l.versionLeases || l.javaCompat
+}
+
+// staleVersionCondition lets a lock be taken if it still carries a record
+// version seen unchanged for its whole lease, or returns "" if there is none.
+func (l *Locker) staleVersionCondition(name string, now time.Time, values map[string]dynamodbtypes.AttributeValue) string {
+	l.mu.Lock()
+	seen, ok := l.versionsSeen[name]
+	l.mu.Unlock()
+	if !ok || now.Sub(seen.at) < seen.lease {
+		return ""
+	}
+	values[":staleVersion"] = &dynamodbtypes.AttributeValueMemberS{Value: seen.version}
+	return recordVersionAttribute + " = :staleVersion"
+}
@@ -0,0 +1,86 @@
+package infra
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordVersionLeases(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	// Written by a holder whose clock runs behind: by ours its lease has
+	// lapsed, but it is still heartbeating with a 100ms lease
+	past := time.Now().Add(-time.Minute)
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":                &dynamodbtypes.AttributeValueMemberS{Value: "skewed"},
+			"lockerId":            &dynamodbtypes.AttributeValueMemberS{Value: "behind"},
+			"ExpireAt":            &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(past.Unix(), 10)},
+			"ExpireAtMs":          &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(past.UnixMilli(), 10)},
+			"leaseDuration":       &dynamodbtypes.AttributeValueMemberS{Value: "100"},
+			"recordVersionNumber": &dynamodbtypes.AttributeValueMemberS{Value: "v1"},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+
+	n := NewLocker(client, ctx, "locks", WithRecordVersionLeases())
+	ok, err := n.AcquireLock("skewed", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a lock should not be taken over on the holder's expiry alone")
+	time.Sleep(time.Millisecond * 150)
+	_, err = client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("locks"),
+		Key:                       defaultAttributeNames.key("skewed"),
+		UpdateExpression:          aws.String("SET recordVersionNumber = :v"),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{":v": &dynamodbtypes.AttributeValueMemberS{Value: "v2"}},
+	})
+	assert.Nil(t, err, "error should be nil")
+	ok, _ = n.AcquireLock("skewed", time.Minute)
+	assert.False(t, ok, "a lock whose holder heartbeats should not be taken over")
+	time.Sleep(time.Millisecond * 150)
+	ok, err = n.AcquireLock("skewed", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a lock whose record version was unchanged for its lease should be taken over")
+
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("locks"), Key: defaultAttributeNames.key("skewed")})
+	assert.Nil(t, err, "error should be nil")
+	assert.Equal(t, &dynamodbtypes.AttributeValueMemberS{Value: "60000"}, out.Item["leaseDuration"], "the lease should be recorded")
+	version := out.Item["recordVersionNumber"]
+	assert.NotEqual(t, &dynamodbtypes.AttributeValueMemberS{Value: "v2"}, version, "the record version should change")
+	ok, err = n.AcquireLock("skewed", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "a held lock should be renewed")
+	out, _ = client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("locks"), Key: defaultAttributeNames.key("skewed")})
+	assert.NotEqual(t, version, out.Item["recordVersionNumber"], "renewals should change the record version")
+
+	b := NewLocker(client, ctx, "locks", WithRecordVersionLeases())
+	ok, err = b.AcquireLocks(ctx, []string{"free", "skewed"}, time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "a set with a held lock should not be acquired")
+	b.mu.Lock()
+	assert.Contains(t, b.versionsSeen, "skewed", "a contended set should note the holder's record version")
+	b.mu.Unlock()
+
+	// Items written without record versions still expire by the clock
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("locks"),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"name":     &dynamodbtypes.AttributeValueMemberS{Value: "legacy"},
+			"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "old"},
+			"ExpireAt": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(past.Unix(), 10)},
+		},
+	})
+	assert.Nil(t, err, "error should be nil")
+	ok, err = b.AcquireLock("legacy", time.Minute)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "an expired lock without a record version should be taken over")
+}
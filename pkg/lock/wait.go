@@ -0,0 +1,115 @@
+package infra
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultWaitInitial = 100 * time.Millisecond
+	defaultWaitMax     = 5 * time.Second
+	defaultWaitFactor  = 2
+	// waiterRecordLease is the lease of the waiter records written with
+	// WithMaxWaiters, renewed for as long as the process waits.
+	waiterRecordLease = 30 * time.Second
+)
+
+// WithWaitBackoff sets how WaitForLock retries a contended lock: first after
+// initial, then multiplying the delay by factor after every failed attempt, up
+// to max. The default starts at 100ms and doubles up to 5s.
+func WithWaitBackoff(initial, max time.Duration, factor float64) Option {
+	return func(l *Locker) {
+		l.waitInitial = initial
+		l.waitMax = max
+		l.waitFactor = factor
+	}
+}
+
+// WithMaxWaiters bounds how many acquirers may wait in WaitForLock on the same
+// lock: at most goroutines of this process, and at most processes Lockers
+// across all processes, counted through waiter records in the lock table. Zero
+// leaves either unbounded. WaitForLock fails fast with ErrTooManyWaiters when
+// the limit is reached.
+func WithMaxWaiters(goroutines, processes int) Option {
+	return func(l *Locker) {
+		l.waiters.max = goroutines
+		l.waiters.slots = nil
+		if processes > 0 && l.backend == nil {
+			l.waiters.slots = NewSemaphore(l.client, l.lockTable, processes, waiterRecordLease)
+		}
+	}
+}
+
+// WithStarvationAlert emits EventStarving when an acquirer has been waiting
+// in WaitForLock for longer than after, and again each time its wait doubles,
+// so chronically starved jobs become visible. The events are raised on their
+// own goroutine.
+func WithStarvationAlert(after time.Duration) Option {
+	return func(l *Locker) {
+		l.waiters.starveAfter = after
+		l.waiters.emit = l.emit
+	}
+}
+
+// ReleaseWatcher is implemented by Backends that can signal that a lock may
+// have been released, so that WaitForLock retries straight away rather than
+// on its next backoff.
+type ReleaseWatcher interface {
+	// WatchRelease returns a channel closed once the named lock changes or
+	// is released. It may also be closed when nothing changed.
+	WatchRelease(ctx context.Context, name string) (<-chan struct{}, error)
+}
+
+// WaitForLock acquires a lock like AcquireLock, but rather than failing when
+// it is held by another Locker, retries with exponential backoff until it is
+// acquired, ctx is done or the Locker is closed. With a Backend implementing
+// ReleaseWatcher, it also retries as soon as the lock is released.
+func (l *Locker) WaitForLock(ctx context.Context, name string, lease time.Duration, opts ...AcquireOption) error {
+	ok, err := l.AcquireLockContext(ctx, name, lease, opts...)
+	if ok || err != nil {
+		return err
+	}
+	leave, err := l.waiters.join(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer leave()
+	delay := l.waitInitial
+	watcher, _ := l.backend.(ReleaseWatcher)
+	for {
+		l.acquireLogger.Debug("Waiting for lock", "lockname", name, "delay", delay)
+		var released <-chan struct{}
+		if watcher != nil {
+			if released, err = watcher.WatchRelease(ctx, name); err != nil {
+				l.acquireLogger.Debug("Watching lock failed, waiting out the backoff", "lockname", name, "error", err)
+			}
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-l.ctx.Done():
+			timer.Stop()
+			return ErrClosed
+		case <-timer.C:
+		case <-released:
+			timer.Stop()
+		}
+		ok, err := l.AcquireLockContext(ctx, name, lease, opts...)
+		if ok || err != nil {
+			return err
+		}
+		delay = l.nextWait(delay)
+	}
+}
+
+// nextWait returns the delay before the attempt following one made after
+// delay.
+func (l *Locker) nextWait(delay time.Duration) time.Duration {
+	next := time.Duration(float64(delay) * l.waitFactor)
+	if next > l.waitMax || next <= 0 {
+		return l.waitMax
+	}
+	return next
+}
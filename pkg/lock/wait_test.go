@@ -0,0 +1,51 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextWait(t *testing.T) {
+	l := &Locker{waitFactor: 2, waitMax: time.Second}
+	assert.Equal(t, 200*time.Millisecond, l.nextWait(100*time.Millisecond), "delay should grow by the factor")
+	assert.Equal(t, time.Second, l.nextWait(800*time.Millisecond), "delay should be capped")
+}
+
+func TestWaitForLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	n := NewLocker(client, ctx, "locks")
+	ok, err := n.AcquireLock("wait", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "lock should be acquired")
+
+	events := make(chan Event, 10)
+	b := NewLocker(client, ctx, "locks", WithWaitBackoff(time.Millisecond*10, time.Millisecond*50, 2),
+		WithMaxWaiters(1, 0), WithStarvationAlert(time.Millisecond*50), WithEventHandler(func(e Event) {
+			if e.Type == EventStarving {
+				events <- e
+			}
+		}))
+	impatient, impatientCancel := context.WithTimeout(ctx, time.Millisecond*30)
+	defer impatientCancel()
+	assert.ErrorIs(t, b.WaitForLock(impatient, "wait", time.Second*10), context.DeadlineExceeded, "held lock should not be acquired")
+
+	done := make(chan error, 1)
+	go func() { done <- b.WaitForLock(ctx, "wait", time.Second*10) }()
+	assert.Eventually(t, func() bool {
+		b.waiters.mu.Lock()
+		defer b.waiters.mu.Unlock()
+		return b.waiters.waiting["wait"] == 1
+	}, time.Second, time.Millisecond*10, "acquirer should wait")
+	assert.ErrorIs(t, b.WaitForLock(ctx, "wait", time.Second*10), ErrTooManyWaiters, "second waiter should fail fast")
+	e := <-events
+	assert.Equal(t, "wait", e.Lock, "starving waiter should be reported")
+
+	assert.Nil(t, n.ReleaseMany(ctx, []string{"wait"}), "error should be nil")
+	assert.Nil(t, <-done, "waiter should acquire the released lock")
+	assert.Equal(t, []string{"wait"}, b.heldNames(), "waiter should hold the lock")
+}
@@ -0,0 +1,174 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrTooManyWaiters is returned by blocking acquisition when as many acquirers
+// as allowed are already waiting on the same name, so callers fail fast
+// instead of piling up behind a stuck holder.
+var ErrTooManyWaiters = errors.New("too many waiters")
+
+// waiterPrefix namespaces the semaphores that count waiting processes.
+const waiterPrefix = "waiters:"
+
+// waitQueue bounds the acquirers waiting on each name: at most max goroutines
+// of this process, and, when slots is set, at most its capacity of processes.
+// A process holds a permit of slots, renewed like any other, while any of its
+// goroutines wait, so the records of a process that dies while waiting lapse
+// with their lease.
+//
+// A waiter still waiting after starveAfter is reported through emit with
+// EventStarving, and again each time its wait doubles.
+type waitQueue struct {
+	max         int
+	slots       *Semaphore
+	starveAfter time.Duration
+	emit        func(Event)
+	mu          sync.Mutex
+	waiting     map[string]int
+	records     map[string]*waiterRecord
+}
+
+// waiterRecord is this process's permit of slots for one name. Its mu is held
+// while the permit is taken or returned, so the table is only written with no
+// lock on the whole queue held, and held says whether it is taken.
+type waiterRecord struct {
+	mu   sync.Mutex
+	held bool
+}
+
+func newWaitQueue() *waitQueue {
+	return &waitQueue{waiting: map[string]int{}, records: map[string]*waiterRecord{}}
+}
+
+// join registers a waiter on name, returning ErrTooManyWaiters if the queue is
+// full. The returned function unregisters it.
+func (q *waitQueue) join(ctx context.Context, name string) (leave func(), err error) {
+	q.mu.Lock()
+	if q.max > 0 && q.waiting[name] >= q.max {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("waiting on %s : %w", name, ErrTooManyWaiters)
+	}
+	q.waiting[name]++
+	var rec *waiterRecord
+	if q.slots != nil {
+		if rec = q.records[name]; rec == nil {
+			rec = &waiterRecord{}
+			q.records[name] = rec
+		}
+	}
+	q.mu.Unlock()
+	if rec != nil {
+		if err := q.register(ctx, name, rec); err != nil {
+			q.leave(name)
+			return nil, err
+		}
+	}
+	watch := q.watchStarvation(name)
+	return func() {
+		watch.stop()
+		q.leave(name)
+	}, nil
+}
+
+// register takes this process's waiter record on name, unless its other
+// waiters already have.
+func (q *waitQueue) register(ctx context.Context, name string, rec *waiterRecord) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.held {
+		return nil
+	}
+	ok, err := q.slots.TryAcquire(ctx, waiterPrefix+name, 1)
+	if err != nil {
+		return fmt.Errorf("registering waiter on %s : %w", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("waiting on %s : %w", name, ErrTooManyWaiters)
+	}
+	rec.held = true
+	return nil
+}
+
+// leave unregisters a waiter on name, removing the waiter record once the
+// last of this process's waiters has left.
+func (q *waitQueue) leave(name string) {
+	q.mu.Lock()
+	q.waiting[name]--
+	if q.waiting[name] > 0 {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.waiting, name)
+	rec := q.records[name]
+	q.mu.Unlock()
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	// A waiter that joined in the meantime keeps the record
+	q.mu.Lock()
+	idle := q.waiting[name] == 0
+	q.mu.Unlock()
+	if !idle {
+		return
+	}
+	if rec.held {
+		rec.held = false
+		if err := q.slots.Release(context.Background(), waiterPrefix+name); err != nil {
+			q.slots.logger.Warn("Waiter record could not be removed", "name", name, "error", err)
+		}
+	}
+	q.mu.Lock()
+	if q.waiting[name] == 0 && q.records[name] == rec {
+		delete(q.records, name)
+	}
+	q.mu.Unlock()
+}
+
+// starvationWatch reports a waiter that has been waiting too long.
+type starvationWatch struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+func (q *waitQueue) watchStarvation(name string) *starvationWatch {
+	w := &starvationWatch{}
+	if q.starveAfter <= 0 || q.emit == nil {
+		return w
+	}
+	start := time.Now()
+	var escalate func(n int, wait time.Duration)
+	escalate = func(n int, wait time.Duration) {
+		w.timer = time.AfterFunc(wait, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.stopped {
+				return
+			}
+			q.emit(Event{Type: EventStarving, Lock: name, Elapsed: time.Since(start), Escalation: n})
+			// The next report comes once the total wait has doubled
+			escalate(n+1, time.Since(start))
+		})
+	}
+	w.mu.Lock()
+	escalate(1, q.starveAfter)
+	w.mu.Unlock()
+	return w
+}
+
+func (w *starvationWatch) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
@@ -0,0 +1,119 @@
+package infra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func waiting(s *Semaphore, name string) int {
+	s.waiters.mu.Lock()
+	defer s.waiters.mu.Unlock()
+	return s.waiters.waiting[name]
+}
+
+func TestMaxSemaphoreWaiters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	holder := NewSemaphore(client, "locks", 1, time.Second*10)
+	assert.Nil(t, holder.Acquire(ctx, "jobs", 1), "error should be nil")
+
+	local := NewSemaphore(client, "locks", 1, time.Second*10, WithMaxSemaphoreWaiters(1, 0))
+	acquired := make(chan error, 1)
+	go func() { acquired <- local.Acquire(ctx, "jobs", 1) }()
+	assert.Eventually(t, func() bool { return waiting(local, "jobs") == 1 }, time.Second, time.Millisecond*10, "acquirer should wait")
+	assert.ErrorIs(t, local.Acquire(ctx, "jobs", 1), ErrTooManyWaiters, "second local waiter should fail fast")
+
+	remote := NewSemaphore(client, "locks", 1, time.Second*10, WithMaxSemaphoreWaiters(0, 1))
+	other := NewSemaphore(client, "locks", 1, time.Second*10, WithMaxSemaphoreWaiters(0, 1))
+	remoteCtx, remoteCancel := context.WithCancel(ctx)
+	remoteDone := make(chan error, 1)
+	go func() { remoteDone <- remote.Acquire(remoteCtx, "jobs", 1) }()
+	assert.Eventually(t, func() bool { return waiting(remote, "jobs") == 1 }, time.Second, time.Millisecond*10, "acquirer should wait")
+	assert.ErrorIs(t, other.Acquire(ctx, "jobs", 1), ErrTooManyWaiters, "waiter records should bound waiting processes")
+	remoteCancel()
+	assert.ErrorIs(t, <-remoteDone, context.Canceled, "cancelled waiter should give up")
+	assert.Equal(t, 0, waiting(remote, "jobs"), "cancelled waiter should leave the queue")
+
+	assert.Nil(t, holder.Release(ctx, "jobs"), "error should be nil")
+	assert.Nil(t, <-acquired, "waiter should acquire once permits are released")
+	assert.Equal(t, 0, waiting(local, "jobs"), "acquirer should leave the queue")
+}
+
+func TestSemaphoreStarvationAlert(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	holder := NewSemaphore(client, "locks", 1, time.Second*10)
+	assert.Nil(t, holder.Acquire(ctx, "jobs", 1), "error should be nil")
+
+	events := make(chan Event, 10)
+	starved := NewSemaphore(client, "locks", 1, time.Second*10, WithSemaphoreStarvationAlert(time.Millisecond*50, func(e Event) { events <- e }))
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Millisecond*300)
+	defer waitCancel()
+	assert.ErrorIs(t, starved.Acquire(waitCtx, "jobs", 1), context.DeadlineExceeded, "permits should stay held")
+	close(events)
+
+	var escalations []int
+	for e := range events {
+		assert.Equal(t, EventStarving, e.Type, "waiter should be reported starving")
+		assert.Equal(t, "jobs", e.Lock, "event should name the semaphore")
+		assert.GreaterOrEqual(t, e.Elapsed, time.Millisecond*50<<(e.Escalation-1), "reports should come as the wait doubles")
+		escalations = append(escalations, e.Escalation)
+	}
+	assert.Equal(t, []int{1, 2, 3}, escalations, "reports should escalate at 50ms, 100ms and 200ms")
+}
+
+// stallingReads is a MemoryClient whose reads of one item wait for release.
+type stallingReads struct {
+	*MemoryClient
+	name    string
+	release chan struct{}
+}
+
+func (c stallingReads) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if key, _ := params.Key["name"].(*dynamodbtypes.AttributeValueMemberS); key != nil && key.Value == c.name {
+		<-c.release
+	}
+	return c.MemoryClient.GetItem(ctx, params, optFns...)
+}
+
+func TestWaiterRecordsDoNotBlockOtherNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := stallingReads{NewMemoryClient(), semaphorePrefix + waiterPrefix + "slow", make(chan struct{})}
+	s := NewSemaphore(client, "locks", 1, time.Second*10, WithMaxSemaphoreWaiters(0, 1))
+
+	slow := make(chan error, 1)
+	go func() {
+		leave, err := s.waiters.join(ctx, "slow")
+		if err == nil {
+			leave()
+		}
+		slow <- err
+	}()
+	assert.Eventually(t, func() bool { return waiting(s, "slow") == 1 }, time.Second, time.Millisecond*10, "acquirer should wait")
+
+	joined := make(chan error, 1)
+	go func() {
+		leave, err := s.waiters.join(ctx, "fast")
+		if err == nil {
+			leave()
+		}
+		joined <- err
+	}()
+	select {
+	case err := <-joined:
+		assert.Nil(t, err, "error should be nil")
+	case <-time.After(time.Second):
+		t.Fatal("a slow waiter record should not hold up other names")
+	}
+	close(client.release)
+	assert.Nil(t, <-slow, "error should be nil")
+	assert.Equal(t, 0, waiting(s, "slow"), "acquirer should leave the queue")
+}
@@ -0,0 +1,47 @@
+package infra
+
+import (
+	"time"
+)
+
+// WithWatchdog enables a watchdog that raises EventHeartbeatStalled when the
+// heartbeater hasn't completed a tick within factor heartbeat intervals, which
+// usually means it is stuck on a hung DynamoDB call and leases are about to
+// lapse.
+func WithWatchdog(factor int) Option {
+	return func(l *Locker) {
+		l.watchdogFactor = factor
+	}
+}
+
+// beat records that the heartbeater completed a tick.
+func (l *Locker) beat() {
+	l.lastBeat.Store(time.Now().UnixNano())
+}
+
+func (l *Locker) watchdog(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(l.interval.Load()))
+	defer ticker.Stop()
+	stalled := false
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			interval := time.Duration(l.interval.Load())
+			ticker.Reset(interval)
+			elapsed := time.Since(time.Unix(0, l.lastBeat.Load()))
+			if elapsed > time.Duration(l.watchdogFactor)*interval {
+				if !stalled {
+					l.heartbeatLogger.Warn("Heartbeater stalled", "elapsed", elapsed, "interval", interval)
+					l.emit(Event{Type: EventHeartbeatStalled, Elapsed: elapsed})
+				}
+				stalled = true
+			} else if stalled {
+				l.heartbeatLogger.Info("Heartbeater recovered", "elapsed", elapsed)
+				l.emit(Event{Type: EventHeartbeatRecovered, Elapsed: elapsed})
+				stalled = false
+			}
+		}
+	}
+}
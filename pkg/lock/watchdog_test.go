@@ -0,0 +1,37 @@
+package infra
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdogReportsStall(t *testing.T) {
+	events := make(chan Event, 10)
+	l := &Locker{heartbeatLogger: slog.Default(), watchdogFactor: 2}
+	WithEventHandler(func(e Event) { events <- e })(l)
+	l.interval.Store(int64(10 * time.Millisecond))
+	l.lastBeat.Store(time.Now().Add(-time.Second).UnixNano())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go l.watchdog(stop)
+
+	select {
+	case e := <-events:
+		assert.Equal(t, EventHeartbeatStalled, e.Type, "stall should be reported")
+	case <-time.After(time.Second):
+		t.Fatal("no stall event")
+	}
+
+	l.beat()
+	select {
+	case e := <-events:
+		assert.Equal(t, EventHeartbeatRecovered, e.Type, "recovery should be reported")
+	case <-time.After(time.Second):
+		t.Fatal("no recovery event")
+	}
+}
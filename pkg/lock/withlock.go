@@ -0,0 +1,47 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WithLock waits for the named lock like WaitForLock, runs fn while holding
+// it and releases it when fn returns, even if fn panics. The context passed
+// to fn is the lock's Context, cancelled if the lock is lost before fn
+// returns, so fn can stop work the lock no longer guards.
+//
+// Calls sharing a Locker take turns: the table can't tell them apart, so each
+// waits for the others using the same name to release it before acquiring.
+//
+// WithLock returns the error from fn. If fn succeeded but the lock was lost
+// or couldn't be released, it returns that error instead.
+func (l *Locker) WithLock(ctx context.Context, name string, lease time.Duration, fn func(ctx context.Context) error) (err error) {
+	if err := l.lockName(ctx, name); err != nil {
+		return err
+	}
+	defer l.unlockName(name)
+	if err := l.WaitForLock(ctx, name, lease); err != nil {
+		return err
+	}
+	h := l.Handle(name)
+	if h == nil {
+		return fmt.Errorf("lock %s lost before it could be used : %w", name, ErrNotHeld)
+	}
+	fnCtx, cancel := h.Context(ctx)
+	defer cancel()
+	defer func() {
+		// The caller's context may be what ended fn, so don't let it stop the
+		// release as well.
+		relErr := h.Release(context.Background())
+		switch {
+		case err != nil:
+		case errors.Is(relErr, ErrNotHeld):
+			err = fmt.Errorf("lock %s lost while held : %w", name, ErrNotHeld)
+		case relErr != nil:
+			err = relErr
+		}
+	}()
+	return fn(fnCtx)
+}
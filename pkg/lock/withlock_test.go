@@ -0,0 +1,87 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewMemoryClient()
+	s := NewManualScheduler()
+	l := NewLocker(client, ctx, "locks", WithScheduler(func(time.Duration) Scheduler { return s }))
+
+	failed := errors.New("failed")
+	err := l.WithLock(ctx, "job", time.Second*10, func(ctx context.Context) error {
+		assert.Equal(t, []string{"job"}, l.heldNames(), "the lock should be held while fn runs")
+		return failed
+	})
+	assert.ErrorIs(t, err, failed, "the error from fn should be returned")
+	assert.Empty(t, l.heldNames(), "the lock should be released after fn")
+
+	assert.Panics(t, func() {
+		l.WithLock(ctx, "job", time.Second*10, func(context.Context) error { panic("boom") })
+	}, "a panic in fn should propagate")
+	assert.Empty(t, l.heldNames(), "the lock should be released after a panic")
+
+	err = l.WithLock(ctx, "job", time.Second*10, func(ctx context.Context) error {
+		client.PutItem(ctx, &dynamodb.PutItemInput{
+			Item: map[string]dynamodbtypes.AttributeValue{
+				"name":     &dynamodbtypes.AttributeValueMemberS{Value: "job"},
+				"lockerId": &dynamodbtypes.AttributeValueMemberS{Value: "someone-else"},
+			},
+			TableName: aws.String("locks"),
+		})
+		s.Tick(time.Now())
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("losing the lock should cancel fn's context")
+		}
+		assert.ErrorIs(t, context.Cause(ctx), ErrNotHeld, "the cause should say the lock was lost")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrNotHeld, "a lost lock should be reported")
+}
+
+func TestWithLockSharedLocker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewLocker(NewMemoryClient(), ctx, "locks")
+
+	var inside atomic.Int32
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := l.WithLock(ctx, "job", time.Second*10, func(ctx context.Context) error {
+				assert.Equal(t, int32(1), inside.Add(1), "only one call should run fn at a time")
+				time.Sleep(time.Millisecond * 5)
+				inside.Add(-1)
+				assert.Nil(t, ctx.Err(), "another call's release should not end the lock")
+				return nil
+			})
+			assert.Nil(t, err, "error should be nil")
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, l.heldNames(), "the lock should be released after the last call")
+
+	waiting, stop := context.WithCancel(ctx)
+	assert.Nil(t, l.lockName(ctx, "job"), "error should be nil")
+	stop()
+	err := l.WithLock(waiting, "job", time.Second*10, func(context.Context) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled, "a call waiting its turn should stop with its context")
+	l.unlockName("job")
+}
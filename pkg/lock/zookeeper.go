@@ -0,0 +1,268 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ZKStat is the part of a znode's stat that ZooKeeperBackend uses.
+type ZKStat struct {
+	Version int32
+	Czxid   int64
+}
+
+// ZKConn is the subset of a ZooKeeper session that ZooKeeperBackend needs,
+// so it works without tying this package to a client library. It maps onto
+// github.com/go-zookeeper/zk's Conn, with errors such as zk.ErrNodeExists,
+// zk.ErrNoNode and zk.ErrBadVersion reported as false rather than returned.
+type ZKConn interface {
+	// Create creates a znode, ephemeral to the session if asked and creating
+	// missing parents, reporting false if it exists.
+	Create(path string, data []byte, ephemeral bool) (bool, error)
+	// Get returns a znode's data, reporting false if it doesn't exist.
+	Get(path string) ([]byte, ZKStat, bool, error)
+	// Set replaces a znode's data if it is at version, or any version if
+	// version is -1, reporting false if it isn't or doesn't exist.
+	Set(path string, data []byte, version int32) (bool, error)
+	// Delete deletes a znode at version, reporting false if it isn't or
+	// doesn't exist.
+	Delete(path string, version int32) (bool, error)
+	// Children returns the names of a znode's children, or none if it
+	// doesn't exist.
+	Children(path string) ([]string, error)
+	// ExistsW reports whether a znode exists, and watches it, closing the
+	// returned channel once it is created, changed or deleted.
+	ExistsW(path string) (bool, <-chan struct{}, error)
+}
+
+// zkLock is the data of a lock znode.
+type zkLock struct {
+	Owner       string `json:"owner"`
+	TraceId     string `json:"traceId,omitempty"`
+	ExpiresAtMs int64  `json:"expiresAtMs"`
+}
+
+// ZooKeeperBackend is a Backend storing locks in ZooKeeper as ephemeral
+// znodes, so a lock is freed as soon as the session holding it ends, and
+// otherwise once its lease lapses. Fencing tokens are the zxid that created
+// the znode, which grows across holders. Data is kept in a persistent znode
+// that outlives the lock. It implements ReleaseWatcher, so WaitForLock
+// retries as soon as a lock's znode is deleted.
+//
+// Every Locker sharing the backend shares its session, so a lost session
+// frees all of their locks.
+type ZooKeeperBackend struct {
+	conn ZKConn
+	root string
+}
+
+var (
+	_ Backend        = (*ZooKeeperBackend)(nil)
+	_ ReleaseWatcher = (*ZooKeeperBackend)(nil)
+)
+
+// NewZooKeeperBackend returns a backend storing locks under the znode root,
+// "/gotrc" if empty.
+func NewZooKeeperBackend(conn ZKConn, root string) *ZooKeeperBackend {
+	if root == "" {
+		root = "/gotrc"
+	}
+	return &ZooKeeperBackend{conn: conn, root: root}
+}
+
+// Lock names are escaped so names containing slashes don't nest znodes.
+func (b *ZooKeeperBackend) lockPath(name string) string {
+	return b.root + "/locks/" + url.QueryEscape(name)
+}
+
+func (b *ZooKeeperBackend) dataPath(name string) string {
+	return b.root + "/data/" + url.QueryEscape(name)
+}
+
+// zkAcquireAttempts bounds how often AcquireItem retries after racing
+// another acquirer for a lapsed lock.
+const zkAcquireAttempts = 3
+
+func (b *ZooKeeperBackend) AcquireItem(ctx context.Context, req LockInfo, lease time.Duration) (LockInfo, bool, error) {
+	now := time.Now()
+	value, err := json.Marshal(zkLock{Owner: req.LockerId, TraceId: req.TraceId, ExpiresAtMs: now.Add(lease).UnixMilli()})
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("encoding lock %s : %w", req.Name, err)
+	}
+	path := b.lockPath(req.Name)
+	acquired := false
+	for attempt := 0; attempt < zkAcquireAttempts && !acquired; attempt++ {
+		if acquired, err = b.conn.Create(path, value, true); err != nil || acquired {
+			break
+		}
+		var current zkLock
+		var stat ZKStat
+		var found bool
+		if current, stat, found, err = b.get(req.Name); err != nil {
+			return LockInfo{}, false, err
+		}
+		switch {
+		case !found:
+		case current.Owner == req.LockerId:
+			acquired, err = b.conn.Set(path, value, stat.Version)
+		case current.ExpiresAtMs < now.UnixMilli():
+			// The holder's session is alive but its lease lapsed
+			_, err = b.conn.Delete(path, stat.Version)
+		default:
+			return LockInfo{}, false, nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("acquiring lock %s : %w", req.Name, err)
+	}
+	if !acquired {
+		return LockInfo{}, false, nil
+	}
+	if req.Data != nil {
+		if err := b.putData(req.Name, req.Data); err != nil {
+			return LockInfo{}, false, b.abandon(req, err)
+		}
+	}
+	item, _, err := b.GetItem(ctx, req.Name)
+	if err != nil {
+		return LockInfo{}, false, b.abandon(req, err)
+	}
+	return item, true, nil
+}
+
+// abandon deletes the lock znode taken for req when AcquireItem fails after
+// taking it, so the lock isn't left held until the session ends, and returns
+// err.
+func (b *ZooKeeperBackend) abandon(req LockInfo, err error) error {
+	// The caller's context may be what failed
+	b.ReleaseItem(context.Background(), req.Name, req.LockerId)
+	return err
+}
+
+func (b *ZooKeeperBackend) RenewItem(ctx context.Context, name, owner string, lease time.Duration) (bool, error) {
+	current, stat, found, err := b.get(name)
+	if err != nil || !found || current.Owner != owner {
+		return false, err
+	}
+	current.ExpiresAtMs = time.Now().Add(lease).UnixMilli()
+	value, err := json.Marshal(current)
+	if err != nil {
+		return false, fmt.Errorf("encoding lock %s : %w", name, err)
+	}
+	ok, err := b.conn.Set(b.lockPath(name), value, stat.Version)
+	if err != nil {
+		return false, fmt.Errorf("renewing lock %s : %w", name, err)
+	}
+	return ok, nil
+}
+
+func (b *ZooKeeperBackend) ReleaseItem(ctx context.Context, name, owner string) error {
+	current, stat, found, err := b.get(name)
+	if err != nil {
+		return err
+	}
+	if !found || current.Owner != owner {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	ok, err := b.conn.Delete(b.lockPath(name), stat.Version)
+	if err != nil {
+		return fmt.Errorf("releasing lock %s : %w", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("releasing lock %s : %w", name, ErrNotHeld)
+	}
+	return nil
+}
+
+func (b *ZooKeeperBackend) GetItem(ctx context.Context, name string) (LockInfo, bool, error) {
+	current, stat, found, err := b.get(name)
+	if err != nil || !found {
+		return LockInfo{Name: name}, false, err
+	}
+	info := LockInfo{Name: name, LockerId: current.Owner, TraceId: current.TraceId,
+		ExpiresAt: time.UnixMilli(current.ExpiresAtMs), FencingToken: stat.Czxid}
+	data, _, hasData, err := b.conn.Get(b.dataPath(name))
+	if err != nil {
+		return LockInfo{}, false, fmt.Errorf("reading data of lock %s : %w", name, err)
+	}
+	if hasData {
+		info.Data = data
+	}
+	return info, true, nil
+}
+
+func (b *ZooKeeperBackend) ListItems(ctx context.Context) ([]LockInfo, error) {
+	children, err := b.conn.Children(b.root + "/locks")
+	if err != nil {
+		return nil, fmt.Errorf("listing locks : %w", err)
+	}
+	var infos []LockInfo
+	for _, child := range children {
+		name, err := url.QueryUnescape(child)
+		if err != nil {
+			return nil, fmt.Errorf("listing locks : %w", err)
+		}
+		info, found, err := b.GetItem(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// WatchRelease watches the lock's znode, closing the channel straight away
+// if it is already gone.
+func (b *ZooKeeperBackend) WatchRelease(ctx context.Context, name string) (<-chan struct{}, error) {
+	exists, changed, err := b.conn.ExistsW(b.lockPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("watching lock %s : %w", name, err)
+	}
+	if !exists {
+		gone := make(chan struct{})
+		close(gone)
+		return gone, nil
+	}
+	return changed, nil
+}
+
+// get reads and decodes the named lock znode.
+func (b *ZooKeeperBackend) get(name string) (zkLock, ZKStat, bool, error) {
+	var current zkLock
+	value, stat, found, err := b.conn.Get(b.lockPath(name))
+	if err != nil {
+		return current, stat, false, fmt.Errorf("reading lock %s : %w", name, err)
+	}
+	if !found {
+		return current, stat, false, nil
+	}
+	if err := json.Unmarshal(value, &current); err != nil {
+		return current, stat, false, fmt.Errorf("decoding lock %s : %w", name, err)
+	}
+	return current, stat, true, nil
+}
+
+// putData writes the lock's data znode, creating it the first time.
+func (b *ZooKeeperBackend) putData(name string, data []byte) error {
+	path := b.dataPath(name)
+	for {
+		ok, err := b.conn.Set(path, data, -1)
+		if err == nil && !ok {
+			ok, err = b.conn.Create(path, data, false)
+		}
+		if err != nil {
+			return fmt.Errorf("storing data of lock %s : %w", name, err)
+		}
+		if ok {
+			return nil
+		}
+	}
+}
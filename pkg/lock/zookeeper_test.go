@@ -0,0 +1,213 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeZNode struct {
+	data      []byte
+	stat      ZKStat
+	ephemeral bool
+}
+
+// fakeZK keeps znodes in memory for a single session.
+type fakeZK struct {
+	mu      sync.Mutex
+	zxid    int64
+	nodes   map[string]*fakeZNode
+	watches map[string][]chan struct{}
+}
+
+func newFakeZK() *fakeZK {
+	return &fakeZK{nodes: map[string]*fakeZNode{}, watches: map[string][]chan struct{}{}}
+}
+
+func (z *fakeZK) fire(path string) {
+	for _, ch := range z.watches[path] {
+		close(ch)
+	}
+	delete(z.watches, path)
+}
+
+func (z *fakeZK) Create(path string, data []byte, ephemeral bool) (bool, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if _, ok := z.nodes[path]; ok {
+		return false, nil
+	}
+	z.zxid++
+	z.nodes[path] = &fakeZNode{data: data, stat: ZKStat{Czxid: z.zxid}, ephemeral: ephemeral}
+	z.fire(path)
+	return true, nil
+}
+
+func (z *fakeZK) Get(path string) ([]byte, ZKStat, bool, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	n, ok := z.nodes[path]
+	if !ok {
+		return nil, ZKStat{}, false, nil
+	}
+	return n.data, n.stat, true, nil
+}
+
+func (z *fakeZK) Set(path string, data []byte, version int32) (bool, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	n, ok := z.nodes[path]
+	if !ok || version != -1 && n.stat.Version != version {
+		return false, nil
+	}
+	n.data = data
+	n.stat.Version++
+	z.fire(path)
+	return true, nil
+}
+
+func (z *fakeZK) Delete(path string, version int32) (bool, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	n, ok := z.nodes[path]
+	if !ok || n.stat.Version != version {
+		return false, nil
+	}
+	delete(z.nodes, path)
+	z.fire(path)
+	return true, nil
+}
+
+func (z *fakeZK) Children(path string) ([]string, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var children []string
+	for p := range z.nodes {
+		if strings.HasPrefix(p, path+"/") {
+			children = append(children, p[len(path)+1:])
+		}
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+func (z *fakeZK) ExistsW(path string) (bool, <-chan struct{}, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	ch := make(chan struct{})
+	z.watches[path] = append(z.watches[path], ch)
+	_, ok := z.nodes[path]
+	return ok, ch, nil
+}
+
+// expireSession deletes the session's ephemeral znodes, as ZooKeeper does
+// when a session ends.
+func (z *fakeZK) expireSession() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for path, n := range z.nodes {
+		if n.ephemeral {
+			delete(z.nodes, path)
+			z.fire(path)
+		}
+	}
+}
+
+func TestZooKeeperBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := newFakeZK()
+	backend := NewZooKeeperBackend(conn, "")
+	n := NewBackendLocker(backend, ctx)
+	b := NewBackendLocker(backend, ctx)
+
+	h, err := n.Acquire(ctx, "jobs/x", time.Second*10, WithTraceID("trace-1"), WithData([]byte("payload")))
+	assert.Nil(t, err, "error should be nil")
+	if !assert.NotNil(t, h, "lock should be acquired") {
+		return
+	}
+	token := h.FencingToken()
+	assert.NotZero(t, token, "the creating zxid should be the fencing token")
+	ok, err := b.AcquireLock("jobs/x", time.Second*10)
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, ok, "held lock should not be acquired")
+
+	info, found, err := b.GetLockInfo(ctx, "jobs/x")
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, found, "the lock znode should be found")
+	assert.Equal(t, n.ID(), info.LockerId, "the holder should be reported")
+	assert.Equal(t, "trace-1", info.TraceId, "the trace should be stored")
+	assert.Equal(t, []byte("payload"), info.Data, "the data should be stored")
+	held, err := b.LocksHeldBy(ctx, n.ID())
+	assert.Nil(t, err, "error should be nil")
+	if assert.Len(t, held, 1, "locks should be listed by holder") {
+		assert.Equal(t, "jobs/x", held[0].Name, "listed names should be unescaped")
+	}
+	assert.ErrorIs(t, backend.ReleaseItem(ctx, "jobs/x", b.ID()), ErrNotHeld, "only the owner should release")
+
+	// The waiter's backoff is far longer than the test, so only the watch
+	// can wake it
+	w := NewBackendLocker(backend, ctx, WithWaitBackoff(time.Minute, time.Minute, 2))
+	acquired := make(chan error, 1)
+	go func() { acquired <- w.WaitForLock(ctx, "jobs/x", time.Second*10) }()
+	time.Sleep(time.Millisecond * 50)
+	assert.Nil(t, h.Release(ctx), "error should be nil")
+	select {
+	case err := <-acquired:
+		assert.Nil(t, err, "error should be nil")
+	case <-time.After(time.Second * 5):
+		t.Fatal("the waiter should be woken by the release")
+	}
+	wi, _, _ := b.GetLockInfo(ctx, "jobs/x")
+	assert.Equal(t, w.ID(), wi.LockerId, "the waiter should hold the lock")
+	assert.Greater(t, wi.FencingToken, token, "fencing tokens should grow across holders")
+
+	conn.expireSession()
+	locked, err := b.IsLocked(ctx, "jobs/x")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, locked, "locks should be freed with the session")
+}
+
+func TestZooKeeperBackendLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	backend := NewZooKeeperBackend(newFakeZK(), "")
+	_, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "a"}, time.Millisecond*20)
+	assert.Nil(t, err, "error should be nil")
+	assert.True(t, ok, "free lock should be acquired")
+	_, ok, _ = backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "b"}, time.Second)
+	assert.False(t, ok, "held lock should not be acquired")
+	time.Sleep(time.Millisecond * 30)
+	_, ok, _ = backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "b"}, time.Second)
+	assert.True(t, ok, "lock should be acquired once its lease lapses")
+	ok, _ = backend.RenewItem(ctx, "x", "a", time.Second)
+	assert.False(t, ok, "the previous holder should not renew")
+}
+
+// failingData is a fakeZK whose writes to data znodes fail.
+type failingData struct {
+	*fakeZK
+}
+
+func (z failingData) Set(path string, data []byte, version int32) (bool, error) {
+	if strings.Contains(path, "/data/") {
+		return false, errors.New("zk: connection closed")
+	}
+	return z.fakeZK.Set(path, data, version)
+}
+
+func TestZooKeeperBackendDataFailure(t *testing.T) {
+	ctx := context.Background()
+	backend := NewZooKeeperBackend(failingData{newFakeZK()}, "")
+	_, ok, err := backend.AcquireItem(ctx, LockInfo{Name: "x", LockerId: "a", Data: []byte("payload")}, time.Second*10)
+	assert.NotNil(t, err, "a failed data write should be an error")
+	assert.False(t, ok, "lock should not be acquired")
+	_, found, err := backend.GetItem(ctx, "x")
+	assert.Nil(t, err, "error should be nil")
+	assert.False(t, found, "the lock znode should be deleted")
+}